@@ -21,6 +21,8 @@ require (
 	github.com/ungerik/go3d v0.0.0-20251020194721-1bde1320d420
 	gitlab.com/gomidi/midi/v2 v2.3.16
 	golang.org/x/image v0.32.0
+	golang.org/x/sys v0.36.0
+	golang.org/x/text v0.30.0
 	honnef.co/go/curve v0.0.0-20250325031802-e021cd9ef495
 )
 
@@ -40,6 +42,4 @@ require (
 	github.com/subosito/gotenv v1.6.0 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
 	go.yaml.in/yaml/v3 v3.0.4 // indirect
-	golang.org/x/sys v0.36.0 // indirect
-	golang.org/x/text v0.30.0 // indirect
 )
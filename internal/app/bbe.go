@@ -3,26 +3,35 @@ package app
 import (
 	"bitbox-editor/internal/app/component/button"
 	"bitbox-editor/internal/app/component/canvas"
+	"bitbox-editor/internal/app/component/midilearn"
 	"bitbox-editor/internal/app/component/spectrum"
 	"bitbox-editor/internal/app/component/volume"
 	"bitbox-editor/internal/app/eventbus"
 	"bitbox-editor/internal/app/events"
 	"bitbox-editor/internal/app/font"
 	"bitbox-editor/internal/app/theme"
+	"bitbox-editor/internal/app/window/cardcheck"
 	"bitbox-editor/internal/app/window/console"
+	"bitbox-editor/internal/app/window/duplicates"
 	"bitbox-editor/internal/app/window/library"
+	"bitbox-editor/internal/app/window/midimonitor"
 	"bitbox-editor/internal/app/window/presetedit"
 	"bitbox-editor/internal/app/window/presetlist"
+	"bitbox-editor/internal/app/window/presetsync"
 	"bitbox-editor/internal/app/window/settings"
+	"bitbox-editor/internal/app/window/snapshots"
 	"bitbox-editor/internal/app/window/storage"
 	"bitbox-editor/internal/audio"
 	"bitbox-editor/internal/config"
 	"bitbox-editor/internal/logging"
+	"bitbox-editor/internal/midi"
 	"bitbox-editor/internal/preset"
 	"bitbox-editor/internal/util"
 	"fmt"
 	"image"
 	_ "image/png"
+	"path/filepath"
+	"strings"
 
 	"github.com/AllenDang/cimgui-go/backend"
 	"github.com/AllenDang/cimgui-go/backend/glfwbackend"
@@ -33,6 +42,10 @@ import (
 )
 
 var log = logging.NewLogger("bbe")
+
+// learnVolume is the MIDI learn target ID of the toolbar volume control
+const learnVolume = "volume"
+
 var windowClass *imgui.WindowClass
 
 func init() {
@@ -46,12 +59,17 @@ type BitboxEditor struct {
 	uuid        string
 
 	Window struct {
-		Settings *settings.SettingsWindow
-		Console  *console.ConsoleWindow
-		Storage  *storage.StorageWindow
-		Presets  *presetlist.PresetListWindow
-		Library  *library.LibraryWindow
-		Editors  []*presetedit.PresetEditWindow
+		Settings   *settings.SettingsWindow
+		Console    *console.ConsoleWindow
+		Storage    *storage.StorageWindow
+		Presets    *presetlist.PresetListWindow
+		Library    *library.LibraryWindow
+		Monitor    *midimonitor.MidiMonitorWindow
+		Sync       *presetsync.SyncWindow
+		Snapshots  *snapshots.SnapshotsWindow
+		CardCheck  *cardcheck.CardCheckWindow
+		Duplicates *duplicates.DuplicatesWindow
+		Editors    []*presetedit.PresetEditWindow
 	}
 
 	Modal struct{}
@@ -64,6 +82,7 @@ type BitboxEditor struct {
 	presetsButton *button.Button
 	consoleButton *button.Button
 	libraryButton *button.Button
+	learnButton   *button.Button
 
 	canvas *canvas.RenderPrimitive
 
@@ -155,7 +174,8 @@ func (b *BitboxEditor) handleUpdate(cmd UpdateCmd) {
 		return
 
 	case events.PresetEventRecord:
-		if c.EventType == events.PresetLoadEvent {
+		switch c.EventType {
+		case events.PresetLoadEvent:
 			if p, ok := c.Data.(*preset.Preset); ok && p != nil {
 				log.Debug("App received LoadPreset event, creating editor", zap.String("preset", p.Name))
 				b.SendUpdate(UpdateCmd{
@@ -163,15 +183,36 @@ func (b *BitboxEditor) handleUpdate(cmd UpdateCmd) {
 					Data: editorCreatePayload{Preset: p},
 				})
 			}
+		case events.PresetChangedEvent:
+			if folder, ok := c.Data.(string); ok {
+				for _, editor := range b.Window.Editors {
+					if p := editor.Preset(); p != nil && filepath.Clean(p.Path) == filepath.Clean(folder) {
+						editor.SetChangedOnDisk()
+					}
+				}
+			}
 		}
 		return
 
 	case events.StorageEventRecord:
-		if c.EventType == events.StorageActivatedEvent {
-			if loc, ok := c.Data.(*storage.StorageLocation); ok {
-				log.Debug("App received StorageActivated event", zap.String("path", loc.Path))
-				b.Window.Presets.SetPresetLocation(loc)
-				b.Window.Library.SetStorageLocation(loc)
+		loc, ok := c.Data.(*storage.StorageLocation)
+		if !ok {
+			return
+		}
+		switch c.EventType {
+		case events.StorageActivatedEvent:
+			log.Debug("App received StorageActivated event", zap.String("path", loc.Path))
+			b.Window.Presets.SetPresetLocation(loc)
+			b.Window.Library.SetStorageLocation(loc)
+
+		case events.StorageUnmountedEvent, events.StorageMountedEvent:
+			// Editors of a removed card stay open so nothing is lost, but can't save until
+			// the card is back
+			stale := c.EventType == events.StorageUnmountedEvent
+			for _, editor := range b.Window.Editors {
+				if p := editor.Preset(); p != nil && isWithin(p.Path, loc.Path) {
+					editor.SetStale(stale)
+				}
 			}
 		}
 		return
@@ -205,6 +246,12 @@ func (b *BitboxEditor) handleUpdate(cmd UpdateCmd) {
 	}
 }
 
+// isWithin returns true if path is root or inside it
+func isWithin(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 func (b *BitboxEditor) afterCreateContext() {
 	implot.CreateContext()
 }
@@ -268,15 +315,37 @@ func (b *BitboxEditor) initWindows() {
 	)
 
 	audioMgr := audio.GetAudioManager()
-	// TODO: Finish building out midi manager.
-	//midiMgr := midi.GetMidiManager()
-	//log.Info("midi ports:", zap.Any("ports", midiMgr.ListPorts()))
+
+	// Play incoming MIDI notes on the pads of the focused preset
+	midi.GetPadRouter().Start()
+	midi.GetLearnManager().LoadActiveProfile()
+	if driver := config.GetMidiDriver(); driver != midi.DriverSystem {
+		midi.GetMidiManager().SetDriver(midi.NewDriver(driver))
+	}
+	if portName := config.GetMidiInputPort(); portName != "" {
+		if err := midi.GetMidiManager().StartMonitoring(portName); err != nil {
+			log.Warn("Could not open MIDI input port", zap.String("port", portName), zap.Error(err))
+		}
+	}
+	if portName := config.GetMidiOutputPort(); portName != "" {
+		if err := midi.GetMidiManager().OpenOutput(portName); err != nil {
+			log.Warn("Could not open MIDI output port", zap.String("port", portName), zap.Error(err))
+		}
+	}
+	if config.GetMidiSendClock() {
+		midi.GetMidiManager().StartClock(0)
+	}
 
 	b.Window.Settings = settings.NewSettingsWindow()
 	b.Window.Console = console.NewConsoleWindow()
 	b.Window.Storage = storage.NewStorageWindow()
 	b.Window.Presets = presetlist.NewPresetListWindow()
 	b.Window.Library = library.NewLibraryWindow()
+	b.Window.Monitor = midimonitor.NewMidiMonitorWindow()
+	b.Window.Sync = presetsync.NewSyncWindow(b.Window.Storage.Locations)
+	b.Window.Snapshots = snapshots.NewSnapshotsWindow(b.Window.Storage.Locations)
+	b.Window.CardCheck = cardcheck.NewCardCheckWindow(b.Window.Storage.Locations)
+	b.Window.Duplicates = duplicates.NewDuplicatesWindow(b.Window.Storage.Locations)
 
 	b.Window.Editors = make([]*presetedit.PresetEditWindow, 0)
 
@@ -319,13 +388,34 @@ func (b *BitboxEditor) initWindows() {
 		SetRounding(theme.GetCurrentTheme().Style.FrameRounding * 1.9).
 		SetOnClick(func() { b.Window.Library.ToggleOpen() })
 
+	b.learnButton = button.NewButtonWithID(imgui.IDStr("toolbar_midi_learn"), font.Icon("Cable")).
+		SetFixedSize(buttonSize, buttonSize).
+		SetPadding(theme.GetCurrentTheme().Style.FramePadding[0]).
+		SetRounding(theme.GetCurrentTheme().Style.FrameRounding * 1.9).
+		SetToggledColor(theme.GetCurrentTheme().Style.Colors.TabHovered.Vec4).
+		SetOnClick(func() {
+			lm := midi.GetLearnManager()
+			lm.SetLearning(!lm.IsLearning())
+		})
+
 	b.volumeControl.SetOnVolumeChange(func(volume float32) {
 		audioMgr.SetVolume(float64(volume))
 	})
 
+	midi.GetLearnManager().RegisterTarget(midi.Target{
+		ID:   learnVolume,
+		Name: "Volume",
+		Kind: midi.ControlContinuous,
+		Get:  audioMgr.GetVolume,
+		Set:  audioMgr.SetVolume,
+	})
+
 	eventbus.Bus.Subscribe(events.AudioVolumeChangedKey, b.uuid, b.eventSub)
 	eventbus.Bus.Subscribe(events.StorageActivatedEventKey, b.uuid, b.eventSub)
+	eventbus.Bus.Subscribe(events.StorageMountedEventKey, b.uuid, b.eventSub)
+	eventbus.Bus.Subscribe(events.StorageUnmountedEventKey, b.uuid, b.eventSub)
 	eventbus.Bus.Subscribe(events.PresetLoadEventKey, b.uuid, b.eventSub)
+	eventbus.Bus.Subscribe(events.PresetChangedEventKey, b.uuid, b.eventSub)
 	eventbus.Bus.Subscribe(events.WindowCloseEventKey, b.uuid, b.eventSub)
 	eventbus.Bus.Subscribe(events.WindowDestroyEventKey, b.uuid, b.eventSub)
 }
@@ -345,6 +435,21 @@ func (b *BitboxEditor) menu() {
 			imgui.EndMenu()
 		}
 		if imgui.BeginMenu("View") {
+			if imgui.MenuItemBoolV("MIDI Monitor", "", b.Window.Monitor.IsOpen(), true) {
+				b.Window.Monitor.ToggleOpen()
+			}
+			if imgui.MenuItemBoolV("Sync", "", b.Window.Sync.IsOpen(), true) {
+				b.Window.Sync.ToggleOpen()
+			}
+			if imgui.MenuItemBoolV("Snapshots", "", b.Window.Snapshots.IsOpen(), true) {
+				b.Window.Snapshots.ToggleOpen()
+			}
+			if imgui.MenuItemBoolV("Card Check", "", b.Window.CardCheck.IsOpen(), true) {
+				b.Window.CardCheck.ToggleOpen()
+			}
+			if imgui.MenuItemBoolV("Duplicates", "", b.Window.Duplicates.IsOpen(), true) {
+				b.Window.Duplicates.ToggleOpen()
+			}
 			imgui.EndMenu()
 		}
 		if len(b.Window.Editors) > 0 {
@@ -458,6 +563,7 @@ func (b *BitboxEditor) toolbar() {
 	b.presetsButton.SetToggled(b.Window.Presets.IsOpen())
 	b.consoleButton.SetToggled(b.Window.Console.IsOpen())
 	b.libraryButton.SetToggled(b.Window.Library.IsOpen())
+	b.learnButton.SetToggled(midi.GetLearnManager().IsLearning())
 
 	if isVertical {
 		// Vertical toolbar layout (left/right)
@@ -469,6 +575,8 @@ func (b *BitboxEditor) toolbar() {
 		b.presetsButton.Build()
 		b.consoleButton.Build()
 		b.libraryButton.Build()
+		b.learnButton.Build()
+		b.learnButtonTooltip()
 
 		if b.spectrumAnalyzer != nil && b.volumeControl != nil {
 			availHeight := imgui.ContentRegionAvail().Y
@@ -482,6 +590,7 @@ func (b *BitboxEditor) toolbar() {
 			imgui.Dummy(imgui.Vec2{X: (toolbarSize - 30) / 2, Y: 1.0})
 			imgui.SameLine()
 			b.volumeControl.Build()
+			midilearn.Item(learnVolume)
 			imgui.EndGroup()
 
 			imgui.Dummy(imgui.Vec2{X: 1, Y: 32.0})
@@ -502,6 +611,9 @@ func (b *BitboxEditor) toolbar() {
 		imgui.SameLine()
 		b.libraryButton.Build()
 		imgui.SameLine()
+		b.learnButton.Build()
+		b.learnButtonTooltip()
+		imgui.SameLine()
 
 		if b.spectrumAnalyzer != nil && b.volumeControl != nil {
 			availWidth := imgui.ContentRegionAvail().X
@@ -515,6 +627,7 @@ func (b *BitboxEditor) toolbar() {
 			imgui.BeginGroup()
 			imgui.Dummy(imgui.Vec2{X: 1.0, Y: (toolbarSize - 30) / 2})
 			b.volumeControl.Build()
+			midilearn.Item(learnVolume)
 			imgui.EndGroup()
 			imgui.SameLine()
 
@@ -526,6 +639,18 @@ func (b *BitboxEditor) toolbar() {
 	}
 }
 
+// learnButtonTooltip explains the MIDI learn toggle
+func (b *BitboxEditor) learnButtonTooltip() {
+	if !imgui.IsItemHovered() {
+		return
+	}
+	if midi.GetLearnManager().IsLearning() {
+		imgui.SetTooltip("MIDI Learn: click a control, then move a knob to bind it")
+	} else {
+		imgui.SetTooltip("MIDI Learn")
+	}
+}
+
 func (b *BitboxEditor) dockspace() {
 	viewport := imgui.MainViewport()
 
@@ -652,6 +777,21 @@ func (b *BitboxEditor) loop() {
 	if b.Window.Library.IsOpen() {
 		b.Window.Library.Build()
 	}
+	if b.Window.Monitor.IsOpen() {
+		b.Window.Monitor.Build()
+	}
+	if b.Window.Sync.IsOpen() {
+		b.Window.Sync.Build()
+	}
+	if b.Window.Snapshots.IsOpen() {
+		b.Window.Snapshots.Build()
+	}
+	if b.Window.CardCheck.IsOpen() {
+		b.Window.CardCheck.Build()
+	}
+	if b.Window.Duplicates.IsOpen() {
+		b.Window.Duplicates.Build()
+	}
 
 	for _, editWindow := range currentEditors {
 		if editWindow != nil {
@@ -706,4 +846,7 @@ func (b *BitboxEditor) Run() {
 	}
 
 	b.backend.Run(b.loop)
+
+	// Library indexes save a few seconds after they change, don't lose the last changes
+	audio.SaveLibraryIndexes()
 }
@@ -0,0 +1,264 @@
+package meter
+
+import (
+	"bitbox-editor/internal/app/component"
+	"bitbox-editor/internal/app/theme"
+	"bitbox-editor/internal/audio"
+	"bitbox-editor/internal/logging"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/AllenDang/cimgui-go/imgui"
+	"go.uber.org/zap"
+)
+
+var log = logging.NewLogger("meter")
+
+const (
+	// meterMinDB is the level shown at the bottom of the meter
+	meterMinDB = -60.0
+
+	// peakHoldTime is how long the peak hold marker stays before falling
+	peakHoldTime = 1500 * time.Millisecond
+
+	// peakDecayDBPerSec is how fast the level bars fall once the signal drops
+	peakDecayDBPerSec = 24.0
+)
+
+// channelState holds the smoothed level and peak hold of one channel
+type channelState struct {
+	levelDB  float64
+	holdDB   float64
+	holdTime time.Time
+}
+
+// update moves the channel towards a new peak, holding the highest recent peak
+func (cs *channelState) update(peak float64, now time.Time, dt float64) {
+	db := linearToDB(peak)
+
+	fallen := cs.levelDB - peakDecayDBPerSec*dt
+	if db > fallen {
+		cs.levelDB = db
+	} else {
+		cs.levelDB = math.Max(fallen, meterMinDB)
+	}
+
+	if db >= cs.holdDB || now.Sub(cs.holdTime) > peakHoldTime {
+		cs.holdDB = db
+		cs.holdTime = now
+	}
+}
+
+// ChannelMeterComponent shows left/right peak levels and the stereo correlation of the
+// audio that is currently playing
+type ChannelMeterComponent struct {
+	*component.Component[*ChannelMeterComponent]
+
+	left, right channelState
+	lastUpdate  time.Time
+	levels      audio.ChannelLevels
+}
+
+// NewChannelMeter creates a new channel meter component with default settings
+func NewChannelMeter() *ChannelMeterComponent {
+	return NewChannelMeterWithID(imgui.IDStr("##channel_meter"))
+}
+
+// NewChannelMeterWithID creates a new channel meter with a specific ID
+func NewChannelMeterWithID(id imgui.ID) *ChannelMeterComponent {
+	t := theme.GetCurrentTheme()
+
+	cm := &ChannelMeterComponent{
+		left:   channelState{levelDB: meterMinDB, holdDB: meterMinDB},
+		right:  channelState{levelDB: meterMinDB, holdDB: meterMinDB},
+		levels: audio.ChannelLevels{Correlation: 1},
+	}
+
+	cm.Component = component.NewComponent[*ChannelMeterComponent](id, cm.HandleUpdate)
+	cm.Component.SetLayoutBuilder(cm)
+
+	cm.SetWidth(120)
+	cm.SetHeight(16)
+	cm.SetRounding(2)
+	cm.SetTrackColor(t.Style.Colors.FrameBg.Vec4)
+
+	return cm
+}
+
+// SetWidth sets the width of the meter
+func (cm *ChannelMeterComponent) SetWidth(width float32) *ChannelMeterComponent {
+	cm.Component.SetWidth(width)
+	return cm
+}
+
+// SetHeight sets the total height of both meter bars
+func (cm *ChannelMeterComponent) SetHeight(height float32) *ChannelMeterComponent {
+	cm.Component.SetHeight(height)
+	return cm
+}
+
+// SetTrackColor sets the color behind the level bars
+func (cm *ChannelMeterComponent) SetTrackColor(color imgui.Vec4) *ChannelMeterComponent {
+	cm.Component.SetProgressBgColor(color)
+	return cm
+}
+
+// Levels returns the levels shown in the last frame
+func (cm *ChannelMeterComponent) Levels() audio.ChannelLevels {
+	return cm.levels
+}
+
+func (cm *ChannelMeterComponent) HandleUpdate(cmd component.UpdateCmd) {
+	if cm.Component.HandleGlobalUpdate(cmd) {
+		return
+	}
+
+	log.Warn("ChannelMeterComponent unhandled update", zap.String("id", cm.IDStr()), zap.Any("cmd", cmd))
+}
+
+func (cm *ChannelMeterComponent) Layout() {
+	cm.Component.ProcessUpdates()
+
+	now := time.Now()
+	dt := 0.0
+	if !cm.lastUpdate.IsZero() {
+		dt = now.Sub(cm.lastUpdate).Seconds()
+	}
+	cm.lastUpdate = now
+
+	cm.levels = audio.GetAudioManager().GetChannelLevels()
+	cm.left.update(cm.levels.PeakL, now, dt)
+	cm.right.update(cm.levels.PeakR, now, dt)
+
+	t := theme.GetCurrentTheme()
+	width := cm.Component.Width()
+	height := cm.Component.Height()
+	rounding := cm.Component.Rounding()
+	trackColor := imgui.ColorU32Vec4(cm.Component.ProgressBg())
+
+	pos := imgui.CursorScreenPos()
+	imgui.InvisibleButtonV("##channel_meter_"+strconv.Itoa(int(cm.ID())), imgui.Vec2{X: width, Y: height}, imgui.ButtonFlagsNone)
+	hovered := imgui.IsItemHovered()
+
+	dl := imgui.WindowDrawList()
+
+	// Two level bars on top, a thin correlation strip underneath
+	corrHeight := float32(3)
+	barGap := float32(1)
+	barHeight := (height - corrHeight - barGap*2) / 2
+
+	for i, ch := range []channelState{cm.left, cm.right} {
+		top := pos.Y + float32(i)*(barHeight+barGap)
+		bottom := top + barHeight
+
+		dl.AddRectFilledV(
+			imgui.Vec2{X: pos.X, Y: top},
+			imgui.Vec2{X: pos.X + width, Y: bottom},
+			trackColor,
+			rounding,
+			imgui.DrawFlagsNone,
+		)
+
+		fill := dbToFraction(ch.levelDB)
+		if fill > 0 {
+			dl.AddRectFilledV(
+				imgui.Vec2{X: pos.X, Y: top},
+				imgui.Vec2{X: pos.X + width*fill, Y: bottom},
+				imgui.ColorU32Vec4(levelColor(ch.levelDB)),
+				rounding,
+				imgui.DrawFlagsNone,
+			)
+		}
+
+		if hold := dbToFraction(ch.holdDB); hold > 0 {
+			x := pos.X + width*hold
+			dl.AddLineV(
+				imgui.Vec2{X: x, Y: top},
+				imgui.Vec2{X: x, Y: bottom},
+				imgui.ColorU32Vec4(levelColor(ch.holdDB)),
+				1.5,
+			)
+		}
+	}
+
+	// Correlation strip: center is 0, right is +1 (mono), left is -1 (out of phase)
+	corrTop := pos.Y + 2*(barHeight+barGap)
+	corrBottom := corrTop + corrHeight
+	center := pos.X + width/2
+	dl.AddRectFilledV(
+		imgui.Vec2{X: pos.X, Y: corrTop},
+		imgui.Vec2{X: pos.X + width, Y: corrBottom},
+		trackColor,
+		0,
+		imgui.DrawFlagsNone,
+	)
+
+	corrX := center + float32(cm.levels.Correlation)*width/2
+	corrColor := imgui.Vec4{X: 0.3, Y: 0.8, Z: 0.4, W: 1}
+	if cm.levels.Correlation < 0 {
+		corrColor = imgui.Vec4{X: 0.9, Y: 0.3, Z: 0.25, W: 1}
+	}
+	dl.AddRectFilledV(
+		imgui.Vec2{X: float32(math.Min(float64(center), float64(corrX))), Y: corrTop},
+		imgui.Vec2{X: float32(math.Max(float64(center), float64(corrX))), Y: corrBottom},
+		imgui.ColorU32Vec4(corrColor),
+		0,
+		imgui.DrawFlagsNone,
+	)
+	dl.AddLineV(
+		imgui.Vec2{X: center, Y: corrTop},
+		imgui.Vec2{X: center, Y: corrBottom},
+		imgui.ColorU32Vec4(t.Style.Colors.Border.Vec4),
+		1.0,
+	)
+
+	if hovered {
+		imgui.SetTooltip(fmt.Sprintf(
+			"L: %s dB\nR: %s dB\nCorrelation: %+.2f",
+			formatDB(cm.left.holdDB),
+			formatDB(cm.right.holdDB),
+			cm.levels.Correlation,
+		))
+	}
+}
+
+// Destroy cleans up the component
+func (cm *ChannelMeterComponent) Destroy() {
+	cm.Component.Destroy()
+}
+
+// linearToDB converts a linear peak to dB, clamped to the bottom of the meter
+func linearToDB(peak float64) float64 {
+	if peak <= 0 {
+		return meterMinDB
+	}
+	return math.Max(20*math.Log10(peak), meterMinDB)
+}
+
+// dbToFraction maps a dB level to the filled fraction of the meter
+func dbToFraction(db float64) float32 {
+	f := (db - meterMinDB) / -meterMinDB
+	return float32(math.Max(0, math.Min(1, f)))
+}
+
+// levelColor returns green for normal levels, yellow near full scale and red when clipping
+func levelColor(db float64) imgui.Vec4 {
+	switch {
+	case db >= -0.1:
+		return imgui.Vec4{X: 0.9, Y: 0.2, Z: 0.2, W: 1}
+	case db >= -6:
+		return imgui.Vec4{X: 0.9, Y: 0.8, Z: 0.2, W: 1}
+	default:
+		return imgui.Vec4{X: 0.2, Y: 0.7, Z: 0.3, W: 1}
+	}
+}
+
+// formatDB formats a level for display, showing the floor as -inf
+func formatDB(db float64) string {
+	if db <= meterMinDB {
+		return "-inf"
+	}
+	return fmt.Sprintf("%.1f", db)
+}
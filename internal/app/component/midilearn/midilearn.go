@@ -0,0 +1,99 @@
+package midilearn
+
+import (
+	"bitbox-editor/internal/app/component"
+	"bitbox-editor/internal/midi"
+	"fmt"
+	"math"
+
+	"github.com/AllenDang/cimgui-go/imgui"
+)
+
+var (
+	armedColor   = imgui.Vec4{X: 0.95, Y: 0.6, Z: 0.15, W: 1.0}
+	boundColor   = imgui.Vec4{X: 0.2, Y: 0.7, Z: 0.3, W: 1.0}
+	unboundColor = imgui.Vec4{X: 0.3, Y: 0.55, Z: 0.9, W: 0.8}
+)
+
+// Item marks the last drawn item as a learnable control. In learn mode the item is
+// outlined, clicking it arms the target and the next MIDI control that moves is bound to it.
+func Item(targetID string) {
+	lm := midi.GetLearnManager()
+	if !lm.IsLearning() {
+		return
+	}
+
+	rectMin := imgui.ItemRectMin()
+	rectMax := imgui.ItemRectMax()
+	hovered := imgui.IsItemHovered()
+
+	if imgui.IsItemClicked() {
+		lm.Arm(targetID)
+	}
+
+	binding, bound := lm.BindingFor(targetID)
+	armed := lm.Armed() == targetID
+
+	col := unboundColor
+	switch {
+	case armed:
+		// Pulse while waiting for a control to move
+		col = armedColor
+		col.W = float32(0.5 + 0.5*math.Sin(imgui.Time()*8))
+	case bound:
+		col = boundColor
+	}
+
+	dl := imgui.WindowDrawList()
+	dl.AddRectV(rectMin, rectMax, imgui.ColorU32Vec4(col), 2, imgui.DrawFlagsNone, 2)
+
+	if hovered {
+		name := lm.TargetName(targetID)
+		switch {
+		case armed:
+			imgui.SetTooltip(fmt.Sprintf("%s\nMove a knob or press a key to bind it", name))
+		case bound:
+			imgui.SetTooltip(fmt.Sprintf("%s\nBound to %s, click to learn again", name, binding))
+		default:
+			imgui.SetTooltip(fmt.Sprintf("%s\nClick to learn", name))
+		}
+	}
+}
+
+// LearnableComponent wraps a component so it can be learned, e.g. a value in a table
+type LearnableComponent struct {
+	*component.Component[*LearnableComponent]
+
+	child    component.ComponentType
+	targetID string
+}
+
+// NewLearnable wraps child as the learnable control for targetID
+func NewLearnable(child component.ComponentType, targetID string) *LearnableComponent {
+	cmp := &LearnableComponent{
+		child:    child,
+		targetID: targetID,
+	}
+
+	cmp.Component = component.NewComponent[*LearnableComponent](imgui.ID(0), cmp.handleUpdate)
+	cmp.Component.SetLayoutBuilder(cmp)
+
+	return cmp
+}
+
+func (lc *LearnableComponent) handleUpdate(cmd component.UpdateCmd) {
+	lc.Component.HandleGlobalUpdate(cmd)
+}
+
+func (lc *LearnableComponent) Layout() {
+	lc.Component.ProcessUpdates()
+
+	lc.child.Build()
+	Item(lc.targetID)
+}
+
+// Destroy cleans up the wrapped component
+func (lc *LearnableComponent) Destroy() {
+	lc.child.Destroy()
+	lc.Component.Destroy()
+}
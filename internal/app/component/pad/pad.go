@@ -9,6 +9,7 @@ import (
 	"bitbox-editor/internal/audio"
 	"bitbox-editor/internal/logging"
 	"fmt"
+	"time"
 
 	"github.com/AllenDang/cimgui-go/imgui"
 	"go.uber.org/zap"
@@ -21,8 +22,13 @@ const (
 	cmdSetPadTextLines localCommand = iota
 	cmdSetPadWaveDisplayData
 	cmdSetPadCellDisplayData
+	cmdSetPadTriggered
+	cmdSetPadReleased
 )
 
+// triggerFadeTime is how long the trigger highlight takes to fade after a pad is released
+const triggerFadeTime = 250 * time.Millisecond
+
 var log = logging.NewLogger("pad")
 
 type PadCellDisplayData struct {
@@ -43,6 +49,12 @@ type PadComponent struct {
 	cellDisplayData PadCellDisplayData
 
 	editing bool
+
+	// triggerVelocity is the velocity of the last trigger, shown as a highlight while the
+	// pad is held and fading out after it is released
+	triggerVelocity float32
+	triggerHeld     bool
+	releasedAt      time.Time
 }
 
 func NewPad(id imgui.ID, row, col int, size float32) *PadComponent {
@@ -104,6 +116,16 @@ func (p *PadComponent) handleUpdate(cmd component.UpdateCmd) {
 		if data, ok := cmd.Data.(PadCellDisplayData); ok {
 			p.cellDisplayData = data
 		}
+	case cmdSetPadTriggered:
+		if velocity, ok := cmd.Data.(float32); ok {
+			p.triggerVelocity = velocity
+			p.triggerHeld = true
+		}
+	case cmdSetPadReleased:
+		if p.triggerHeld {
+			p.triggerHeld = false
+			p.releasedAt = time.Now()
+		}
 	default:
 		if !handled {
 			log.Warn(
@@ -157,6 +179,37 @@ func (p *PadComponent) SetCellDisplayData(data PadCellDisplayData) *PadComponent
 	return p
 }
 
+// SetTriggered lights the pad up as if it was hit with the given velocity (0.0 to 1.0)
+func (p *PadComponent) SetTriggered(velocity float32) *PadComponent {
+	p.Component.SendUpdate(component.UpdateCmd{Type: cmdSetPadTriggered, Data: velocity})
+	return p
+}
+
+// SetReleased fades out the trigger highlight
+func (p *PadComponent) SetReleased() *PadComponent {
+	p.Component.SendUpdate(component.UpdateCmd{Type: cmdSetPadReleased})
+	return p
+}
+
+// triggerAlpha returns the opacity of the trigger highlight
+func (p *PadComponent) triggerAlpha() float32 {
+	if p.triggerVelocity <= 0 {
+		return 0
+	}
+
+	alpha := 0.25 + 0.6*p.triggerVelocity
+	if p.triggerHeld {
+		return alpha
+	}
+
+	elapsed := time.Since(p.releasedAt)
+	if elapsed >= triggerFadeTime {
+		p.triggerVelocity = 0
+		return 0
+	}
+	return alpha * float32(1-elapsed.Seconds()/triggerFadeTime.Seconds())
+}
+
 func (p *PadComponent) Layout() {
 	p.Component.ProcessUpdates()
 
@@ -193,6 +246,17 @@ func (p *PadComponent) Layout() {
 	active := imgui.IsItemActive()
 	clicked := imgui.IsItemClicked()
 
+	// Right click to look for samples like the pad's in the library
+	if p.waveDisplayData.IsReady && p.waveDisplayData.Path != "" && imgui.BeginPopupContextItem() {
+		if imgui.MenuItemBool(font.Icon("AudioLines") + " Find Similar Samples") {
+			eventbus.Bus.Publish(events.LibrarySearchEventRecord{
+				EventType: events.LibraryFindSimilarEvent,
+				Path:      p.waveDisplayData.Path,
+			})
+		}
+		imgui.EndPopup()
+	}
+
 	// Set hand cursor when hovering over the pad
 	if hoveredPad {
 		imgui.SetMouseCursor(imgui.MouseCursorHand)
@@ -248,6 +312,13 @@ func (p *PadComponent) Layout() {
 
 	draw.AddRectFilledV(padSizeMin, padSizeMax, imgui.ColorU32Vec4(bg), rounding, imgui.DrawFlagsNone)
 
+	// Highlight pads played from MIDI, brighter for harder hits
+	if alpha := p.triggerAlpha(); alpha > 0 {
+		triggerColor := t.Style.Colors.PlotHistogram.Vec4
+		triggerColor.W = alpha
+		draw.AddRectFilledV(padSizeMin, padSizeMax, imgui.ColorU32Vec4(triggerColor), rounding, imgui.DrawFlagsNone)
+	}
+
 	currentBorderColor := borderColor
 	if p.editing {
 		currentBorderColor = t.Style.Colors.Text.Vec4
@@ -2,12 +2,14 @@ package pad_config
 
 import (
 	"bitbox-editor/internal/app/component"
+	"bitbox-editor/internal/app/component/midilearn"
 	"bitbox-editor/internal/app/component/pad"
 	"bitbox-editor/internal/app/component/table"
 	"bitbox-editor/internal/app/component/text"
 	"bitbox-editor/internal/app/eventbus"
 	"bitbox-editor/internal/app/events"
 	"bitbox-editor/internal/logging"
+	"bitbox-editor/internal/midi"
 	"bitbox-editor/internal/parsing/bitbox"
 	"bitbox-editor/internal/preset"
 	"fmt"
@@ -285,15 +287,26 @@ func drawParamRows(p any) []*table.TableRowComponent {
 
 	meta := getOrBuildTypeMeta(t)
 
+	learn := midi.GetLearnManager()
+
 	rows := make([]*table.TableRowComponent, 0, len(meta.fields))
 	for _, fm := range meta.fields {
 		fv := v.Field(fm.index)
-		val := valueToStringFast(fv)
-
 		rowID := imgui.IDStr(fmt.Sprintf("row-%s-%d", t.Name(), fm.index))
+
+		// Values that can be driven from MIDI are read live so learned controls show up
+		if targetID := "cell." + fm.display; learn.HasTarget(targetID) {
+			value := text.NewDynamicText(func() string { return valueToStringFast(fv) })
+			rows = append(rows, table.NewTableRow(rowID,
+				text.NewText(fm.display),
+				midilearn.NewLearnable(value, targetID),
+			))
+			continue
+		}
+
 		rows = append(rows, table.NewTableRow(rowID,
 			text.NewText(fm.display),
-			text.NewText(val),
+			text.NewText(valueToStringFast(fv)),
 		))
 	}
 	return rows
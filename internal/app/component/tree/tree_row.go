@@ -10,15 +10,22 @@ import (
 )
 
 type treeRowBuildData struct {
-	Path         string
-	Name         string
-	Icon         string
-	IsDir        bool
+	// ID tells apart rows of the same path shown in more than one place, the path is
+	// used when empty
+	ID    string
+	Path  string
+	Name  string
+	Icon  string
+	IsDir bool
+	// Open shows a folder's children until the user closes it
+	Open         bool
 	IsAudio      bool
 	DurationText string
 	SizeText     string
 	DragDropType string
-	Children     []treeRowBuildData
+	// Highlights are the parts of Name matched by a search, as byte offsets
+	Highlights [][2]int
+	Children   []treeRowBuildData
 }
 
 type TreeRowData = treeRowBuildData
@@ -37,6 +44,9 @@ type TreeRowComponent struct {
 	dragDropData      interface{}
 	dragDropType      string
 	dragDropTooltipFn dragdrop.TooltipFunc
+
+	highlights    [][2]int
+	contextMenuFn func()
 }
 
 func NewTreeRow(id imgui.ID, components ...component.ComponentType) *TreeRowComponent {
@@ -91,6 +101,18 @@ func (trc *TreeRowComponent) Children(children ...*TreeRowComponent) *TreeRowCom
 	return trc
 }
 
+// SetHighlights marks parts of the label, as byte offsets, e.g. the text a search matched
+func (trc *TreeRowComponent) SetHighlights(ranges [][2]int) *TreeRowComponent {
+	trc.highlights = ranges
+	return trc
+}
+
+// SetContextMenu sets a function drawing the items of the row's right click menu
+func (trc *TreeRowComponent) SetContextMenu(fn func()) *TreeRowComponent {
+	trc.contextMenuFn = fn
+	return trc
+}
+
 func (trc *TreeRowComponent) Flags(flags imgui.TreeNodeFlags) *TreeRowComponent {
 	trc.flags = flags
 	return trc
@@ -117,6 +139,7 @@ func (trc *TreeRowComponent) Layout() {
 	}
 	open := false
 	isLeaf := len(trc.children) == 0 && trc.childrenData == nil
+	labelPos := imgui.CursorScreenPos()
 
 	if isLeaf {
 		flags := trc.flags | imgui.TreeNodeFlagsLeaf |
@@ -134,6 +157,15 @@ func (trc *TreeRowComponent) Layout() {
 		imgui.SetMouseCursor(imgui.MouseCursorHand)
 	}
 
+	if len(trc.highlights) > 0 {
+		trc.drawHighlights(labelText, labelPos)
+	}
+
+	if trc.contextMenuFn != nil && imgui.BeginPopupContextItem() {
+		trc.contextMenuFn()
+		imgui.EndPopup()
+	}
+
 	if trc.dragDropData != nil {
 		if imgui.BeginDragDropSource() {
 
@@ -185,6 +217,25 @@ func (trc *TreeRowComponent) Layout() {
 	}
 }
 
+// drawHighlights marks the highlighted parts of the label, drawn by the tree node at pos
+func (trc *TreeRowComponent) drawHighlights(label string, pos imgui.Vec2) {
+	pad := imgui.CurrentStyle().FramePadding()
+	x := pos.X + imgui.TreeNodeToLabelSpacing()
+	y := pos.Y + pad.Y
+	height := imgui.TextLineHeight()
+	color := imgui.ColorU32Col(imgui.ColTextSelectedBg)
+	dl := imgui.WindowDrawList()
+
+	for _, r := range trc.highlights {
+		if r[0] < 0 || r[1] > len(label) || r[0] >= r[1] {
+			continue
+		}
+		start := x + imgui.CalcTextSize(label[:r[0]]).X
+		end := x + imgui.CalcTextSize(label[:r[1]]).X
+		dl.AddRectFilled(imgui.Vec2{X: start, Y: y}, imgui.Vec2{X: end, Y: y + height}, color)
+	}
+}
+
 // Destroy cleans up the component and all its children
 func (trc *TreeRowComponent) Destroy() {
 	for _, c := range trc.layout {
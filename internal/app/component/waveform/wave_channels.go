@@ -0,0 +1,135 @@
+package waveform
+
+import (
+	"bitbox-editor/internal/audio"
+
+	"github.com/AllenDang/cimgui-go/imgui"
+	"github.com/AllenDang/cimgui-go/implot"
+)
+
+// ChannelMode selects how the channels of a stereo wave are laid out
+type ChannelMode int
+
+const (
+	// ChannelsMixed draws a single lane with the mono mix
+	ChannelsMixed ChannelMode = iota
+	// ChannelsSplit draws separate left and right lanes
+	ChannelsSplit
+	// ChannelsMidSide draws the mid (L+R) and side (L-R) signals in separate lanes
+	ChannelsMidSide
+)
+
+func (m ChannelMode) String() string {
+	switch m {
+	case ChannelsSplit:
+		return "L/R"
+	case ChannelsMidSide:
+		return "Mid/Side"
+	default:
+		return "Mixed"
+	}
+}
+
+// waveLane is a single signal drawn in its own vertical lane
+type waveLane struct {
+	label      string
+	levels     []audio.Downsample
+	numSamples int
+	sample     audio.SampleGetter
+}
+
+// lanes returns the lanes to draw for the current channel mode. Mono waves always use a single lane.
+func (wc *WaveComponent) lanes() []waveLane {
+	data := wc.displayData
+
+	mono := waveLane{
+		levels:     data.Downsamples,
+		numSamples: len(data.Samples),
+		sample:     func(i int) float64 { return float64(data.Samples[i]) },
+	}
+
+	if len(data.Channels) < 2 || len(data.ChannelDownsamples) < 2 {
+		return []waveLane{mono}
+	}
+
+	left, right := data.Channels[0], data.Channels[1]
+
+	switch wc.channelMode {
+	case ChannelsSplit:
+		return []waveLane{
+			{
+				label:      "L",
+				levels:     data.ChannelDownsamples[0],
+				numSamples: len(left),
+				sample:     func(i int) float64 { return float64(left[i]) },
+			},
+			{
+				label:      "R",
+				levels:     data.ChannelDownsamples[1],
+				numSamples: len(right),
+				sample:     func(i int) float64 { return float64(right[i]) },
+			},
+		}
+
+	case ChannelsMidSide:
+		mono.label = "M"
+		return []waveLane{
+			mono,
+			{
+				label:      "S",
+				levels:     data.SideDownsamples,
+				numSamples: len(left),
+				sample:     func(i int) float64 { return float64(left[i]-right[i]) / 2.0 },
+			},
+		}
+	}
+
+	return []waveLane{mono}
+}
+
+// laneOffset returns the vertical center of lane idx out of count lanes. Lanes are two units
+// tall so a full scale signal fills its lane.
+func laneOffset(idx, count int) float64 {
+	return float64(count - 1 - 2*idx)
+}
+
+// plotYRange returns the vertical range of the plot for the given number of lanes
+func (wc *WaveComponent) plotYRange(laneCount int) (yMin, yMax float64) {
+	if laneCount <= 1 {
+		return float64(wc.displayData.MinY), float64(wc.displayData.MaxY)
+	}
+	return -float64(laneCount), float64(laneCount)
+}
+
+// drawLaneDecorations draws separators and labels between lanes
+func (wc *WaveComponent) drawLaneDecorations(lanes []waveLane) {
+	if len(lanes) <= 1 {
+		return
+	}
+
+	drawList := implot.GetPlotDrawList()
+	plotPos := implot.GetPlotPos()
+	plotSize := implot.GetPlotSize()
+	sepCol := imgui.NewColor(1, 1, 1, 0.2).Pack()
+	labelCol := imgui.Vec4{X: 1, Y: 1, Z: 1, W: 0.7}
+
+	for i, lane := range lanes {
+		offset := laneOffset(i, len(lanes))
+
+		if i > 0 {
+			sep := implot.PlotToPixelsdoubleV(wc.viewMin, offset+1, implot.AxisX1, implot.AxisY1)
+			drawList.AddLineV(
+				imgui.Vec2{X: plotPos.X, Y: sep.Y},
+				imgui.Vec2{X: plotPos.X + plotSize.X, Y: sep.Y},
+				sepCol,
+				1.0,
+			)
+		}
+
+		implot.AnnotationStr(
+			wc.viewMin, offset+1,
+			labelCol, imgui.Vec2{X: 12, Y: 10},
+			true, lane.label,
+		)
+	}
+}
@@ -0,0 +1,181 @@
+package waveform
+
+import (
+	"bitbox-editor/internal/app/font"
+	"bitbox-editor/internal/audio"
+	"bitbox-editor/internal/util"
+	"fmt"
+	"math"
+
+	"github.com/AllenDang/cimgui-go/imgui"
+	"github.com/AllenDang/cimgui-go/implot"
+)
+
+var (
+	loopColor     = imgui.Vec4{X: 0.95, Y: 0.6, Z: 0.15, W: 1.0}
+	loopFillColor = imgui.Vec4{X: 0.95, Y: 0.6, Z: 0.15, W: 0.08}
+	loopFadeColor = imgui.Vec4{X: 0.95, Y: 0.6, Z: 0.15, W: 0.35}
+)
+
+// WaveLoopMarker draws and edits the sustain loop of a sample
+type WaveLoopMarker struct {
+	StartHovered bool
+	StartHeld    bool
+	EndHovered   bool
+	EndHeld      bool
+}
+
+func NewWaveLoopMarker() *WaveLoopMarker {
+	return &WaveLoopMarker{}
+}
+
+// IsDragging returns true while either loop point is held
+func (m *WaveLoopMarker) IsDragging() bool {
+	return m.StartHeld || m.EndHeld
+}
+
+// DrawInteract draws the loop region with its crossfade and lets the user drag the loop points.
+// Positions are in bins, fadeBins is the crossfade length taken from before the loop start.
+func (m *WaveLoopMarker) DrawInteract(
+	currentStart, currentEnd, fadeBins float64,
+	samplesPerBin float64,
+	sampleRate int,
+	minBound, maxBound float64,
+	yMin, yMax float64,
+) (newStart, newEnd float64, changed bool) {
+	newStart = currentStart
+	newEnd = currentEnd
+	minGap := 1.0
+
+	drawList := implot.GetPlotDrawList()
+
+	// Loop region
+	pMin := implot.PlotToPixelsdoubleV(newStart, yMin, implot.AxisX1, implot.AxisY1)
+	pMax := implot.PlotToPixelsdoubleV(newEnd, yMax, implot.AxisX1, implot.AxisY1)
+	drawList.AddRectFilled(
+		imgui.Vec2{X: pMin.X, Y: pMax.Y},
+		imgui.Vec2{X: pMax.X, Y: pMin.Y},
+		imgui.ColorU32Vec4(loopFillColor),
+	)
+
+	// Crossfade ramps: the end of the loop fades out while the audio before the start fades in
+	if fadeBins > 0 {
+		fadeCol := imgui.ColorU32Vec4(loopFadeColor)
+		m.drawFadeRamp(drawList, newEnd-fadeBins, newEnd, yMin, yMax, false, fadeCol)
+		m.drawFadeRamp(drawList, newStart-fadeBins, newStart, yMin, yMax, true, fadeCol)
+	}
+
+	flags := implot.DragToolFlagsNone
+
+	var startClicked bool
+	tempStart := newStart
+	if implot.DragLineXV(-3, &tempStart, loopColor, 2.0, flags, &startClicked, &m.StartHovered, &m.StartHeld) {
+		tempStart = math.Max(tempStart, minBound)
+		tempStart = math.Min(tempStart, newEnd-minGap)
+		if tempStart != newStart {
+			newStart = tempStart
+			changed = true
+		}
+
+		sec := CalculateStartSeconds(newStart, samplesPerBin, sampleRate)
+		implot.AnnotationStr(
+			newStart, 0, loopColor, imgui.Vec2{X: 0, Y: 0}, true,
+			fmt.Sprintf("Loop Start: %s", util.SecondsLabel(sec)),
+		)
+	}
+
+	var endClicked bool
+	tempEnd := newEnd
+	if implot.DragLineXV(-4, &tempEnd, loopColor, 2.0, flags, &endClicked, &m.EndHovered, &m.EndHeld) {
+		tempEnd = math.Min(tempEnd, maxBound)
+		tempEnd = math.Max(tempEnd, newStart+minGap)
+		if tempEnd != newEnd {
+			newEnd = tempEnd
+			changed = true
+		}
+
+		sec := CalculateEndSeconds(newEnd, samplesPerBin, sampleRate)
+		implot.AnnotationStr(
+			newEnd, 0, loopColor, imgui.Vec2{X: 0, Y: 0}, true,
+			fmt.Sprintf("Loop End: %s", util.SecondsLabel(sec)),
+		)
+	}
+
+	implot.AnnotationStr(newStart, yMin, loopColor, imgui.Vec2{X: 0, Y: 1}, true, font.Icon("Repeat1"))
+	implot.AnnotationStr(newEnd, yMin, loopColor, imgui.Vec2{X: 0, Y: 1}, true, font.Icon("Repeat1"))
+
+	return newStart, newEnd, changed
+}
+
+// drawFadeRamp draws a triangle showing a linear fade between two bin positions
+func (m *WaveLoopMarker) drawFadeRamp(drawList *imgui.DrawList, from, to, yMin, yMax float64, fadeIn bool, col uint32) {
+	pFrom := implot.PlotToPixelsdoubleV(from, yMin, implot.AxisX1, implot.AxisY1)
+	pTo := implot.PlotToPixelsdoubleV(to, yMax, implot.AxisX1, implot.AxisY1)
+
+	bottom := pFrom.Y
+	top := pTo.Y
+
+	if fadeIn {
+		drawList.AddTriangleFilled(
+			imgui.Vec2{X: pFrom.X, Y: bottom},
+			imgui.Vec2{X: pTo.X, Y: top},
+			imgui.Vec2{X: pTo.X, Y: bottom},
+			col,
+		)
+		return
+	}
+
+	drawList.AddTriangleFilled(
+		imgui.Vec2{X: pFrom.X, Y: top},
+		imgui.Vec2{X: pTo.X, Y: bottom},
+		imgui.Vec2{X: pFrom.X, Y: bottom},
+		col,
+	)
+}
+
+// drawLoopMarker draws the loop markers when the sample has a loop and applies any edits
+func (wc *WaveComponent) drawLoopMarker(yMin, yMax float64) {
+	if wc.loop.Mode == audio.LoopModeOff || wc.samplesPerBin <= 0 || wc.loopMarker == nil {
+		return
+	}
+
+	loop := wc.loop
+	if loop.End <= loop.Start {
+		loop.Start = int(wc.boundsStart * wc.samplesPerBin)
+		loop.End = int(wc.boundsEnd * wc.samplesPerBin)
+	}
+
+	currentStart := float64(loop.Start) / wc.samplesPerBin
+	currentEnd := float64(loop.End) / wc.samplesPerBin
+	fadeBins := float64(loop.FadeSamples()) / wc.samplesPerBin
+
+	newStart, newEnd, changed := wc.loopMarker.DrawInteract(
+		currentStart, currentEnd, fadeBins,
+		wc.samplesPerBin, wc.displayData.SampleRate,
+		wc.boundsStart, wc.boundsEnd,
+		yMin, yMax,
+	)
+
+	if changed {
+		if newStart != currentStart {
+			newStart = wc.snapBin(newStart)
+			loop.Start = int(math.Round(newStart * wc.samplesPerBin))
+		}
+		if newEnd != currentEnd {
+			newEnd = wc.snapBin(newEnd)
+			loop.End = int(math.Round(newEnd * wc.samplesPerBin))
+		}
+	}
+
+	if loop != wc.loop {
+		wc.SetLoop(loop)
+	}
+
+	// Show where the loop preview is playing
+	if pos, ok := audio.GetAudioManager().GetLoopPreviewPosition(wc.displayData.Path); ok {
+		cursorBin := float64(pos) / wc.samplesPerBin
+		implot.PushStyleColorVec4(implot.ColLine, loopColor)
+		implot.PlotInfLinesdoublePtr("loop cursor", &cursorBin, 1)
+		implot.PopStyleColor()
+	}
+}
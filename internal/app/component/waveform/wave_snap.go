@@ -0,0 +1,113 @@
+package waveform
+
+import (
+	"bitbox-editor/internal/audio"
+	"math"
+
+	"github.com/AllenDang/cimgui-go/imgui"
+	"github.com/AllenDang/cimgui-go/implot"
+)
+
+// SnapMode controls how bounds and slice markers are positioned when moved
+type SnapMode int
+
+const (
+	SnapOff SnapMode = iota
+	SnapZeroCrossing
+	SnapBeatGrid
+)
+
+const (
+	// zeroCrossingWindowSec is how far either side of the marker to search for a zero crossing
+	zeroCrossingWindowSec = 0.005
+
+	// beatGridDivision is the number of grid lines per beat (sixteenth notes)
+	beatGridDivision = 4
+)
+
+func (m SnapMode) String() string {
+	switch m {
+	case SnapZeroCrossing:
+		return "Zero Crossing"
+	case SnapBeatGrid:
+		return "Beat Grid"
+	default:
+		return "Off"
+	}
+}
+
+// snapBin moves a bin position to the nearest snap point for the current snap mode
+func (wc *WaveComponent) snapBin(bin float64) float64 {
+	if wc.snapMode == SnapOff || wc.samplesPerBin <= 0 {
+		return bin
+	}
+
+	sampleRate := wc.displayData.SampleRate
+	sample := int(math.Round(bin * wc.samplesPerBin))
+
+	switch wc.snapMode {
+	case SnapZeroCrossing:
+		if len(wc.displayData.Samples) == 0 {
+			return bin
+		}
+		window := int(zeroCrossingWindowSec * float64(sampleRate))
+		sample = audio.FindNearestZeroCrossing(wc.displayData.Samples, sample, window)
+
+	case SnapBeatGrid:
+		if wc.tempo <= 0 {
+			return bin
+		}
+		sample = audio.SnapToBeatGrid(sample, sampleRate, wc.tempo, beatGridDivision)
+	}
+
+	return float64(sample) / wc.samplesPerBin
+}
+
+// drawBeatGrid draws faint grid lines when snapping to the beat grid
+func (wc *WaveComponent) drawBeatGrid(xMin, xMax float64) {
+	if wc.snapMode != SnapBeatGrid || wc.samplesPerBin <= 0 {
+		return
+	}
+
+	step := audio.BeatGridStep(wc.displayData.SampleRate, wc.tempo, beatGridDivision)
+	if step <= 0 {
+		return
+	}
+
+	stepBins := step / wc.samplesPerBin
+
+	// Skip drawing when the lines would be too dense to be useful
+	plotSize := implot.GetPlotSize()
+	if plotSize.X <= 0 || (xMax-xMin)/stepBins > float64(plotSize.X)/4 {
+		return
+	}
+
+	beatLines := make([]float64, 0)
+	subLines := make([]float64, 0)
+	for i := 0; float64(i)*stepBins <= xMax; i++ {
+		pos := float64(i) * stepBins
+		if pos < xMin {
+			continue
+		}
+		if i%beatGridDivision == 0 {
+			beatLines = append(beatLines, pos)
+		} else {
+			subLines = append(subLines, pos)
+		}
+	}
+
+	implot.PushStyleVarFloat(implot.StyleVarLineWeight, 1.0)
+	defer implot.PopStyleVar()
+
+	if len(subLines) > 0 {
+		implot.PushStyleColorVec4(implot.ColLine, imgui.Vec4{X: 1, Y: 1, Z: 1, W: 0.06})
+		implot.PlotInfLinesdoublePtr("beat grid sub", &subLines[0], int32(len(subLines)))
+		implot.PopStyleColor()
+	}
+
+	if len(beatLines) > 0 {
+		implot.PushStyleColorVec4(implot.ColLine, imgui.Vec4{X: 1, Y: 1, Z: 1, W: 0.15})
+		implot.PlotInfLinesdoublePtr("beat grid", &beatLines[0], int32(len(beatLines)))
+		implot.PopStyleColor()
+	}
+}
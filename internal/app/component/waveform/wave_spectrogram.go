@@ -0,0 +1,95 @@
+package waveform
+
+import (
+	"bitbox-editor/internal/audio"
+	"math"
+
+	"github.com/AllenDang/cimgui-go/implot"
+)
+
+// ViewMode selects how the wave is drawn
+type ViewMode int
+
+const (
+	ViewWaveform ViewMode = iota
+	ViewSpectrogram
+)
+
+func (m ViewMode) String() string {
+	switch m {
+	case ViewSpectrogram:
+		return "Spectrogram"
+	default:
+		return "Waveform"
+	}
+}
+
+// drawSpectrogram draws the visible part of the spectrogram as a heatmap over the plot area.
+// Returns false if the spectrogram is still being computed.
+func (wc *WaveComponent) drawSpectrogram(yMin, yMax float64) bool {
+	spec := audio.GetGlobalAsyncCache().GetSpectrogram(wc.displayData.Path)
+	if spec == nil || spec.Frames == 0 || wc.samplesPerBin <= 0 {
+		return false
+	}
+
+	hopBins := float64(spec.HopSize) / wc.samplesPerBin
+	first := int(math.Floor(wc.viewMin/hopBins)) - 1
+	last := int(math.Ceil(wc.viewMax/hopBins)) + 1
+	if first < 0 {
+		first = 0
+	}
+	if last > spec.Frames-1 {
+		last = spec.Frames - 1
+	}
+
+	count := last - first + 1
+	if count <= 0 {
+		return true
+	}
+
+	// Merge frames when there are more than the plot can show to keep the heatmap light
+	maxCols := int(implot.GetPlotSize().X / 2)
+	if maxCols < 1 {
+		maxCols = 1
+	}
+
+	values := spec.Values[first*spec.Rows : (last+1)*spec.Rows]
+	cols := count
+	if count > maxCols {
+		cols = maxCols
+		merged := make([]float32, cols*spec.Rows)
+		for c := 0; c < cols; c++ {
+			from := c * count / cols
+			to := (c + 1) * count / cols
+			if to <= from {
+				to = from + 1
+			}
+			dst := merged[c*spec.Rows : (c+1)*spec.Rows]
+			copy(dst, spec.Column(first+from))
+			for f := from + 1; f < to; f++ {
+				for r, v := range spec.Column(first + f) {
+					if v > dst[r] {
+						dst[r] = v
+					}
+				}
+			}
+		}
+		values = merged
+	}
+
+	// Frames are centered on their position, so each column spans half a hop either side
+	boundsMin := implot.NewPlotPoint(float64(first)*hopBins-hopBins/2, yMin)
+	boundsMax := implot.NewPlotPoint(float64(last)*hopBins+hopBins/2, yMax)
+
+	implot.PlotHeatmapFloatPtrV(
+		"spectrogram",
+		&values[0],
+		int32(spec.Rows), int32(cols),
+		audio.SpectrogramMinDB, 0,
+		"",
+		boundsMin, boundsMax,
+		implot.HeatmapFlagsColMajor,
+	)
+
+	return true
+}
@@ -0,0 +1,332 @@
+package waveform
+
+import (
+	"bitbox-editor/internal/app/theme"
+	"bitbox-editor/internal/audio"
+	"fmt"
+	"math"
+
+	"github.com/AllenDang/cimgui-go/imgui"
+	"github.com/AllenDang/cimgui-go/implot"
+)
+
+const (
+	// zoomStep is the zoom factor applied per mouse wheel notch
+	zoomStep = 1.25
+
+	// minVisibleSamples is the smallest number of samples the view can be zoomed to
+	minVisibleSamples = 32
+
+	// minimapHeight is the height of the overview plot in pixels
+	minimapHeight = 36
+
+	// rawSampleMarkerThreshold is the pixels per sample above which individual samples are marked
+	rawSampleMarkerThreshold = 6.0
+)
+
+// resetView shows the whole wave
+func (wc *WaveComponent) resetView() {
+	wc.viewMin = 0
+	wc.viewMax = wc.displayData.XLimitMax
+}
+
+// isZoomed returns true if only part of the wave is visible
+func (wc *WaveComponent) isZoomed() bool {
+	return wc.viewMin > 0 || wc.viewMax < wc.displayData.XLimitMax
+}
+
+// setView sets the visible range in bins, keeping it within the wave and above the minimum zoom
+func (wc *WaveComponent) setView(viewMin, viewMax float64) {
+	xLimitMax := wc.displayData.XLimitMax
+	if xLimitMax <= 0 {
+		return
+	}
+
+	minSpan := 1.0
+	if wc.samplesPerBin > 0 {
+		minSpan = minVisibleSamples / wc.samplesPerBin
+	}
+	if minSpan > xLimitMax {
+		minSpan = xLimitMax
+	}
+
+	span := viewMax - viewMin
+	if span < minSpan {
+		center := (viewMin + viewMax) / 2
+		viewMin = center - minSpan/2
+		viewMax = center + minSpan/2
+		span = minSpan
+	}
+	if span > xLimitMax {
+		viewMin, viewMax = 0, xLimitMax
+	}
+
+	if viewMin < 0 {
+		viewMax -= viewMin
+		viewMin = 0
+	}
+	if viewMax > xLimitMax {
+		viewMin -= viewMax - xLimitMax
+		viewMax = xLimitMax
+	}
+
+	wc.viewMin = math.Max(0, viewMin)
+	wc.viewMax = math.Min(xLimitMax, viewMax)
+}
+
+// zoomAround scales the view by factor keeping the anchor position under the mouse
+func (wc *WaveComponent) zoomAround(anchor, factor float64) {
+	newMin := anchor - (anchor-wc.viewMin)*factor
+	newMax := anchor + (wc.viewMax-anchor)*factor
+	wc.setView(newMin, newMax)
+}
+
+// panBy moves the view by delta bins
+func (wc *WaveComponent) panBy(delta float64) {
+	span := wc.viewMax - wc.viewMin
+	wc.setView(wc.viewMin+delta, wc.viewMin+delta+span)
+}
+
+// handleZoomAndPan handles mouse wheel zoom and right mouse drag panning over the main plot
+func (wc *WaveComponent) handleZoomAndPan() {
+	io := imgui.CurrentIO()
+
+	if implot.IsPlotHovered() {
+		if wheel := io.MouseWheel(); wheel != 0 {
+			anchor := implot.GetPlotMousePos().X
+			wc.zoomAround(anchor, math.Pow(zoomStep, -float64(wheel)))
+		}
+
+		if wheelH := io.MouseWheelH(); wheelH != 0 {
+			wc.panBy(-float64(wheelH) * (wc.viewMax - wc.viewMin) * 0.1)
+		}
+
+		if imgui.IsMouseClickedBool(imgui.MouseButtonRight) {
+			wc.panning = true
+		}
+
+		if imgui.IsMouseDoubleClicked(imgui.MouseButtonRight) {
+			wc.resetView()
+		}
+	}
+
+	if wc.panning {
+		if !imgui.IsMouseDown(imgui.MouseButtonRight) {
+			wc.panning = false
+			return
+		}
+
+		if imgui.IsMouseDragging(imgui.MouseButtonRight) {
+			plotWidth := implot.GetPlotSize().X
+			if plotWidth > 0 {
+				delta := float64(io.MouseDelta().X) / float64(plotWidth) * (wc.viewMax - wc.viewMin)
+				wc.panBy(-delta)
+			}
+		}
+	}
+}
+
+// selectLevel returns the index of the coarsest downsample level that still has at least one
+// bin per pixel for the visible range, or -1 if raw samples should be drawn instead.
+func (wc *WaveComponent) selectLevel(levels []audio.Downsample, hasRaw bool, pixelWidth float32) int {
+	span := wc.viewMax - wc.viewMin
+	totalBins := wc.displayData.XLimitMax + 1
+	if span <= 0 || totalBins <= 0 {
+		return 0
+	}
+
+	for i, level := range levels {
+		visibleBins := span * float64(len(level.Mins)) / totalBins
+		if visibleBins >= float64(pixelWidth) {
+			return i
+		}
+	}
+
+	if hasRaw {
+		return -1
+	}
+
+	return len(levels) - 1
+}
+
+// drawWaveform draws the visible part of each lane using the most suitable resolution
+func (wc *WaveComponent) drawWaveform() {
+	lanes := wc.lanes()
+	for i, lane := range lanes {
+		wc.drawLane(i, lane, laneOffset(i, len(lanes)))
+	}
+	wc.drawLaneDecorations(lanes)
+}
+
+// drawLane draws a single lane centered vertically on offset
+func (wc *WaveComponent) drawLane(idx int, lane waveLane, offset float64) {
+	if len(lane.levels) == 0 {
+		return
+	}
+
+	levelIdx := wc.selectLevel(lane.levels, lane.numSamples > 0, implot.GetPlotSize().X)
+	if levelIdx < 0 {
+		wc.drawRawSamples(idx, lane, offset)
+		return
+	}
+
+	ds := lane.levels[levelIdx]
+	numBins := len(ds.Mins)
+	if len(ds.Maxs) < numBins {
+		numBins = len(ds.Maxs)
+	}
+
+	if numBins == 0 {
+		return
+	}
+
+	// Bin positions of this level in the base (level 0) coordinate space
+	binScale := (wc.displayData.XLimitMax + 1) / float64(numBins)
+	first := int(math.Floor(wc.viewMin/binScale)) - 1
+	last := int(math.Ceil(wc.viewMax/binScale)) + 1
+	if first < 0 {
+		first = 0
+	}
+	if last > numBins-1 {
+		last = numBins - 1
+	}
+
+	count := last - first + 1
+	if count <= 0 {
+		return
+	}
+
+	xs := make([]float64, count)
+	mins := make([]float64, count)
+	maxs := make([]float64, count)
+	for i := 0; i < count; i++ {
+		xs[i] = float64(first+i) * binScale
+		mins[i] = float64(ds.Mins[first+i]) + offset
+		maxs[i] = float64(ds.Maxs[first+i]) + offset
+	}
+
+	implot.PlotShadeddoublePtrdoublePtrdoublePtr(fmt.Sprintf("ch_fill_%d", idx), &xs[0], &mins[0], &maxs[0], int32(count))
+	implot.PlotLinedoublePtrdoublePtr(fmt.Sprintf("ch_lines_min_%d", idx), &xs[0], &mins[0], int32(count))
+	implot.PlotLinedoublePtrdoublePtr(fmt.Sprintf("ch_lines_max_%d", idx), &xs[0], &maxs[0], int32(count))
+}
+
+// drawRawSamples draws individual samples when zoomed in past the finest downsample level
+func (wc *WaveComponent) drawRawSamples(idx int, lane waveLane, offset float64) {
+	if lane.numSamples == 0 || wc.samplesPerBin <= 0 {
+		return
+	}
+
+	first := int(math.Floor(wc.viewMin*wc.samplesPerBin)) - 1
+	last := int(math.Ceil(wc.viewMax*wc.samplesPerBin)) + 1
+	if first < 0 {
+		first = 0
+	}
+	if last > lane.numSamples-1 {
+		last = lane.numSamples - 1
+	}
+
+	count := last - first + 1
+	if count <= 0 {
+		return
+	}
+
+	xs := make([]float64, count)
+	ys := make([]float64, count)
+	for i := 0; i < count; i++ {
+		xs[i] = float64(first+i) / wc.samplesPerBin
+		ys[i] = lane.sample(first+i) + offset
+	}
+
+	implot.PlotLinedoublePtrdoublePtr(fmt.Sprintf("ch_samples_%d", idx), &xs[0], &ys[0], int32(count))
+
+	// Mark each sample once there is enough room to tell them apart
+	plotWidth := float64(implot.GetPlotSize().X)
+	if plotWidth/float64(count) >= rawSampleMarkerThreshold {
+		col := implot.GetColormapColor(0)
+		implot.SetNextMarkerStyleV(implot.MarkerCircle, 2.5, col, 1.0, col)
+		implot.PlotScatterdoublePtrdoublePtr(fmt.Sprintf("ch_sample_points_%d", idx), &xs[0], &ys[0], int32(count))
+	}
+}
+
+// drawMinimap draws an overview of the whole wave with the visible range highlighted.
+// Clicking or dragging in the minimap moves the view, double-clicking resets the zoom.
+func (wc *WaveComponent) drawMinimap(downsamples []audio.Downsample, yMin, yMax float64) {
+	if len(downsamples) == 0 || len(downsamples[0].Mins) == 0 {
+		return
+	}
+
+	xMax := wc.displayData.XLimitMax
+	flags := wc.plotFlags | implot.FlagsCanvasOnly | implot.FlagsNoInputs
+	axisFlags := implot.AxisFlagsNoDecorations | implot.AxisFlagsLock
+
+	if !implot.BeginPlotV(wc.IDStr()+"_minimap", imgui.Vec2{X: -1, Y: minimapHeight}, flags) {
+		return
+	}
+	defer implot.EndPlot()
+
+	implot.SetupAxesV("", "", axisFlags, axisFlags)
+	implot.SetupAxisLimitsV(implot.AxisX1, 0, xMax, implot.CondAlways)
+	implot.SetupAxisLimitsV(implot.AxisY1, yMin, yMax, implot.CondAlways)
+
+	ds := downsamples[0]
+	numBins := len(ds.Mins)
+	if len(ds.Maxs) < numBins {
+		numBins = len(ds.Maxs)
+	}
+
+	xs := make([]float32, numBins)
+	for i := range xs {
+		xs[i] = float32(i)
+	}
+
+	implot.PlotShadedFloatPtrFloatPtrFloatPtr("minimap_fill", &xs[0], &ds.Mins[0], &ds.Maxs[0], int32(numBins))
+
+	// Bounds, shown as dimmed regions outside the playable range
+	drawList := implot.GetPlotDrawList()
+	shade := imgui.NewColor(0, 0, 0, 0.35).Pack()
+	if wc.boundsStart > 0 {
+		pMin := implot.PlotToPixelsdoubleV(0, yMax, implot.AxisX1, implot.AxisY1)
+		pMax := implot.PlotToPixelsdoubleV(wc.boundsStart, yMin, implot.AxisX1, implot.AxisY1)
+		drawList.AddRectFilled(pMin, pMax, shade)
+	}
+	if wc.boundsEnd < xMax {
+		pMin := implot.PlotToPixelsdoubleV(wc.boundsEnd, yMax, implot.AxisX1, implot.AxisY1)
+		pMax := implot.PlotToPixelsdoubleV(xMax, yMin, implot.AxisX1, implot.AxisY1)
+		drawList.AddRectFilled(pMin, pMax, shade)
+	}
+
+	// Visible range
+	t := theme.GetCurrentTheme()
+	viewCol := t.Style.Colors.TextSelectedBg.Vec4
+	pMin := implot.PlotToPixelsdoubleV(wc.viewMin, yMax, implot.AxisX1, implot.AxisY1)
+	pMax := implot.PlotToPixelsdoubleV(wc.viewMax, yMin, implot.AxisX1, implot.AxisY1)
+	drawList.AddRectFilled(pMin, pMax, imgui.NewColor(viewCol.X, viewCol.Y, viewCol.Z, 0.25).Pack())
+	drawList.AddRectV(pMin, pMax, imgui.NewColor(viewCol.X, viewCol.Y, viewCol.Z, 0.9).Pack(), 0, imgui.DrawFlagsNone, 1.5)
+
+	// Navigation
+	plotPos := implot.GetPlotPos()
+	plotSize := implot.GetPlotSize()
+	mouse := imgui.MousePos()
+	hovered := mouse.X >= plotPos.X && mouse.X <= plotPos.X+plotSize.X &&
+		mouse.Y >= plotPos.Y && mouse.Y <= plotPos.Y+plotSize.Y
+
+	if hovered && imgui.IsMouseDoubleClicked(imgui.MouseButtonLeft) {
+		wc.resetView()
+		return
+	}
+
+	if hovered && imgui.IsMouseClickedBool(imgui.MouseButtonLeft) {
+		wc.minimapDragging = true
+	}
+
+	if wc.minimapDragging {
+		if !imgui.IsMouseDown(imgui.MouseButtonLeft) {
+			wc.minimapDragging = false
+			return
+		}
+
+		center := implot.PixelsToPlotFloatV(mouse.X, mouse.Y, implot.AxisX1, implot.AxisY1).X
+		span := wc.viewMax - wc.viewMin
+		wc.setView(center-span/2, center+span/2)
+	}
+}
@@ -14,6 +14,11 @@ const (
 	cmdSetWaveAxisYFlags
 	cmdAddWaveSlice
 	cmdUpdateWaveSlicePosition
+	cmdSetWaveSnapMode
+	cmdSetWaveTempo
+	cmdSetWaveViewMode
+	cmdSetWaveChannelMode
+	cmdSetWaveLoop
 )
 
 type WaveBoundsPayload struct {
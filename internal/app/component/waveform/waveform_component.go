@@ -35,16 +35,33 @@ type WaveComponent struct {
 	boundsMarker      *WaveBoundsMarker
 	boundsInitialized bool
 
+	// loop is the sustain loop in samples, shown when the loop mode is not off
+	loop       audio.LoopSettings
+	loopMarker *WaveLoopMarker
+
 	plotFlags  implot.Flags
 	axisXFlags implot.AxisFlags
 	axisYFlags implot.AxisFlags
 
 	samplesPerBin float64
 
+	// viewMin and viewMax are the visible range in bins
+	viewMin         float64
+	viewMax         float64
+	panning         bool
+	minimapDragging bool
+
+	viewMode    ViewMode
+	channelMode ChannelMode
+
 	// repeatMode 0 = off, 1 = repeat all, 2 = repeat one slice
 	repeatMode     int
 	repeatSliceIdx int
 
+	// snapMode controls marker snapping, tempo is used for the beat grid
+	snapMode SnapMode
+	tempo    float64
+
 	emptyText        string
 	filteredEventSub *eventbus.FilteredSubscription
 }
@@ -58,6 +75,7 @@ func NewWaveformComponent(id imgui.ID) *WaveComponent {
 		boundsStart:  0.0,
 		boundsEnd:    0.0,
 		boundsMarker: nil,
+		loopMarker:   NewWaveLoopMarker(),
 		emptyText:    "No wav loaded . . .",
 		plotFlags: implot.FlagsNoMenus |
 			implot.FlagsNoLegend |
@@ -154,8 +172,13 @@ func (wc *WaveComponent) handleUpdate(cmd component.UpdateCmd) {
 					wc.boundsMarker = NewWaveBoundsMarker()
 				}
 
+				wc.resetView()
 				wc.boundsInitialized = true
 			}
+
+			if wc.viewMax <= wc.viewMin || wc.viewMax > wc.displayData.XLimitMax {
+				wc.resetView()
+			}
 		}
 
 	case cmdUpdatePlaybackProgress:
@@ -343,6 +366,31 @@ func (wc *WaveComponent) handleUpdate(cmd component.UpdateCmd) {
 			wc.slices = append(wc.slices, marker)
 		}
 
+	case cmdSetWaveSnapMode:
+		if mode, ok := cmd.Data.(SnapMode); ok {
+			wc.snapMode = mode
+		}
+
+	case cmdSetWaveTempo:
+		if bpm, ok := cmd.Data.(float64); ok {
+			wc.tempo = bpm
+		}
+
+	case cmdSetWaveChannelMode:
+		if mode, ok := cmd.Data.(ChannelMode); ok {
+			wc.channelMode = mode
+		}
+
+	case cmdSetWaveLoop:
+		if loop, ok := cmd.Data.(audio.LoopSettings); ok {
+			wc.loop = loop
+		}
+
+	case cmdSetWaveViewMode:
+		if mode, ok := cmd.Data.(ViewMode); ok {
+			wc.viewMode = mode
+		}
+
 	case cmdUpdateWaveSlicePosition:
 		if payload, ok := cmd.Data.(WaveSlicePositionPayload); ok {
 			if payload.Index >= 0 && payload.Index < len(wc.slices) && wc.slices[payload.Index] != nil {
@@ -478,6 +526,10 @@ func (wc *WaveComponent) handleUserInteraction(xMin, xMax float64) {
 	if implot.IsPlotHovered() && imgui.IsMouseClickedBool(imgui.MouseButtonMiddle) && !isDragging {
 		mp := implot.GetPlotMousePos()
 		x := math.Round(mp.X)
+		if wc.snapMode != SnapOff {
+			x = wc.snapBin(mp.X)
+		}
+
 		if x < minBound {
 			x = minBound
 		}
@@ -554,6 +606,13 @@ func (wc *WaveComponent) drawBoundsMarker(samplesPerBin float64, sampleRate int,
 	)
 
 	if changed {
+		// Only snap the edge that moved so the other one stays put
+		if newStart != currentStart {
+			newStart = wc.snapBin(newStart)
+		}
+		if newEnd != currentEnd {
+			newEnd = wc.snapBin(newEnd)
+		}
 		wc.SetBounds(newStart, newEnd)
 	}
 }
@@ -684,7 +743,7 @@ func (wc *WaveComponent) drawSliceMarkers(slices []*WaveMarker, cursor *WaveCurs
 		} else if positionChanged {
 			updatePayload := WaveSlicePositionPayload{
 				Index:    idx,
-				NewStart: newStartPos,
+				NewStart: wc.snapBin(newStartPos),
 			}
 			cmd := component.UpdateCmd{Type: cmdUpdateWaveSlicePosition, Data: updatePayload}
 			updatesToSend = append(updatesToSend, cmd)
@@ -710,50 +769,16 @@ func (wc *WaveComponent) drawSliceMarkers(slices []*WaveMarker, cursor *WaveCurs
 	}
 }
 
-func (wc *WaveComponent) drawWaveform(downsamples []audio.Downsample) {
-	if len(downsamples) == 0 {
-		return
-	}
-
-	ds := downsamples[0]
-	numSamples := len(ds.Mins)
-
-	if len(ds.Maxs) < numSamples {
-		numSamples = len(ds.Maxs)
-	}
-
-	if numSamples == 0 {
-		return
-	}
-
-	xs := make([]float32, numSamples)
-
-	for i := range xs {
-		xs[i] = float32(i)
-	}
-
-	var minsPtr, maxsPtr *float32
-	if numSamples > 0 {
-		minsPtr = &ds.Mins[0]
-		maxsPtr = &ds.Maxs[0]
-	}
-
-	implot.PlotShadedFloatPtrFloatPtrFloatPtr("ch_fill_0", &xs[0], minsPtr, maxsPtr, int32(numSamples))
-	implot.PlotLineFloatPtrFloatPtr("ch_lines_min_0", &xs[0], minsPtr, int32(numSamples))
-	implot.PlotLineFloatPtrFloatPtr("ch_lines_max_0", &xs[0], maxsPtr, int32(numSamples))
-}
-
-func (wc *WaveComponent) drawTimeTicks(sampleRate int, totalSamples int, xLimitMax float64, samplesPerBin float64) {
-	xCount := int(xLimitMax) + 1
-
-	if sampleRate <= 0 || totalSamples <= 0 || xCount <= 0 || samplesPerBin <= 0 {
+func (wc *WaveComponent) drawTimeTicks(sampleRate int, totalSamples int, viewMin, viewMax float64, samplesPerBin float64) {
+	if sampleRate <= 0 || totalSamples <= 0 || viewMax <= viewMin || samplesPerBin <= 0 {
 		return
 	}
 
-	totalSec := float64(totalSamples) / float64(sampleRate)
+	startSec := (viewMin * samplesPerBin) / float64(sampleRate)
+	endSec := (viewMax * samplesPerBin) / float64(sampleRate)
 	targetTicks := 10.0
-	rawStep := totalSec / targetTicks
-	niceSteps := []float64{0.1, 0.2, 0.5, 1, 2, 5, 10, 15, 30, 60}
+	rawStep := (endSec - startSec) / targetTicks
+	niceSteps := []float64{0.0001, 0.0002, 0.0005, 0.001, 0.002, 0.005, 0.01, 0.02, 0.05, 0.1, 0.2, 0.5, 1, 2, 5, 10, 15, 30, 60}
 	step := niceSteps[len(niceSteps)-1]
 
 	for _, s := range niceSteps {
@@ -763,7 +788,9 @@ func (wc *WaveComponent) drawTimeTicks(sampleRate int, totalSamples int, xLimitM
 		}
 	}
 
-	count := int(math.Floor(totalSec/step)) + 1
+	first := int(math.Ceil(startSec / step))
+	last := int(math.Floor(endSec / step))
+	count := last - first + 1
 
 	if count <= 0 {
 		return
@@ -773,7 +800,7 @@ func (wc *WaveComponent) drawTimeTicks(sampleRate int, totalSamples int, xLimitM
 	labels := make([]string, count)
 
 	for i := 0; i < count; i++ {
-		tsec := float64(i) * step
+		tsec := float64(first+i) * step
 		positions[i] = (tsec * float64(sampleRate)) / samplesPerBin
 		labels[i] = util.SecondsLabel(tsec)
 	}
@@ -986,6 +1013,66 @@ func (wc *WaveComponent) SetRepeatMode(mode int, sliceIdx int) {
 	wc.repeatSliceIdx = sliceIdx
 }
 
+// SetSnapMode sets how bounds and slice markers snap when moved
+func (wc *WaveComponent) SetSnapMode(mode SnapMode) *WaveComponent {
+	cmd := component.UpdateCmd{Type: cmdSetWaveSnapMode, Data: mode}
+	wc.SendUpdate(cmd)
+	return wc
+}
+
+// GetSnapMode returns the current snap mode
+func (wc *WaveComponent) GetSnapMode() SnapMode {
+	return wc.snapMode
+}
+
+// SetChannelMode sets how the channels of stereo waves are laid out
+func (wc *WaveComponent) SetChannelMode(mode ChannelMode) *WaveComponent {
+	cmd := component.UpdateCmd{Type: cmdSetWaveChannelMode, Data: mode}
+	wc.SendUpdate(cmd)
+	return wc
+}
+
+// GetChannelMode returns the current channel mode
+func (wc *WaveComponent) GetChannelMode() ChannelMode {
+	return wc.channelMode
+}
+
+// SetLoop sets the sustain loop shown on the wave, in samples
+func (wc *WaveComponent) SetLoop(loop audio.LoopSettings) *WaveComponent {
+	cmd := component.UpdateCmd{Type: cmdSetWaveLoop, Data: loop}
+	wc.SendUpdate(cmd)
+	return wc
+}
+
+// GetLoop returns the current sustain loop in samples
+func (wc *WaveComponent) GetLoop() audio.LoopSettings {
+	return wc.loop
+}
+
+// IsEditingLoop returns true while a loop point is being dragged
+func (wc *WaveComponent) IsEditingLoop() bool {
+	return wc.loopMarker != nil && wc.loopMarker.IsDragging()
+}
+
+// SetViewMode switches between the waveform and spectrogram views
+func (wc *WaveComponent) SetViewMode(mode ViewMode) *WaveComponent {
+	cmd := component.UpdateCmd{Type: cmdSetWaveViewMode, Data: mode}
+	wc.SendUpdate(cmd)
+	return wc
+}
+
+// GetViewMode returns the current view mode
+func (wc *WaveComponent) GetViewMode() ViewMode {
+	return wc.viewMode
+}
+
+// SetTempo sets the tempo in BPM used by the beat grid snap mode
+func (wc *WaveComponent) SetTempo(bpm float64) *WaveComponent {
+	cmd := component.UpdateCmd{Type: cmdSetWaveTempo, Data: bpm}
+	wc.SendUpdate(cmd)
+	return wc
+}
+
 func (wc *WaveComponent) SetBounds(start, end float64) *WaveComponent {
 	payload := WaveBoundsPayload{Start: start, End: end}
 	cmd := component.UpdateCmd{Type: cmdSetWaveBounds, Data: payload}
@@ -1086,23 +1173,43 @@ func (wc *WaveComponent) Layout() {
 	implot.PushColormapPlotColormap(theme.GetCurrentColormap())
 	defer implot.PopColormap()
 
-	if implot.BeginPlotV(wc.Component.IDStr(), imgui.Vec2{X: -1, Y: -1}, wc.plotFlags) {
+	wc.drawPlot(displayData, slices, cursor, samplesPerBin)
+	wc.drawMinimap(displayData.Downsamples, float64(displayData.MinY), float64(displayData.MaxY))
+}
+
+// drawPlot draws the main waveform plot for the visible range
+func (wc *WaveComponent) drawPlot(displayData audio.WaveDisplayData, slices []*WaveMarker, cursor *WaveCursor, samplesPerBin float64) {
+	// Leave room for the minimap below
+	plotSize := imgui.Vec2{X: -1, Y: -(minimapHeight + imgui.CurrentStyle().ItemSpacing().Y)}
+
+	// Zoom and pan on X are handled by the component, so lock implot's own handling
+	plotFlags := wc.plotFlags | implot.FlagsNoBoxSelect
+	axisXFlags := wc.axisXFlags | implot.AxisFlagsLock
+
+	if implot.BeginPlotV(wc.Component.IDStr(), plotSize, plotFlags) {
 		defer implot.EndPlot()
 
 		// Setup Axis
 		xMin, xMax := 0.0, displayData.XLimitMax
 		yMin, yMax := float64(displayData.MinY), float64(displayData.MaxY)
-		implot.SetupAxesV("Time", "Amplitude", wc.axisXFlags, wc.axisYFlags)
-		implot.SetupAxisLimitsV(implot.AxisX1, xMin, xMax, implot.CondOnce)
+		if wc.viewMode == ViewWaveform {
+			yMin, yMax = wc.plotYRange(len(wc.lanes()))
+		}
+		implot.SetupAxesV("Time", "Amplitude", axisXFlags, wc.axisYFlags)
+		implot.SetupAxisLimitsV(implot.AxisX1, wc.viewMin, wc.viewMax, implot.CondAlways)
 		implot.SetupAxisLimitsV(implot.AxisY1, yMin, yMax, implot.CondOnce)
 
 		boundsStartValue := wc.boundsStart
 		boundsEndValue := wc.boundsEnd
 
 		// Draw elements using ViewModel data
-		wc.drawTimeTicks(displayData.SampleRate, displayData.NumSamples, xMax, samplesPerBin)
+		wc.drawTimeTicks(displayData.SampleRate, displayData.NumSamples, wc.viewMin, wc.viewMax, samplesPerBin)
+		wc.handleZoomAndPan()
 		wc.handleUserInteraction(xMin, xMax)
-		wc.drawWaveform(displayData.Downsamples)
+		if wc.viewMode != ViewSpectrogram || !wc.drawSpectrogram(yMin, yMax) {
+			wc.drawWaveform()
+		}
+		wc.drawBeatGrid(wc.viewMin, wc.viewMax)
 		wc.drawOutOfBounds(boundsStartValue, boundsEndValue, yMin)
 
 		var cursorBin float64
@@ -1126,6 +1233,7 @@ func (wc *WaveComponent) Layout() {
 			yMin, yMax,
 		)
 		wc.drawSliceMarkers(slices, cursor, boundsStartValue, boundsEndValue, xMin, xMax, samplesPerBin, displayData.SampleRate, yMin, yMax)
+		wc.drawLoopMarker(yMin, yMax)
 	}
 }
 
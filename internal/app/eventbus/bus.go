@@ -68,6 +68,35 @@ func (bus *EventBus) Publish(event events.Event) {
 	}
 }
 
+// PublishWait sends an event to all subscribed channels, waiting for room in full ones
+// instead of dropping the event. Returns false if stop was closed before every
+// subscriber got the event.
+func (bus *EventBus) PublishWait(event events.Event, stop <-chan struct{}) bool {
+	bus.mu.RLock()
+
+	subs, ok := bus.subscribers[event.Type()]
+	if !ok {
+		bus.mu.RUnlock()
+		return true
+	}
+
+	channelsToPublish := make([]EventChannel, 0, len(subs))
+	for _, ch := range subs {
+		channelsToPublish = append(channelsToPublish, ch)
+	}
+
+	bus.mu.RUnlock()
+
+	for _, ch := range channelsToPublish {
+		select {
+		case ch <- event:
+		case <-stop:
+			return false
+		}
+	}
+	return true
+}
+
 func NewEventBus() *EventBus {
 	return &EventBus{
 		subscribers: make(map[string]map[string]EventChannel),
@@ -0,0 +1,32 @@
+package events
+
+type LibrarySearchEvent int32
+
+// Library Search Event Enums
+const (
+	// LibraryFindSimilarEvent asks the library to list the samples that sound like a file
+	LibraryFindSimilarEvent LibrarySearchEvent = iota
+)
+
+// Library Search Event Keys
+const (
+	LibraryFindSimilarKey = "library.search.similar"
+)
+
+// LibrarySearchEventRecord holds data for searches started outside the library window.
+type LibrarySearchEventRecord struct {
+	// EventType is the enum value (e.g., LibraryFindSimilarEvent).
+	EventType LibrarySearchEvent
+	// Path is the file searched for.
+	Path string
+}
+
+// Type implements the events.Event interface
+func (e LibrarySearchEventRecord) Type() string {
+	switch e.EventType {
+	case LibraryFindSimilarEvent:
+		return LibraryFindSimilarKey
+	default:
+		return "library.search.unknown"
+	}
+}
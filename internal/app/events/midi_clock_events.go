@@ -0,0 +1,47 @@
+package events
+
+type MidiClockEventType int32
+
+// MIDI Clock Event Enums
+const (
+	MidiClockStartedEvent MidiClockEventType = iota
+	MidiClockStoppedEvent
+	MidiClockTempoEvent
+	MidiClockPositionEvent
+)
+
+// MIDI Clock Event Keys
+const (
+	MidiClockStartedKey  = "midi.clock.started"
+	MidiClockStoppedKey  = "midi.clock.stopped"
+	MidiClockTempoKey    = "midi.clock.tempo"
+	MidiClockPositionKey = "midi.clock.position"
+)
+
+// MidiClockEventRecord holds the state of the external MIDI clock after a change
+type MidiClockEventRecord struct {
+	// EventType is the enum value (e.g., MidiClockTempoEvent)
+	EventType MidiClockEventType
+	// Tempo is the measured clock tempo in BPM, 0 when no clock is received
+	Tempo float64
+	// Beat is the song position in beats
+	Beat float64
+	// Running is true between a start or continue and a stop
+	Running bool
+}
+
+// Type implements the events.Event interface
+func (e MidiClockEventRecord) Type() string {
+	switch e.EventType {
+	case MidiClockStartedEvent:
+		return MidiClockStartedKey
+	case MidiClockStoppedEvent:
+		return MidiClockStoppedKey
+	case MidiClockTempoEvent:
+		return MidiClockTempoKey
+	case MidiClockPositionEvent:
+		return MidiClockPositionKey
+	default:
+		return "midi.clock.unknown"
+	}
+}
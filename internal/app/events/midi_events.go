@@ -1,5 +1,7 @@
 package events
 
+import "time"
+
 // MidiEventType defines the type of MIDI message.
 type MidiEventType int
 
@@ -12,6 +14,11 @@ const (
 	MidiProgramChangeEvent
 	MidiAfterTouchEvent
 	MidiPolyAfterTouchEvent
+	MidiClockEvent
+	MidiStartEvent
+	MidiContinueEvent
+	MidiStopEvent
+	MidiSongPositionEvent
 )
 
 // Midi Event Keys
@@ -23,6 +30,11 @@ const (
 	MidiProgramChangeKey  = "midi.program_change"
 	MidiAfterTouchKey     = "midi.after_touch"
 	MidiPolyAfterTouchKey = "midi.poly_after_touch"
+	MidiClockKey          = "midi.clock"
+	MidiStartKey          = "midi.start"
+	MidiContinueKey       = "midi.continue"
+	MidiStopKey           = "midi.stop"
+	MidiSongPositionKey   = "midi.song_position"
 	MidiUnknownKey        = "midi.unknown"
 )
 
@@ -34,6 +46,9 @@ type MidiEventRecord struct {
 	Timestamp int32
 	// PortID is the name of the port this message came from.
 	PortID string
+	// Received is when the message arrived, read from the monotonic clock in the driver
+	// callback. Unlike Timestamp it isn't rounded to the millisecond.
+	Received time.Time
 
 	// Channel is the MIDI channel (0-15).
 	Channel uint8
@@ -46,7 +61,7 @@ type MidiEventRecord struct {
 	Controller uint8
 	Value      uint8
 
-	// For PitchBend (14-bit value, 0-16383)
+	// For PitchBend (14-bit value, 0-16383) and SongPosition (in 16th notes)
 	Value14 uint16
 }
 
@@ -67,6 +82,16 @@ func (e MidiEventRecord) Type() string {
 		return MidiAfterTouchKey
 	case MidiPolyAfterTouchEvent:
 		return MidiPolyAfterTouchKey
+	case MidiClockEvent:
+		return MidiClockKey
+	case MidiStartEvent:
+		return MidiStartKey
+	case MidiContinueEvent:
+		return MidiContinueKey
+	case MidiStopEvent:
+		return MidiStopKey
+	case MidiSongPositionEvent:
+		return MidiSongPositionKey
 	default:
 		return MidiUnknownKey
 	}
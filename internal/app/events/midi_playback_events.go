@@ -9,6 +9,7 @@ const (
 	MidiPlaybackNoteOnEvent
 	MidiPlaybackNoteOffEvent
 	MidiPlaybackCCEvent
+	MidiPlaybackProgramChangeEvent
 )
 
 // MIDI Playback Event Keys
@@ -18,6 +19,7 @@ const (
 	MidiPlaybackNoteOnKey  = "midi.playback.noteon"
 	MidiPlaybackNoteOffKey = "midi.playback.noteoff"
 	MidiPlaybackCCKey      = "midi.playback.cc"
+	MidiPlaybackProgramKey = "midi.playback.program"
 )
 
 // MidiPlaybackEventRecord holds data for MIDI playback events
@@ -32,7 +34,9 @@ type MidiPlaybackEventRecord struct {
 	CC int
 	// CCValue is the MIDI CC value
 	CCValue int
-	// Channel is the MIDI channel
+	// Program is the MIDI program number for program changes
+	Program int
+	// Channel is the MIDI channel (0-15), events on other channels are not sent
 	Channel int
 	// OwnerID identifies which window/component initiated this MIDI playback
 	OwnerID string
@@ -51,6 +55,8 @@ func (e MidiPlaybackEventRecord) Type() string {
 		return MidiPlaybackNoteOffKey
 	case MidiPlaybackCCEvent:
 		return MidiPlaybackCCKey
+	case MidiPlaybackProgramChangeEvent:
+		return MidiPlaybackProgramKey
 	default:
 		return "midi.playback.unknown"
 	}
@@ -4,14 +4,22 @@ type PadGridEvent int32
 
 const (
 	PadGridSelectEvent PadGridEvent = iota
+	PadGridTriggerEvent
+	PadGridReleaseEvent
 )
 const (
-	PadGridSelectKey = "padgrid.select"
+	PadGridSelectKey  = "padgrid.select"
+	PadGridTriggerKey = "padgrid.trigger"
+	PadGridReleaseKey = "padgrid.release"
 )
 
 type PadGridEventRecord struct {
 	EventType PadGridEvent
 	Pad       interface{}
+	// Row and Col locate the pad for trigger and release events
+	Row, Col int
+	// Velocity is the trigger velocity from 0.0 to 1.0
+	Velocity float32
 	// OwnerID is the UUID of the window that owns this pad grid
 	OwnerID string
 }
@@ -20,6 +28,10 @@ func (e PadGridEventRecord) Type() string {
 	switch e.EventType {
 	case PadGridSelectEvent:
 		return PadGridSelectKey
+	case PadGridTriggerEvent:
+		return PadGridTriggerKey
+	case PadGridReleaseEvent:
+		return PadGridReleaseKey
 	default:
 		return "padgrid.unknown"
 	}
@@ -6,12 +6,15 @@ type PresetEvent int32
 
 const (
 	PresetLoadEvent PresetEvent = iota
+	// PresetChangedEvent carries the folder of a preset whose preset.xml changed on disk
+	PresetChangedEvent
 )
 
 // PresetEvent Event Keys
 
 const (
-	PresetLoadEventKey = "preset.load"
+	PresetLoadEventKey    = "preset.load"
+	PresetChangedEventKey = "preset.changed"
 )
 
 // PresetEventRecord holds data for preset events.
@@ -28,6 +31,8 @@ func (e PresetEventRecord) Type() string {
 	switch e.EventType {
 	case PresetLoadEvent:
 		return PresetLoadEventKey
+	case PresetChangedEvent:
+		return PresetChangedEventKey
 	default:
 		return "preset.unknown"
 	}
@@ -0,0 +1,278 @@
+package cardcheck
+
+/*
+┍━━━━━━━━━━━━━━━━━━╳┑
+│ Card Check Window │
+└───────────────────┘
+*/
+
+import (
+	"bitbox-editor/internal/app/font"
+	"bitbox-editor/internal/app/window"
+	"bitbox-editor/internal/app/window/storage"
+	"bitbox-editor/internal/io"
+	"bitbox-editor/internal/io/compliance"
+	"bitbox-editor/internal/logging"
+	"fmt"
+	"path/filepath"
+
+	"github.com/AllenDang/cimgui-go/imgui"
+	"go.uber.org/zap"
+)
+
+var log = logging.NewLogger("cardcheck")
+
+// renameRow is a suggested rename the user can edit or leave out
+type renameRow struct {
+	name     string
+	selected bool
+}
+
+// CardCheckWindow lists files the card's FAT file system or the Bitbox can't handle and
+// renames them, updating the presets that reference them
+type CardCheckWindow struct {
+	*window.Window[*CardCheckWindow]
+
+	// locations returns the storage locations that can be checked
+	locations func() []*storage.StorageLocation
+
+	path    string
+	report  *compliance.Report
+	renames map[string]*renameRow
+	busy    bool
+	status  string
+	// notice is the outcome of the last rename, kept across the check that follows it
+	notice string
+
+	tableFlags imgui.TableFlags
+}
+
+func NewCardCheckWindow(locations func() []*storage.StorageLocation) *CardCheckWindow {
+	w := &CardCheckWindow{
+		locations: locations,
+		renames:   make(map[string]*renameRow),
+		tableFlags: imgui.TableFlagsResizable |
+			imgui.TableFlagsRowBg |
+			imgui.TableFlagsScrollY |
+			imgui.TableFlagsSizingFixedFit,
+	}
+
+	w.Window = window.NewWindow[*CardCheckWindow]("Card Check", "ShieldCheck", w.handleUpdate)
+	w.Window.SetLayoutBuilder(w)
+
+	// Opened from the View menu when needed
+	w.SetClose()
+
+	return w
+}
+
+// handleUpdate - processes incoming update commands
+func (w *CardCheckWindow) handleUpdate(cmd UpdateCmd) {
+	switch c := cmd.Type.(type) {
+	case window.GlobalCommand:
+		w.Window.HandleGlobalUpdate(cmd)
+		return
+
+	case localCommand:
+		switch c {
+		case cmdCardCheckSetReport:
+			if report, ok := cmd.Data.(*compliance.Report); ok {
+				w.report = report
+				w.busy = false
+
+				w.renames = make(map[string]*renameRow)
+				for _, rename := range report.Renames() {
+					w.renames[rename.Path] = &renameRow{name: rename.Name, selected: true}
+				}
+
+				if len(report.Issues) == 0 {
+					w.status = "No problems found"
+				} else {
+					w.status = fmt.Sprintf("%d errors, %d warnings",
+						report.Errors(), len(report.Issues)-report.Errors())
+				}
+			}
+
+		case cmdCardCheckSetStatus:
+			if status, ok := cmd.Data.(string); ok {
+				w.busy = false
+				w.notice = status
+				w.check()
+			}
+
+		case cmdCardCheckSetError:
+			if err, ok := cmd.Data.(error); ok {
+				w.busy = false
+				w.status = err.Error()
+				w.notice = ""
+			}
+		}
+		return
+
+	default:
+		log.Warn("CardCheckWindow unhandled update", zap.Any("cmd", cmd))
+	}
+}
+
+// check scans the chosen location in the background
+func (w *CardCheckWindow) check() {
+	if w.path == "" {
+		return
+	}
+
+	w.busy = true
+	w.status = "Checking..."
+	path := w.path
+
+	go func() {
+		tree := io.NewFSTree(path)
+		if err := tree.ScanDirectory(path, "*"); err != nil {
+			log.Error("Failed to scan directory", zap.Error(err), zap.String("path", path))
+			w.SendUpdate(UpdateCmd{Type: cmdCardCheckSetError, Data: err})
+			return
+		}
+		w.SendUpdate(UpdateCmd{Type: cmdCardCheckSetReport, Data: compliance.Check(tree)})
+	}()
+}
+
+// applyRenames renames the selected files in the background
+func (w *CardCheckWindow) applyRenames() {
+	var renames []compliance.Rename
+	for path, row := range w.renames {
+		if row.selected && row.name != "" && row.name != filepath.Base(path) {
+			renames = append(renames, compliance.Rename{Path: path, Name: row.name})
+		}
+	}
+	if len(renames) == 0 {
+		return
+	}
+
+	w.busy = true
+	w.status = "Renaming..."
+	root := w.path
+
+	go func() {
+		updated, err := compliance.Apply(root, renames)
+		if err != nil {
+			log.Error("Failed to rename files", zap.Error(err))
+			w.SendUpdate(UpdateCmd{Type: cmdCardCheckSetError, Data: err})
+			return
+		}
+		w.SendUpdate(UpdateCmd{
+			Type: cmdCardCheckSetStatus,
+			Data: fmt.Sprintf("Renamed %d files, updated %d presets", len(renames), updated),
+		})
+	}()
+}
+
+func (w *CardCheckWindow) Menu() {}
+
+func (w *CardCheckWindow) Layout() {
+	w.Window.ProcessUpdates()
+
+	preview := w.path
+	if preview == "" {
+		preview = "Choose location"
+	}
+	imgui.SetNextItemWidth(260)
+	if imgui.BeginCombo("##card_check_location", preview) {
+		for _, loc := range w.locations() {
+			label := loc.Path
+			if loc.Name != "" && loc.Name != loc.Path {
+				label = fmt.Sprintf("%s (%s)", loc.Name, loc.Path)
+			}
+			if imgui.SelectableBoolV(label, loc.Path == w.path, imgui.SelectableFlagsNone, imgui.Vec2{}) && loc.Path != w.path {
+				w.path = loc.Path
+				w.report = nil
+				w.status = ""
+			}
+		}
+		imgui.EndCombo()
+	}
+	imgui.SameLine()
+
+	imgui.BeginDisabledV(w.busy || w.path == "")
+	if imgui.Button(font.Icon("ScanSearch") + " Check") {
+		w.notice = ""
+		w.check()
+	}
+	imgui.SameLine()
+
+	selected := 0
+	for _, row := range w.renames {
+		if row.selected {
+			selected++
+		}
+	}
+	imgui.BeginDisabledV(selected == 0)
+	if imgui.Button(fmt.Sprintf("%s Rename Selected (%d)", font.Icon("WandSparkles"), selected)) {
+		w.applyRenames()
+	}
+	if imgui.IsItemHoveredV(imgui.HoveredFlagsAllowWhenDisabled) {
+		imgui.SetTooltip("Rename the files and update the presets that use them")
+	}
+	imgui.EndDisabled()
+	imgui.EndDisabled()
+
+	if w.notice != "" {
+		imgui.Text(w.notice)
+		imgui.SameLine()
+	}
+	if w.status != "" {
+		imgui.TextDisabled(w.status)
+	}
+
+	if w.report != nil && len(w.report.Issues) > 0 {
+		w.layoutIssues()
+	}
+}
+
+// layoutIssues draws the problems found, fixable ones with their new name
+func (w *CardCheckWindow) layoutIssues() {
+	if !imgui.BeginTableV("card_check_issues", 4, w.tableFlags, imgui.Vec2{}, 0) {
+		return
+	}
+	defer imgui.EndTable()
+
+	static := imgui.TableColumnFlagsWidthFixed
+	stretch := imgui.TableColumnFlagsWidthStretch
+	imgui.TableSetupScrollFreeze(0, 1)
+	imgui.TableSetupColumnV("Problem", static, 120, 0)
+	imgui.TableSetupColumnV("Path", stretch, 1, 0)
+	imgui.TableSetupColumnV("Details", stretch, 1, 0)
+	imgui.TableSetupColumnV("Rename To", static, 220, 0)
+	imgui.TableHeadersRow()
+
+	warning := imgui.Vec4{X: 0.9, Y: 0.7, Z: 0.2, W: 1.0}
+	failure := imgui.Vec4{X: 1.0, Y: 0.3, Z: 0.3, W: 1.0}
+
+	for i, issue := range w.report.Issues {
+		imgui.TableNextRow()
+		imgui.TableNextColumn()
+		if issue.Kind.Warning() {
+			imgui.TextColored(warning, issue.Kind.String())
+		} else {
+			imgui.TextColored(failure, issue.Kind.String())
+		}
+
+		imgui.TableNextColumn()
+		path := issue.Path
+		if rel, err := filepath.Rel(w.report.Root, issue.Path); err == nil {
+			path = rel
+		}
+		imgui.Text(path)
+
+		imgui.TableNextColumn()
+		imgui.Text(issue.Message)
+
+		imgui.TableNextColumn()
+		row, ok := w.renames[issue.Path]
+		if !ok || issue.Suggested == "" {
+			continue
+		}
+		imgui.Checkbox(fmt.Sprintf("##rename_sel_%d", i), &row.selected)
+		imgui.SameLine()
+		imgui.SetNextItemWidth(-1)
+		imgui.InputTextWithHint(fmt.Sprintf("##rename_name_%d", i), "New name", &row.name, imgui.InputTextFlagsNone, nil)
+	}
+}
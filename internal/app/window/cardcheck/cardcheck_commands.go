@@ -0,0 +1,16 @@
+package cardcheck
+
+import (
+	"bitbox-editor/internal/app/window"
+)
+
+type UpdateCmd = window.UpdateCmd
+type UpdateCmdType = window.UpdateCmdType
+
+type localCommand int
+
+const (
+	cmdCardCheckSetReport localCommand = iota
+	cmdCardCheckSetStatus
+	cmdCardCheckSetError
+)
@@ -0,0 +1,353 @@
+package duplicates
+
+/*
+┍━━━━━━━━━━━━━━━━━━╳┑
+│ Duplicates Window │
+└───────────────────┘
+*/
+
+import (
+	"bitbox-editor/internal/app/font"
+	"bitbox-editor/internal/app/window"
+	"bitbox-editor/internal/app/window/storage"
+	"bitbox-editor/internal/io"
+	"bitbox-editor/internal/io/dedupe"
+	"bitbox-editor/internal/io/drive/space"
+	"bitbox-editor/internal/logging"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/AllenDang/cimgui-go/imgui"
+	"go.uber.org/zap"
+)
+
+var log = logging.NewLogger("duplicates")
+
+const confirmMergePopupID = "Remove Similar Files##duplicates_confirm_merge"
+
+// DuplicatesWindow finds copies of the same sample on a card, shows the presets using
+// each copy and merges them into one
+type DuplicatesWindow struct {
+	*window.Window[*DuplicatesWindow]
+
+	// locations returns the storage locations that can be searched
+	locations func() []*storage.StorageLocation
+
+	path   string
+	report *dedupe.Report
+	// keep is the file kept of each group when merging, by group index
+	keep   []int
+	busy   bool
+	status string
+	// notice is the outcome of the last merge, kept across the search that follows it
+	notice string
+
+	// done and total count the files fingerprinted by a running search
+	done, total atomic.Int64
+
+	tableFlags imgui.TableFlags
+}
+
+func NewDuplicatesWindow(locations func() []*storage.StorageLocation) *DuplicatesWindow {
+	w := &DuplicatesWindow{
+		locations: locations,
+		tableFlags: imgui.TableFlagsResizable |
+			imgui.TableFlagsRowBg |
+			imgui.TableFlagsSizingFixedFit,
+	}
+
+	w.Window = window.NewWindow[*DuplicatesWindow]("Duplicates", "Files", w.handleUpdate)
+	w.Window.SetLayoutBuilder(w)
+
+	// Opened from the View menu when needed
+	w.SetClose()
+
+	return w
+}
+
+// handleUpdate - processes incoming update commands
+func (w *DuplicatesWindow) handleUpdate(cmd UpdateCmd) {
+	switch c := cmd.Type.(type) {
+	case window.GlobalCommand:
+		w.Window.HandleGlobalUpdate(cmd)
+		return
+
+	case localCommand:
+		switch c {
+		case cmdDuplicatesSetReport:
+			if report, ok := cmd.Data.(*dedupe.Report); ok {
+				w.report = report
+				w.busy = false
+
+				w.keep = make([]int, len(report.Groups))
+				for i := range report.Groups {
+					w.keep[i] = report.Groups[i].Keep()
+				}
+
+				switch {
+				case len(report.Groups) == 0:
+					w.status = fmt.Sprintf("No duplicates among %d samples", report.Scanned)
+				default:
+					w.status = fmt.Sprintf("%d groups of duplicates among %d samples, %s can be freed",
+						len(report.Groups), report.Scanned, space.FormatBytes(uint64(report.Wasted())))
+				}
+				if report.Failed > 0 {
+					w.status += fmt.Sprintf(", %d couldn't be read", report.Failed)
+				}
+				if report.PresetsErr != nil {
+					w.status += ". Some presets couldn't be read, fix them before merging"
+				}
+			}
+
+		case cmdDuplicatesSetStatus:
+			if status, ok := cmd.Data.(string); ok {
+				w.busy = false
+				w.notice = status
+				w.scan()
+			}
+
+		case cmdDuplicatesSetError:
+			if err, ok := cmd.Data.(error); ok {
+				w.busy = false
+				w.status = err.Error()
+				w.notice = ""
+			}
+		}
+		return
+
+	default:
+		log.Warn("DuplicatesWindow unhandled update", zap.Any("cmd", cmd))
+	}
+}
+
+// scan looks for duplicates in the chosen location in the background
+func (w *DuplicatesWindow) scan() {
+	if w.path == "" {
+		return
+	}
+
+	w.busy = true
+	w.status = "Scanning..."
+	w.done.Store(0)
+	w.total.Store(0)
+	path := w.path
+
+	go func() {
+		tree := io.NewFSTree(path)
+		if err := tree.ScanDirectory(path, ".wav"); err != nil {
+			log.Error("Failed to scan directory", zap.Error(err), zap.String("path", path))
+			w.SendUpdate(UpdateCmd{Type: cmdDuplicatesSetError, Data: err})
+			return
+		}
+
+		report, err := dedupe.Scan(tree, func(done, total int) {
+			w.done.Store(int64(done))
+			w.total.Store(int64(total))
+		})
+		if err != nil {
+			log.Error("Failed to find duplicates", zap.Error(err), zap.String("path", path))
+			w.SendUpdate(UpdateCmd{Type: cmdDuplicatesSetError, Data: err})
+			return
+		}
+		w.SendUpdate(UpdateCmd{Type: cmdDuplicatesSetReport, Data: report})
+	}()
+}
+
+// consolidate merges a group into the file chosen to keep in the background
+func (w *DuplicatesWindow) consolidate(index int) {
+	group := w.report.Groups[index]
+	keep := group.Files[w.keep[index]].Path
+
+	var remove []string
+	for _, file := range group.Files {
+		if file.Path != keep {
+			remove = append(remove, file.Path)
+		}
+	}
+
+	w.busy = true
+	w.status = "Merging..."
+	root := w.path
+
+	go func() {
+		updated, err := dedupe.Consolidate(root, keep, remove)
+		if err != nil {
+			log.Error("Failed to merge duplicates", zap.Error(err))
+			w.SendUpdate(UpdateCmd{Type: cmdDuplicatesSetError, Data: err})
+			return
+		}
+		w.SendUpdate(UpdateCmd{
+			Type: cmdDuplicatesSetStatus,
+			Data: fmt.Sprintf("Kept %s, removed %d copies, updated %d presets", filepath.Base(keep), len(remove), updated),
+		})
+	}()
+}
+
+func (w *DuplicatesWindow) Menu() {}
+
+func (w *DuplicatesWindow) Layout() {
+	w.Window.ProcessUpdates()
+
+	preview := w.path
+	if preview == "" {
+		preview = "Choose location"
+	}
+	imgui.SetNextItemWidth(260)
+	if imgui.BeginCombo("##duplicates_location", preview) {
+		for _, loc := range w.locations() {
+			label := loc.Path
+			if loc.Name != "" && loc.Name != loc.Path {
+				label = fmt.Sprintf("%s (%s)", loc.Name, loc.Path)
+			}
+			if imgui.SelectableBoolV(label, loc.Path == w.path, imgui.SelectableFlagsNone, imgui.Vec2{}) && loc.Path != w.path {
+				w.path = loc.Path
+				w.report = nil
+				w.status = ""
+				w.notice = ""
+			}
+		}
+		imgui.EndCombo()
+	}
+	imgui.SameLine()
+
+	imgui.BeginDisabledV(w.busy || w.path == "")
+	if imgui.Button(font.Icon("ScanSearch") + " Find Duplicates") {
+		w.notice = ""
+		w.scan()
+	}
+	imgui.EndDisabled()
+
+	if w.busy && w.total.Load() > 0 {
+		done, total := w.done.Load(), w.total.Load()
+		imgui.ProgressBarV(float32(done)/float32(total), imgui.Vec2{X: -1}, fmt.Sprintf("%d / %d samples", done, total))
+	}
+
+	if w.notice != "" {
+		imgui.Text(w.notice)
+		imgui.SameLine()
+	}
+	if w.status != "" {
+		imgui.TextDisabled(w.status)
+	}
+
+	if w.report != nil && len(w.report.Groups) > 0 {
+		imgui.BeginDisabledV(w.busy)
+		if imgui.BeginChildStrV("duplicates_groups", imgui.Vec2{}, imgui.ChildFlagsNone, imgui.WindowFlagsNone) {
+			for i := range w.report.Groups {
+				w.layoutGroup(i)
+			}
+		}
+		imgui.EndChild()
+		imgui.EndDisabled()
+	}
+}
+
+// layoutGroup draws the files of a group, with the one to keep chosen
+func (w *DuplicatesWindow) layoutGroup(index int) {
+	group := &w.report.Groups[index]
+
+	kind := "Similar sound"
+	if group.Exact {
+		kind = "Exact copies"
+	}
+	keep := group.Files[w.keep[index]]
+	label := fmt.Sprintf("%s %s: %s, %d files, %s##duplicates_group_%d",
+		font.Icon("Copy"), kind, filepath.Base(keep.Path), len(group.Files),
+		space.FormatBytes(uint64(group.Wasted())), index)
+
+	if !imgui.CollapsingHeaderTreeNodeFlagsV(label, imgui.TreeNodeFlagsDefaultOpen) {
+		return
+	}
+
+	imgui.PushIDInt(int32(index))
+	defer imgui.PopID()
+
+	if imgui.BeginTableV("duplicates_files", 4, w.tableFlags, imgui.Vec2{}, 0) {
+		static := imgui.TableColumnFlagsWidthFixed
+		stretch := imgui.TableColumnFlagsWidthStretch
+		imgui.TableSetupColumnV("Keep", static, 40, 0)
+		imgui.TableSetupColumnV("Path", stretch, 1, 0)
+		imgui.TableSetupColumnV("Size", static, 80, 0)
+		imgui.TableSetupColumnV("Presets", static, 80, 0)
+		imgui.TableHeadersRow()
+
+		for i, file := range group.Files {
+			imgui.TableNextRow()
+			imgui.TableNextColumn()
+			if imgui.RadioButtonBool(fmt.Sprintf("##keep_%d", i), w.keep[index] == i) {
+				w.keep[index] = i
+			}
+
+			imgui.TableNextColumn()
+			imgui.Text(w.relPath(file.Path))
+
+			imgui.TableNextColumn()
+			imgui.Text(space.FormatBytes(uint64(file.Size)))
+
+			imgui.TableNextColumn()
+			if len(file.Presets) == 0 {
+				imgui.TextDisabled("none")
+				continue
+			}
+			imgui.Text(fmt.Sprintf("%d", len(file.Presets)))
+			if imgui.IsItemHovered() {
+				presets := make([]string, len(file.Presets))
+				for p, preset := range file.Presets {
+					presets[p] = w.relPath(filepath.Dir(preset))
+				}
+				imgui.SetTooltip(strings.Join(presets, "\n"))
+			}
+		}
+		imgui.EndTable()
+	}
+
+	// Near duplicates differ in length or content, positions set in presets for the
+	// removed files may not fit the kept one, so they are listed and confirmed first
+	imgui.BeginDisabledV(w.report.PresetsErr != nil)
+	if imgui.Button(font.Icon("Merge") + " Keep Selected, Remove Others") {
+		if group.Exact {
+			w.consolidate(index)
+		} else {
+			imgui.OpenPopupStr(confirmMergePopupID)
+		}
+	}
+	imgui.EndDisabled()
+	if imgui.IsItemHoveredV(imgui.HoveredFlagsAllowWhenDisabled) {
+		if w.report.PresetsErr != nil {
+			imgui.SetTooltip("Some presets couldn't be read, they may still use these files")
+		} else {
+			imgui.SetTooltip("Point the presets using the other files at the kept one, then delete the other files")
+		}
+	}
+
+	if imgui.BeginPopupModalV(confirmMergePopupID, nil, imgui.WindowFlagsAlwaysAutoResize) {
+		imgui.Text(fmt.Sprintf("Keep %s and delete these files?", w.relPath(keep.Path)))
+		for i, file := range group.Files {
+			if i != w.keep[index] {
+				imgui.BulletText(w.relPath(file.Path))
+			}
+		}
+		imgui.TextDisabled("The files sound alike but are not the same. Loop points, sample starts and\n" +
+			"slices of presets using them may land elsewhere in the kept file.")
+		if imgui.Button(fmt.Sprintf("Delete %d Files", len(group.Files)-1)) {
+			w.consolidate(index)
+			imgui.CloseCurrentPopup()
+		}
+		imgui.SameLine()
+		if imgui.Button("Cancel") {
+			imgui.CloseCurrentPopup()
+		}
+		imgui.EndPopup()
+	}
+	imgui.Spacing()
+}
+
+// relPath returns a path relative to the location searched
+func (w *DuplicatesWindow) relPath(path string) string {
+	if rel, err := filepath.Rel(w.report.Root, path); err == nil {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,16 @@
+package duplicates
+
+import (
+	"bitbox-editor/internal/app/window"
+)
+
+type UpdateCmd = window.UpdateCmd
+type UpdateCmdType = window.UpdateCmdType
+
+type localCommand int
+
+const (
+	cmdDuplicatesSetReport localCommand = iota
+	cmdDuplicatesSetStatus
+	cmdDuplicatesSetError
+)
@@ -19,9 +19,13 @@ import (
 	"bitbox-editor/internal/app/window"
 	"bitbox-editor/internal/app/window/storage"
 	"bitbox-editor/internal/audio"
+	"bitbox-editor/internal/audio/search"
 	"bitbox-editor/internal/io"
+	"bitbox-editor/internal/io/file"
 	"bitbox-editor/internal/logging"
 	"fmt"
+	"path/filepath"
+	"sync/atomic"
 
 	"github.com/AllenDang/cimgui-go/imgui"
 	"go.uber.org/zap"
@@ -38,6 +42,11 @@ const (
 	cmdLibSetTreeRows
 	cmdLibSetSearchQuery
 	cmdHandleScanEvent
+	cmdLibHandleUnmount
+	cmdLibSetWatcher
+	cmdLibSetSearchStatus
+	cmdLibFindSimilar
+	cmdLibSetSimilar
 )
 
 var log = logging.NewLogger("library")
@@ -56,11 +65,27 @@ func hashString(s string) uint32 {
 type LibraryWindow struct {
 	*window.Window[*LibraryWindow]
 
-	storageLoc    *storage.StorageLocation
-	fsTree        *io.FSTree
-	searchQuery   string
-	searchResults []*io.FSEntry
-	isScanning    bool
+	storageLoc  *storage.StorageLocation
+	fsTree      *io.FSTree
+	searchQuery string
+	isScanning  bool
+	watcher     *file.Watcher
+
+	// query is the parsed search query, searchErr why the last query couldn't be parsed
+	query        *search.Query
+	searchErr    string
+	searchStatus string
+	// searchGen counts searches so a running search stops once a newer one starts
+	searchGen atomic.Int64
+
+	// newTag is the tag being typed in a file's context menu
+	newTag string
+
+	// similar lists the samples like a file, shown above the library
+	similar       *similarResults
+	similarStatus string
+	// similarGen counts similarity searches so a running one stops once a newer one starts
+	similarGen atomic.Int64
 
 	// child component
 	Components struct {
@@ -74,13 +99,21 @@ func (w *LibraryWindow) createTreeRowsFromData(data []tree.TreeRowData) []*tree.
 	rows := make([]*tree.TreeRowComponent, len(data))
 
 	for i, rowData := range data {
+		key := rowData.ID
+		if key == "" {
+			key = rowData.Path
+		}
+
 		displayName := rowData.Icon + " " + rowData.Name
-		textHash := imgui.ID(hashString(rowData.Path + ":text"))
+		if rowData.IsAudio {
+			displayName += w.annotationSuffix(rowData.Path)
+		}
+		textHash := imgui.ID(hashString(key + ":text"))
 		textComp := text.NewTextWithID(textHash, displayName)
 		layoutComponents := []component.ComponentType{textComp}
 
 		if rowData.IsAudio {
-			pathHash := imgui.ID(hashString(rowData.Path + ":waveform"))
+			pathHash := imgui.ID(hashString(key + ":waveform"))
 			waveform := miniwave.NewMiniWaveform(pathHash, rowData.Path)
 			layoutComponents = append(layoutComponents, waveform)
 		} else if !rowData.IsDir {
@@ -112,14 +145,39 @@ func (w *LibraryWindow) createTreeRowsFromData(data []tree.TreeRowData) []*tree.
 		layoutComponents = append(layoutComponents, text.NewText(rowData.SizeText))
 
 		row := tree.NewTreeRow(
-			imgui.ID(hashString(rowData.Path)),
+			imgui.ID(hashString(key)),
 			layoutComponents...,
-		).Flags(
-			imgui.TreeNodeFlagsSpanAllColumns |
-				imgui.TreeNodeFlagsDrawLinesToNodes |
-				imgui.TreeNodeFlagsLabelSpanAllColumns,
 		)
 
+		flags := imgui.TreeNodeFlagsSpanAllColumns |
+			imgui.TreeNodeFlagsDrawLinesToNodes |
+			imgui.TreeNodeFlagsLabelSpanAllColumns
+		if rowData.Open {
+			flags |= imgui.TreeNodeFlagsDefaultOpen
+		}
+		row.Flags(flags)
+
+		if len(rowData.Highlights) > 0 {
+			// Highlights are offsets into the name, the label starts with the icon
+			offset := len(rowData.Icon) + 1
+			highlights := make([][2]int, len(rowData.Highlights))
+			for j, h := range rowData.Highlights {
+				highlights[j] = [2]int{h[0] + offset, h[1] + offset}
+			}
+			row.SetHighlights(highlights)
+		}
+
+		if rowData.IsAudio {
+			path := rowData.Path
+			row.SetContextMenu(func() {
+				if imgui.MenuItemBool(font.Icon("AudioLines") + " Find Similar") {
+					w.findSimilar(path)
+				}
+				imgui.Separator()
+				w.layoutAnnotationMenu(path)
+			})
+		}
+
 		if rowData.DragDropType != "" {
 			row.SetDragDropData(rowData.DragDropType, rowData.Path)
 			tooltipName := rowData.Name
@@ -160,8 +218,13 @@ func (w *LibraryWindow) drainEvents() {
 		for {
 			select {
 			case event := <-w.filteredEventSub.Events():
-				if e, ok := event.(events.LibraryScanEventRecord); ok {
+				switch e := event.(type) {
+				case events.LibraryScanEventRecord:
 					w.SendUpdate(UpdateCmd{Type: cmdHandleScanEvent, Data: e})
+				case events.StorageEventRecord:
+					w.SendUpdate(UpdateCmd{Type: cmdLibHandleUnmount, Data: e})
+				case events.LibrarySearchEventRecord:
+					w.SendUpdate(UpdateCmd{Type: cmdLibFindSimilar, Data: e.Path})
 				}
 			default:
 				return
@@ -179,23 +242,55 @@ func (w *LibraryWindow) handleUpdate(cmd component.UpdateCmd) {
 	case cmdLibSetStorageLoc:
 		if loc, ok := cmd.Data.(*storage.StorageLocation); ok {
 			if w.storageLoc == nil || w.storageLoc.Path != loc.Path {
+				w.stopWatching()
 				w.storageLoc = loc
 				w.fsTree = nil
-				w.searchResults = nil
-				w.searchQuery = ""
+				w.resetSearch()
+				w.clearSimilar()
 				w.startScan()
 			}
 		}
 
+	case cmdLibHandleUnmount:
+		if event, ok := cmd.Data.(events.StorageEventRecord); ok {
+			if loc, ok := event.Data.(*storage.StorageLocation); ok {
+				if w.storageLoc != nil && w.storageLoc.Path == loc.Path {
+					w.stopWatching()
+					w.storageLoc = nil
+					w.fsTree = nil
+					w.resetSearch()
+					w.clearSimilar()
+					if w.Components.Tree != nil {
+						w.Components.Tree.Rows()
+					}
+				}
+			}
+		}
+
 	case cmdLibSetScanning:
 		if scanning, ok := cmd.Data.(bool); ok {
 			w.isScanning = scanning
 		}
 
 	case cmdLibSetFSTree:
-		if tree, ok := cmd.Data.(*io.FSTree); ok {
+		// A scan can finish after its card was removed or another location was chosen
+		if tree, ok := cmd.Data.(*io.FSTree); ok && w.isCurrent(tree.Root.Path) {
 			w.fsTree = tree
-			go w.buildAndSetTreeRowsInBackground()
+			if w.query != nil && !w.query.Empty() {
+				go w.performSearchAndBuildRowsInBackground()
+			} else {
+				go w.buildAndSetTreeRowsInBackground()
+			}
+		}
+
+	case cmdLibSetWatcher:
+		if payload, ok := cmd.Data.(watcherPayload); ok {
+			if w.isCurrent(payload.path) {
+				w.stopWatching()
+				w.watcher = payload.watcher
+			} else {
+				payload.watcher.Close()
+			}
 		}
 
 	case cmdLibSetTreeRows:
@@ -208,10 +303,29 @@ func (w *LibraryWindow) handleUpdate(cmd component.UpdateCmd) {
 
 	case cmdLibSetSearchQuery:
 		if query, ok := cmd.Data.(string); ok {
-			if w.searchQuery != query {
+			if w.searchQuery != query || w.searchErr != "" {
 				w.searchQuery = query
-				go w.performSearchAndBuildRowsInBackground()
+				w.setQuery(query)
+			}
+		}
+
+	case cmdLibSetSearchStatus:
+		if status, ok := cmd.Data.(searchStatusPayload); ok && status.gen == w.searchGen.Load() {
+			w.searchStatus = status.text
+		}
+
+	case cmdLibFindSimilar:
+		if path, ok := cmd.Data.(string); ok {
+			w.findSimilar(path)
+		}
+
+	case cmdLibSetSimilar:
+		if payload, ok := cmd.Data.(similarPayload); ok && payload.gen == w.similarGen.Load() {
+			if payload.results != nil {
+				w.similar = payload.results
 			}
+			w.similarStatus = payload.status
+			w.refreshRows()
 		}
 
 	case cmdHandleScanEvent:
@@ -239,24 +353,12 @@ func (w *LibraryWindow) handleUpdate(cmd component.UpdateCmd) {
 
 func (w *LibraryWindow) buildAndSetTreeRowsInBackground() {
 	fstree := w.fsTree
-	search := w.searchResults
 
 	var rowData []tree.TreeRowData
 	if fstree == nil || fstree.Root == nil {
 		rowData = []tree.TreeRowData{}
-	} else if search != nil {
-		matchedPaths := make(map[string]bool)
-		for _, entry := range search {
-			matchedPaths[entry.Path] = true
-			current := entry.Parent
-			for current != nil {
-				matchedPaths[current.Path] = true
-				current = current.Parent
-			}
-		}
-		rowData = w.buildRowDataFromEntry(fstree.Root, matchedPaths)
 	} else {
-		rowData = w.buildRowDataFromEntry(fstree.Root, nil)
+		rowData = append(w.virtualRowData(fstree, nil), w.buildRowDataFromEntry(fstree.Root, nil)...)
 	}
 
 	cmd := component.UpdateCmd{Type: cmdLibSetTreeRows, Data: rowData}
@@ -279,9 +381,16 @@ func (w *LibraryWindow) startScan() {
 		Path:      path,
 	})
 
+	index := audio.OpenLibraryIndex(path)
+	indexed := index.Len() > 0
+
 	go func() {
-		tree := io.NewFSTree(path)
-		err := tree.ScanDirectory(path, ".wav", ".WAV")
+		// Show what the index remembers right away, the rescan only reads what changed
+		if indexed {
+			w.SendUpdate(UpdateCmd{Type: cmdLibSetFSTree, Data: index.Tree()})
+		}
+
+		tree, changed, err := index.Rescan()
 
 		if err != nil {
 			log.Error("Failed to scan directory", zap.Error(err), zap.String("path", path))
@@ -299,8 +408,14 @@ func (w *LibraryWindow) startScan() {
 				"Finished directory scan",
 				zap.String("path", path),
 				zap.Int("fileCount", tree.GetFileCount()),
+				zap.Int("changed", len(changed)),
 			)
 
+			cache := audio.GetGlobalAsyncCache()
+			for _, p := range changed {
+				cache.Invalidate(p)
+			}
+
 			eventbus.Bus.Publish(
 				events.LibraryScanEventRecord{
 					EventType: events.LibraryScanCompletedEvent,
@@ -310,11 +425,15 @@ func (w *LibraryWindow) startScan() {
 				},
 			)
 
-			treeCmd := UpdateCmd{Type: cmdLibSetFSTree, Data: tree}
-			w.SendUpdate(treeCmd)
+			if !indexed || len(changed) > 0 {
+				treeCmd := UpdateCmd{Type: cmdLibSetFSTree, Data: tree}
+				w.SendUpdate(treeCmd)
+			}
 
 			doneCmd := UpdateCmd{Type: cmdLibSetScanning, Data: false}
 			w.SendUpdate(doneCmd)
+
+			w.watch(path, index)
 		}
 	}()
 }
@@ -337,61 +456,23 @@ func formatDuration(seconds float64) string {
 	return fmt.Sprintf("%02d:%05.2f", minutes, secs)
 }
 
-func (w *LibraryWindow) buildRowDataFromEntry(entry *io.FSEntry, matchedPaths map[string]bool) []tree.TreeRowData {
+// buildRowDataFromEntry builds the rows below entry. With matches given only matched
+// files and the folders holding them are included, with the matched parts of their names
+// highlighted.
+func (w *LibraryWindow) buildRowDataFromEntry(entry *io.FSEntry, matches map[string][][2]int) []tree.TreeRowData {
 	rowData := make([]tree.TreeRowData, 0, len(entry.Children))
 
 	for _, child := range entry.Children {
-		if matchedPaths != nil && !matchedPaths[child.Path] {
+		highlights, matched := matches[child.Path]
+		if matches != nil && !matched {
 			continue
 		}
 
-		var icon string = font.Icon("FileAudio")
-		if child.IsDir {
-			icon = font.Icon("Folder")
-		}
-
-		sizeText := ""
-		if !child.IsDir && child.Size > 0 {
-			sizeText = formatFileSize(child.Size)
-		}
-
-		durationText := ""
-		isAudio := !child.IsDir && audio.IsAudioFile(child.Path)
-		if isAudio {
-			cache := audio.GetGlobalAsyncCache()
-			snapshot := cache.GetSnapshot(child.Path)
-			if snapshot != nil && snapshot.MetadataLoaded && snapshot.SampleRate > 0 {
-				duration := float64(snapshot.NumSamples) / float64(snapshot.SampleRate)
-				if duration > 0 {
-					durationText = formatDuration(duration)
-				}
-			}
-		}
-
-		dragDropType := ""
-		if isAudio {
-			dragDropType = "audio/wav-path"
-		} else if child.IsDir {
-			dragDropType = "file/folder-path"
-		}
-
-		data := tree.TreeRowData{
-			Path:         child.Path,
-			Name:         child.Name,
-			Icon:         icon,
-			IsDir:        child.IsDir,
-			IsAudio:      isAudio,
-			DurationText: durationText,
-			SizeText:     sizeText,
-			DragDropType: dragDropType,
-		}
-
+		data := w.rowDataForEntry(child, highlights)
 		if child.IsDir {
-			childData := w.buildRowDataFromEntry(child, matchedPaths)
+			childData := w.buildRowDataFromEntry(child, matches)
 			if len(childData) > 0 {
 				data.Children = childData
-			} else if matchedPaths == nil {
-				continue
 			} else {
 				continue
 			}
@@ -402,44 +483,54 @@ func (w *LibraryWindow) buildRowDataFromEntry(entry *io.FSEntry, matchedPaths ma
 	return rowData
 }
 
-func (w *LibraryWindow) performSearchAndBuildRowsInBackground() {
-	fstree := w.fsTree
-	query := w.searchQuery
-
-	if fstree == nil {
-		return
+// rowDataForEntry describes the row of a file or folder, without the folder's children
+func (w *LibraryWindow) rowDataForEntry(child *io.FSEntry, highlights [][2]int) tree.TreeRowData {
+	var icon string = font.Icon("FileAudio")
+	if child.IsDir {
+		icon = font.Icon("Folder")
 	}
 
-	var results []*io.FSEntry
-	if query == "" {
-		results = nil
-	} else {
-		results = fstree.Search(query)
+	sizeText := ""
+	if !child.IsDir && child.Size > 0 {
+		sizeText = formatFileSize(child.Size)
 	}
 
-	var rowData []tree.TreeRowData
-	if results != nil {
-		matchedPaths := make(map[string]bool)
-		for _, entry := range results {
-			matchedPaths[entry.Path] = true
-			current := entry.Parent
-			for current != nil {
-				matchedPaths[current.Path] = true
-				current = current.Parent
+	durationText := ""
+	isAudio := !child.IsDir && audio.IsAudioFile(child.Path)
+	if isAudio {
+		cache := audio.GetGlobalAsyncCache()
+		snapshot := cache.GetSnapshot(child.Path)
+		if snapshot != nil && snapshot.MetadataLoaded && snapshot.SampleRate > 0 {
+			duration := float64(snapshot.NumSamples) / float64(snapshot.SampleRate)
+			if duration > 0 {
+				durationText = formatDuration(duration)
 			}
 		}
-		rowData = w.buildRowDataFromEntry(fstree.Root, matchedPaths)
-	} else {
-		rowData = w.buildRowDataFromEntry(fstree.Root, nil)
 	}
 
-	cmd := component.UpdateCmd{Type: cmdLibSetTreeRows, Data: rowData}
-	w.SendUpdate(cmd)
+	dragDropType := ""
+	if isAudio {
+		dragDropType = "audio/wav-path"
+	} else if child.IsDir {
+		dragDropType = "file/folder-path"
+	}
+
+	return tree.TreeRowData{
+		Path:         child.Path,
+		Name:         child.Name,
+		Icon:         icon,
+		IsDir:        child.IsDir,
+		IsAudio:      isAudio,
+		DurationText: durationText,
+		SizeText:     sizeText,
+		DragDropType: dragDropType,
+		Highlights:   highlights,
+	}
 }
 
-func (w *LibraryWindow) hasMatchingDescendants(entry *io.FSEntry, matchedPaths map[string]bool) bool {
+func (w *LibraryWindow) hasMatchingDescendants(entry *io.FSEntry, matchedPaths map[string][][2]int) bool {
 	for _, child := range entry.Children {
-		if !child.IsDir && matchedPaths[child.Path] {
+		if _, ok := matchedPaths[child.Path]; !child.IsDir && ok {
 			return true
 		}
 		if child.IsDir && w.hasMatchingDescendants(child, matchedPaths) {
@@ -488,7 +579,8 @@ func (w *LibraryWindow) Layout() {
 		return
 	}
 
-	if isScanning {
+	// An indexed library is shown while the rescan runs
+	if isScanning && fsTree == nil {
 		component.WavyText(
 			"Scanning...",
 			theme.GetCurrentColormap(),
@@ -505,6 +597,10 @@ func (w *LibraryWindow) Layout() {
 	if w.fsTree != nil {
 		imgui.Text(fmt.Sprintf("Library: %s", w.storageLoc.Path))
 		imgui.Text(fmt.Sprintf("Files: %d", w.fsTree.GetFileCount()))
+		if isScanning {
+			imgui.SameLine()
+			imgui.TextDisabled("| Checking for changes...")
+		}
 
 		totalSize := w.fsTree.GetTotalSize()
 		if totalSize > 0 {
@@ -519,7 +615,7 @@ func (w *LibraryWindow) Layout() {
 	currentSearchQuery := searchQuery
 	imgui.PushItemWidth(-100)
 	if imgui.InputTextWithHint(
-		"##search", "search",
+		"##search", "search, e.g. kick dur<2s bpm:120-128",
 		&currentSearchQuery,
 		imgui.InputTextFlagsEnterReturnsTrue, nil) {
 		if currentSearchQuery != searchQuery {
@@ -527,6 +623,9 @@ func (w *LibraryWindow) Layout() {
 			w.SendUpdate(cmd)
 		}
 	}
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip(searchHelp)
+	}
 	imgui.PopItemWidth()
 	imgui.SameLine()
 	if imgui.Button(font.Icon("Search")) {
@@ -534,8 +633,21 @@ func (w *LibraryWindow) Layout() {
 		w.SendUpdate(cmd)
 	}
 
-	if searchQuery != "" {
-		imgui.Text(fmt.Sprintf("Searching for '%s'...", searchQuery))
+	if w.searchErr != "" {
+		imgui.TextColored(imgui.Vec4{X: 1.0, Y: 0.3, Z: 0.3, W: 1.0}, w.searchErr)
+	} else if searchQuery != "" {
+		imgui.TextDisabled(w.searchStatus)
+	}
+
+	if w.similar != nil {
+		imgui.Text(fmt.Sprintf("%s Similar to %s", font.Icon("AudioLines"), filepath.Base(w.similar.path)))
+		imgui.SameLine()
+		imgui.TextDisabled(w.similarStatus)
+		imgui.SameLine()
+		if imgui.SmallButton(font.Icon("X") + "##clear_similar") {
+			w.clearSimilar()
+			w.refreshRows()
+		}
 	}
 
 	imgui.Separator()
@@ -549,6 +661,8 @@ func (w *LibraryWindow) Layout() {
 
 // Destroy cleans up the window and its subscriptions
 func (w *LibraryWindow) Destroy() {
+	w.stopWatching()
+
 	// Unsubscribe from filtered subscriptions (handles all event types)
 	if w.filteredEventSub != nil {
 		w.filteredEventSub.Unsubscribe()
@@ -603,6 +717,8 @@ func NewLibraryWindow() *LibraryWindow {
 		events.LibraryScanProgressKey,
 		events.LibraryScanCompletedKey,
 		events.LibraryScanFailedKey,
+		events.StorageUnmountedEventKey,
+		events.LibraryFindSimilarKey,
 	)
 
 	return w
@@ -0,0 +1,211 @@
+package library
+
+import (
+	"bitbox-editor/internal/app/component/tree"
+	"bitbox-editor/internal/app/font"
+	"bitbox-editor/internal/audio"
+	"bitbox-editor/internal/io"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/AllenDang/cimgui-go/imgui"
+	"go.uber.org/zap"
+)
+
+// annotations returns the tags, ratings and favorites of the library shown, nil if none
+// is shown
+func (w *LibraryWindow) annotations() *audio.Annotations {
+	if w.storageLoc == nil {
+		return nil
+	}
+	return audio.OpenAnnotations(w.storageLoc.Path)
+}
+
+// annotationSuffix returns what is shown after a file name for its favorite and rating
+func (w *LibraryWindow) annotationSuffix(path string) string {
+	notes := w.annotations()
+	if notes == nil {
+		return ""
+	}
+
+	ann := notes.Get(path)
+	suffix := ""
+	if ann.Favorite {
+		suffix += " " + font.Icon("Heart")
+	}
+	if ann.Rating > 0 {
+		suffix += fmt.Sprintf(" %s%d", font.Icon("Star"), ann.Rating)
+	}
+	return suffix
+}
+
+// layoutAnnotationMenu draws the context menu of a file, to mark it as a favorite, rate
+// it and tag it
+func (w *LibraryWindow) layoutAnnotationMenu(path string) {
+	notes := w.annotations()
+	if notes == nil {
+		return
+	}
+
+	ann := notes.Get(path)
+	changed := false
+
+	if imgui.MenuItemBoolV(font.Icon("Heart")+" Favorite", "", ann.Favorite, true) {
+		ann.Favorite = !ann.Favorite
+		changed = true
+	}
+
+	if imgui.BeginMenu(font.Icon("Star") + " Rating") {
+		for rating := 0; rating <= audio.MaxRating; rating++ {
+			label := "No rating"
+			if rating > 0 {
+				label = strings.Repeat(font.Icon("Star"), rating)
+			}
+			if imgui.MenuItemBoolV(fmt.Sprintf("%s##rating_%d", label, rating), "", ann.Rating == rating, true) {
+				ann.Rating = rating
+				changed = true
+			}
+		}
+		imgui.EndMenu()
+	}
+
+	if imgui.BeginMenu(font.Icon("Tags") + " Tags") {
+		tags := notes.Tags()
+		for _, tag := range tags {
+			has := ann.HasTag(tag)
+			if imgui.MenuItemBoolV(tag+"##tag", "", has, true) {
+				if has {
+					ann.Tags = slices.DeleteFunc(ann.Tags, func(t string) bool {
+						return strings.EqualFold(t, tag)
+					})
+				} else {
+					ann.Tags = append(ann.Tags, tag)
+				}
+				changed = true
+			}
+		}
+		if len(tags) > 0 {
+			imgui.Separator()
+		}
+
+		imgui.SetNextItemWidth(160)
+		if imgui.InputTextWithHint("##new_tag", "new tag", &w.newTag, imgui.InputTextFlagsEnterReturnsTrue, nil) {
+			if tag := strings.TrimSpace(w.newTag); tag != "" {
+				ann.Tags = append(ann.Tags, tag)
+				changed = true
+			}
+			w.newTag = ""
+			imgui.CloseCurrentPopup()
+		}
+		imgui.EndMenu()
+	}
+
+	if !changed {
+		return
+	}
+
+	if err := notes.Set(path, ann); err != nil {
+		log.Error("Failed to save library annotations", zap.String("path", path), zap.Error(err))
+	}
+	w.refreshRows()
+}
+
+// refreshRows rebuilds the tree rows after annotations changed, searching again if a
+// search is shown
+func (w *LibraryWindow) refreshRows() {
+	if w.query != nil && !w.query.Empty() {
+		w.searchGen.Add(1)
+		go w.performSearchAndBuildRowsInBackground()
+		return
+	}
+	go w.buildAndSetTreeRowsInBackground()
+}
+
+// favoritesRowData describes the Favorites folder shown above the library, holding the
+// favorite files found in matches or every favorite file if matches is nil. Returns false
+// if there are none.
+func (w *LibraryWindow) favoritesRowData(fstree *io.FSTree, matches map[string][][2]int) (tree.TreeRowData, bool) {
+	root := fstree.Root.Path
+
+	var children []tree.TreeRowData
+	for path, ann := range audio.OpenAnnotations(root).All() {
+		if !ann.Favorite {
+			continue
+		}
+
+		highlights, matched := matches[path]
+		if matches != nil && !matched {
+			continue
+		}
+
+		entry, ok := fstree.FindEntry(path)
+		if !ok || entry.IsDir {
+			continue
+		}
+
+		data := w.rowDataForEntry(entry, highlights)
+		data.ID = "favorites:" + path
+		children = append(children, data)
+	}
+
+	if len(children) == 0 {
+		return tree.TreeRowData{}, false
+	}
+
+	slices.SortFunc(children, func(a, b tree.TreeRowData) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+
+	return tree.TreeRowData{
+		ID:       root + "#favorites",
+		Name:     "Favorites",
+		Icon:     font.Icon("Heart"),
+		IsDir:    true,
+		Children: children,
+	}, true
+}
+
+// carryAnnotations moves the annotations of files that disappeared to files that
+// appeared with the same size and modification time, which is how a rename or move shows
+// up. before holds the index entries from before the change.
+func carryAnnotations(root string, before map[string]audio.IndexEntry, changed []string) {
+	notes := audio.OpenAnnotations(root)
+	all := notes.All()
+
+	var removed, added []string
+	for _, path := range changed {
+		if _, err := os.Stat(path); err != nil {
+			if _, ok := all[path]; ok {
+				removed = append(removed, path)
+			}
+		} else if _, existed := before[path]; !existed {
+			added = append(added, path)
+		}
+	}
+	if len(removed) == 0 || len(added) == 0 {
+		return
+	}
+
+	moves := make(map[string]string)
+	for _, from := range removed {
+		old, ok := before[from]
+		if !ok {
+			continue
+		}
+		for i, to := range added {
+			info, err := os.Stat(to)
+			if err != nil || info.Size() != old.Size || info.ModTime().UnixNano() != old.ModTime {
+				continue
+			}
+			moves[from] = to
+			added = slices.Delete(added, i, i+1)
+			break
+		}
+	}
+
+	if err := notes.Move(moves); err != nil {
+		log.Error("Failed to save library annotations", zap.String("path", root), zap.Error(err))
+	}
+}
@@ -0,0 +1,203 @@
+package library
+
+import (
+	"bitbox-editor/internal/app/component/tree"
+	"bitbox-editor/internal/audio"
+	"bitbox-editor/internal/audio/search"
+	"bitbox-editor/internal/io"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// searchRetryDelay is how long a search waits for files to be analyzed before
+	// searching again
+	searchRetryDelay = time.Second
+
+	// searchMaxStalls is how many retries in a row may find no newly analyzed files
+	// before the search gives up on the rest, e.g. files that can't be read
+	searchMaxStalls = 3
+)
+
+// searchHelp is shown when hovering the search field
+const searchHelp = `Words match file names, then folders.
+Filters:
+  dur<2s  dur:1-3s  rate:44.1k  bits:24  ch:stereo
+  bpm:120-128  key:Am  loud>-18  peak<=-1
+  tag:kick  name:loop  path:drums
+  rating>=4  fav:yes
+Prefix a term with - to exclude what it matches.`
+
+// searchStatusPayload is the outcome of a search pass, gen tells apart passes of older
+// searches
+type searchStatusPayload struct {
+	gen  int64
+	text string
+}
+
+// resetSearch clears the search, e.g. when another location is chosen
+func (w *LibraryWindow) resetSearch() {
+	w.searchQuery = ""
+	w.query = nil
+	w.searchErr = ""
+	w.searchStatus = ""
+	w.searchGen.Add(1)
+}
+
+// setQuery parses a search query and starts searching. An invalid query keeps the
+// current results and reports the problem.
+func (w *LibraryWindow) setQuery(s string) {
+	query, err := search.Parse(s)
+	if err != nil {
+		w.searchErr = err.Error()
+		return
+	}
+
+	w.query = query
+	w.searchErr = ""
+	w.searchStatus = "Searching..."
+	w.searchGen.Add(1)
+	go w.performSearchAndBuildRowsInBackground()
+}
+
+// performSearchAndBuildRowsInBackground searches the library and shows the matches.
+// Files the query needs metadata of that isn't indexed yet are queued for analysis and
+// the search repeats while their results come in.
+func (w *LibraryWindow) performSearchAndBuildRowsInBackground() {
+	fstree := w.fsTree
+	query := w.query
+	gen := w.searchGen.Load()
+
+	if fstree == nil {
+		return
+	}
+	if query == nil || query.Empty() {
+		w.buildAndSetTreeRowsInBackground()
+		w.SendUpdate(UpdateCmd{Type: cmdLibSetSearchStatus, Data: searchStatusPayload{gen: gen}})
+		return
+	}
+
+	lastPending, stalls := -1, 0
+	for {
+		matches, count, pending := searchTree(fstree, query)
+		if w.searchGen.Load() != gen {
+			return
+		}
+
+		rowData := append(w.virtualRowData(fstree, matches), w.buildRowDataFromEntry(fstree.Root, matches)...)
+		if rowData == nil {
+			rowData = []tree.TreeRowData{}
+		}
+		w.SendUpdate(UpdateCmd{Type: cmdLibSetTreeRows, Data: rowData})
+
+		status := fmt.Sprintf("%d matches", count)
+		if pending > 0 {
+			status += fmt.Sprintf(", analyzing %d files...", pending)
+		}
+
+		if pending == lastPending {
+			stalls++
+		} else {
+			stalls = 0
+		}
+		if pending > 0 && stalls >= searchMaxStalls {
+			status = fmt.Sprintf("%d matches, %d files couldn't be analyzed", count, pending)
+		}
+		w.SendUpdate(UpdateCmd{Type: cmdLibSetSearchStatus, Data: searchStatusPayload{gen: gen, text: status}})
+
+		if pending == 0 || stalls >= searchMaxStalls {
+			return
+		}
+		lastPending = pending
+
+		time.Sleep(searchRetryDelay)
+		if w.searchGen.Load() != gen {
+			return
+		}
+	}
+}
+
+// searchTree matches every file of a tree against a query. Returns the matched files and
+// the folders holding them, with the matched parts of the file names, along with the
+// number of files matched and the number still waiting for the metadata the query needs.
+func searchTree(fstree *io.FSTree, query *search.Query) (map[string][][2]int, int, int) {
+	root := fstree.Root.Path
+	entries := audio.OpenLibraryIndex(root).Entries()
+	notes := audio.OpenAnnotations(root).All()
+	cache := audio.GetGlobalAsyncCache()
+
+	needsMetadata := query.NeedsMetadata()
+	needsLevels := query.NeedsLevels()
+
+	matches := make(map[string][][2]int)
+	count, pending := 0, 0
+
+	for _, file := range fstree.GetAllFiles() {
+		rel, err := filepath.Rel(root, file.Path)
+		if err != nil {
+			rel = file.Path
+		}
+		rel = filepath.ToSlash(rel)
+
+		record := search.Record{
+			Path:    file.Path,
+			Name:    file.Name,
+			RelPath: rel,
+			Tags:    search.Tags(rel),
+		}
+		record.BPM, record.Key = search.ParseName(file.Name)
+
+		if ann, ok := notes[file.Path]; ok {
+			record.Tags = append(record.Tags, ann.Tags...)
+			record.Rating = ann.Rating
+			record.Favorite = ann.Favorite
+		}
+
+		entry, ok := entries[file.Path]
+		if ok && entry.MetadataLoaded {
+			record.MetadataLoaded = true
+			record.Duration = entry.Duration()
+			record.SampleRate = entry.SampleRate
+			record.BitDepth = entry.BitDepth
+			record.Channels = entry.NumChannels
+		}
+		if ok && entry.LevelsMeasured {
+			record.LevelsMeasured = true
+			record.Peak = entry.Peak
+			record.RMS = entry.RMS
+		}
+
+		switch {
+		case needsLevels && !record.LevelsMeasured:
+			cache.RequestLoad(file.Path, audio.LoadMiniDownsamples)
+			pending++
+			continue
+		case needsMetadata && !record.MetadataLoaded:
+			cache.RequestLoad(file.Path, audio.LoadMetadataOnly)
+			pending++
+			continue
+		}
+
+		matched, ranges := query.Match(&record)
+		if !matched {
+			continue
+		}
+
+		count++
+		highlights := make([][2]int, len(ranges))
+		for i, r := range ranges {
+			highlights[i] = [2]int{r.Start, r.End}
+		}
+		matches[file.Path] = highlights
+
+		for parent := file.Parent; parent != nil; parent = parent.Parent {
+			if _, ok := matches[parent.Path]; ok {
+				break
+			}
+			matches[parent.Path] = nil
+		}
+	}
+
+	return matches, count, pending
+}
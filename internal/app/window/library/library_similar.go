@@ -0,0 +1,149 @@
+package library
+
+import (
+	"bitbox-editor/internal/app/component/tree"
+	"bitbox-editor/internal/app/font"
+	"bitbox-editor/internal/audio"
+	"bitbox-editor/internal/io"
+	"fmt"
+	"math"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// similarLimit is how many of the closest samples are listed
+const similarLimit = 50
+
+// similarResults are the samples found to sound like path, closest first
+type similarResults struct {
+	path    string
+	matches []audio.SimilarMatch
+}
+
+// similarPayload is the outcome of a similarity search pass, gen tells apart passes of
+// older searches. results is nil if the search failed.
+type similarPayload struct {
+	gen     int64
+	results *similarResults
+	status  string
+}
+
+// findSimilar lists the samples of the library that sound like a file, closest first
+func (w *LibraryWindow) findSimilar(path string) {
+	if w.storageLoc == nil {
+		return
+	}
+
+	gen := w.similarGen.Add(1)
+	w.similar = &similarResults{path: path}
+	w.similarStatus = "Comparing..."
+	go w.findSimilarInBackground(w.storageLoc.Path, path, gen)
+}
+
+// clearSimilar stops showing samples like a file
+func (w *LibraryWindow) clearSimilar() {
+	w.similar = nil
+	w.similarStatus = ""
+	w.similarGen.Add(1)
+}
+
+// findSimilarInBackground ranks the library against a file. Files that haven't been
+// measured yet are queued for analysis and the ranking repeats while they come in.
+func (w *LibraryWindow) findSimilarInBackground(root, path string, gen int64) {
+	cache := audio.GetGlobalAsyncCache()
+
+	lastPending, stalls := -1, 0
+	for {
+		matches, missing, err := audio.FindSimilar(root, path, similarLimit)
+		if w.similarGen.Load() != gen {
+			return
+		}
+		if err != nil {
+			log.Warn("Failed to find similar samples", zap.String("path", path), zap.Error(err))
+			w.SendUpdate(UpdateCmd{Type: cmdLibSetSimilar, Data: similarPayload{gen: gen, status: err.Error()}})
+			return
+		}
+
+		for _, p := range missing {
+			cache.RequestLoad(p, audio.LoadMiniDownsamples)
+		}
+		pending := len(missing)
+
+		status := fmt.Sprintf("%d closest", len(matches))
+		if pending > 0 {
+			status += fmt.Sprintf(", analyzing %d files...", pending)
+		}
+
+		if pending == lastPending {
+			stalls++
+		} else {
+			stalls = 0
+		}
+		if pending > 0 && stalls >= searchMaxStalls {
+			status = fmt.Sprintf("%d closest, %d files couldn't be analyzed", len(matches), pending)
+		}
+
+		results := &similarResults{path: path, matches: matches}
+		w.SendUpdate(UpdateCmd{Type: cmdLibSetSimilar, Data: similarPayload{gen: gen, results: results, status: status}})
+
+		if pending == 0 || stalls >= searchMaxStalls {
+			return
+		}
+		lastPending = pending
+
+		time.Sleep(searchRetryDelay)
+		if w.similarGen.Load() != gen {
+			return
+		}
+	}
+}
+
+// similarRowData describes the folder listing the samples like a file, closest first.
+// Returns false if there are none.
+func (w *LibraryWindow) similarRowData(fstree *io.FSTree) (tree.TreeRowData, bool) {
+	similar := w.similar
+	if similar == nil {
+		return tree.TreeRowData{}, false
+	}
+
+	var children []tree.TreeRowData
+	for _, match := range similar.matches {
+		entry, ok := fstree.FindEntry(match.Path)
+		if !ok || entry.IsDir {
+			continue
+		}
+
+		data := w.rowDataForEntry(entry, nil)
+		data.ID = "similar:" + match.Path
+		data.Name = fmt.Sprintf("%s  %d%%", data.Name, int(math.Round(match.Similarity*100)))
+		children = append(children, data)
+	}
+
+	if len(children) == 0 {
+		return tree.TreeRowData{}, false
+	}
+
+	return tree.TreeRowData{
+		ID:       fstree.Root.Path + "#similar",
+		Name:     "Similar to " + filepath.Base(similar.path),
+		Icon:     font.Icon("AudioLines"),
+		IsDir:    true,
+		Open:     true,
+		Children: children,
+	}, true
+}
+
+// virtualRowData returns the folders shown above the library that don't exist on disk,
+// with favorites filtered by matches unless it is nil
+func (w *LibraryWindow) virtualRowData(fstree *io.FSTree, matches map[string][][2]int) []tree.TreeRowData {
+	var rows []tree.TreeRowData
+	if similar, ok := w.similarRowData(fstree); ok {
+		rows = append(rows, similar)
+	}
+	if favorites, ok := w.favoritesRowData(fstree, matches); ok {
+		rows = append(rows, favorites)
+	}
+	return rows
+}
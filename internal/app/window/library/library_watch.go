@@ -0,0 +1,67 @@
+package library
+
+import (
+	"bitbox-editor/internal/audio"
+	"bitbox-editor/internal/io/file"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// watchDelay is how long file changes have to settle before the library updates
+const watchDelay = 500 * time.Millisecond
+
+// watcherPayload hands a watcher started in the background to the window
+type watcherPayload struct {
+	path    string
+	watcher *file.Watcher
+}
+
+// watch starts watching a library folder in the background, keeping the index and the
+// tree up to date as files are added, removed or renamed
+func (w *LibraryWindow) watch(path string, index *audio.LibraryIndex) {
+	watcher, err := file.WatchDir(path, watchDelay, func(batch []fsnotify.Event) {
+		paths := make([]string, len(batch))
+		for i, event := range batch {
+			paths[i] = event.Name
+		}
+
+		before := index.Entries()
+		changed := index.Refresh(paths)
+		if len(changed) == 0 {
+			return
+		}
+
+		carryAnnotations(path, before, changed)
+
+		log.Debug("Library changed on disk", zap.String("path", path), zap.Int("files", len(changed)))
+
+		cache := audio.GetGlobalAsyncCache()
+		for _, p := range changed {
+			cache.Invalidate(p)
+		}
+
+		w.SendUpdate(UpdateCmd{Type: cmdLibSetFSTree, Data: index.Tree()})
+	})
+	if err != nil {
+		log.Warn("Failed to watch library, changes won't show until a rescan", zap.String("path", path), zap.Error(err))
+		return
+	}
+
+	w.SendUpdate(UpdateCmd{Type: cmdLibSetWatcher, Data: watcherPayload{path: path, watcher: watcher}})
+}
+
+// stopWatching stops watching the current library folder
+func (w *LibraryWindow) stopWatching() {
+	if w.watcher != nil {
+		w.watcher.Close()
+		w.watcher = nil
+	}
+}
+
+// isCurrent returns true if path is the library folder shown
+func (w *LibraryWindow) isCurrent(path string) bool {
+	return w.storageLoc != nil && filepath.Clean(w.storageLoc.Path) == filepath.Clean(path)
+}
@@ -0,0 +1,563 @@
+package midimonitor
+
+/*
+┍━━━━━━━━━━━━━━━━━━━━╳┑
+│ MIDI Monitor Window │
+└─────────────────────┘
+*/
+
+import (
+	"bitbox-editor/internal/app/eventbus"
+	"bitbox-editor/internal/app/events"
+	"bitbox-editor/internal/app/font"
+	"bitbox-editor/internal/app/window"
+	"bitbox-editor/internal/config"
+	"bitbox-editor/internal/logging"
+	"bitbox-editor/internal/midi"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/AllenDang/cimgui-go/imgui"
+	"go.uber.org/zap"
+)
+
+var log = logging.NewLogger("midimonitor")
+
+const (
+	// maxEventsPerFrame limits how many events are taken from the bus each frame
+	maxEventsPerFrame = 256
+	// maxEntries is the number of events kept in the log
+	maxEntries = 5000
+)
+
+// eventCategory groups MIDI event types for filtering
+type eventCategory int
+
+const (
+	categoryNotes eventCategory = iota
+	categoryControlChange
+	categoryPitchBend
+	categoryProgramChange
+	categoryAfterTouch
+	categoryClock
+	categoryTransport
+	numCategories
+)
+
+var categoryNames = [numCategories]string{
+	"Notes",
+	"Control Change",
+	"Pitch Bend",
+	"Program Change",
+	"Aftertouch",
+	"Clock",
+	"Transport",
+}
+
+// monitoredKeys are the MIDI bus keys the monitor subscribes to
+var monitoredKeys = []string{
+	events.MidiNoteOnKey,
+	events.MidiNoteOffKey,
+	events.MidiControlChangeKey,
+	events.MidiPitchBendKey,
+	events.MidiProgramChangeKey,
+	events.MidiAfterTouchKey,
+	events.MidiPolyAfterTouchKey,
+	events.MidiClockKey,
+	events.MidiStartKey,
+	events.MidiContinueKey,
+	events.MidiStopKey,
+	events.MidiSongPositionKey,
+}
+
+// monitorEntry is a received MIDI event with the time it arrived
+type monitorEntry struct {
+	received time.Time
+	event    events.MidiEventRecord
+}
+
+// eventRow is the display and export form of a MIDI event
+type eventRow struct {
+	Type    string
+	Channel string
+	Note    string
+	Data1   string
+	Data2   string
+}
+
+type MidiMonitorWindow struct {
+	*window.Window[*MidiMonitorWindow]
+
+	eventSub eventbus.EventChannel
+	// subscribed is true while the window is open and listening to the MIDI bus
+	subscribed bool
+
+	entries        []monitorEntry
+	visible        []int
+	needsFilter    bool
+	scrollToBottom bool
+	paused         bool
+
+	showCategory [numCategories]bool
+	channel      int
+
+	exportPath string
+	status     string
+
+	tableFlags imgui.TableFlags
+}
+
+func NewMidiMonitorWindow() *MidiMonitorWindow {
+	exportPath := "midi-monitor.csv"
+	if home, err := os.UserHomeDir(); err == nil {
+		exportPath = filepath.Join(home, exportPath)
+	}
+
+	w := &MidiMonitorWindow{
+		eventSub:   make(eventbus.EventChannel, 1024),
+		entries:    make([]monitorEntry, 0, 256),
+		visible:    make([]int, 0, 256),
+		channel:    -1,
+		exportPath: exportPath,
+		tableFlags: imgui.TableFlagsResizable |
+			imgui.TableFlagsRowBg |
+			imgui.TableFlagsScrollY |
+			imgui.TableFlagsSizingFixedFit,
+		scrollToBottom: true,
+	}
+
+	// Clock is sent 24 times per beat and would drown out everything else
+	for i := range w.showCategory {
+		w.showCategory[i] = eventCategory(i) != categoryClock
+	}
+
+	w.Window = window.NewWindow[*MidiMonitorWindow]("MIDI Monitor", "Activity", w.handleUpdate)
+	w.SetFlags(imgui.WindowFlagsMenuBar)
+	w.Window.SetLayoutBuilder(w)
+
+	// Opened from the View menu when needed, the MIDI bus is only listened to while open
+	w.SetClose()
+
+	return w
+}
+
+// handleUpdate - processes incoming update commands
+func (w *MidiMonitorWindow) handleUpdate(cmd UpdateCmd) {
+	switch c := cmd.Type.(type) {
+	case window.GlobalCommand:
+		w.Window.HandleGlobalUpdate(cmd)
+		if c == window.CmdWinSetOpen {
+			w.setSubscribed(w.IsOpen())
+		}
+		return
+
+	case localCommand:
+		switch c {
+		case cmdMidiMonitorAddEvent:
+			if entry, ok := cmd.Data.(monitorEntry); ok {
+				w.entries = append(w.entries, entry)
+				if len(w.entries) > maxEntries {
+					w.entries = w.entries[len(w.entries)-maxEntries:]
+				}
+				w.needsFilter = true
+				w.scrollToBottom = true
+			} else {
+				log.Warn("Invalid data type for cmdMidiMonitorAddEvent", zap.Any("data", cmd.Data))
+			}
+
+		case cmdMidiMonitorSetPort:
+			if portName, ok := cmd.Data.(string); ok {
+				manager := midi.GetMidiManager()
+				if portName == "" {
+					manager.StopMonitoring()
+				} else if err := manager.StartMonitoring(portName); err != nil {
+					log.Error("Failed to open MIDI input port", zap.String("port", portName), zap.Error(err))
+					w.status = err.Error()
+					return
+				}
+
+				if err := config.SetMidiInputPort(portName); err != nil {
+					log.Error("Failed to save MIDI input port to config", zap.Error(err))
+				}
+				w.status = ""
+			}
+
+		case cmdMidiMonitorClear:
+			w.entries = w.entries[:0]
+			w.needsFilter = true
+			w.status = ""
+
+		case cmdMidiMonitorExport:
+			if path, ok := cmd.Data.(string); ok {
+				if err := w.exportCSV(path); err != nil {
+					log.Error("Failed to export MIDI monitor log", zap.Error(err))
+					w.status = err.Error()
+					return
+				}
+				w.status = fmt.Sprintf("Exported %d events to %s", len(w.visible), path)
+			}
+		}
+		return
+
+	default:
+		log.Warn("MidiMonitorWindow unhandled update", zap.Any("cmd", cmd))
+	}
+}
+
+// setSubscribed listens to the MIDI bus or stops listening, so a closed monitor doesn't
+// collect events it would show as new once opened again
+func (w *MidiMonitorWindow) setSubscribed(subscribed bool) {
+	if subscribed == w.subscribed {
+		return
+	}
+	w.subscribed = subscribed
+
+	if subscribed {
+		for _, key := range monitoredKeys {
+			midi.Bus.Subscribe(key, w.UUID(), w.eventSub)
+		}
+		return
+	}
+
+	for _, key := range monitoredKeys {
+		midi.Bus.Unsubscribe(key, w.UUID())
+	}
+	for {
+		select {
+		case <-w.eventSub:
+		default:
+			return
+		}
+	}
+}
+
+// drainEvents takes the MIDI events received since the last frame. Events are dropped
+// while paused so the log stays still for inspection.
+func (w *MidiMonitorWindow) drainEvents() {
+	for i := 0; i < maxEventsPerFrame; i++ {
+		select {
+		case event := <-w.eventSub:
+			record, ok := event.(events.MidiEventRecord)
+			if !ok || w.paused {
+				continue
+			}
+			cmd := UpdateCmd{Type: cmdMidiMonitorAddEvent, Data: monitorEntry{received: time.Now(), event: record}}
+			w.Window.SendUpdate(cmd)
+		default:
+			return
+		}
+	}
+}
+
+// applyFilter rebuilds the indices of the entries shown by the type and channel filters
+func (w *MidiMonitorWindow) applyFilter() {
+	w.visible = w.visible[:0]
+	for i, entry := range w.entries {
+		if w.matches(entry.event) {
+			w.visible = append(w.visible, i)
+		}
+	}
+	w.needsFilter = false
+}
+
+// matches returns true if an event passes the type and channel filters. Clock and
+// transport messages have no channel and are only filtered by type.
+func (w *MidiMonitorWindow) matches(e events.MidiEventRecord) bool {
+	category := categoryOf(e.EventType)
+	if !w.showCategory[category] {
+		return false
+	}
+	if w.channel >= 0 && category < categoryClock && int(e.Channel) != w.channel {
+		return false
+	}
+	return true
+}
+
+// categoryOf returns the filter category of a MIDI event type
+func categoryOf(t events.MidiEventType) eventCategory {
+	switch t {
+	case events.MidiNoteOnEvent, events.MidiNoteOffEvent:
+		return categoryNotes
+	case events.MidiControlChangeEvent:
+		return categoryControlChange
+	case events.MidiPitchBendEvent:
+		return categoryPitchBend
+	case events.MidiProgramChangeEvent:
+		return categoryProgramChange
+	case events.MidiAfterTouchEvent, events.MidiPolyAfterTouchEvent:
+		return categoryAfterTouch
+	case events.MidiClockEvent:
+		return categoryClock
+	default:
+		return categoryTransport
+	}
+}
+
+// describe returns the columns shown for an event. Channels are shown 1-16.
+func describe(e events.MidiEventRecord) eventRow {
+	channel := strconv.Itoa(int(e.Channel) + 1)
+	key := strconv.Itoa(int(e.Key))
+
+	switch e.EventType {
+	case events.MidiNoteOnEvent:
+		return eventRow{"Note On", channel, midi.NoteName(e.Key), key, strconv.Itoa(int(e.Velocity))}
+	case events.MidiNoteOffEvent:
+		return eventRow{"Note Off", channel, midi.NoteName(e.Key), key, strconv.Itoa(int(e.Velocity))}
+	case events.MidiPolyAfterTouchEvent:
+		return eventRow{"Poly Aftertouch", channel, midi.NoteName(e.Key), key, strconv.Itoa(int(e.Velocity))}
+	case events.MidiControlChangeEvent:
+		return eventRow{"Control Change", channel, "", strconv.Itoa(int(e.Controller)), strconv.Itoa(int(e.Value))}
+	case events.MidiPitchBendEvent:
+		// Show the bend relative to center alongside the raw 14-bit value
+		return eventRow{"Pitch Bend", channel, "", strconv.Itoa(int(e.Value14) - 8192), strconv.Itoa(int(e.Value14))}
+	case events.MidiProgramChangeEvent:
+		return eventRow{"Program Change", channel, "", strconv.Itoa(int(e.Value)), ""}
+	case events.MidiAfterTouchEvent:
+		return eventRow{"Aftertouch", channel, "", strconv.Itoa(int(e.Value)), ""}
+	case events.MidiClockEvent:
+		return eventRow{Type: "Clock"}
+	case events.MidiStartEvent:
+		return eventRow{Type: "Start"}
+	case events.MidiContinueEvent:
+		return eventRow{Type: "Continue"}
+	case events.MidiStopEvent:
+		return eventRow{Type: "Stop"}
+	case events.MidiSongPositionEvent:
+		return eventRow{Type: "Song Position", Data1: strconv.Itoa(int(e.Value14))}
+	default:
+		return eventRow{Type: "Unknown"}
+	}
+}
+
+// exportCSV writes the events passing the filters to a CSV file
+func (w *MidiMonitorWindow) exportCSV(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create '%s': %w", path, err)
+	}
+	defer f.Close()
+
+	out := csv.NewWriter(f)
+	if err := out.Write([]string{"time", "port", "type", "channel", "note", "data1", "data2"}); err != nil {
+		return fmt.Errorf("failed to write '%s': %w", path, err)
+	}
+	for _, i := range w.visible {
+		entry := w.entries[i]
+		row := describe(entry.event)
+		record := []string{
+			entry.received.Format("2006-01-02T15:04:05.000"),
+			entry.event.PortID,
+			row.Type,
+			row.Channel,
+			row.Note,
+			row.Data1,
+			row.Data2,
+		}
+		if err := out.Write(record); err != nil {
+			return fmt.Errorf("failed to write '%s': %w", path, err)
+		}
+	}
+
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return fmt.Errorf("failed to write '%s': %w", path, err)
+	}
+	return nil
+}
+
+func (w *MidiMonitorWindow) Menu() {
+	if imgui.BeginMenuBar() {
+		w.layoutPortSelector()
+		imgui.SameLine()
+
+		pauseIcon := font.Icon("Pause")
+		if w.paused {
+			pauseIcon = font.Icon("Play")
+		}
+		if imgui.Button(pauseIcon) {
+			w.paused = !w.paused
+		}
+		if imgui.IsItemHovered() {
+			if w.paused {
+				imgui.SetTooltip("Resume capturing events")
+			} else {
+				imgui.SetTooltip("Pause capturing events")
+			}
+		}
+		imgui.SameLine()
+
+		if imgui.Button(font.Icon("Trash2")) {
+			w.Window.SendUpdate(UpdateCmd{Type: cmdMidiMonitorClear})
+		}
+		if imgui.IsItemHovered() {
+			imgui.SetTooltip("Clear the log")
+		}
+		imgui.SameLine()
+
+		if imgui.Button(font.Icon("ListFilter")) {
+			imgui.OpenPopupStr("##midi_monitor_filter")
+		}
+		if imgui.IsItemHovered() {
+			imgui.SetTooltip("Filter by event type")
+		}
+		w.layoutFilterPopup()
+		imgui.SameLine()
+
+		w.layoutChannelFilter()
+		imgui.SameLine()
+
+		if imgui.Button(font.Icon("FileDown")) {
+			w.Window.SendUpdate(UpdateCmd{Type: cmdMidiMonitorExport, Data: w.exportPath})
+		}
+		if imgui.IsItemHovered() {
+			imgui.SetTooltip(fmt.Sprintf("Export the shown events to %s", w.exportPath))
+		}
+		imgui.SameLine()
+		imgui.SetNextItemWidth(-1)
+		imgui.InputTextWithHint("##midi_monitor_export", "Export path (.csv)", &w.exportPath, imgui.InputTextFlagsNone, nil)
+
+		imgui.EndMenuBar()
+	}
+}
+
+// layoutPortSelector draws the input port combo, changing it changes the app's input port
+func (w *MidiMonitorWindow) layoutPortSelector() {
+	manager := midi.GetMidiManager()
+	current := manager.InputPort()
+
+	preview := current
+	if preview == "" {
+		preview = "No input"
+	}
+
+	imgui.SetNextItemWidth(180)
+	if imgui.BeginCombo("##midi_monitor_port", preview) {
+		if imgui.SelectableBoolV("None", current == "", imgui.SelectableFlagsNone, imgui.Vec2{}) {
+			w.Window.SendUpdate(UpdateCmd{Type: cmdMidiMonitorSetPort, Data: ""})
+		}
+		for _, portName := range manager.ListPorts() {
+			isSelected := portName == current
+			if imgui.SelectableBoolV(portName, isSelected, imgui.SelectableFlagsNone, imgui.Vec2{}) {
+				w.Window.SendUpdate(UpdateCmd{Type: cmdMidiMonitorSetPort, Data: portName})
+			}
+			if isSelected {
+				imgui.SetItemDefaultFocus()
+			}
+		}
+		imgui.EndCombo()
+	}
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("MIDI input port")
+	}
+}
+
+// layoutFilterPopup draws the event type checkboxes
+func (w *MidiMonitorWindow) layoutFilterPopup() {
+	if imgui.BeginPopup("##midi_monitor_filter") {
+		for i, name := range categoryNames {
+			if imgui.Checkbox(name, &w.showCategory[i]) {
+				w.needsFilter = true
+			}
+		}
+		imgui.EndPopup()
+	}
+}
+
+// layoutChannelFilter draws the channel combo
+func (w *MidiMonitorWindow) layoutChannelFilter() {
+	preview := "All ch"
+	if w.channel >= 0 {
+		preview = fmt.Sprintf("Ch %d", w.channel+1)
+	}
+
+	imgui.SetNextItemWidth(80)
+	if imgui.BeginCombo("##midi_monitor_channel", preview) {
+		if imgui.SelectableBoolV("All ch", w.channel < 0, imgui.SelectableFlagsNone, imgui.Vec2{}) {
+			w.channel = -1
+			w.needsFilter = true
+		}
+		for ch := 0; ch < 16; ch++ {
+			if imgui.SelectableBoolV(fmt.Sprintf("Ch %d", ch+1), w.channel == ch, imgui.SelectableFlagsNone, imgui.Vec2{}) {
+				w.channel = ch
+				w.needsFilter = true
+			}
+		}
+		imgui.EndCombo()
+	}
+}
+
+func (w *MidiMonitorWindow) Layout() {
+	w.drainEvents()
+	w.Window.ProcessUpdates()
+
+	if w.needsFilter {
+		w.applyFilter()
+	}
+
+	if w.status != "" {
+		imgui.TextDisabled(w.status)
+	}
+
+	if imgui.BeginTableV("midi_monitor", 7, w.tableFlags, imgui.Vec2{}, 0) {
+		defer imgui.EndTable()
+
+		static := imgui.TableColumnFlagsWidthFixed
+		stretch := imgui.TableColumnFlagsWidthStretch
+		imgui.TableSetupScrollFreeze(0, 1)
+		imgui.TableSetupColumnV("Time", static, 90, 0)
+		imgui.TableSetupColumnV("Port", static, 120, 0)
+		imgui.TableSetupColumnV("Type", static, 110, 0)
+		imgui.TableSetupColumnV("Ch", static, 24, 0)
+		imgui.TableSetupColumnV("Note", static, 40, 0)
+		imgui.TableSetupColumnV("Data 1", static, 50, 0)
+		imgui.TableSetupColumnV("Data 2", stretch, 1, 0)
+		imgui.TableHeadersRow()
+
+		imgui.PushFont(font.FontCode, 0)
+
+		clipper := imgui.NewListClipper()
+		clipper.Begin(int32(len(w.visible)))
+		for clipper.Step() {
+			for i := clipper.DisplayStart(); i < clipper.DisplayEnd(); i++ {
+				entry := w.entries[w.visible[i]]
+				row := describe(entry.event)
+
+				imgui.TableNextRow()
+				imgui.TableNextColumn()
+				imgui.Text(entry.received.Format("15:04:05.000"))
+				imgui.TableNextColumn()
+				imgui.Text(entry.event.PortID)
+				imgui.TableNextColumn()
+				imgui.Text(row.Type)
+				imgui.TableNextColumn()
+				imgui.Text(row.Channel)
+				imgui.TableNextColumn()
+				imgui.Text(row.Note)
+				imgui.TableNextColumn()
+				imgui.Text(row.Data1)
+				imgui.TableNextColumn()
+				imgui.Text(row.Data2)
+			}
+		}
+		clipper.End()
+		clipper.Destroy()
+
+		imgui.PopFont()
+
+		// Follow new events unless paused or scrolled up to read
+		if w.scrollToBottom && !w.paused && imgui.ScrollY() >= imgui.ScrollMaxY() {
+			imgui.SetScrollHereYV(1)
+		}
+		w.scrollToBottom = false
+	}
+}
+
+// Destroy cleans up the window and its subscriptions
+func (w *MidiMonitorWindow) Destroy() {
+	w.setSubscribed(false)
+	w.Window.Destroy()
+}
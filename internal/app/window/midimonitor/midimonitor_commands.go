@@ -0,0 +1,15 @@
+package midimonitor
+
+import "bitbox-editor/internal/app/window"
+
+type UpdateCmd = window.UpdateCmd
+type UpdateCmdType = window.UpdateCmdType
+
+type localCommand int
+
+const (
+	cmdMidiMonitorAddEvent localCommand = iota
+	cmdMidiMonitorSetPort
+	cmdMidiMonitorClear
+	cmdMidiMonitorExport
+)
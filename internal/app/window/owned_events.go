@@ -40,6 +40,7 @@ func (m *OwnedEventsMixin) SubscribeToMidiEvents(bus *eventbus.EventBus) {
 		events.MidiPlaybackNoteOnKey,
 		events.MidiPlaybackNoteOffKey,
 		events.MidiPlaybackCCKey,
+		events.MidiPlaybackProgramKey,
 	)
 }
 
@@ -11,6 +11,8 @@ import (
 	"bitbox-editor/internal/app/component/button"
 	"bitbox-editor/internal/app/component/combobox"
 	"bitbox-editor/internal/app/component/label"
+	"bitbox-editor/internal/app/component/meter"
+	"bitbox-editor/internal/app/component/midilearn"
 	"bitbox-editor/internal/app/component/pad"
 	"bitbox-editor/internal/app/component/pad_config"
 	"bitbox-editor/internal/app/component/padgrid"
@@ -22,8 +24,12 @@ import (
 	"bitbox-editor/internal/app/window"
 	"bitbox-editor/internal/audio"
 	"bitbox-editor/internal/logging"
+	"bitbox-editor/internal/midi"
+	"bitbox-editor/internal/parsing/bitbox"
 	"bitbox-editor/internal/preset"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 	"unsafe"
@@ -69,6 +75,16 @@ type PresetEditWindow struct {
 		SkipBackButton        *button.Button
 		SkipForwardButton     *button.Button
 		RepeatButton          *button.Button
+		SnapButton            *button.Button
+		ViewModeButton        *button.Button
+		ChannelModeButton     *button.Button
+		ChannelMeter          *meter.ChannelMeterComponent
+		LoopModeButton        *button.Button
+		LoopPreviewButton     *button.Button
+		SaveLoopButton        *button.Button
+		ImportSequenceButton  *button.Button
+		ExportSequenceButton  *button.Button
+		PreviewSequenceButton *button.Button
 		WaveLabel             *label.LabelComponent
 		ConfigurationLabel    *label.LabelComponent
 		PadsLabel             *label.LabelComponent
@@ -84,10 +100,20 @@ type PresetEditWindow struct {
 
 	preset         *preset.Preset
 	loading        bool
+	stale          bool
+	changedOnDisk  bool
+	savedModTime   time.Time
 	activeWavePath string
 	activeWaveData audio.WaveDisplayData
 	activePadKey   string
 	previousPadKey string
+	activeCell     *bitbox.Cell
+	seqImport      sequenceImport
+	seqPreview     *midi.SequencePreview
+
+	// previewLoop is the loop that is currently being previewed, used to restart the
+	// preview when the loop is edited
+	previewLoop audio.LoopSettings
 
 	waveformStates map[string]*WaveformState
 	audioManager   *audio.AudioManager
@@ -111,6 +137,7 @@ func NewPresetEditWindow(p *preset.Preset, audioMgr *audio.AudioManager) *Preset
 		preset:         p,
 		waveformStates: make(map[string]*WaveformState),
 		peakThreshold:  0.5, // Default to 50% threshold
+		seqImport:      sequenceImport{track: -1, channel: -1},
 	}
 
 	windowTitle := "Preset Editor"
@@ -145,32 +172,81 @@ func NewPresetEditWindow(p *preset.Preset, audioMgr *audio.AudioManager) *Preset
 	w.Components.PlayFromStartButton = button.NewButtonWithID(baseID+20, font.Icon("StepForward")).
 		SetPadding(4).
 		SetRounding(4).
-		SetOnClick(func() { w.onPlayFromStart() })
+		SetOnClick(w.unlessLearning(w.onPlayFromStart))
 
 	w.Components.PlayPauseButton = button.NewButtonWithID(baseID+21, font.Icon("Play")).
 		SetPadding(4).
 		SetRounding(4).
-		SetOnClick(func() { w.onPlayPause() })
+		SetOnClick(w.unlessLearning(w.onPlayPause))
 
 	w.Components.StopButton = button.NewButtonWithID(baseID+22, font.Icon("Square")).
 		SetPadding(4).
 		SetRounding(4).
-		SetOnClick(func() { w.onStop() })
+		SetOnClick(w.unlessLearning(w.onStop))
 
 	w.Components.SkipBackButton = button.NewButtonWithID(baseID+23, font.Icon("ChevronLeft")).
 		SetPadding(4).
 		SetRounding(4).
-		SetOnClick(func() { w.onSkipBack() })
+		SetOnClick(w.unlessLearning(w.onSkipBack))
 
 	w.Components.SkipForwardButton = button.NewButtonWithID(baseID+24, font.Icon("ChevronRight")).
 		SetPadding(4).
 		SetRounding(4).
-		SetOnClick(func() { w.onSkipForward() })
+		SetOnClick(w.unlessLearning(w.onSkipForward))
 
 	w.Components.RepeatButton = button.NewButtonWithID(baseID+25, font.Icon("Repeat")).
 		SetPadding(4).
 		SetRounding(4).
-		SetOnClick(func() { w.onRepeat() })
+		SetOnClick(w.unlessLearning(w.onRepeat))
+
+	w.Components.SnapButton = button.NewButtonWithID(baseID+27, font.Icon("Magnet")).
+		SetPadding(4).
+		SetRounding(4).
+		SetOnClick(func() { w.onSnap() })
+
+	w.Components.ViewModeButton = button.NewButtonWithID(baseID+28, font.Icon("AudioWaveform")).
+		SetPadding(4).
+		SetRounding(4).
+		SetOnClick(func() { w.onToggleViewMode() })
+
+	w.Components.ChannelModeButton = button.NewButtonWithID(baseID+29, font.Icon("AudioLines")).
+		SetPadding(4).
+		SetRounding(4).
+		SetOnClick(func() { w.onCycleChannelMode() })
+
+	w.Components.ChannelMeter = meter.NewChannelMeterWithID(baseID + 36).
+		SetWidth(100).
+		SetHeight(18)
+
+	w.Components.LoopModeButton = button.NewButtonWithID(baseID+37, font.Icon("Repeat1")).
+		SetPadding(4).
+		SetRounding(4).
+		SetOnClick(func() { w.onCycleLoopMode() })
+
+	w.Components.LoopPreviewButton = button.NewButtonWithID(baseID+38, font.Icon("Headphones")).
+		SetPadding(4).
+		SetRounding(4).
+		SetOnClick(func() { w.onToggleLoopPreview() })
+
+	w.Components.SaveLoopButton = button.NewButtonWithID(baseID+39, font.Icon("Save")).
+		SetPadding(4).
+		SetRounding(4).
+		SetOnClick(func() { w.onSaveLoop() })
+
+	w.Components.ImportSequenceButton = button.NewButtonWithID(baseID+41, font.Icon("FileInput")).
+		SetPadding(4).
+		SetRounding(4).
+		SetOnClick(func() { w.onImportSequence() })
+
+	w.Components.ExportSequenceButton = button.NewButtonWithID(baseID+42, font.Icon("FileOutput")).
+		SetPadding(4).
+		SetRounding(4).
+		SetOnClick(func() { w.onExportSequence() })
+
+	w.Components.PreviewSequenceButton = button.NewButtonWithID(baseID+43, font.Icon("Play")).
+		SetPadding(4).
+		SetRounding(4).
+		SetOnClick(func() { w.onToggleSequencePreview() })
 
 	w.Components.GeneratePeaksButton = button.NewButtonWithID(baseID+26, font.Icon("Sparkles")).
 		SetPadding(4).
@@ -222,10 +298,14 @@ func NewPresetEditWindow(p *preset.Preset, audioMgr *audio.AudioManager) *Preset
 	uuid := w.UUID()
 
 	w.Components.PadGrid.SetOwnerID(uuid)
+	w.registerLearnTargets()
 
 	if p != nil {
 		w.Components.PadGrid.SetPreset(p)
 		go w.preloadPresetWavs(p)
+
+		// The newest editor plays incoming MIDI until another editor is focused
+		midi.GetPadRouter().SetPreset(p, uuid)
 	}
 
 	w.Window.SetLayoutBuilder(w)
@@ -240,6 +320,8 @@ func NewPresetEditWindow(p *preset.Preset, audioMgr *audio.AudioManager) *Preset
 		events.AudioPlaybackStoppedKey,
 		events.AudioPlaybackFinishedKey,
 		events.PadGridSelectKey,
+		events.PadGridTriggerKey,
+		events.PadGridReleaseKey,
 		events.ComboboxSelectionChangeEventKey,
 		events.ComponentClickEventKey,
 		events.AudioMetadataLoadedKey,
@@ -268,6 +350,8 @@ func (w *PresetEditWindow) drainEvents() {
 					cmd = component.UpdateCmd{Type: cmdHandleAudioStartStop, Data: event}
 				case events.PadGridSelectKey:
 					cmd = component.UpdateCmd{Type: cmdHandlePadGridClick, Data: event}
+				case events.PadGridTriggerKey, events.PadGridReleaseKey:
+					cmd = component.UpdateCmd{Type: cmdHandlePadTrigger, Data: event}
 				case events.ComboboxSelectionChangeEventKey:
 					cmd = component.UpdateCmd{Type: cmdHandleGridSizeChange, Data: event}
 				case events.ComponentClickEventKey:
@@ -383,12 +467,56 @@ func (w *PresetEditWindow) handleUpdate(cmd component.UpdateCmd) {
 				}
 			}
 
+		case cmdEditSetStale:
+			if stale, ok := cmd.Data.(bool); ok && stale != w.stale {
+				w.stale = stale
+				suffix := ""
+				if stale {
+					suffix = "(removed)"
+				}
+				w.Window.HandleGlobalUpdate(component.UpdateCmd{Type: window.CmdWinSetSuffix, Data: suffix})
+			}
+
+		case cmdEditSetChangedOnDisk:
+			if w.preset != nil {
+				// Our own saves show up as changes too
+				info, err := os.Stat(filepath.Join(w.preset.Path, "preset.xml"))
+				if err == nil && !info.ModTime().Equal(w.savedModTime) {
+					w.changedOnDisk = true
+				}
+			}
+
+		case cmdHandleLearnedControl:
+			if control, ok := cmd.Data.(learnedControl); ok {
+				w.applyLearnedControl(control)
+			}
+
+		case cmdHandlePadTrigger:
+			if event, ok := cmd.Data.(events.PadGridEventRecord); ok && w.Components.PadGrid != nil {
+				if pc := w.Components.PadGrid.Pad(event.Row, event.Col); pc != nil {
+					if event.EventType == events.PadGridTriggerEvent {
+						pc.SetTriggered(event.Velocity)
+					} else {
+						pc.SetReleased()
+					}
+				}
+			}
+
 		case cmdHandlePadGridClick:
 			if event, ok := cmd.Data.(events.PadGridEventRecord); ok {
 				if pc, ok := event.Pad.(*pad.PadComponent); ok && pc != nil {
+					// Sequence cells have no wave, select them for MIDI file import and export
+					if w.isNoteseqPad(pc.Row(), pc.Col()) {
+						w.Components.PadConfig.SetPad(pc)
+						w.loadLoopFromCell(pc.Row(), pc.Col())
+						w.seqImport.status = ""
+						return
+					}
+
 					wavePath := pc.GetWavePath()
 					if wavePath != "" && w.audioManager != nil {
 						w.Components.PadConfig.SetPad(pc)
+						w.loadLoopFromCell(pc.Row(), pc.Col())
 						w.audioManager.ClearPlaybackRegion(wavePath)
 
 						// Save previous pad key and set new one
@@ -697,6 +825,15 @@ func (w *PresetEditWindow) Layout() {
 
 	t := theme.GetCurrentTheme()
 
+	// Route MIDI notes and learned controls to the focused editor
+	if imgui.IsWindowFocusedV(imgui.FocusedFlagsRootAndChildWindows) {
+		midi.GetLearnManager().SetFocusOwner(w.UUID())
+		if currentPreset != nil {
+			midi.GetPadRouter().SetPreset(currentPreset, w.UUID())
+			midi.GetMidiManager().SetClockTempo(currentPreset.Tempo())
+		}
+	}
+
 	if currentPreset == nil {
 		imgui.Text("No preset selected")
 		return
@@ -707,6 +844,24 @@ func (w *PresetEditWindow) Layout() {
 		return
 	}
 
+	if w.stale {
+		imgui.TextColored(imgui.Vec4{X: 0.9, Y: 0.7, Z: 0.2, W: 1.0},
+			fmt.Sprintf("%s The card holding this preset was removed, changes can't be saved", font.Icon("TriangleAlert")))
+	}
+
+	if w.changedOnDisk {
+		imgui.TextColored(imgui.Vec4{X: 0.9, Y: 0.7, Z: 0.2, W: 1.0},
+			fmt.Sprintf("%s This preset was changed outside the editor", font.Icon("TriangleAlert")))
+		imgui.SameLine()
+		if imgui.SmallButton("Reload") {
+			w.reloadPreset()
+		}
+		imgui.SameLine()
+		if imgui.SmallButton("Keep Mine") {
+			w.changedOnDisk = false
+		}
+	}
+
 	availHeight := imgui.ContentRegionAvail().Y
 	defaultWaveformHeight := availHeight * 0.5
 	if defaultWaveformHeight < 200 {
@@ -745,6 +900,7 @@ func (w *PresetEditWindow) Layout() {
 		if imgui.IsItemHovered() {
 			imgui.SetTooltip("Play from beginning")
 		}
+		midilearn.Item(learnPlayFromStart)
 
 		imgui.SameLine()
 
@@ -759,6 +915,7 @@ func (w *PresetEditWindow) Layout() {
 				imgui.SetTooltip("Play from cursor")
 			}
 		}
+		midilearn.Item(learnPlayPause)
 
 		imgui.SameLine()
 
@@ -767,6 +924,7 @@ func (w *PresetEditWindow) Layout() {
 		if imgui.IsItemHovered() {
 			imgui.SetTooltip("Stop")
 		}
+		midilearn.Item(learnStop)
 
 		imgui.SameLine()
 
@@ -775,6 +933,7 @@ func (w *PresetEditWindow) Layout() {
 		if imgui.IsItemHovered() {
 			imgui.SetTooltip("Previous slice")
 		}
+		midilearn.Item(learnSkipBack)
 
 		imgui.SameLine()
 
@@ -783,6 +942,7 @@ func (w *PresetEditWindow) Layout() {
 		if imgui.IsItemHovered() {
 			imgui.SetTooltip("Next slice")
 		}
+		midilearn.Item(learnSkipForward)
 
 		imgui.SameLine()
 
@@ -802,6 +962,40 @@ func (w *PresetEditWindow) Layout() {
 				imgui.SetTooltip("Repeat: One Slice")
 			}
 		}
+		midilearn.Item(learnRepeat)
+
+		imgui.SameLine()
+
+		w.Components.SnapButton.Build()
+
+		if imgui.IsItemHovered() {
+			snapMode := w.Components.Wave.GetSnapMode()
+			if snapMode == waveform.SnapBeatGrid && w.preset != nil && w.preset.Tempo() <= 0 {
+				imgui.SetTooltip("Snap: Beat Grid (tempo unknown)")
+			} else {
+				imgui.SetTooltip(fmt.Sprintf("Snap: %s", snapMode))
+			}
+		}
+
+		imgui.SameLine()
+
+		w.Components.ViewModeButton.Build()
+
+		if imgui.IsItemHovered() {
+			imgui.SetTooltip(fmt.Sprintf("View: %s", w.Components.Wave.GetViewMode()))
+		}
+
+		imgui.SameLine()
+
+		w.Components.ChannelModeButton.Build()
+
+		if imgui.IsItemHovered() {
+			imgui.SetTooltip(fmt.Sprintf("Channels: %s", w.Components.Wave.GetChannelMode()))
+		}
+
+		imgui.SameLine()
+
+		w.Components.ChannelMeter.Build()
 
 		imgui.SameLine()
 
@@ -907,6 +1101,8 @@ func (w *PresetEditWindow) Layout() {
 			imgui.SetTooltip("Generate slice markers from audio peaks")
 		}
 
+		w.layoutLoopControls()
+
 	} else {
 		imgui.Text("No wave selected")
 	}
@@ -954,6 +1150,10 @@ func (w *PresetEditWindow) Layout() {
 		w.Components.ConfigurationLabel.Build()
 		imgui.EndMenuBar()
 	}
+	if w.activeNoteseqParams() != nil {
+		w.layoutSequenceControls()
+		imgui.Separator()
+	}
 	if w.Components.PadConfig != nil {
 		w.Components.PadConfig.Build()
 	}
@@ -1071,6 +1271,8 @@ func (w *PresetEditWindow) onPlayFromStart() {
 	boundsStartSample, boundsEndSample, _ := w.Components.Wave.GetBoundsAndSlices()
 	w.playbackState.SliceIdx = 0
 
+	w.sendClockTransport(true)
+
 	go func(startMarker, endMarker int, path string) {
 		w.audioManager.ClearCursorPosition(path)
 		if err := w.audioManager.PlayWaveByPath(path, false, startMarker, endMarker); err != nil {
@@ -1090,6 +1292,8 @@ func (w *PresetEditWindow) onStop() {
 
 	w.playbackState.Stop()
 
+	w.sendClockTransport(false)
+
 	go func(path string, state *audio.PlaybackState) {
 		w.audioManager.StopCurrent()
 		// Set cursor position from state
@@ -1200,6 +1404,57 @@ func (w *PresetEditWindow) onRepeat() {
 	}
 }
 
+// onSnap cycles the marker snap mode between off, zero crossing and beat grid
+func (w *PresetEditWindow) onSnap() {
+	if w.Components.Wave == nil {
+		return
+	}
+
+	newMode := (w.Components.Wave.GetSnapMode() + 1) % 3
+
+	if newMode == waveform.SnapBeatGrid && w.preset != nil {
+		w.Components.Wave.SetTempo(w.preset.Tempo())
+	}
+
+	w.Components.Wave.SetSnapMode(newMode)
+}
+
+// onToggleViewMode switches the wave panel between the waveform and spectrogram
+func (w *PresetEditWindow) onToggleViewMode() {
+	if w.Components.Wave == nil {
+		return
+	}
+
+	if w.Components.Wave.GetViewMode() == waveform.ViewSpectrogram {
+		w.Components.Wave.SetViewMode(waveform.ViewWaveform)
+		w.Components.ViewModeButton.SetText(font.Icon("AudioWaveform"))
+	} else {
+		w.Components.Wave.SetViewMode(waveform.ViewSpectrogram)
+		w.Components.ViewModeButton.SetText(font.Icon("Rainbow"))
+	}
+}
+
+// onCycleChannelMode cycles the wave panel through mixed, L/R and mid/side lanes
+func (w *PresetEditWindow) onCycleChannelMode() {
+	if w.Components.Wave == nil {
+		return
+	}
+
+	var newMode waveform.ChannelMode
+	var icon string
+	switch w.Components.Wave.GetChannelMode() {
+	case waveform.ChannelsMixed:
+		newMode, icon = waveform.ChannelsSplit, "Rows2"
+	case waveform.ChannelsSplit:
+		newMode, icon = waveform.ChannelsMidSide, "Columns2"
+	default:
+		newMode, icon = waveform.ChannelsMixed, "AudioLines"
+	}
+
+	w.Components.Wave.SetChannelMode(newMode)
+	w.Components.ChannelModeButton.SetText(font.Icon(icon))
+}
+
 // onGeneratePeaks generates slice markers based on peak detection
 func (w *PresetEditWindow) onGeneratePeaks() {
 	if w.activeWavePath == "" || w.audioManager == nil {
@@ -1378,6 +1633,30 @@ func (w *PresetEditWindow) updateButtonStates(isPlaying bool) {
 		w.Components.RepeatButton.SetText(font.Icon("Repeat") + " 1")
 	}
 
+	// Update Snap button
+	snapMode := waveform.SnapOff
+	if w.Components.Wave != nil {
+		snapMode = w.Components.Wave.GetSnapMode()
+	}
+	if snapMode != waveform.SnapOff {
+		w.Components.SnapButton.SetNormalColor(imgui.Vec4{X: 0.2, Y: 0.7, Z: 0.3, W: 1.0}).
+			SetHoveredColor(imgui.Vec4{X: 0.25, Y: 0.8, Z: 0.35, W: 1.0}).
+			SetActiveColor(imgui.Vec4{X: 0.15, Y: 0.6, Z: 0.25, W: 1.0})
+	} else {
+		w.Components.SnapButton.SetNormalColor(t.Style.Colors.Button.Vec4).
+			SetHoveredColor(t.Style.Colors.ButtonHovered.Vec4).
+			SetActiveColor(t.Style.Colors.ButtonActive.Vec4)
+	}
+
+	switch snapMode {
+	case waveform.SnapOff:
+		w.Components.SnapButton.SetText(font.Icon("Magnet"))
+	case waveform.SnapZeroCrossing:
+		w.Components.SnapButton.SetText(font.Icon("Magnet") + " 0")
+	case waveform.SnapBeatGrid:
+		w.Components.SnapButton.SetText(font.Icon("Magnet") + " #")
+	}
+
 	// Update Playback Status Label
 	var statusText string
 	var statusColor imgui.Vec4
@@ -1402,6 +1681,43 @@ func (w *PresetEditWindow) Preset() *preset.Preset {
 	return w.preset
 }
 
+// SetStale flags the preset as unavailable, e.g. its card was removed. Stale editors stay
+// open but refuse to save so nothing is written where the card used to be mounted.
+func (w *PresetEditWindow) SetStale(stale bool) {
+	w.SendUpdate(component.UpdateCmd{Type: cmdEditSetStale, Data: stale})
+}
+
+// SetChangedOnDisk tells the editor its preset.xml was changed by something else, the
+// editor then offers to reload it
+func (w *PresetEditWindow) SetChangedOnDisk() {
+	w.SendUpdate(component.UpdateCmd{Type: cmdEditSetChangedOnDisk})
+}
+
+// reloadPreset reads the preset from the card again, dropping unsaved changes
+func (w *PresetEditWindow) reloadPreset() {
+	w.changedOnDisk = false
+	if w.preset == nil {
+		return
+	}
+	w.SendUpdate(component.UpdateCmd{Type: cmdEditSetPreset, Data: preset.NewPreset(w.preset.Name, w.preset.Path)})
+}
+
+// savePreset writes the changes in patch back to the card
+func (w *PresetEditWindow) savePreset(patch *bitbox.Patch) error {
+	if w.stale {
+		return fmt.Errorf("preset %s is no longer available", w.preset.Name)
+	}
+	if err := w.preset.Save(patch); err != nil {
+		return err
+	}
+
+	// Remembered so the change it causes on disk isn't mistaken for someone else's
+	if info, err := os.Stat(filepath.Join(w.preset.Path, "preset.xml")); err == nil {
+		w.savedModTime = info.ModTime()
+	}
+	return nil
+}
+
 // preloadPresetWavs requests async loading of all wav files in the preset
 func (w *PresetEditWindow) preloadPresetWavs(p *preset.Preset) {
 	if p == nil || w.audioManager == nil {
@@ -1424,6 +1740,10 @@ func (w *PresetEditWindow) preloadPresetWavs(p *preset.Preset) {
 }
 
 func (w *PresetEditWindow) Destroy() {
+	midi.GetPadRouter().ClearPreset(w.UUID())
+	midi.GetLearnManager().UnregisterOwner(w.UUID())
+	w.stopSequencePreview()
+
 	// Unsubscribe from filtered subscriptions (handles all event types)
 	if w.filteredEventSub != nil {
 		w.filteredEventSub.Unsubscribe()
@@ -1447,6 +1767,16 @@ func (w *PresetEditWindow) Destroy() {
 	w.Components.SkipBackButton.Destroy()
 	w.Components.SkipForwardButton.Destroy()
 	w.Components.SliceInfoLabel.Destroy()
+	w.Components.SnapButton.Destroy()
+	w.Components.ViewModeButton.Destroy()
+	w.Components.ChannelModeButton.Destroy()
+	w.Components.ChannelMeter.Destroy()
+	w.Components.LoopModeButton.Destroy()
+	w.Components.LoopPreviewButton.Destroy()
+	w.Components.SaveLoopButton.Destroy()
+	w.Components.ImportSequenceButton.Destroy()
+	w.Components.ExportSequenceButton.Destroy()
+	w.Components.PreviewSequenceButton.Destroy()
 	w.Components.StopButton.Destroy()
 	w.Components.Wave.Destroy()
 	w.Components.WaveLabel.Destroy()
@@ -17,6 +17,10 @@ const (
 	cmdHandleAudioProgress
 	cmdHandleAudioStartStop
 	cmdHandleAudioLoad
+	cmdHandlePadTrigger
+	cmdHandleLearnedControl
+	cmdEditSetStale
+	cmdEditSetChangedOnDisk
 )
 
 type activeWavePayload struct {
@@ -0,0 +1,162 @@
+package presetedit
+
+import (
+	"bitbox-editor/internal/app/component"
+	"bitbox-editor/internal/audio"
+	"bitbox-editor/internal/midi"
+	"bitbox-editor/internal/parsing/bitbox"
+	"math"
+)
+
+// MIDI learn target IDs of the transport controls
+const (
+	learnPlayFromStart = "transport.play_from_start"
+	learnPlayPause     = "transport.play_pause"
+	learnStop          = "transport.stop"
+	learnSkipBack      = "transport.skip_back"
+	learnSkipForward   = "transport.skip_forward"
+	learnRepeat        = "transport.repeat"
+)
+
+// learnedControl is a value from a learned MIDI control, handed to the UI thread
+type learnedControl struct {
+	TargetID string
+	Value    float64
+}
+
+// learnableCellParam is a sample cell parameter that can be driven from MIDI. Bitbox stores
+// these values in thousandths, min and max are in the same units.
+type learnableCellParam struct {
+	key      string
+	name     string
+	min, max int
+	field    func(p *bitbox.SampleParams) *int
+}
+
+var learnableCellParams = []learnableCellParam{
+	{"gaindb", "Gain", -48000, 12000, func(p *bitbox.SampleParams) *int { return &p.GainDB }},
+	{"pitch", "Pitch", -24000, 24000, func(p *bitbox.SampleParams) *int { return &p.Pitch }},
+	{"panpos", "Pan", -1000, 1000, func(p *bitbox.SampleParams) *int { return &p.PanPos }},
+	{"envattack", "Attack", 0, 9000, func(p *bitbox.SampleParams) *int { return &p.EnvAttack }},
+	{"envdecay", "Decay", 0, 9000, func(p *bitbox.SampleParams) *int { return &p.EnvDecay }},
+	{"envsus", "Sustain", 0, 1000, func(p *bitbox.SampleParams) *int { return &p.EnvSus }},
+	{"envrel", "Release", 0, 9000, func(p *bitbox.SampleParams) *int { return &p.EnvRel }},
+	{"dualfilcutoff", "Filter", -1000, 1000, func(p *bitbox.SampleParams) *int { return &p.DualFilCutoff }},
+	{"fx1send", "FX 1 Send", 0, 1000, func(p *bitbox.SampleParams) *int { return &p.Fx1Send }},
+	{"fx2send", "FX 2 Send", 0, 1000, func(p *bitbox.SampleParams) *int { return &p.Fx2Send }},
+	{"loopfadeamt", "Loop Fade", 0, audio.LoopFadeMax, func(p *bitbox.SampleParams) *int { return &p.LoopFadeAmt }},
+}
+
+// unlessLearning wraps a button callback so clicks only arm the control in learn mode
+func (w *PresetEditWindow) unlessLearning(fn func()) func() {
+	return func() {
+		if !midi.GetLearnManager().IsLearning() {
+			fn()
+		}
+	}
+}
+
+// registerLearnTargets makes the transport controls and the parameters of the selected
+// cell available to MIDI learn
+func (w *PresetEditWindow) registerLearnTargets() {
+	lm := midi.GetLearnManager()
+	ownerID := w.UUID()
+
+	send := func(targetID string) func(float64) {
+		return func(value float64) {
+			w.SendUpdate(component.UpdateCmd{
+				Type: cmdHandleLearnedControl,
+				Data: learnedControl{TargetID: targetID, Value: value},
+			})
+		}
+	}
+
+	transport := []struct{ id, name string }{
+		{learnPlayFromStart, "Play From Start"},
+		{learnPlayPause, "Play/Pause"},
+		{learnStop, "Stop"},
+		{learnSkipBack, "Previous Slice"},
+		{learnSkipForward, "Next Slice"},
+		{learnRepeat, "Repeat"},
+	}
+	for _, t := range transport {
+		lm.RegisterTarget(midi.Target{
+			ID:      t.id,
+			Name:    t.name,
+			OwnerID: ownerID,
+			Kind:    midi.ControlTrigger,
+			Set:     send(t.id),
+		})
+	}
+
+	for _, param := range learnableCellParams {
+		lm.RegisterTarget(midi.Target{
+			ID:      "cell." + param.key,
+			Name:    "Cell " + param.name,
+			OwnerID: ownerID,
+			Kind:    midi.ControlContinuous,
+			Get: func() float64 {
+				params := w.activeSampleParams()
+				if params == nil {
+					return 0
+				}
+				return float64(*param.field(params)-param.min) / float64(param.max-param.min)
+			},
+			Set: send("cell." + param.key),
+		})
+	}
+}
+
+// activeSampleParams returns the params of the selected cell if it is a sample cell
+func (w *PresetEditWindow) activeSampleParams() *bitbox.SampleParams {
+	if w.activeCell == nil {
+		return nil
+	}
+	params, _ := w.activeCell.Params.(*bitbox.SampleParams)
+	return params
+}
+
+// applyLearnedControl runs the action of a learned control on the UI thread
+func (w *PresetEditWindow) applyLearnedControl(control learnedControl) {
+	switch control.TargetID {
+	case learnPlayFromStart:
+		w.onPlayFromStart()
+	case learnPlayPause:
+		w.onPlayPause()
+	case learnStop:
+		w.onStop()
+	case learnSkipBack:
+		w.onSkipBack()
+	case learnSkipForward:
+		w.onSkipForward()
+	case learnRepeat:
+		w.onRepeat()
+	default:
+		w.applyLearnedCellParam(control)
+	}
+}
+
+// applyLearnedCellParam sets a parameter of the selected cell from a learned control
+func (w *PresetEditWindow) applyLearnedCellParam(control learnedControl) {
+	params := w.activeSampleParams()
+	if params == nil {
+		return
+	}
+
+	for _, param := range learnableCellParams {
+		if "cell."+param.key != control.TargetID {
+			continue
+		}
+
+		value := param.min + int(math.Round(control.Value*float64(param.max-param.min)))
+		*param.field(params) = value
+
+		// Keep the loop editor in step with the fade amount
+		if param.key == "loopfadeamt" && w.Components.Wave != nil {
+			loop := w.Components.Wave.GetLoop()
+			loop.FadeAmt = value
+			w.Components.Wave.SetLoop(loop)
+		}
+		return
+	}
+}
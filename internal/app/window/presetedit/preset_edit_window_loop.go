@@ -0,0 +1,284 @@
+package presetedit
+
+import (
+	"bitbox-editor/internal/app/font"
+	"bitbox-editor/internal/app/theme"
+	"bitbox-editor/internal/audio"
+	"bitbox-editor/internal/config"
+	"bitbox-editor/internal/midi"
+	"bitbox-editor/internal/parsing/bitbox"
+	"fmt"
+
+	"github.com/AllenDang/cimgui-go/imgui"
+	"go.uber.org/zap"
+)
+
+// loopModeName returns a display name for a cell loop mode
+func loopModeName(mode int) string {
+	switch mode {
+	case audio.LoopModeForward:
+		return "Forward"
+	case audio.LoopModeBidirectional:
+		return "Bidirectional"
+	default:
+		return "Off"
+	}
+}
+
+// loadLoopFromCell shows the loop stored in the params of the cell at a pad position
+func (w *PresetEditWindow) loadLoopFromCell(row, col int) {
+	w.activeCell = nil
+	loop := audio.LoopSettings{}
+
+	if w.preset != nil {
+		w.activeCell = w.preset.CellAt(row, col)
+	}
+
+	if w.activeCell != nil {
+		if params, ok := w.activeCell.Params.(*bitbox.SampleParams); ok {
+			loop = audio.LoopSettings{
+				Start:   params.LoopStart,
+				End:     params.LoopEnd,
+				Mode:    params.LoopMode,
+				FadeAmt: params.LoopFadeAmt,
+			}
+		}
+	}
+
+	if w.Components.Wave != nil {
+		w.Components.Wave.SetLoop(loop)
+	}
+	w.updateLoopButtons(loop)
+}
+
+// layoutLoopControls draws the loop mode, crossfade, preview and save controls
+func (w *PresetEditWindow) layoutLoopControls() {
+	if w.Components.Wave == nil || w.audioManager == nil {
+		return
+	}
+
+	loop := w.Components.Wave.GetLoop()
+
+	imgui.SameLine()
+	w.Components.LoopModeButton.Build()
+
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip(fmt.Sprintf("Loop: %s", loopModeName(loop.Mode)))
+	}
+
+	if loop.Mode == audio.LoopModeOff {
+		return
+	}
+
+	if loop.Mode == audio.LoopModeForward {
+		imgui.SameLine()
+		imgui.SetNextItemWidth(100)
+
+		fade := int32(loop.FadeAmt)
+		if imgui.SliderIntV("##loopFade", &fade, 0, audio.LoopFadeMax, "Fade %d", imgui.SliderFlagsNone) {
+			loop.FadeAmt = int(fade)
+			w.Components.Wave.SetLoop(loop)
+		}
+
+		if imgui.IsItemHoveredV(imgui.HoveredFlagsNone) {
+			imgui.SetTooltip(fmt.Sprintf("Loop crossfade (%.1f%%%% of the loop)", float64(loop.FadeAmt)/10))
+		}
+	}
+
+	imgui.SameLine()
+	w.Components.LoopPreviewButton.Build()
+
+	_, previewing := w.audioManager.GetLoopPreviewPosition(w.activeWavePath)
+	if imgui.IsItemHovered() {
+		if previewing {
+			imgui.SetTooltip("Stop loop preview")
+		} else {
+			imgui.SetTooltip("Preview loop")
+		}
+	}
+
+	imgui.SameLine()
+	w.Components.SaveLoopButton.Build()
+
+	if imgui.IsItemHovered() {
+		if w.activeCell == nil {
+			imgui.SetTooltip("No cell selected")
+		} else {
+			imgui.SetTooltip("Save loop to cell")
+		}
+	}
+
+	w.layoutClockSync()
+
+	// Restart the preview once an edit is finished so the change can be heard
+	if previewing && loop != w.previewLoop && !w.Components.Wave.IsEditingLoop() {
+		w.startLoopPreview(loop)
+	}
+}
+
+// onCycleLoopMode cycles the loop between off, forward and bidirectional
+func (w *PresetEditWindow) onCycleLoopMode() {
+	if w.Components.Wave == nil {
+		return
+	}
+
+	loop := w.Components.Wave.GetLoop()
+	loop.Mode = (loop.Mode + 1) % (audio.LoopModeBidirectional + 1)
+
+	// Default a new loop to the current bounds
+	if loop.Mode != audio.LoopModeOff && loop.End <= loop.Start {
+		loop.Start, loop.End, _ = w.Components.Wave.GetBoundsAndSlices()
+	}
+
+	w.Components.Wave.SetLoop(loop)
+	w.updateLoopButtons(loop)
+
+	if loop.Mode == audio.LoopModeOff && w.audioManager != nil {
+		if _, previewing := w.audioManager.GetLoopPreviewPosition(w.activeWavePath); previewing {
+			w.audioManager.StopCurrent()
+		}
+	}
+}
+
+// onToggleLoopPreview starts or stops the loop preview of the active wave
+func (w *PresetEditWindow) onToggleLoopPreview() {
+	if w.audioManager == nil || w.activeWavePath == "" || w.Components.Wave == nil {
+		return
+	}
+
+	if _, previewing := w.audioManager.GetLoopPreviewPosition(w.activeWavePath); previewing {
+		w.audioManager.StopCurrent()
+		return
+	}
+
+	w.startLoopPreview(w.Components.Wave.GetLoop())
+}
+
+// startLoopPreview plays the active wave from the start of its bounds into the loop
+func (w *PresetEditWindow) startLoopPreview(loop audio.LoopSettings) {
+	boundsStart, _, _ := w.Components.Wave.GetBoundsAndSlices()
+
+	w.audioManager.SetLoopSync(w.loopSync())
+
+	if err := w.audioManager.PlayLoopPreview(w.activeWavePath, w.UUID(), boundsStart, loop); err != nil {
+		log.Error("Failed to start loop preview", zap.Error(err))
+		return
+	}
+
+	w.previewLoop = loop
+}
+
+// loopSync returns how the loop preview of the active cell follows an external clock
+func (w *PresetEditWindow) loopSync() audio.LoopSync {
+	sync := audio.LoopSync{Mode: audio.ParseSyncMode(config.GetMidiLoopSync())}
+
+	if w.preset != nil {
+		sync.Tempo = w.preset.Tempo()
+	}
+	if params := w.activeSampleParams(); params != nil {
+		sync.Beats = params.BeatCount
+	}
+
+	return sync
+}
+
+// layoutClockSync shows the external clock tempo a loop preview follows
+func (w *PresetEditWindow) layoutClockSync() {
+	mode := audio.ParseSyncMode(config.GetMidiLoopSync())
+	if mode == audio.SyncModeOff {
+		return
+	}
+
+	imgui.SameLine()
+	tempo := midi.GetClockSync().Tempo()
+	if tempo <= 0 {
+		imgui.TextDisabled("No clock")
+		if imgui.IsItemHovered() {
+			imgui.SetTooltip("Loop previews follow the MIDI clock of the input port once it is received")
+		}
+		return
+	}
+
+	imgui.Text(fmt.Sprintf("%.1f BPM", tempo))
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip(fmt.Sprintf("Loop previews follow the external MIDI clock (%s)", audio.SyncModeNames[mode]))
+	}
+}
+
+// sendClockTransport sends start or stop to the output port when MIDI clock is sent
+func (w *PresetEditWindow) sendClockTransport(start bool) {
+	manager := midi.GetMidiManager()
+	if !manager.IsSendingClock() {
+		return
+	}
+
+	var err error
+	if start {
+		err = manager.SendStart()
+	} else {
+		err = manager.SendStop()
+	}
+	if err != nil {
+		log.Debug("Could not send MIDI transport", zap.Error(err))
+	}
+}
+
+// onSaveLoop writes the loop to the active cell's params and saves the preset
+func (w *PresetEditWindow) onSaveLoop() {
+	if w.preset == nil || w.activeCell == nil || w.Components.Wave == nil {
+		log.Warn("Cannot save loop: no cell selected")
+		return
+	}
+
+	params, ok := w.activeCell.Params.(*bitbox.SampleParams)
+	if !ok {
+		log.Warn("Cannot save loop: cell is not a sample", zap.String("type", w.activeCell.Type))
+		return
+	}
+
+	cell := w.preset.CellIndex(w.activeCell)
+	if cell < 0 {
+		log.Warn("Cannot save loop: cell is not part of the preset")
+		return
+	}
+
+	loop := w.Components.Wave.GetLoop()
+	patch := bitbox.NewPatch().
+		SetParam(cell, "loopstart", loop.Start).
+		SetParam(cell, "loopend", loop.End).
+		SetParam(cell, "loopmode", loop.Mode).
+		SetParam(cell, "loopfadeamt", loop.FadeAmt)
+
+	if err := w.savePreset(patch); err != nil {
+		log.Error("Failed to save loop", zap.Error(err))
+		return
+	}
+
+	// Only changed once saved, so the cell never shows a loop that isn't on the card
+	params.LoopStart = loop.Start
+	params.LoopEnd = loop.End
+	params.LoopMode = loop.Mode
+	params.LoopFadeAmt = loop.FadeAmt
+}
+
+// updateLoopButtons highlights the loop mode button when a loop is enabled
+func (w *PresetEditWindow) updateLoopButtons(loop audio.LoopSettings) {
+	t := theme.GetCurrentTheme()
+
+	if loop.Mode != audio.LoopModeOff {
+		w.Components.LoopModeButton.SetNormalColor(imgui.Vec4{X: 0.2, Y: 0.7, Z: 0.3, W: 1.0}).
+			SetHoveredColor(imgui.Vec4{X: 0.25, Y: 0.8, Z: 0.35, W: 1.0}).
+			SetActiveColor(imgui.Vec4{X: 0.15, Y: 0.6, Z: 0.25, W: 1.0})
+	} else {
+		w.Components.LoopModeButton.SetNormalColor(t.Style.Colors.Button.Vec4).
+			SetHoveredColor(t.Style.Colors.ButtonHovered.Vec4).
+			SetActiveColor(t.Style.Colors.ButtonActive.Vec4)
+	}
+
+	switch loop.Mode {
+	case audio.LoopModeBidirectional:
+		w.Components.LoopModeButton.SetText(font.Icon("ArrowRightLeft"))
+	default:
+		w.Components.LoopModeButton.SetText(font.Icon("Repeat1"))
+	}
+}
@@ -0,0 +1,284 @@
+package presetedit
+
+import (
+	"bitbox-editor/internal/app/eventbus"
+	"bitbox-editor/internal/io/compliance"
+	"bitbox-editor/internal/midi"
+	"bitbox-editor/internal/parsing/bitbox"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AllenDang/cimgui-go/imgui"
+	"go.uber.org/zap"
+)
+
+// sequenceImport holds the MIDI file chosen for import into the active noteseq cell
+type sequenceImport struct {
+	path    string
+	tracks  []midi.SMFTrack
+	track   int
+	channel int
+	status  string
+}
+
+// activeNoteseqParams returns the params of the selected cell if it is a noteseq cell
+func (w *PresetEditWindow) activeNoteseqParams() *bitbox.NoteseqParams {
+	if w.activeCell == nil {
+		return nil
+	}
+	params, _ := w.activeCell.Params.(*bitbox.NoteseqParams)
+	return params
+}
+
+// isNoteseqPad returns true if the pad at a position holds a noteseq cell
+func (w *PresetEditWindow) isNoteseqPad(row, col int) bool {
+	if w.preset == nil {
+		return false
+	}
+	cell := w.preset.CellAt(row, col)
+	return cell != nil && cell.Type == "noteseq"
+}
+
+// layoutSequenceControls draws the MIDI file import and export controls of a noteseq cell
+func (w *PresetEditWindow) layoutSequenceControls() {
+	params := w.activeNoteseqParams()
+	if params == nil {
+		return
+	}
+
+	notes := 0
+	if w.activeCell.Sequence != nil {
+		notes = len(w.activeCell.Sequence.Notes())
+	}
+	imgui.Text(fmt.Sprintf("Sequence: %d notes, %d steps of %s", notes, params.Steps(), stepLengthName(params)))
+
+	imgui.SetNextItemWidth(260)
+	imgui.InputTextWithHint("##smfPath", "Path to .mid file", &w.seqImport.path, imgui.InputTextFlagsNone, nil)
+	if imgui.IsItemDeactivatedAfterEdit() {
+		w.loadSequenceTracks()
+	}
+
+	if len(w.seqImport.tracks) > 1 {
+		imgui.SameLine()
+		imgui.SetNextItemWidth(160)
+		if imgui.BeginCombo("##smfTrack", w.sequenceTrackName(w.seqImport.track)) {
+			if imgui.SelectableBoolV("All tracks", w.seqImport.track < 0, imgui.SelectableFlagsNone, imgui.Vec2{}) {
+				w.seqImport.track = -1
+			}
+			for _, track := range w.seqImport.tracks {
+				if imgui.SelectableBoolV(w.sequenceTrackName(track.Index), w.seqImport.track == track.Index, imgui.SelectableFlagsNone, imgui.Vec2{}) {
+					w.seqImport.track = track.Index
+				}
+			}
+			imgui.EndCombo()
+		}
+	}
+
+	imgui.SameLine()
+	imgui.SetNextItemWidth(90)
+	channelName := "All ch"
+	if w.seqImport.channel >= 0 {
+		channelName = fmt.Sprintf("Ch %d", w.seqImport.channel+1)
+	}
+	if imgui.BeginCombo("##smfChannel", channelName) {
+		if imgui.SelectableBoolV("All ch", w.seqImport.channel < 0, imgui.SelectableFlagsNone, imgui.Vec2{}) {
+			w.seqImport.channel = -1
+		}
+		for ch := 0; ch < 16; ch++ {
+			if imgui.SelectableBoolV(fmt.Sprintf("Ch %d", ch+1), w.seqImport.channel == ch, imgui.SelectableFlagsNone, imgui.Vec2{}) {
+				w.seqImport.channel = ch
+			}
+		}
+		imgui.EndCombo()
+	}
+
+	imgui.SameLine()
+	w.Components.ImportSequenceButton.Build()
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Import notes from the MIDI file, quantized to the sequence steps")
+	}
+
+	imgui.SameLine()
+	w.Components.ExportSequenceButton.Build()
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip(fmt.Sprintf("Export the sequence to %s", w.sequenceExportPath()))
+	}
+
+	imgui.SameLine()
+	previewing := w.seqPreview != nil && w.seqPreview.IsPlaying()
+	w.Components.PreviewSequenceButton.SetToggled(previewing).Build()
+	if imgui.IsItemHovered() {
+		if previewing {
+			imgui.SetTooltip("Stop the sequence preview")
+		} else {
+			imgui.SetTooltip(fmt.Sprintf("Play the sequence on MIDI channel %d of the output port", midi.SequenceChannel(params)+1))
+		}
+	}
+
+	if w.seqImport.status != "" {
+		imgui.TextDisabled(w.seqImport.status)
+	}
+}
+
+// stepLengthName returns the step length of a sequence as a note value
+func stepLengthName(params *bitbox.NoteseqParams) string {
+	quarters := params.StepQuarters()
+	if quarters >= 4 {
+		return fmt.Sprintf("%.0f bar", quarters/4)
+	}
+	return fmt.Sprintf("1/%.0f", 4/quarters)
+}
+
+// sequenceTrackName describes a track of the MIDI file chosen for import
+func (w *PresetEditWindow) sequenceTrackName(index int) string {
+	if index < 0 || index >= len(w.seqImport.tracks) {
+		return "All tracks"
+	}
+	track := w.seqImport.tracks[index]
+	return fmt.Sprintf("%d: %s (%d)", track.Index+1, track.Name, track.Notes)
+}
+
+// loadSequenceTracks reads the tracks of the MIDI file chosen for import
+func (w *PresetEditWindow) loadSequenceTracks() {
+	w.seqImport.tracks = nil
+	w.seqImport.track = -1
+	w.seqImport.status = ""
+
+	if w.seqImport.path == "" {
+		return
+	}
+
+	tracks, err := midi.ReadSMFTracks(w.seqImport.path)
+	if err != nil {
+		w.seqImport.status = err.Error()
+		return
+	}
+	w.seqImport.tracks = tracks
+
+	// Default to the first track with notes, type 1 files usually start with a tempo track
+	for _, track := range tracks {
+		if track.Notes > 0 {
+			w.seqImport.track = track.Index
+			break
+		}
+	}
+}
+
+// onImportSequence replaces the sequence of the active noteseq cell with the notes of
+// the chosen MIDI file and saves the preset
+func (w *PresetEditWindow) onImportSequence() {
+	params := w.activeNoteseqParams()
+	if params == nil || w.preset == nil {
+		log.Warn("Cannot import MIDI file: no noteseq cell selected")
+		return
+	}
+
+	if w.seqImport.tracks == nil {
+		w.loadSequenceTracks()
+		if w.seqImport.tracks == nil {
+			return
+		}
+	}
+
+	seq, err := midi.ImportSMF(w.seqImport.path, params, midi.SMFImportOptions{
+		Track:   w.seqImport.track,
+		Channel: w.seqImport.channel,
+	})
+	if err != nil {
+		log.Error("Failed to import MIDI file", zap.Error(err))
+		w.seqImport.status = err.Error()
+		return
+	}
+
+	patch := bitbox.NewPatch().SetSequence(w.preset.CellIndex(w.activeCell), seq)
+	if err := w.savePreset(patch); err != nil {
+		log.Error("Failed to save imported sequence", zap.Error(err))
+		w.seqImport.status = err.Error()
+		return
+	}
+	w.activeCell.Sequence = seq
+
+	w.seqImport.status = fmt.Sprintf("Imported %d notes from %s", len(seq.Events), filepath.Base(w.seqImport.path))
+}
+
+// onExportSequence writes the sequence of the active noteseq cell to a MIDI file
+func (w *PresetEditWindow) onExportSequence() {
+	params := w.activeNoteseqParams()
+	if params == nil || w.preset == nil {
+		log.Warn("Cannot export MIDI file: no noteseq cell selected")
+		return
+	}
+
+	path := w.sequenceExportPath()
+	if err := midi.ExportSMF(path, w.activeCell.Sequence, params, w.activeCell.Name, w.preset.Tempo()); err != nil {
+		log.Error("Failed to export MIDI file", zap.Error(err))
+		w.seqImport.status = err.Error()
+		return
+	}
+
+	w.seqImport.status = fmt.Sprintf("Exported to %s", path)
+}
+
+// sequenceExportPath returns the file the active sequence is exported to, named after the
+// cell in the preset dir. The name is made safe for the card so it can't point outside the
+// preset, and a number is added rather than overwriting an existing file, e.g. the one the
+// sequence was imported from.
+func (w *PresetEditWindow) sequenceExportPath() string {
+	name := "sequence"
+	if w.activeCell != nil {
+		switch {
+		case w.activeCell.Name != "":
+			name = w.activeCell.Name
+		case w.activeCell.Row != nil && w.activeCell.Column != nil:
+			name = fmt.Sprintf("noteseq_%d_%d", *w.activeCell.Row, *w.activeCell.Column)
+		}
+	}
+	name = strings.TrimSuffix(compliance.SafeName(name+".mid"), ".mid")
+
+	dir := ""
+	if w.preset != nil {
+		dir = w.preset.Path
+	}
+
+	path := filepath.Join(dir, name+".mid")
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+			return path
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s_%d.mid", name, i))
+	}
+}
+
+// onToggleSequencePreview plays the sequence of the active noteseq cell to the MIDI output
+// port at the preset tempo, or stops a playing preview
+func (w *PresetEditWindow) onToggleSequencePreview() {
+	if w.seqPreview != nil && w.seqPreview.IsPlaying() {
+		w.stopSequencePreview()
+		return
+	}
+
+	params := w.activeNoteseqParams()
+	if params == nil || w.preset == nil {
+		return
+	}
+
+	if midi.GetMidiManager().OutputPort() == "" {
+		w.seqImport.status = "No MIDI output port open, choose one in the settings"
+		return
+	}
+
+	w.seqPreview = midi.PlaySequence(eventbus.Bus, w.activeCell.Sequence, params, w.preset.Tempo(), w.UUID())
+}
+
+// stopSequencePreview stops the sequence preview if one is playing
+func (w *PresetEditWindow) stopSequencePreview() {
+	if w.seqPreview == nil {
+		return
+	}
+	w.seqPreview.Stop()
+	w.seqPreview = nil
+}
@@ -15,9 +15,11 @@ import (
 	"bitbox-editor/internal/app/font"
 	"bitbox-editor/internal/app/window"
 	"bitbox-editor/internal/app/window/storage"
+	"bitbox-editor/internal/io/file"
 	"bitbox-editor/internal/logging"
 	"bitbox-editor/internal/preset"
 	"os"
+	"path/filepath"
 
 	"github.com/AllenDang/cimgui-go/imgui"
 	"go.uber.org/zap"
@@ -38,6 +40,7 @@ type PresetListWindow struct {
 	selectedPreset *preset.Preset
 	presetLocation *storage.StorageLocation
 	loading        bool
+	watcher        *file.Watcher
 
 	filteredEventSub *eventbus.FilteredSubscription
 }
@@ -77,6 +80,7 @@ func NewPresetListWindow() *PresetListWindow {
 	w.filteredEventSub.SubscribeMultiple(
 		bus,
 		events.StorageActivatedEventKey,
+		events.StorageUnmountedEventKey,
 		events.ComponentClickEventKey,
 	)
 
@@ -93,6 +97,8 @@ func (w *PresetListWindow) drainEvents() {
 				switch event.Type() {
 				case events.StorageActivatedEventKey:
 					cmd = component.UpdateCmd{Type: cmdPresetListSetLocation, Data: event}
+				case events.StorageUnmountedEventKey:
+					cmd = component.UpdateCmd{Type: cmdPresetListHandleUnmount, Data: event}
 				case events.ComponentClickEventKey:
 					cmd = component.UpdateCmd{Type: cmdHandleRowClick, Data: event}
 				}
@@ -117,6 +123,7 @@ func (w *PresetListWindow) handleUpdate(cmd component.UpdateCmd) {
 		if event, ok := cmd.Data.(events.StorageEventRecord); ok {
 			if loc, ok := event.Data.(*storage.StorageLocation); ok {
 				if w.presetLocation == nil || w.presetLocation.Path != loc.Path {
+					w.stopWatching()
 					w.presetLocation = loc
 					w.presets = nil
 					w.selectedPreset = nil
@@ -126,13 +133,41 @@ func (w *PresetListWindow) handleUpdate(cmd component.UpdateCmd) {
 			}
 		}
 
+	case cmdPresetListHandleUnmount:
+		if event, ok := cmd.Data.(events.StorageEventRecord); ok {
+			if loc, ok := event.Data.(*storage.StorageLocation); ok {
+				if w.presetLocation != nil && w.presetLocation.Path == loc.Path {
+					w.stopWatching()
+					w.presetLocation = nil
+					w.presets = nil
+					w.selectedPreset = nil
+					w.rebuildTableRows()
+				}
+			}
+		}
+
 	case cmdPresetListSetLoading:
 		if isLoading, ok := cmd.Data.(bool); ok {
 			w.loading = isLoading
 		}
 
 	case cmdPresetListUpdateList:
-		if newList, ok := cmd.Data.([]*preset.Preset); ok {
+		if folders, ok := cmd.Data.([]string); ok {
+			// Presets already loaded are kept so a refresh doesn't read every preset again
+			existing := make(map[string]*preset.Preset, len(w.presets))
+			for _, p := range w.presets {
+				existing[p.Path] = p
+			}
+
+			newList := make([]*preset.Preset, 0, len(folders))
+			for _, folder := range folders {
+				if p, ok := existing[folder]; ok {
+					newList = append(newList, p)
+				} else {
+					newList = append(newList, preset.NewPreset(filepath.Base(folder), folder))
+				}
+			}
+
 			w.presets = newList
 			foundSelected := false
 			if w.selectedPreset != nil {
@@ -149,6 +184,32 @@ func (w *PresetListWindow) handleUpdate(cmd component.UpdateCmd) {
 			w.rebuildTableRows()
 		}
 
+	case cmdPresetListSetWatcher:
+		if payload, ok := cmd.Data.(watcherPayload); ok {
+			if w.presetLocation != nil && w.presetLocation.Path == payload.path {
+				w.stopWatching()
+				w.watcher = payload.watcher
+			} else {
+				payload.watcher.Close()
+			}
+		}
+
+	case cmdPresetListReloadPreset:
+		if folder, ok := cmd.Data.(string); ok {
+			for i, p := range w.presets {
+				if p.Path != folder {
+					continue
+				}
+				reloaded := preset.NewPreset(p.Name, p.Path)
+				w.presets[i] = reloaded
+				if w.selectedPreset == p {
+					w.selectedPreset = reloaded
+				}
+				w.rebuildTableRows()
+				break
+			}
+		}
+
 	case cmdPresetListSetSelected:
 		if p, ok := cmd.Data.(*preset.Preset); ok {
 			if w.selectedPreset != p {
@@ -219,30 +280,30 @@ func (w *PresetListWindow) startScan() {
 	path := w.presetLocation.Path
 
 	go func() {
-		presetList := make([]*preset.Preset, 0)
-		scanPath := path + "/Presets/"
-		entries, err := os.ReadDir(scanPath)
-
-		if err != nil {
-			log.Error("Failed to read preset directory", zap.Error(err), zap.String("path", scanPath))
-			// Send empty list
-			w.SendUpdate(component.UpdateCmd{Type: cmdPresetListUpdateList, Data: presetList})
-		} else {
-			for _, entry := range entries {
-				if entry.IsDir() {
-					p := preset.NewPreset(
-						entry.Name(),
-						scanPath+entry.Name(),
-					)
-					presetList = append(presetList, p)
-				}
+		w.scan(path)
+		w.SendUpdate(component.UpdateCmd{Type: cmdPresetListSetLoading, Data: false})
+		w.watch(path)
+	}()
+}
+
+// scan lists the preset folders of a location and sends them to the window
+func (w *PresetListWindow) scan(path string) {
+	folders := make([]string, 0)
+	scanPath := path + "/Presets/"
+	entries, err := os.ReadDir(scanPath)
+
+	if err != nil {
+		log.Error("Failed to read preset directory", zap.Error(err), zap.String("path", scanPath))
+	} else {
+		for _, entry := range entries {
+			if entry.IsDir() {
+				folders = append(folders, scanPath+entry.Name())
 			}
-			// Send updated list
-			w.SendUpdate(component.UpdateCmd{Type: cmdPresetListUpdateList, Data: presetList})
 		}
+	}
 
-		w.SendUpdate(component.UpdateCmd{Type: cmdPresetListSetLoading, Data: false})
-	}()
+	// Send updated list, empty if the folder couldn't be read
+	w.SendUpdate(component.UpdateCmd{Type: cmdPresetListUpdateList, Data: folders})
 }
 
 func (w *PresetListWindow) SetPresetLocation(location *storage.StorageLocation) *PresetListWindow {
@@ -285,6 +346,8 @@ func (w *PresetListWindow) Layout() {
 }
 
 func (w *PresetListWindow) Destroy() {
+	w.stopWatching()
+
 	// Unsubscribe from filtered subscriptions
 	if w.filteredEventSub != nil {
 		w.filteredEventSub.Unsubscribe()
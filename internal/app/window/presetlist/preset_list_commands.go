@@ -8,4 +8,7 @@ const (
 	cmdPresetListUpdateList
 	cmdPresetListSetSelected
 	cmdHandleRowClick
+	cmdPresetListHandleUnmount
+	cmdPresetListSetWatcher
+	cmdPresetListReloadPreset
 )
@@ -0,0 +1,79 @@
+package presetlist
+
+import (
+	"bitbox-editor/internal/app/component"
+	"bitbox-editor/internal/app/eventbus"
+	"bitbox-editor/internal/app/events"
+	"bitbox-editor/internal/io/file"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// watchDelay is how long file changes have to settle before the list updates
+const watchDelay = 500 * time.Millisecond
+
+// watcherPayload hands a watcher started in the background to the window
+type watcherPayload struct {
+	path    string
+	watcher *file.Watcher
+}
+
+// watch starts watching the presets folder of a location in the background. Presets
+// added, removed or renamed refresh the list, a changed preset.xml is reloaded and
+// announced so open editors can offer to reload it too.
+func (w *PresetListWindow) watch(path string) {
+	presetsDir := filepath.Join(path, "Presets")
+
+	watcher, err := file.WatchDir(presetsDir, watchDelay, func(batch []fsnotify.Event) {
+		refresh := false
+		changed := make(map[string]bool)
+
+		for _, event := range batch {
+			rel, err := filepath.Rel(presetsDir, event.Name)
+			if err != nil {
+				continue
+			}
+
+			parts := strings.Split(filepath.ToSlash(rel), "/")
+			switch {
+			case len(parts) == 1:
+				refresh = true
+			case len(parts) == 2 && strings.EqualFold(parts[1], "preset.xml") &&
+				event.Has(fsnotify.Create|fsnotify.Write):
+				// Same form as the folders the scan finds
+				changed[path+"/Presets/"+parts[0]] = true
+			}
+		}
+
+		if refresh {
+			w.scan(path)
+		}
+
+		for folder := range changed {
+			log.Debug("Preset changed on disk", zap.String("preset", folder))
+			w.SendUpdate(component.UpdateCmd{Type: cmdPresetListReloadPreset, Data: folder})
+			eventbus.Bus.Publish(events.PresetEventRecord{
+				EventType: events.PresetChangedEvent,
+				Data:      folder,
+			})
+		}
+	})
+	if err != nil {
+		log.Warn("Failed to watch presets, changes won't show until a rescan", zap.String("path", presetsDir), zap.Error(err))
+		return
+	}
+
+	w.SendUpdate(component.UpdateCmd{Type: cmdPresetListSetWatcher, Data: watcherPayload{path: path, watcher: watcher}})
+}
+
+// stopWatching stops watching the current presets folder
+func (w *PresetListWindow) stopWatching() {
+	if w.watcher != nil {
+		w.watcher.Close()
+		w.watcher = nil
+	}
+}
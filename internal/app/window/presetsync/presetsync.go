@@ -0,0 +1,330 @@
+package presetsync
+
+/*
+┍━━━━━━━━━━━━╳┑
+│ Sync Window │
+└─────────────┘
+*/
+
+import (
+	"bitbox-editor/internal/app/font"
+	"bitbox-editor/internal/app/window"
+	"bitbox-editor/internal/app/window/storage"
+	"bitbox-editor/internal/io/cardsync"
+	"bitbox-editor/internal/logging"
+	"fmt"
+
+	"github.com/AllenDang/cimgui-go/imgui"
+	"go.uber.org/zap"
+)
+
+var log = logging.NewLogger("presetsync")
+
+// SyncWindow compares two storage locations, e.g. a local preset workspace and the card,
+// and copies presets and samples between them
+type SyncWindow struct {
+	*window.Window[*SyncWindow]
+
+	// locations returns the storage locations that can be synced
+	locations func() []*storage.StorageLocation
+
+	pathA string
+	pathB string
+
+	plan          *cardsync.Plan
+	direction     cardsync.Direction
+	result        *cardsync.Result
+	busy          bool
+	status        string
+	showUnchanged bool
+
+	tableFlags imgui.TableFlags
+}
+
+func NewSyncWindow(locations func() []*storage.StorageLocation) *SyncWindow {
+	w := &SyncWindow{
+		locations: locations,
+		direction: cardsync.DirectionBoth,
+		tableFlags: imgui.TableFlagsResizable |
+			imgui.TableFlagsRowBg |
+			imgui.TableFlagsScrollY |
+			imgui.TableFlagsSizingFixedFit,
+	}
+
+	w.Window = window.NewWindow[*SyncWindow]("Sync", "FolderSync", w.handleUpdate)
+	w.Window.SetLayoutBuilder(w)
+
+	// Opened from the View menu when needed
+	w.SetClose()
+
+	return w
+}
+
+// handleUpdate - processes incoming update commands
+func (w *SyncWindow) handleUpdate(cmd UpdateCmd) {
+	switch c := cmd.Type.(type) {
+	case window.GlobalCommand:
+		w.Window.HandleGlobalUpdate(cmd)
+		return
+
+	case localCommand:
+		switch c {
+		case cmdSyncSetPlan:
+			if plan, ok := cmd.Data.(*cardsync.Plan); ok {
+				w.plan = plan
+				w.result = nil
+				w.busy = false
+				w.status = fmt.Sprintf("%d added, %d changed, %d removed, %d conflicts",
+					plan.Count(cardsync.AddedA)+plan.Count(cardsync.AddedB),
+					plan.Count(cardsync.ChangedA)+plan.Count(cardsync.ChangedB),
+					plan.Count(cardsync.RemovedA)+plan.Count(cardsync.RemovedB),
+					plan.Count(cardsync.Conflict))
+			}
+
+		case cmdSyncSetResult:
+			if payload, ok := cmd.Data.(syncResultPayload); ok {
+				w.result = payload.Result
+				w.busy = false
+
+				switch {
+				case payload.Err != nil:
+					w.status = payload.Err.Error()
+				case payload.Result.DryRun:
+					w.status = fmt.Sprintf("Dry run: %d operations", len(payload.Result.Operations))
+				default:
+					w.status = fmt.Sprintf("Synced: %d operations", payload.Result.Applied)
+					// The plan is out of date once applied
+					w.plan = nil
+					w.compare()
+				}
+			}
+
+		case cmdSyncSetError:
+			if err, ok := cmd.Data.(error); ok {
+				w.busy = false
+				w.status = err.Error()
+			}
+		}
+		return
+
+	default:
+		log.Warn("SyncWindow unhandled update", zap.Any("cmd", cmd))
+	}
+}
+
+// compare builds the sync plan of the chosen locations in the background
+func (w *SyncWindow) compare() {
+	if w.pathA == "" || w.pathB == "" || w.pathA == w.pathB {
+		w.status = "Choose two different locations"
+		return
+	}
+
+	w.busy = true
+	w.status = "Comparing..."
+	pathA, pathB := w.pathA, w.pathB
+
+	go func() {
+		plan, err := cardsync.Compare(pathA, pathB)
+		if err != nil {
+			log.Error("Failed to compare locations", zap.Error(err))
+			w.SendUpdate(UpdateCmd{Type: cmdSyncSetError, Data: err})
+			return
+		}
+		w.SendUpdate(UpdateCmd{Type: cmdSyncSetPlan, Data: plan})
+	}()
+}
+
+// apply runs the plan in the background, or only lists its operations for a dry run
+func (w *SyncWindow) apply(dryRun bool) {
+	if w.plan == nil {
+		return
+	}
+
+	w.busy = true
+	w.status = "Syncing..."
+	plan, direction := w.plan, w.direction
+
+	go func() {
+		result, err := plan.Apply(direction, dryRun)
+		if err != nil {
+			log.Error("Failed to sync locations", zap.Error(err))
+		}
+		w.SendUpdate(UpdateCmd{Type: cmdSyncSetResult, Data: syncResultPayload{Result: result, Err: err}})
+	}()
+}
+
+func (w *SyncWindow) Menu() {}
+
+// layoutLocationCombo draws a combo choosing one of the storage locations
+func (w *SyncWindow) layoutLocationCombo(id string, path *string) {
+	preview := *path
+	if preview == "" {
+		preview = "Choose location"
+	}
+
+	imgui.SetNextItemWidth(260)
+	if imgui.BeginCombo(id, preview) {
+		for _, loc := range w.locations() {
+			label := loc.Path
+			if loc.Name != "" && loc.Name != loc.Path {
+				label = fmt.Sprintf("%s (%s)", loc.Name, loc.Path)
+			}
+			if imgui.SelectableBoolV(label, loc.Path == *path, imgui.SelectableFlagsNone, imgui.Vec2{}) && loc.Path != *path {
+				*path = loc.Path
+				w.plan = nil
+				w.result = nil
+				w.status = ""
+			}
+		}
+		imgui.EndCombo()
+	}
+}
+
+func (w *SyncWindow) Layout() {
+	w.Window.ProcessUpdates()
+
+	imgui.Text("A")
+	imgui.SameLine()
+	w.layoutLocationCombo("##sync_a", &w.pathA)
+	imgui.SameLine()
+	imgui.Text("B")
+	imgui.SameLine()
+	w.layoutLocationCombo("##sync_b", &w.pathB)
+	imgui.SameLine()
+
+	imgui.BeginDisabledV(w.busy)
+	if imgui.Button(font.Icon("GitCompare") + " Compare") {
+		w.compare()
+	}
+	imgui.EndDisabled()
+
+	imgui.SetNextItemWidth(120)
+	if imgui.BeginCombo("##sync_direction", cardsync.DirectionNames[w.direction]) {
+		for i, name := range cardsync.DirectionNames {
+			if imgui.SelectableBoolV(name, int(w.direction) == i, imgui.SelectableFlagsNone, imgui.Vec2{}) {
+				w.direction = cardsync.Direction(i)
+				w.result = nil
+			}
+		}
+		imgui.EndCombo()
+	}
+	imgui.SameLine()
+
+	imgui.BeginDisabledV(w.busy || w.plan == nil)
+	if imgui.Button("Dry Run") {
+		w.apply(true)
+	}
+	if imgui.IsItemHoveredV(imgui.HoveredFlagsAllowWhenDisabled) {
+		imgui.SetTooltip("List what a sync would do without changing any files")
+	}
+	imgui.SameLine()
+	if imgui.Button(font.Icon("FolderSync") + " Sync") {
+		w.apply(false)
+	}
+	imgui.EndDisabled()
+	imgui.SameLine()
+	imgui.Checkbox("Show unchanged", &w.showUnchanged)
+
+	if w.status != "" {
+		imgui.TextDisabled(w.status)
+	}
+
+	if w.result != nil {
+		w.layoutResult()
+	}
+
+	if w.plan != nil {
+		w.layoutPlan()
+	}
+}
+
+// layoutPlan draws the files that differ, conflicts get a choice of which side to keep
+func (w *SyncWindow) layoutPlan() {
+	if !imgui.BeginTableV("sync_plan", 5, w.tableFlags, imgui.Vec2{}, 0) {
+		return
+	}
+	defer imgui.EndTable()
+
+	static := imgui.TableColumnFlagsWidthFixed
+	stretch := imgui.TableColumnFlagsWidthStretch
+	imgui.TableSetupScrollFreeze(0, 1)
+	imgui.TableSetupColumnV("Path", stretch, 1, 0)
+	imgui.TableSetupColumnV("A", static, 130, 0)
+	imgui.TableSetupColumnV("B", static, 130, 0)
+	imgui.TableSetupColumnV("Change", static, 80, 0)
+	imgui.TableSetupColumnV("Action", static, 110, 0)
+	imgui.TableHeadersRow()
+
+	for i, entry := range w.plan.Entries {
+		if entry.Change == cardsync.Unchanged && !w.showUnchanged {
+			continue
+		}
+
+		imgui.TableNextRow()
+		imgui.TableNextColumn()
+		imgui.Text(entry.Path)
+		imgui.TableNextColumn()
+		imgui.Text(describeFile(entry.A))
+		imgui.TableNextColumn()
+		imgui.Text(describeFile(entry.B))
+		imgui.TableNextColumn()
+		if entry.Change == cardsync.Conflict {
+			imgui.TextColored(imgui.Vec4{X: 0.9, Y: 0.5, Z: 0.2, W: 1.0}, entry.Change.String())
+		} else {
+			imgui.Text(entry.Change.String())
+		}
+		imgui.TableNextColumn()
+
+		if entry.Change != cardsync.Conflict {
+			imgui.Text(entry.Action.String())
+			continue
+		}
+
+		imgui.SetNextItemWidth(-1)
+		if imgui.BeginCombo(fmt.Sprintf("##sync_resolve_%d", i), cardsync.ResolutionNames[entry.Resolution()]) {
+			for r, name := range cardsync.ResolutionNames {
+				if imgui.SelectableBoolV(name, int(entry.Resolution()) == r, imgui.SelectableFlagsNone, imgui.Vec2{}) {
+					entry.Resolve(cardsync.Resolution(r))
+					w.result = nil
+				}
+			}
+			imgui.EndCombo()
+		}
+	}
+}
+
+// layoutResult draws the operations of a dry run and the references a sync would break
+func (w *SyncWindow) layoutResult() {
+	for _, problem := range w.result.Problems {
+		imgui.TextColored(imgui.Vec4{X: 1.0, Y: 0.3, Z: 0.3, W: 1.0}, font.Icon("TriangleAlert")+" "+problem)
+	}
+
+	if !w.result.DryRun || len(w.result.Operations) == 0 {
+		return
+	}
+
+	if imgui.CollapsingHeaderBoolPtr(fmt.Sprintf("Operations (%d)", len(w.result.Operations)), nil) {
+		for _, op := range w.result.Operations {
+			imgui.BulletText(fmt.Sprintf("%s: %s", op.Action, op.Path))
+		}
+	}
+}
+
+// describeFile returns the size and mtime of a file on one side
+func describeFile(f *cardsync.FileState) string {
+	if f == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%s %s", formatSize(f.Size), f.ModTime.Format("2006-01-02 15:04"))
+}
+
+// formatSize returns a byte count in a readable unit
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
@@ -0,0 +1,23 @@
+package presetsync
+
+import (
+	"bitbox-editor/internal/app/window"
+	"bitbox-editor/internal/io/cardsync"
+)
+
+type UpdateCmd = window.UpdateCmd
+type UpdateCmdType = window.UpdateCmdType
+
+type localCommand int
+
+const (
+	cmdSyncSetPlan localCommand = iota
+	cmdSyncSetResult
+	cmdSyncSetError
+)
+
+// syncResultPayload is the outcome of a sync or dry run
+type syncResultPayload struct {
+	Result *cardsync.Result
+	Err    error
+}
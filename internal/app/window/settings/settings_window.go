@@ -12,8 +12,11 @@ import (
 	"bitbox-editor/internal/app/component/label"
 	"bitbox-editor/internal/app/theme"
 	"bitbox-editor/internal/app/window"
+	"bitbox-editor/internal/audio"
 	"bitbox-editor/internal/config"
 	"bitbox-editor/internal/logging"
+	"bitbox-editor/internal/midi"
+	"slices"
 
 	"github.com/AllenDang/cimgui-go/imgui"
 	"github.com/AllenDang/cimgui-go/implot"
@@ -43,6 +46,14 @@ type SettingsWindow struct {
 	currentColormap     string
 	spectrumSettings    spectrumSettings
 	spectrumTemp        spectrumSettings
+	midiInputPort       string
+	midiOutputPort      string
+	midiLearnProfile    string
+	midiLoopSync        string
+	midiSendClock       bool
+	midiDriver          string
+	midiSessionPath     string
+	newProfileName      string
 }
 
 func NewSettingsWindow() *SettingsWindow {
@@ -68,6 +79,12 @@ func NewSettingsWindow() *SettingsWindow {
 		currentColormap:     currentColormap,
 		spectrumSettings:    spectSettings,
 		spectrumTemp:        spectSettings,
+		midiInputPort:       config.GetMidiInputPort(),
+		midiOutputPort:      config.GetMidiOutputPort(),
+		midiLearnProfile:    config.GetMidiLearnProfile(),
+		midiLoopSync:        config.GetMidiLoopSync(),
+		midiSendClock:       config.GetMidiSendClock(),
+		midiDriver:          midi.GetMidiManager().Driver().Name(),
 	}
 
 	w.Window = window.NewWindow[*SettingsWindow]("Settings", "Cog", w.handleUpdate)
@@ -149,6 +166,146 @@ func (w *SettingsWindow) handleUpdate(cmd component.UpdateCmd) {
 			w.spectrumTemp = settings
 		}
 
+	case cmdSettingsSetMidiInputPort:
+		if portName, ok := cmd.Data.(string); ok {
+			manager := midi.GetMidiManager()
+			if portName == "" {
+				manager.StopMonitoring()
+			} else if err := manager.StartMonitoring(portName); err != nil {
+				log.Error("Failed to open MIDI input port", zap.String("port", portName), zap.Error(err))
+				return
+			}
+
+			w.midiInputPort = portName
+
+			// Save MIDI input port to config
+			if err := config.SetMidiInputPort(portName); err != nil {
+				log.Error("Failed to save MIDI input port to config", zap.Error(err))
+			}
+		}
+
+	case cmdSettingsSetMidiOutputPort:
+		if portName, ok := cmd.Data.(string); ok {
+			manager := midi.GetMidiManager()
+			if portName == "" {
+				manager.CloseOutput()
+			} else if err := manager.OpenOutput(portName); err != nil {
+				log.Error("Failed to open MIDI output port", zap.String("port", portName), zap.Error(err))
+				return
+			}
+
+			w.midiOutputPort = portName
+
+			// Save MIDI output port to config
+			if err := config.SetMidiOutputPort(portName); err != nil {
+				log.Error("Failed to save MIDI output port to config", zap.Error(err))
+			}
+		}
+
+	case cmdSettingsSetMidiLoopSync:
+		if mode, ok := cmd.Data.(string); ok {
+			am := audio.GetAudioManager()
+			sync := am.LoopSyncSettings()
+			sync.Mode = audio.ParseSyncMode(mode)
+			am.SetLoopSync(sync)
+
+			w.midiLoopSync = mode
+
+			// Save loop sync mode to config
+			if err := config.SetMidiLoopSync(mode); err != nil {
+				log.Error("Failed to save MIDI loop sync to config", zap.Error(err))
+			}
+		}
+
+	case cmdSettingsSetMidiSendClock:
+		if enabled, ok := cmd.Data.(bool); ok {
+			if enabled {
+				midi.GetMidiManager().StartClock(0)
+			} else {
+				midi.GetMidiManager().StopClock()
+			}
+
+			w.midiSendClock = enabled
+
+			// Save send clock to config
+			if err := config.SetMidiSendClock(enabled); err != nil {
+				log.Error("Failed to save MIDI send clock to config", zap.Error(err))
+			}
+		}
+
+	case cmdSettingsSetMidiDriver:
+		if name, ok := cmd.Data.(string); ok {
+			midi.GetMidiManager().SetDriver(midi.NewDriver(name))
+			w.midiDriver = name
+
+			// Port names belong to the driver, so the selected ports are closed with it
+			w.midiInputPort = ""
+			w.midiOutputPort = ""
+			if err := config.SetMidiInputPort(""); err != nil {
+				log.Error("Failed to save MIDI input port to config", zap.Error(err))
+			}
+			if err := config.SetMidiOutputPort(""); err != nil {
+				log.Error("Failed to save MIDI output port to config", zap.Error(err))
+			}
+
+			// Save MIDI driver to config
+			if err := config.SetMidiDriver(name); err != nil {
+				log.Error("Failed to save MIDI driver to config", zap.Error(err))
+			}
+		}
+
+	case cmdSettingsToggleMidiRecording:
+		manager := midi.GetMidiManager()
+		if !manager.IsRecording() {
+			manager.StartRecording()
+			return
+		}
+
+		session := manager.StopRecording()
+		if err := midi.SaveSession(w.midiSessionPath, session); err != nil {
+			log.Error("Failed to save MIDI session", zap.Error(err))
+			return
+		}
+		log.Info("Saved MIDI session", zap.String("path", w.midiSessionPath), zap.Int("events", len(session.Events)))
+
+	case cmdSettingsReplayMidiSession:
+		if path, ok := cmd.Data.(string); ok {
+			session, err := midi.LoadSession(path)
+			if err != nil {
+				log.Error("Failed to load MIDI session", zap.Error(err))
+				return
+			}
+
+			go func() {
+				if err := midi.GetMidiManager().ReplaySession(session, true, nil); err != nil {
+					log.Error("Failed to replay MIDI session", zap.Error(err))
+				}
+			}()
+		}
+
+	case cmdSettingsSetMidiLearnProfile:
+		if name, ok := cmd.Data.(string); ok {
+			if err := midi.GetLearnManager().UseProfile(name); err != nil {
+				log.Error("Failed to switch MIDI learn profile", zap.String("profile", name), zap.Error(err))
+				return
+			}
+			w.midiLearnProfile = name
+		}
+
+	case cmdSettingsUpdateMidiBinding:
+		if binding, ok := cmd.Data.(midi.Binding); ok {
+			if err := midi.GetLearnManager().UpdateBinding(binding); err != nil {
+				log.Error("Failed to save MIDI binding", zap.String("target", binding.Target), zap.Error(err))
+			}
+		}
+
+	case cmdSettingsRemoveMidiBinding:
+		if targetID, ok := cmd.Data.(string); ok {
+			if err := midi.GetLearnManager().RemoveBinding(targetID); err != nil {
+				log.Error("Failed to remove MIDI binding", zap.String("target", targetID), zap.Error(err))
+			}
+		}
+
 	default:
 		log.Warn("SettingsWindow unhandled update", zap.Any("cmd", cmd))
 	}
@@ -471,5 +628,306 @@ func (w *SettingsWindow) Layout() {
 		}
 	}
 
+	imgui.Spacing()
+	imgui.Separator()
+	imgui.Spacing()
+
+	// MIDI Settings Section
+	label.NewLabel("MIDI").Build()
+	imgui.Spacing()
+
+	// Driver
+	label.NewLabel("Driver").Build()
+	imgui.SameLineV(0, 10)
+	imgui.PushItemWidth(200)
+	if imgui.BeginCombo("##midi_driver", w.midiDriver) {
+		for _, name := range []string{midi.DriverSystem, midi.DriverLoopback} {
+			isSelected := name == w.midiDriver
+			if imgui.SelectableBoolV(name, isSelected, imgui.SelectableFlagsNone, imgui.Vec2{}) && !isSelected {
+				cmd := component.UpdateCmd{Type: cmdSettingsSetMidiDriver, Data: name}
+				w.Window.SendUpdate(cmd)
+			}
+			if isSelected {
+				imgui.SetItemDefaultFocus()
+			}
+		}
+		imgui.EndCombo()
+	}
+	imgui.PopItemWidth()
+
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("The loopback driver sends output back to its input without any hardware")
+	}
+
+	// Session recording and replay
+	label.NewLabel("Session").Build()
+	imgui.SameLineV(0, 10)
+	imgui.PushItemWidth(200)
+	imgui.InputTextWithHint("##midi_session_path", "Path to "+midi.SessionExt+" file", &w.midiSessionPath, imgui.InputTextFlagsNone, nil)
+	imgui.PopItemWidth()
+
+	imgui.SameLine()
+	imgui.BeginDisabledV(w.midiSessionPath == "")
+	recordLabel := "Record"
+	if midi.GetMidiManager().IsRecording() {
+		recordLabel = "Stop & Save"
+	}
+	if imgui.Button(recordLabel + "##midi_session_record") {
+		w.Window.SendUpdate(component.UpdateCmd{Type: cmdSettingsToggleMidiRecording})
+	}
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Record the messages received on the input port to the session file")
+	}
+	imgui.SameLine()
+	if imgui.Button("Replay##midi_session_replay") {
+		cmd := component.UpdateCmd{Type: cmdSettingsReplayMidiSession, Data: w.midiSessionPath}
+		w.Window.SendUpdate(cmd)
+	}
+	imgui.EndDisabled()
+
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Replay a recorded session into the editor as if it came from the input port")
+	}
+
+	// Input Port
+	label.NewLabel("Input Port").Build()
+	imgui.SameLineV(0, 10)
+	imgui.PushItemWidth(200)
+
+	// The port can also be changed from the MIDI monitor
+	w.midiInputPort = midi.GetMidiManager().InputPort()
+
+	portPreview := w.midiInputPort
+	if portPreview == "" {
+		portPreview = "None"
+	}
+	if imgui.BeginCombo("##midi_input_port", portPreview) {
+		if imgui.SelectableBoolV("None", w.midiInputPort == "", imgui.SelectableFlagsNone, imgui.Vec2{}) {
+			cmd := component.UpdateCmd{Type: cmdSettingsSetMidiInputPort, Data: ""}
+			w.Window.SendUpdate(cmd)
+		}
+		for _, portName := range midi.GetMidiManager().ListPorts() {
+			isSelected := portName == w.midiInputPort
+			if imgui.SelectableBoolV(portName, isSelected, imgui.SelectableFlagsNone, imgui.Vec2{}) {
+				cmd := component.UpdateCmd{Type: cmdSettingsSetMidiInputPort, Data: portName}
+				w.Window.SendUpdate(cmd)
+			}
+			if isSelected {
+				imgui.SetItemDefaultFocus()
+			}
+		}
+		imgui.EndCombo()
+	}
+	imgui.PopItemWidth()
+
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Notes from this port play the pads of the focused preset")
+	}
+
+	// Output Port
+	label.NewLabel("Output Port").Build()
+	imgui.SameLineV(0, 10)
+	imgui.PushItemWidth(200)
+
+	outPortPreview := w.midiOutputPort
+	if outPortPreview == "" {
+		outPortPreview = "None"
+	}
+	if imgui.BeginCombo("##midi_output_port", outPortPreview) {
+		if imgui.SelectableBoolV("None", w.midiOutputPort == "", imgui.SelectableFlagsNone, imgui.Vec2{}) {
+			cmd := component.UpdateCmd{Type: cmdSettingsSetMidiOutputPort, Data: ""}
+			w.Window.SendUpdate(cmd)
+		}
+		for _, portName := range midi.GetMidiManager().ListOutPorts() {
+			isSelected := portName == w.midiOutputPort
+			if imgui.SelectableBoolV(portName, isSelected, imgui.SelectableFlagsNone, imgui.Vec2{}) {
+				cmd := component.UpdateCmd{Type: cmdSettingsSetMidiOutputPort, Data: portName}
+				w.Window.SendUpdate(cmd)
+			}
+			if isSelected {
+				imgui.SetItemDefaultFocus()
+			}
+		}
+		imgui.EndCombo()
+	}
+	imgui.PopItemWidth()
+
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Sequence previews are sent to this port, e.g. a Bitbox connected over USB")
+	}
+
+	// Loop Sync
+	label.NewLabel("Loop Sync").Build()
+	imgui.SameLineV(0, 10)
+	imgui.PushItemWidth(200)
+	if imgui.BeginCombo("##midi_loop_sync", w.midiLoopSync) {
+		for _, mode := range audio.SyncModeNames {
+			isSelected := mode == w.midiLoopSync
+			if imgui.SelectableBoolV(mode, isSelected, imgui.SelectableFlagsNone, imgui.Vec2{}) {
+				cmd := component.UpdateCmd{Type: cmdSettingsSetMidiLoopSync, Data: mode}
+				w.Window.SendUpdate(cmd)
+			}
+			if isSelected {
+				imgui.SetItemDefaultFocus()
+			}
+		}
+		imgui.EndCombo()
+	}
+	imgui.PopItemWidth()
+
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("How loop previews follow the MIDI clock of the input port:\n" +
+			"varispeed resamples them to the clock tempo, which shifts their pitch too,\n" +
+			"retrigger restarts them on the beat without changing their speed")
+	}
+
+	// Send Clock
+	sendClock := w.midiSendClock
+	if imgui.Checkbox("Send Clock", &sendClock) {
+		cmd := component.UpdateCmd{Type: cmdSettingsSetMidiSendClock, Data: sendClock}
+		w.Window.SendUpdate(cmd)
+	}
+
+	if imgui.IsItemHovered() {
+		imgui.SetTooltip("Send MIDI clock at the tempo of the focused preset to the output port")
+	}
+
+	imgui.Spacing()
+	w.midiLearnLayout()
+
 	imgui.EndChild()
 }
+
+// midiLearnLayout draws the learn profile selection and the bindings of the active profile
+func (w *SettingsWindow) midiLearnLayout() {
+	lm := midi.GetLearnManager()
+
+	// Learn Profile
+	label.NewLabel("Learn Profile").Build()
+	imgui.SameLineV(0, 10)
+	imgui.PushItemWidth(200)
+
+	if imgui.BeginCombo("##midi_learn_profile", w.midiLearnProfile) {
+		profiles, err := midi.ListProfiles()
+		if err != nil {
+			log.Warn("Failed to list MIDI learn profiles", zap.Error(err))
+		}
+		if !slices.Contains(profiles, w.midiLearnProfile) {
+			profiles = append([]string{w.midiLearnProfile}, profiles...)
+		}
+
+		for _, name := range profiles {
+			isSelected := name == w.midiLearnProfile
+			if imgui.SelectableBoolV(name, isSelected, imgui.SelectableFlagsNone, imgui.Vec2{}) {
+				cmd := component.UpdateCmd{Type: cmdSettingsSetMidiLearnProfile, Data: name}
+				w.Window.SendUpdate(cmd)
+			}
+			if isSelected {
+				imgui.SetItemDefaultFocus()
+			}
+		}
+		imgui.EndCombo()
+	}
+	imgui.PopItemWidth()
+
+	// New profile
+	imgui.SameLine()
+	imgui.PushItemWidth(140)
+	imgui.InputTextWithHint("##midi_new_profile", "New profile", &w.newProfileName, imgui.InputTextFlagsNone, nil)
+	imgui.PopItemWidth()
+	imgui.SameLine()
+
+	valid := midi.ValidProfileName(w.newProfileName)
+	imgui.BeginDisabledV(!valid)
+	if imgui.Button("Create") {
+		cmd := component.UpdateCmd{Type: cmdSettingsSetMidiLearnProfile, Data: w.newProfileName}
+		w.Window.SendUpdate(cmd)
+		w.newProfileName = ""
+	}
+	imgui.EndDisabled()
+
+	profile := lm.Profile()
+	if len(profile.Bindings) == 0 {
+		imgui.TextDisabled("No bindings. Turn on MIDI Learn in the toolbar, click a control and move a knob.")
+		return
+	}
+
+	flags := imgui.TableFlagsBorders | imgui.TableFlagsRowBg | imgui.TableFlagsSizingStretchProp
+	if !imgui.BeginTableV("##midi_bindings", 6, flags, imgui.Vec2{}, 0) {
+		return
+	}
+
+	imgui.TableSetupColumn("Control")
+	imgui.TableSetupColumn("MIDI")
+	imgui.TableSetupColumn("Encoder")
+	imgui.TableSetupColumn("Range")
+	imgui.TableSetupColumn("Step")
+	imgui.TableSetupColumnV("", imgui.TableColumnFlagsWidthFixed, 24, 0)
+	imgui.TableHeadersRow()
+
+	for i, binding := range profile.Bindings {
+		imgui.PushIDInt(int32(i))
+		changed := false
+
+		imgui.TableNextRow()
+
+		imgui.TableNextColumn()
+		imgui.Text(lm.TargetName(binding.Target))
+
+		imgui.TableNextColumn()
+		imgui.Text(binding.String())
+
+		imgui.TableNextColumn()
+		imgui.PushItemWidth(-1)
+		if binding.Source == midi.SourceCC {
+			if imgui.BeginCombo("##encoder", binding.Encoder.String()) {
+				for _, mode := range midi.EncoderModes {
+					if imgui.SelectableBoolV(mode.String(), mode == binding.Encoder, imgui.SelectableFlagsNone, imgui.Vec2{}) {
+						binding.Encoder = mode
+						changed = true
+					}
+				}
+				imgui.EndCombo()
+			}
+		} else {
+			imgui.TextDisabled("-")
+		}
+		imgui.PopItemWidth()
+
+		imgui.TableNextColumn()
+		imgui.PushItemWidth(-1)
+		lo, hi := float32(binding.Min), float32(binding.Max)
+		if imgui.DragFloatRange2V("##range", &lo, &hi, 0.005, 0, 1, "%.2f", "%.2f", imgui.SliderFlagsAlwaysClamp) {
+			binding.Min, binding.Max = float64(lo), float64(hi)
+			changed = true
+		}
+		imgui.PopItemWidth()
+
+		imgui.TableNextColumn()
+		imgui.PushItemWidth(-1)
+		step := float32(binding.Step)
+		if imgui.SliderFloatV("##step", &step, 0.001, 0.1, "%.3f", imgui.SliderFlagsLogarithmic) {
+			binding.Step = float64(step)
+			changed = true
+		}
+		imgui.PopItemWidth()
+
+		imgui.TableNextColumn()
+		if imgui.SmallButton("x") {
+			cmd := component.UpdateCmd{Type: cmdSettingsRemoveMidiBinding, Data: binding.Target}
+			w.Window.SendUpdate(cmd)
+		}
+		if imgui.IsItemHovered() {
+			imgui.SetTooltip("Remove binding")
+		}
+
+		if changed {
+			cmd := component.UpdateCmd{Type: cmdSettingsUpdateMidiBinding, Data: binding}
+			w.Window.SendUpdate(cmd)
+		}
+
+		imgui.PopID()
+	}
+
+	imgui.EndTable()
+}
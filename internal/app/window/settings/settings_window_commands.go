@@ -8,4 +8,14 @@ const (
 	cmdSettingsSetConsoleMaxLines
 	cmdSettingsSetColormap
 	cmdSettingsSetSpectrumSettings
+	cmdSettingsSetMidiInputPort
+	cmdSettingsSetMidiOutputPort
+	cmdSettingsSetMidiLearnProfile
+	cmdSettingsUpdateMidiBinding
+	cmdSettingsRemoveMidiBinding
+	cmdSettingsSetMidiLoopSync
+	cmdSettingsSetMidiSendClock
+	cmdSettingsSetMidiDriver
+	cmdSettingsToggleMidiRecording
+	cmdSettingsReplayMidiSession
 )
@@ -0,0 +1,344 @@
+package snapshots
+
+/*
+┍━━━━━━━━━━━━━━━━━╳┑
+│ Snapshots Window │
+└──────────────────┘
+*/
+
+import (
+	"bitbox-editor/internal/app/font"
+	"bitbox-editor/internal/app/window"
+	"bitbox-editor/internal/app/window/storage"
+	"bitbox-editor/internal/io/snapshot"
+	"bitbox-editor/internal/logging"
+	"fmt"
+	"path"
+
+	"github.com/AllenDang/cimgui-go/imgui"
+	"go.uber.org/zap"
+)
+
+var log = logging.NewLogger("snapshots")
+
+const restoreCardPopupID = "Restore Card##snapshots_restore_card"
+
+// SnapshotsWindow takes backups of a card and restores presets or the whole card from them
+type SnapshotsWindow struct {
+	*window.Window[*SnapshotsWindow]
+
+	// locations returns the storage locations that can be snapshotted and restored to
+	locations func() []*storage.StorageLocation
+
+	// path is the location snapshots are taken of and restored to
+	path  string
+	label string
+
+	snapshots []*snapshot.Snapshot
+	usage     int64
+	selected  *snapshot.Snapshot
+	loaded    bool
+	busy      bool
+	status    string
+
+	tableFlags imgui.TableFlags
+}
+
+func NewSnapshotsWindow(locations func() []*storage.StorageLocation) *SnapshotsWindow {
+	w := &SnapshotsWindow{
+		locations: locations,
+		tableFlags: imgui.TableFlagsResizable |
+			imgui.TableFlagsRowBg |
+			imgui.TableFlagsScrollY |
+			imgui.TableFlagsSizingFixedFit,
+	}
+
+	w.Window = window.NewWindow[*SnapshotsWindow]("Snapshots", "History", w.handleUpdate)
+	w.Window.SetLayoutBuilder(w)
+
+	// Opened from the View menu when needed
+	w.SetClose()
+
+	return w
+}
+
+// handleUpdate - processes incoming update commands
+func (w *SnapshotsWindow) handleUpdate(cmd UpdateCmd) {
+	switch c := cmd.Type.(type) {
+	case window.GlobalCommand:
+		w.Window.HandleGlobalUpdate(cmd)
+		return
+
+	case localCommand:
+		switch c {
+		case cmdSnapshotsSetList:
+			if payload, ok := cmd.Data.(snapshotListPayload); ok {
+				w.snapshots = payload.Snapshots
+				w.usage = payload.Usage
+
+				// Keep the selection if the snapshot still exists
+				selected := w.selected
+				w.selected = nil
+				for _, snap := range w.snapshots {
+					if selected != nil && snap.ID == selected.ID {
+						w.selected = snap
+					}
+				}
+			}
+
+		case cmdSnapshotsSetStatus:
+			if status, ok := cmd.Data.(string); ok {
+				w.busy = false
+				w.status = status
+				w.refresh()
+			}
+
+		case cmdSnapshotsSetError:
+			if err, ok := cmd.Data.(error); ok {
+				w.busy = false
+				w.status = err.Error()
+				w.refresh()
+			}
+		}
+		return
+
+	default:
+		log.Warn("SnapshotsWindow unhandled update", zap.Any("cmd", cmd))
+	}
+}
+
+// refresh reloads the list of snapshots in the background
+func (w *SnapshotsWindow) refresh() {
+	go func() {
+		snaps, err := snapshot.List()
+		if err != nil {
+			log.Error("Failed to list snapshots", zap.Error(err))
+		}
+		usage, err := snapshot.Usage()
+		if err != nil {
+			log.Error("Failed to read snapshot store usage", zap.Error(err))
+		}
+		w.SendUpdate(UpdateCmd{Type: cmdSnapshotsSetList, Data: snapshotListPayload{Snapshots: snaps, Usage: usage}})
+	}()
+}
+
+// run does a slow operation in the background, reporting its status when done
+func (w *SnapshotsWindow) run(status string, op func() (string, error)) {
+	w.busy = true
+	w.status = status
+
+	go func() {
+		done, err := op()
+		if err != nil {
+			log.Error("Snapshot operation failed", zap.Error(err))
+			w.SendUpdate(UpdateCmd{Type: cmdSnapshotsSetError, Data: err})
+			return
+		}
+		w.SendUpdate(UpdateCmd{Type: cmdSnapshotsSetStatus, Data: done})
+	}()
+}
+
+// takeSnapshot snapshots the chosen location
+func (w *SnapshotsWindow) takeSnapshot() {
+	root, label := w.path, w.label
+	w.label = ""
+
+	w.run("Taking snapshot...", func() (string, error) {
+		snap, err := snapshot.Create(root, label)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Took snapshot of %d files, %d presets changed", len(snap.Files), snap.ChangedPresets), nil
+	})
+}
+
+// restore writes presets of a snapshot back to the chosen location, no presets restores
+// the whole card. The card is snapshotted first so a restore can be undone.
+func (w *SnapshotsWindow) restore(snap *snapshot.Snapshot, presets []string) {
+	root := w.path
+
+	w.run("Restoring...", func() (string, error) {
+		if _, err := snapshot.Create(root, fmt.Sprintf("Before restoring %s", snap.ID)); err != nil {
+			return "", fmt.Errorf("failed to back up the card before restoring: %w", err)
+		}
+
+		n, err := snap.Restore(root, presets)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Restored %d files from %s", n, snap.ID), nil
+	})
+}
+
+// deleteSnapshot removes a snapshot
+func (w *SnapshotsWindow) deleteSnapshot(snap *snapshot.Snapshot) {
+	w.run("Deleting snapshot...", func() (string, error) {
+		if err := snapshot.Delete(snap.ID); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Deleted snapshot %s", snap.ID), nil
+	})
+}
+
+func (w *SnapshotsWindow) Menu() {}
+
+func (w *SnapshotsWindow) Layout() {
+	w.Window.ProcessUpdates()
+
+	if !w.loaded {
+		w.loaded = true
+		w.refresh()
+	}
+
+	w.layoutLocationCombo()
+	imgui.SameLine()
+	imgui.SetNextItemWidth(200)
+	imgui.InputTextWithHint("##snapshot_label", "Label (optional)", &w.label, imgui.InputTextFlagsNone, nil)
+	imgui.SameLine()
+
+	imgui.BeginDisabledV(w.busy || w.path == "")
+	if imgui.Button(font.Icon("Camera") + " Take Snapshot") {
+		w.takeSnapshot()
+	}
+	imgui.EndDisabled()
+
+	imgui.TextDisabled(fmt.Sprintf("%d snapshots, %s stored", len(w.snapshots), formatSize(w.usage)))
+	if w.status != "" {
+		imgui.SameLine()
+		imgui.TextDisabled("- " + w.status)
+	}
+
+	w.layoutSnapshots()
+
+	if w.selected != nil {
+		w.layoutSelected()
+	}
+}
+
+// layoutLocationCombo draws a combo choosing the location to snapshot and restore to
+func (w *SnapshotsWindow) layoutLocationCombo() {
+	preview := w.path
+	if preview == "" {
+		preview = "Choose location"
+	}
+
+	imgui.SetNextItemWidth(260)
+	if imgui.BeginCombo("##snapshot_location", preview) {
+		for _, loc := range w.locations() {
+			label := loc.Path
+			if loc.Name != "" && loc.Name != loc.Path {
+				label = fmt.Sprintf("%s (%s)", loc.Name, loc.Path)
+			}
+			if imgui.SelectableBoolV(label, loc.Path == w.path, imgui.SelectableFlagsNone, imgui.Vec2{}) {
+				w.path = loc.Path
+			}
+		}
+		imgui.EndCombo()
+	}
+}
+
+// layoutSnapshots draws the table of snapshots, newest first
+func (w *SnapshotsWindow) layoutSnapshots() {
+	if !imgui.BeginTableV("snapshot_list", 6, w.tableFlags, imgui.Vec2{Y: 200}, 0) {
+		return
+	}
+	defer imgui.EndTable()
+
+	static := imgui.TableColumnFlagsWidthFixed
+	stretch := imgui.TableColumnFlagsWidthStretch
+	imgui.TableSetupScrollFreeze(0, 1)
+	imgui.TableSetupColumnV("Created", static, 140, 0)
+	imgui.TableSetupColumnV("Label", stretch, 1, 0)
+	imgui.TableSetupColumnV("Location", stretch, 1, 0)
+	imgui.TableSetupColumnV("Presets", static, 60, 0)
+	imgui.TableSetupColumnV("Changed", static, 60, 0)
+	imgui.TableSetupColumnV("Size", static, 80, 0)
+	imgui.TableHeadersRow()
+
+	for _, snap := range w.snapshots {
+		imgui.TableNextRow()
+		imgui.TableNextColumn()
+		if imgui.SelectableBoolV(snap.Created.Format("2006-01-02 15:04:05")+"##"+snap.ID, w.selected == snap,
+			imgui.SelectableFlagsSpanAllColumns, imgui.Vec2{}) {
+			w.selected = snap
+		}
+		imgui.TableNextColumn()
+		imgui.Text(snap.Label)
+		imgui.TableNextColumn()
+		imgui.Text(snap.Root)
+		imgui.TableNextColumn()
+		imgui.Text(fmt.Sprintf("%d", len(snap.Presets())))
+		imgui.TableNextColumn()
+		imgui.Text(fmt.Sprintf("%d", snap.ChangedPresets))
+		imgui.TableNextColumn()
+		imgui.Text(formatSize(snap.Size))
+	}
+}
+
+// layoutSelected draws the presets of the selected snapshot with their restore buttons
+func (w *SnapshotsWindow) layoutSelected() {
+	snap := w.selected
+
+	imgui.Separator()
+	imgui.Text(fmt.Sprintf("Snapshot %s", snap.ID))
+	imgui.SameLine()
+
+	imgui.BeginDisabledV(w.busy || w.path == "")
+	if imgui.Button(font.Icon("ArchiveRestore") + " Restore Card") {
+		imgui.OpenPopupStr(restoreCardPopupID)
+	}
+	imgui.EndDisabled()
+	imgui.SameLine()
+
+	imgui.BeginDisabledV(w.busy)
+	if imgui.Button(font.Icon("Trash2") + " Delete") {
+		w.deleteSnapshot(snap)
+	}
+	imgui.EndDisabled()
+
+	if imgui.BeginPopupModalV(restoreCardPopupID, nil, imgui.WindowFlagsAlwaysAutoResize) {
+		imgui.Text(fmt.Sprintf("Roll %s back to snapshot %s?", w.path, snap.ID))
+		imgui.TextDisabled("Presets added since are removed. The card is snapshotted first.")
+		if imgui.Button("Restore") {
+			w.restore(snap, nil)
+			imgui.CloseCurrentPopup()
+		}
+		imgui.SameLine()
+		if imgui.Button("Cancel") {
+			imgui.CloseCurrentPopup()
+		}
+		imgui.EndPopup()
+	}
+
+	if !imgui.BeginChildStrV("snapshot_presets", imgui.Vec2{}, imgui.ChildFlagsNone, imgui.WindowFlagsNone) {
+		imgui.EndChild()
+		return
+	}
+	defer imgui.EndChild()
+
+	for _, preset := range snap.Presets() {
+		imgui.BeginDisabledV(w.busy || w.path == "")
+		if imgui.SmallButton(font.Icon("RotateCcw") + "##restore_" + preset) {
+			w.restore(snap, []string{preset})
+		}
+		imgui.EndDisabled()
+		if imgui.IsItemHoveredV(imgui.HoveredFlagsAllowWhenDisabled) {
+			imgui.SetTooltip("Restore this preset and its samples")
+		}
+		imgui.SameLine()
+		imgui.Text(path.Base(preset))
+	}
+}
+
+// formatSize returns a byte count in a readable unit
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
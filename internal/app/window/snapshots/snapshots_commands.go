@@ -0,0 +1,23 @@
+package snapshots
+
+import (
+	"bitbox-editor/internal/app/window"
+	"bitbox-editor/internal/io/snapshot"
+)
+
+type UpdateCmd = window.UpdateCmd
+type UpdateCmdType = window.UpdateCmdType
+
+type localCommand int
+
+const (
+	cmdSnapshotsSetList localCommand = iota
+	cmdSnapshotsSetStatus
+	cmdSnapshotsSetError
+)
+
+// snapshotListPayload is the list of snapshots and the space their store takes
+type snapshotListPayload struct {
+	Snapshots []*snapshot.Snapshot
+	Usage     int64
+}
@@ -8,9 +8,10 @@ import (
 	"bitbox-editor/internal/app/events"
 	"bitbox-editor/internal/app/font"
 	"bitbox-editor/internal/app/window"
-	"bitbox-editor/internal/io"
 	"bitbox-editor/internal/io/drive/detect"
+	"bitbox-editor/internal/io/drive/space"
 	"bitbox-editor/internal/logging"
+	"fmt"
 	"sync"
 	"time"
 
@@ -20,6 +21,15 @@ import (
 
 var log = logging.NewLogger("storage")
 
+const (
+	// drivePollInterval is how often drives are scanned when the OS gives no mount notifications
+	drivePollInterval = 5 * time.Second
+	// mountSettleDelay is how long to wait after a mount change before scanning
+	mountSettleDelay = 500 * time.Millisecond
+	// usageRefreshInterval is how often the free space of the locations is measured again
+	usageRefreshInterval = 30 * time.Second
+)
+
 type StorageType int32
 
 const (
@@ -33,11 +43,15 @@ type StorageLocation struct {
 	Path        string
 	Collapsed   bool
 	Stale       bool
+	// Usage is nil until the location has been measured
+	Usage *LocationUsage
 }
 
 // StorageLocationsPayload is the message from the monitor
 type StorageLocationsPayload struct {
 	Drives []*StorageLocation
+	// Mounted are the drives that appeared since the last scan
+	Mounted []*StorageLocation
 }
 
 // StorageWindow is a window that displays available drives/storage.
@@ -52,7 +66,10 @@ type StorageWindow struct {
 	selectedLocation *StorageLocation
 	driveLocations   []*StorageLocation
 	customLocations  []*StorageLocation
+	customForm       customLocationForm
 	needsRebuild     bool
+	measuring        bool
+	lastMeasured     time.Time
 
 	// Background task control
 	stopMonitor chan struct{}
@@ -81,10 +98,13 @@ func NewStorageWindow() *StorageWindow {
 		SetColumns(
 			table.NewTableColumn("##icon").SetFlags(imgui.TableColumnFlagsWidthFixed).SetInnerWidthOrWeight(25),
 			table.NewTableColumn("Path").SetFlags(imgui.TableColumnFlagsWidthStretch),
+			table.NewTableColumn("Free").SetFlags(imgui.TableColumnFlagsWidthFixed).SetInnerWidthOrWeight(150),
 		)
 
 	w.Window.SetLayoutBuilder(w)
 
+	w.loadCustomLocations()
+
 	eventbus.Bus.Subscribe(events.ComponentClickEventKey, w.UUID(), w.eventSub)
 
 	if w.driveMonitor {
@@ -107,6 +127,7 @@ func (w *StorageWindow) handleUpdate(cmd component.UpdateCmd) {
 		case cmdStorageSetLocations:
 			if payload, ok := cmd.Data.(StorageLocationsPayload); ok {
 				w.driveLocations = payload.Drives
+				w.validateCustomLocations()
 				foundSelected := false
 				currentSelection := w.selectedLocation
 				if currentSelection != nil {
@@ -118,7 +139,7 @@ func (w *StorageWindow) handleUpdate(cmd component.UpdateCmd) {
 					}
 					if !foundSelected {
 						for _, loc := range w.customLocations {
-							if loc.Path == currentSelection.Path {
+							if loc.Path == currentSelection.Path && !loc.Stale {
 								foundSelected = true
 								break
 							}
@@ -133,7 +154,29 @@ func (w *StorageWindow) handleUpdate(cmd component.UpdateCmd) {
 					})
 				}
 				w.needsRebuild = true
+
+				// Open a card as soon as it is inserted when nothing else is open
+				if w.selectedLocation == nil && len(payload.Mounted) > 0 {
+					w.SendUpdate(component.UpdateCmd{Type: cmdStorageSetSelected, Data: payload.Mounted[0]})
+				}
+
+				w.measureLocations()
+			}
+
+		case cmdStorageSetUsage:
+			payload, ok := cmd.Data.(locationUsagePayload)
+			if !ok {
+				// Every location has been measured
+				w.measuring = false
+				return
+			}
+			usage := payload.Usage
+			for _, loc := range w.Locations() {
+				if loc.Path == payload.Path {
+					loc.Usage = &usage
+				}
 			}
+			w.needsRebuild = true
 
 		case cmdStorageHandleClick:
 			if event, ok := cmd.Data.(events.MouseEventRecord); ok {
@@ -148,8 +191,12 @@ func (w *StorageWindow) handleUpdate(cmd component.UpdateCmd) {
 			if cmd.Data == nil {
 				isValid = true
 			} else if loc, ok := cmd.Data.(*StorageLocation); ok {
-				newSelection = loc
-				isValid = true
+				if loc.Stale {
+					log.Warn("Storage location is missing", zap.String("path", loc.Path))
+				} else {
+					newSelection = loc
+					isValid = true
+				}
 			} else {
 				log.Warn("Invalid data type for CmdStorageSetSelected", zap.Any("data", cmd.Data))
 			}
@@ -168,6 +215,30 @@ func (w *StorageWindow) handleUpdate(cmd component.UpdateCmd) {
 				})
 			}
 
+		case cmdStorageAddCustom:
+			if payload, ok := cmd.Data.(customLocationPayload); ok {
+				if err := w.addCustomLocation(payload.Name, payload.Path); err != nil {
+					w.customForm.status = err.Error()
+					return
+				}
+				w.customForm = customLocationForm{done: true}
+				w.measureLocations()
+			}
+
+		case cmdStorageRemoveCustom:
+			if payload, ok := cmd.Data.(customLocationPayload); ok && payload.Location != nil {
+				w.removeCustomLocation(payload.Location)
+			}
+
+		case cmdStorageRenameCustom:
+			if payload, ok := cmd.Data.(customLocationPayload); ok && payload.Location != nil {
+				if err := w.renameCustomLocation(payload.Location, payload.Name); err != nil {
+					w.customForm.status = err.Error()
+					return
+				}
+				w.customForm = customLocationForm{done: true}
+			}
+
 		case cmdStorageSetMonitor:
 			if monitor, ok := cmd.Data.(bool); ok {
 				if w.driveMonitor != monitor {
@@ -196,7 +267,9 @@ func (w *StorageWindow) handleUpdate(cmd component.UpdateCmd) {
 	}
 }
 
-// startDriveMonitor is a background task to detect drives
+// startDriveMonitor is a background task that rescans drives whenever the OS reports a
+// mount change. Cards that appear or disappear are published as mounted and unmounted
+// storage events.
 func (w *StorageWindow) startDriveMonitor() {
 	log.Debug("Starting drive detection ...")
 	w.monitorWG.Add(1)
@@ -204,56 +277,107 @@ func (w *StorageWindow) startDriveMonitor() {
 
 	go func() {
 		defer w.monitorWG.Done()
-		ticker := time.NewTicker(5 * time.Second)
-		defer ticker.Stop()
 
-		forceCheck := true
+		changes, err := detect.Watch(currentStopChan)
+		if err != nil {
+			log.Warn("Mount notifications unavailable, polling for drives", zap.Error(err))
+			changes = detect.Poll(currentStopChan, drivePollInterval)
+		}
+
+		known := make(map[string]*StorageLocation)
+		initial := true
 
 		for {
 			select {
-			case <-ticker.C:
-				forceCheck = true
+			case _, ok := <-changes:
+				if !ok {
+					log.Debug("Stopping drive detection goroutine")
+					return
+				}
 			case <-currentStopChan:
 				log.Debug("Stopping drive detection goroutine")
 				return
-			default:
-				time.Sleep(100 * time.Millisecond)
 			}
 
-			if !forceCheck {
-				continue
+			// Automounters create folders and mount in several steps, wait for them to settle
+			select {
+			case <-time.After(mountSettleDelay):
+			case <-currentStopChan:
+				log.Debug("Stopping drive detection goroutine")
+				return
 			}
-			forceCheck = false
 
-			detectedDrives, err := detect.Detect()
-			if err != nil {
-				log.Error("Drive detection failed", zap.Error(err))
-				continue
-			}
+			w.scanDrives(known, initial)
+			initial = false
+		}
+	}()
+}
 
-			newDriveLocations := make([]*StorageLocation, 0)
-			for _, d := range detectedDrives {
-				presetsExist, _ := io.Exists(d + "/Presets")
-				if !presetsExist {
-					continue
-				}
-				sl := &StorageLocation{
-					StorageType: RemovableStorage,
-					Name:        d,
-					Path:        d,
-					Stale:       false,
-				}
-				newDriveLocations = append(newDriveLocations, sl)
-			}
+// scanDrives detects the Bitbox cards currently mounted and compares them with the known
+// cards. Changes are published to the event bus, except on the initial scan where every
+// card is simply listed.
+func (w *StorageWindow) scanDrives(known map[string]*StorageLocation, initial bool) {
+	detectedDrives, err := detect.Detect()
+	if err != nil {
+		log.Error("Drive detection failed", zap.Error(err))
+		return
+	}
 
-			// Send Update Command (Drives Only)
-			payload := StorageLocationsPayload{
-				Drives: newDriveLocations,
+	newDriveLocations := make([]*StorageLocation, 0)
+	mounted := make([]*StorageLocation, 0)
+	current := make(map[string]bool)
+	for _, d := range detectedDrives {
+		if !detect.IsBitboxCard(d) {
+			continue
+		}
+		current[d] = true
+
+		sl, ok := known[d]
+		if !ok {
+			sl = &StorageLocation{
+				StorageType: RemovableStorage,
+				Name:        d,
+				Path:        d,
+				Stale:       false,
 			}
-			cmd := component.UpdateCmd{Type: cmdStorageSetLocations, Data: payload}
-			w.SendUpdate(cmd)
+			known[d] = sl
+			mounted = append(mounted, sl)
 		}
-	}()
+		newDriveLocations = append(newDriveLocations, sl)
+	}
+
+	for path, sl := range known {
+		if current[path] {
+			continue
+		}
+		delete(known, path)
+
+		log.Info("Storage unmounted", zap.String("path", path))
+		eventbus.Bus.Publish(events.StorageEventRecord{
+			EventType: events.StorageUnmountedEvent,
+			Data:      sl,
+		})
+	}
+
+	if !initial {
+		for _, sl := range mounted {
+			log.Info("Storage mounted", zap.String("path", sl.Path))
+			eventbus.Bus.Publish(events.StorageEventRecord{
+				EventType: events.StorageMountedEvent,
+				Data:      sl,
+			})
+		}
+	} else {
+		mounted = nil
+	}
+
+	// Send Update Command (Drives Only)
+	payload := StorageLocationsPayload{
+		Drives:  newDriveLocations,
+		Mounted: mounted,
+	}
+	cmd := component.UpdateCmd{Type: cmdStorageSetLocations, Data: payload}
+	w.SendUpdate(cmd)
 }
 
 // rebuildTableRows creates row components
@@ -269,35 +393,59 @@ func (w *StorageWindow) rebuildTableRows() {
 	totalRows := len(drives) + len(customs)
 	rows := make([]*table.TableRowComponent, 0, totalRows)
 
-	createRow := func(loc *StorageLocation, iconKey string) *table.TableRowComponent {
+	createRow := func(loc *StorageLocation, iconKey, label string) *table.TableRowComponent {
 		location := loc
 		isSelected := selected != nil && selected.Path == location.Path
 
-		selectableText := text.NewText(location.Path).
+		selectableText := text.NewText(label).
 			SetSelectable(true)
 
 		selectableText.SetDragDropData("", location)
 		selectableText.SetSelected(isSelected)
 
+		free := ""
+		if location.Usage != nil {
+			free = fmt.Sprintf("%s free of %s",
+				space.FormatBytes(location.Usage.Free), space.FormatBytes(location.Usage.Total))
+		}
+
 		tr := table.NewTableRow(
 			imgui.IDStr(location.Path),
 			text.NewText(font.Icon(iconKey)),
 			selectableText,
+			text.NewText(free),
 		)
 		return tr
 	}
 
 	for _, loc := range drives {
-		rows = append(rows, createRow(loc, "HardDrive"))
+		rows = append(rows, createRow(loc, "HardDrive", loc.Path))
 	}
 
 	for _, loc := range customs {
-		rows = append(rows, createRow(loc, "Folder"))
+		label := fmt.Sprintf("%s (%s)", loc.Name, loc.Path)
+		if loc.Stale {
+			rows = append(rows, createRow(loc, "FolderX", label+" - missing"))
+			continue
+		}
+		rows = append(rows, createRow(loc, "Folder", label))
 	}
 
 	w.driveTable.SetRows(rows...)
 }
 
+// Locations returns the drives and custom locations that are available
+func (w *StorageWindow) Locations() []*StorageLocation {
+	locations := make([]*StorageLocation, 0, len(w.driveLocations)+len(w.customLocations))
+	locations = append(locations, w.driveLocations...)
+	for _, loc := range w.customLocations {
+		if !loc.Stale {
+			locations = append(locations, loc)
+		}
+	}
+	return locations
+}
+
 func (w *StorageWindow) Menu() {
 	monitor := w.driveMonitor
 
@@ -308,9 +456,26 @@ func (w *StorageWindow) Menu() {
 
 	if imgui.BeginMenuBar() {
 		if imgui.Button(font.Icon("FolderPlus")) {
-			// TODO: Open dialog to select folder, then send CmdStorageAddCustom
+			w.customForm = customLocationForm{}
+			imgui.OpenPopupStr(addCustomPopupID)
+		}
+		if imgui.IsItemHovered() {
+			imgui.SetTooltip("Add a folder as a storage location")
 		}
 		imgui.SameLine()
+
+		custom := w.selectedCustomLocation()
+		imgui.BeginDisabledV(custom == nil)
+		if imgui.Button(font.Icon("PenLine")) {
+			w.customForm = customLocationForm{name: custom.Name}
+			imgui.OpenPopupStr(renameCustomPopupID)
+		}
+		imgui.SameLine()
+		if imgui.Button(font.Icon("FolderMinus")) {
+			w.SendUpdate(component.UpdateCmd{Type: cmdStorageRemoveCustom, Data: customLocationPayload{Location: custom}})
+		}
+		imgui.EndDisabled()
+		imgui.SameLine()
 		if imgui.Button(font.Icon("FolderOpen")) {
 			// TODO: Open selected location in OS file explorer?
 		}
@@ -321,6 +486,7 @@ func (w *StorageWindow) Menu() {
 			cmd := component.UpdateCmd{Type: cmdStorageSetMonitor, Data: !monitor}
 			w.SendUpdate(cmd)
 		}
+		w.layoutCustomLocationPopups()
 		imgui.EndMenuBar()
 	}
 }
@@ -364,6 +530,14 @@ func (w *StorageWindow) Layout() {
 		return
 	}
 
+	if !w.measuring && time.Since(w.lastMeasured) > usageRefreshInterval {
+		w.measureLocations()
+	}
+
+	if w.selectedLocation != nil && w.selectedLocation.Usage != nil {
+		w.layoutUsage(w.selectedLocation.Usage)
+	}
+
 	if w.driveTable != nil {
 		w.driveTable.Build()
 	} else {
@@ -7,4 +7,21 @@ const (
 	cmdStorageSetSelected
 	cmdStorageSetMonitor
 	cmdStorageHandleClick
+	cmdStorageAddCustom
+	cmdStorageRemoveCustom
+	cmdStorageRenameCustom
+	cmdStorageSetUsage
 )
+
+// customLocationPayload describes a custom location to add, remove or rename
+type customLocationPayload struct {
+	Location *StorageLocation
+	Name     string
+	Path     string
+}
+
+// locationUsagePayload is the measured capacity and contents of a location
+type locationUsagePayload struct {
+	Path  string
+	Usage LocationUsage
+}
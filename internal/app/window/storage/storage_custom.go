@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"bitbox-editor/internal/app/component"
+	"bitbox-editor/internal/config"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/AllenDang/cimgui-go/imgui"
+	"go.uber.org/zap"
+)
+
+const (
+	addCustomPopupID    = "Add Location##storage_add_custom"
+	renameCustomPopupID = "Rename Location##storage_rename_custom"
+)
+
+// customLocationForm holds the inputs of the add and rename popups
+type customLocationForm struct {
+	name   string
+	path   string
+	status string
+	// done closes the popup after the change was applied
+	done bool
+}
+
+// loadCustomLocations reads the custom locations saved in config, flagging the ones
+// whose folder is missing as stale
+func (w *StorageWindow) loadCustomLocations() {
+	for _, saved := range config.GetStorageLocations() {
+		w.customLocations = append(w.customLocations, &StorageLocation{
+			StorageType: FixedStorage,
+			Name:        saved.Name,
+			Path:        saved.Path,
+		})
+	}
+	w.validateCustomLocations()
+}
+
+// validateCustomLocations updates the stale flag of the custom locations, folders on a
+// drive that was unmounted come back when it is mounted again
+func (w *StorageWindow) validateCustomLocations() {
+	for _, loc := range w.customLocations {
+		stale := !isDir(loc.Path)
+		if stale != loc.Stale {
+			if stale {
+				log.Warn("Custom storage location is missing", zap.String("name", loc.Name), zap.String("path", loc.Path))
+			}
+			loc.Stale = stale
+			w.needsRebuild = true
+		}
+	}
+}
+
+// saveCustomLocations writes the custom locations to config
+func (w *StorageWindow) saveCustomLocations() {
+	locations := make([]config.StorageLocation, 0, len(w.customLocations))
+	for _, loc := range w.customLocations {
+		locations = append(locations, config.StorageLocation{Name: loc.Name, Path: loc.Path})
+	}
+
+	if err := config.SetStorageLocations(locations); err != nil {
+		log.Error("Failed to save storage locations to config", zap.Error(err))
+	}
+}
+
+// addCustomLocation adds a folder as a custom location
+func (w *StorageWindow) addCustomLocation(name, path string) error {
+	path, err := normalizeLocationPath(path)
+	if err != nil {
+		return err
+	}
+	if !isDir(path) {
+		return fmt.Errorf("'%s' is not a folder", path)
+	}
+
+	for _, loc := range slices.Concat(w.driveLocations, w.customLocations) {
+		if loc.Path == path {
+			return fmt.Errorf("'%s' is already a storage location", path)
+		}
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = filepath.Base(path)
+	}
+
+	w.customLocations = append(w.customLocations, &StorageLocation{
+		StorageType: FixedStorage,
+		Name:        name,
+		Path:        path,
+	})
+	w.saveCustomLocations()
+	w.needsRebuild = true
+
+	log.Info("Added storage location", zap.String("name", name), zap.String("path", path))
+	return nil
+}
+
+// removeCustomLocation removes a custom location, deselecting it first
+func (w *StorageWindow) removeCustomLocation(loc *StorageLocation) {
+	index := slices.Index(w.customLocations, loc)
+	if index < 0 {
+		return
+	}
+
+	if w.selectedLocation == loc {
+		w.SendUpdate(component.UpdateCmd{Type: cmdStorageSetSelected, Data: nil})
+	}
+
+	w.customLocations = slices.Delete(w.customLocations, index, index+1)
+	w.saveCustomLocations()
+	w.needsRebuild = true
+
+	log.Info("Removed storage location", zap.String("name", loc.Name), zap.String("path", loc.Path))
+}
+
+// renameCustomLocation changes the display name of a custom location
+func (w *StorageWindow) renameCustomLocation(loc *StorageLocation, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("name can't be empty")
+	}
+	if !slices.Contains(w.customLocations, loc) {
+		return fmt.Errorf("'%s' is not a custom location", loc.Path)
+	}
+
+	loc.Name = name
+	w.saveCustomLocations()
+	w.needsRebuild = true
+	return nil
+}
+
+// selectedCustomLocation returns the selected location if it is a custom location
+func (w *StorageWindow) selectedCustomLocation() *StorageLocation {
+	if w.selectedLocation != nil && slices.Contains(w.customLocations, w.selectedLocation) {
+		return w.selectedLocation
+	}
+	return nil
+}
+
+// layoutCustomLocationPopups draws the add and rename popups opened from the menu
+func (w *StorageWindow) layoutCustomLocationPopups() {
+	if imgui.BeginPopup(addCustomPopupID) {
+		if w.customForm.done {
+			w.customForm.done = false
+			imgui.CloseCurrentPopup()
+		}
+
+		imgui.SetNextItemWidth(320)
+		imgui.InputTextWithHint("##custom_path", "Folder, e.g. ~/bitbox-mirror", &w.customForm.path, imgui.InputTextFlagsNone, nil)
+		imgui.SetNextItemWidth(320)
+		imgui.InputTextWithHint("##custom_name", "Name (optional)", &w.customForm.name, imgui.InputTextFlagsNone, nil)
+
+		imgui.BeginDisabledV(strings.TrimSpace(w.customForm.path) == "")
+		if imgui.Button("Add") {
+			w.SendUpdate(component.UpdateCmd{
+				Type: cmdStorageAddCustom,
+				Data: customLocationPayload{Name: w.customForm.name, Path: w.customForm.path},
+			})
+		}
+		imgui.EndDisabled()
+		imgui.SameLine()
+		if imgui.Button("Cancel") {
+			imgui.CloseCurrentPopup()
+		}
+
+		if w.customForm.status != "" {
+			imgui.TextDisabled(w.customForm.status)
+		}
+		imgui.EndPopup()
+	}
+
+	if imgui.BeginPopup(renameCustomPopupID) {
+		loc := w.selectedCustomLocation()
+		if loc == nil || w.customForm.done {
+			w.customForm.done = false
+			imgui.CloseCurrentPopup()
+		} else {
+			imgui.TextDisabled(loc.Path)
+			imgui.SetNextItemWidth(320)
+			imgui.InputTextWithHint("##custom_rename", "Name", &w.customForm.name, imgui.InputTextFlagsNone, nil)
+
+			if imgui.Button("Rename") {
+				w.SendUpdate(component.UpdateCmd{
+					Type: cmdStorageRenameCustom,
+					Data: customLocationPayload{Location: loc, Name: w.customForm.name},
+				})
+			}
+			imgui.SameLine()
+			if imgui.Button("Cancel") {
+				imgui.CloseCurrentPopup()
+			}
+
+			if w.customForm.status != "" {
+				imgui.TextDisabled(w.customForm.status)
+			}
+		}
+		imgui.EndPopup()
+	}
+}
+
+// normalizeLocationPath expands a leading ~ and makes a location path absolute
+func normalizeLocationPath(path string) (string, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return "", errors.New("path can't be empty")
+	}
+
+	if path == "~" || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to expand '%s': %w", path, err)
+		}
+		path = filepath.Join(home, path[1:])
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path '%s': %w", path, err)
+	}
+	return abs, nil
+}
+
+// isDir returns true if path is an existing folder
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
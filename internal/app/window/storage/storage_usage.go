@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"bitbox-editor/internal/app/component"
+	"bitbox-editor/internal/io"
+	"bitbox-editor/internal/io/drive/detect"
+	"bitbox-editor/internal/io/drive/space"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AllenDang/cimgui-go/imgui"
+	"go.uber.org/zap"
+)
+
+// LocationUsage is the capacity of the drive holding a location and how much of it the
+// location's presets and samples take
+type LocationUsage struct {
+	space.Usage
+	// Presets is the size of everything in the presets folder
+	Presets int64
+	// Samples is the size of the WAV files outside the presets folder
+	Samples int64
+}
+
+// measureLocations measures every location in the background, sending an update per
+// location as it is done
+func (w *StorageWindow) measureLocations() {
+	if w.measuring {
+		return
+	}
+
+	locations := w.Locations()
+	if len(locations) == 0 {
+		return
+	}
+
+	paths := make([]string, 0, len(locations))
+	for _, loc := range locations {
+		paths = append(paths, loc.Path)
+	}
+
+	w.measuring = true
+	w.lastMeasured = time.Now()
+
+	go func() {
+		for _, path := range paths {
+			usage, err := measureLocation(path)
+			if err != nil {
+				log.Warn("Failed to measure storage location", zap.String("path", path), zap.Error(err))
+				continue
+			}
+			w.SendUpdate(component.UpdateCmd{Type: cmdStorageSetUsage, Data: locationUsagePayload{Path: path, Usage: usage}})
+		}
+		w.SendUpdate(component.UpdateCmd{Type: cmdStorageSetUsage, Data: nil})
+	}()
+}
+
+// measureLocation reads the capacity of a location's drive and adds up its presets and
+// samples
+func measureLocation(path string) (LocationUsage, error) {
+	var usage LocationUsage
+
+	var err error
+	if usage.Usage, err = space.Get(path); err != nil {
+		return usage, err
+	}
+
+	presetsDir := filepath.Join(path, detect.BitboxPresetsDir)
+	if info, err := os.Stat(presetsDir); err == nil && info.IsDir() {
+		presets := io.NewFSTree(presetsDir)
+		if err := presets.ScanDirectory(presetsDir, "*"); err != nil {
+			return usage, fmt.Errorf("failed to scan presets: %w", err)
+		}
+		usage.Presets = presets.GetTotalSize()
+	}
+
+	samples := io.NewFSTree(path)
+	if err := samples.ScanDirectory(path, ".wav"); err != nil {
+		return usage, fmt.Errorf("failed to scan samples: %w", err)
+	}
+	usage.Samples = samples.GetTotalSize()
+
+	// Samples inside preset folders are already counted with the presets
+	if entry, ok := samples.FindEntry(presetsDir); ok {
+		for _, file := range samples.GetAllFiles() {
+			if strings.HasPrefix(file.Path, entry.Path+string(filepath.Separator)) {
+				usage.Samples -= file.Size
+			}
+		}
+	}
+
+	return usage, nil
+}
+
+// layoutUsage draws how full the drive of the selected location is
+func (w *StorageWindow) layoutUsage(usage *LocationUsage) {
+	fraction := float32(0)
+	if usage.Total > 0 {
+		fraction = float32(usage.Used()) / float32(usage.Total)
+	}
+
+	overlay := fmt.Sprintf("%s used of %s", space.FormatBytes(usage.Used()), space.FormatBytes(usage.Total))
+	imgui.ProgressBarV(fraction, imgui.Vec2{X: -1}, overlay)
+
+	imgui.TextDisabled(fmt.Sprintf("Presets %s, Samples %s",
+		space.FormatBytes(uint64(usage.Presets)), space.FormatBytes(uint64(usage.Samples))))
+}
@@ -0,0 +1,210 @@
+package audio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// MaxRating is the highest star rating of a file
+const MaxRating = 5
+
+// Annotation is what the user attached to a library file
+type Annotation struct {
+	Tags     []string `json:"tags,omitempty"`
+	Rating   int      `json:"rating,omitempty"`
+	Favorite bool     `json:"favorite,omitempty"`
+}
+
+// Empty returns true if nothing is attached
+func (a Annotation) Empty() bool {
+	return len(a.Tags) == 0 && a.Rating == 0 && !a.Favorite
+}
+
+// HasTag returns true if the file has a tag, ignoring case
+func (a Annotation) HasTag(tag string) bool {
+	return slices.ContainsFunc(a.Tags, func(t string) bool {
+		return strings.EqualFold(t, tag)
+	})
+}
+
+// Annotations holds the tags, ratings and favorites of a library folder. They are kept
+// in the config folder rather than on the card.
+type Annotations struct {
+	Root string
+
+	mu    sync.RWMutex
+	files map[string]Annotation
+	path  string
+}
+
+// annotations holds the open annotations by root
+var annotations sync.Map
+
+// annotationsPath returns the file holding the annotations of a library root
+func annotationsPath(root string) string {
+	return strings.TrimSuffix(indexPath(root), ".gob") + ".annotations.json"
+}
+
+// OpenAnnotations returns the annotations of a library folder, loading them from disk
+// the first time
+func OpenAnnotations(root string) *Annotations {
+	root = filepath.Clean(root)
+	if existing, ok := annotations.Load(root); ok {
+		return existing.(*Annotations)
+	}
+
+	a := &Annotations{
+		Root:  root,
+		files: make(map[string]Annotation),
+		path:  annotationsPath(root),
+	}
+
+	data, err := os.ReadFile(a.path)
+	if err == nil {
+		if err := json.Unmarshal(data, &a.files); err != nil {
+			log.Error("Failed to parse library annotations", zap.String("path", a.path), zap.Error(err))
+			a.files = make(map[string]Annotation)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		log.Error("Failed to read library annotations", zap.String("path", a.path), zap.Error(err))
+	}
+
+	actual, _ := annotations.LoadOrStore(root, a)
+	return actual.(*Annotations)
+}
+
+// rel returns the key of a path
+func (a *Annotations) rel(path string) string {
+	rel, err := filepath.Rel(a.Root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Get returns the annotation of a file
+func (a *Annotations) Get(path string) Annotation {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	ann := a.files[a.rel(path)]
+	ann.Tags = slices.Clone(ann.Tags)
+	return ann
+}
+
+// Set replaces the annotation of a file and saves
+func (a *Annotations) Set(path string, ann Annotation) error {
+	ann.Rating = max(0, min(MaxRating, ann.Rating))
+
+	var tags []string
+	for _, tag := range ann.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.ContainsFunc(tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			tags = append(tags, tag)
+		}
+	}
+	slices.SortFunc(tags, func(x, y string) int {
+		return strings.Compare(strings.ToLower(x), strings.ToLower(y))
+	})
+	ann.Tags = tags
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if ann.Empty() {
+		delete(a.files, a.rel(path))
+	} else {
+		a.files[a.rel(path)] = ann
+	}
+	return a.save()
+}
+
+// Update changes the annotation of a file and saves
+func (a *Annotations) Update(path string, fn func(ann *Annotation)) error {
+	ann := a.Get(path)
+	fn(&ann)
+	return a.Set(path, ann)
+}
+
+// Move carries annotations over to where files were moved or renamed to
+func (a *Annotations) Move(moves map[string]string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	moved := false
+	for from, to := range moves {
+		if ann, ok := a.files[a.rel(from)]; ok {
+			delete(a.files, a.rel(from))
+			a.files[a.rel(to)] = ann
+			moved = true
+		}
+	}
+	if !moved {
+		return nil
+	}
+	return a.save()
+}
+
+// All returns every annotation by full path
+func (a *Annotations) All() map[string]Annotation {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	all := make(map[string]Annotation, len(a.files))
+	for rel, ann := range a.files {
+		all[filepath.Join(a.Root, filepath.FromSlash(rel))] = ann
+	}
+	return all
+}
+
+// Tags returns every tag in use, sorted
+func (a *Annotations) Tags() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var tags []string
+	for _, ann := range a.files {
+		for _, tag := range ann.Tags {
+			if key := strings.ToLower(tag); !seen[key] {
+				seen[key] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	slices.SortFunc(tags, func(x, y string) int {
+		return strings.Compare(strings.ToLower(x), strings.ToLower(y))
+	})
+	return tags
+}
+
+// save writes the annotations, the caller holds the lock
+func (a *Annotations) save() error {
+	if err := os.MkdirAll(filepath.Dir(a.path), 0750); err != nil {
+		return fmt.Errorf("failed to create library folder: %w", err)
+	}
+
+	data, err := json.MarshalIndent(a.files, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode library annotations: %w", err)
+	}
+
+	tmp := a.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write library annotations: %w", err)
+	}
+	if err := os.Rename(tmp, a.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write library annotations: %w", err)
+	}
+	return nil
+}
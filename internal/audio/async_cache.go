@@ -3,6 +3,7 @@ package audio
 import (
 	"bitbox-editor/internal/app/eventbus"
 	"bitbox-editor/internal/app/events"
+	"bitbox-editor/internal/audio/features"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -18,9 +19,10 @@ const asyncCacheWorkers = 4
 
 // AsyncWaveCache cache for audio file data. Uses worker pool to limit concurrent file I/O.
 type AsyncWaveCache struct {
-	entries    sync.Map
-	loadQueue  chan loadRequest
-	inProgress sync.Map
+	entries      sync.Map
+	loadQueue    chan loadRequest
+	inProgress   sync.Map
+	spectrograms sync.Map
 }
 
 type loadRequest struct {
@@ -75,6 +77,13 @@ func (c *AsyncWaveCache) UpdateSnapshot(path string, snapshot *WaveFileSnapshot)
 	ptr.Store(snapshot)
 }
 
+// Invalidate drops everything cached for a path, so it is read again the next time it
+// is requested
+func (c *AsyncWaveCache) Invalidate(path string) {
+	c.entries.Delete(path)
+	c.spectrograms.Delete(path)
+}
+
 // RequestLoad queues a file for loading if not already loaded/loading
 func (c *AsyncWaveCache) RequestLoad(path string, loadType LoadType) {
 	// Check if already loaded
@@ -86,7 +95,7 @@ func (c *AsyncWaveCache) RequestLoad(path string, loadType LoadType) {
 				return
 			}
 		case LoadMiniDownsamples:
-			if len(snapshot.MiniDownsamples) > 0 {
+			if len(snapshot.MiniDownsamples) > 0 && hasFeatures(path) {
 				return
 			}
 		case LoadFullSamples:
@@ -133,9 +142,26 @@ func (c *AsyncWaveCache) processLoad(path string, loadType LoadType) {
 		}
 	}
 
+	// Take what the library index already knows so unchanged files aren't read again
+	if indexed := applyIndex(snapshot); indexed != nil {
+		metadataFromIndex := !snapshot.MetadataLoaded
+		snapshot = indexed
+		c.UpdateSnapshot(path, snapshot)
+
+		if metadataFromIndex {
+			eventbus.Bus.Publish(events.AudioLoadEventRecord{
+				EventType:      events.AudioMetadataLoadedEvent,
+				Path:           path,
+				MetadataLoaded: true,
+			})
+		}
+	}
+
 	switch loadType {
 	case LoadMetadataOnly:
-		c.loadMetadataSync(path, snapshot)
+		if !snapshot.MetadataLoaded {
+			c.loadMetadataSync(path, snapshot)
+		}
 	case LoadMiniDownsamples:
 		// Load metadata first if needed
 		if !snapshot.MetadataLoaded {
@@ -144,7 +170,9 @@ func (c *AsyncWaveCache) processLoad(path string, loadType LoadType) {
 				return
 			}
 		}
-		c.loadMiniDownsamplesSync(path, snapshot)
+		if len(snapshot.MiniDownsamples) == 0 || !hasFeatures(path) {
+			c.loadMiniDownsamplesSync(path, snapshot)
+		}
 	case LoadFullSamples:
 		// Load metadata first if needed
 		if !snapshot.MetadataLoaded {
@@ -200,11 +228,13 @@ func (c *AsyncWaveCache) loadMetadataSync(path string, baseSnapshot *WaveFileSna
 	newSnapshot.SampleRate = int(format.SampleRate)
 	newSnapshot.BitDepth = int(format.Precision)
 	newSnapshot.NumSamples = streamer.Len()
+	newSnapshot.NumChannels = format.NumChannels
 	newSnapshot.MetadataLoaded = true
 	newSnapshot.LoadErr = nil
 
 	// Update cache atomically
 	c.UpdateSnapshot(path, &newSnapshot)
+	indexMetadata(&newSnapshot)
 
 	// Publish metadata loaded event
 	eventbus.Bus.Publish(events.AudioLoadEventRecord{
@@ -252,6 +282,12 @@ func (c *AsyncWaveCache) loadMiniDownsamplesSync(path string, baseSnapshot *Wave
 	buf := make([][2]float64, skipInterval)
 	position := 0
 
+	// Every sample passes through here anyway, so the loudness and the features used to
+	// find similar samples are measured along the way
+	var sumSquares float64
+	var count int
+	extractor := features.NewExtractor(baseSnapshot.SampleRate, baseSnapshot.NumSamples)
+
 	for position < baseSnapshot.NumSamples {
 		n, ok := streamer.Stream(buf)
 		if !ok {
@@ -261,7 +297,12 @@ func (c *AsyncWaveCache) loadMiniDownsamplesSync(path string, baseSnapshot *Wave
 		var chunkMin, chunkMax float32 = 1.0, -1.0
 		for i := 0; i < n; i++ {
 			sample := float32(buf[i][0])
+			sumSquares += buf[i][0] * buf[i][0]
+			count++
 			if numChannels > 1 {
+				extractor.Add((buf[i][0] + buf[i][1]) / 2)
+				sumSquares += buf[i][1] * buf[i][1]
+				count++
 				sample2 := float32(buf[i][1])
 				if sample2 < chunkMin {
 					chunkMin = sample2
@@ -269,6 +310,8 @@ func (c *AsyncWaveCache) loadMiniDownsamplesSync(path string, baseSnapshot *Wave
 				if sample2 > chunkMax {
 					chunkMax = sample2
 				}
+			} else {
+				extractor.Add(buf[i][0])
 			}
 			if sample < chunkMin {
 				chunkMin = sample
@@ -289,6 +332,8 @@ func (c *AsyncWaveCache) loadMiniDownsamplesSync(path string, baseSnapshot *Wave
 
 	// Update cache atomically
 	c.UpdateSnapshot(path, &newSnapshot)
+	indexMiniDownsample(path, miniMins, miniMaxs, rms(sumSquares, count))
+	indexFeatures(path, extractor.Features())
 }
 
 func (c *AsyncWaveCache) loadFullSamplesSync(path string, baseSnapshot *WaveFileSnapshot) {
@@ -330,13 +375,18 @@ func (c *AsyncWaveCache) loadFullSamplesSync(path string, baseSnapshot *WaveFile
 	}
 	defer streamer.Close()
 
-	// Load all samples into memory as mono
+	// Load all samples into memory as mono, keeping the separate channels for stereo files
 	numSamples := baseSnapshot.NumSamples
 	samples := make([]float32, numSamples)
 	buf := make([][2]float64, 512)
 	position := 0
 	numChannels := format.NumChannels
 
+	var channels [][]float32
+	if numChannels > 1 {
+		channels = [][]float32{make([]float32, numSamples), make([]float32, numSamples)}
+	}
+
 	for position < numSamples {
 		n, ok := streamer.Stream(buf)
 		if !ok {
@@ -348,15 +398,34 @@ func (c *AsyncWaveCache) loadFullSamplesSync(path string, baseSnapshot *WaveFile
 			sample := float32(buf[i][0])
 			if numChannels > 1 {
 				sample = (sample + float32(buf[i][1])) / 2.0
+				channels[0][position] = float32(buf[i][0])
+				channels[1][position] = float32(buf[i][1])
 			}
 			samples[position] = sample
 			position++
 		}
 	}
 
-	// Downsample
+	// Downsample. Level 0 is the overview, later levels get progressively finer for zooming
 	targetBins := 10000
-	mins, maxs := DownsampleMinMax(samples, targetBins)
+	downsamples := DownsampleLevels(samples, targetBins)
+
+	// Per channel and side (L-R) downsamples for the split and mid/side views.
+	// The mono mix above doubles as the mid channel.
+	var channelDownsamples [][]Downsample
+	var sideDownsamples []Downsample
+	if channels != nil {
+		channelDownsamples = make([][]Downsample, len(channels))
+		for c, ch := range channels {
+			channelDownsamples[c] = DownsampleLevels(ch, targetBins)
+		}
+
+		side := make([]float32, numSamples)
+		for i := range side {
+			side[i] = (channels[0][i] - channels[1][i]) / 2.0
+		}
+		sideDownsamples = DownsampleLevels(side, targetBins)
+	}
 
 	// Calculate min/max Y for display
 	var minY, maxY float32 = 1.0, -1.0
@@ -371,7 +440,11 @@ func (c *AsyncWaveCache) loadFullSamplesSync(path string, baseSnapshot *WaveFile
 
 	// Create updated snapshot
 	newSnapshot := *baseSnapshot
-	newSnapshot.Downsamples = []Downsample{{Mins: mins, Maxs: maxs}}
+	newSnapshot.Downsamples = downsamples
+	newSnapshot.Samples = samples
+	newSnapshot.Channels = channels
+	newSnapshot.ChannelDownsamples = channelDownsamples
+	newSnapshot.SideDownsamples = sideDownsamples
 	newSnapshot.MinY = minY
 	newSnapshot.MaxY = maxY
 	newSnapshot.SamplesLoaded = true
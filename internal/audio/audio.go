@@ -33,6 +33,7 @@ func init() {
 	globalAudioManager = &AudioManager{
 		AnalyzerData:   make(chan []float64, 1),
 		analyzerBuffer: NewAudioBuffer(DefaultChunkSize),
+		channelMeter:   NewChannelMeter(),
 		stopChan:       make(chan struct{}),
 		waveCache:      sync.Map{},
 		volume:         0.8,
@@ -0,0 +1,77 @@
+package audio
+
+import (
+	"math"
+	"sync"
+)
+
+// correlationSmoothing is how much of the previous correlation is kept on each update
+const correlationSmoothing = 0.8
+
+// ChannelLevels holds the most recent per-channel peak levels and the stereo correlation.
+// Correlation ranges from -1 (out of phase) through 0 (unrelated) to +1 (mono).
+type ChannelLevels struct {
+	PeakL       float64
+	PeakR       float64
+	Correlation float64
+}
+
+// ChannelMeter tracks per-channel levels of the audio passing through the monitor
+type ChannelMeter struct {
+	mu     sync.Mutex
+	levels ChannelLevels
+}
+
+func NewChannelMeter() *ChannelMeter {
+	return &ChannelMeter{levels: ChannelLevels{Correlation: 1}}
+}
+
+// Update measures a block of stereo samples
+func (cm *ChannelMeter) Update(samples [][2]float64) {
+	if len(samples) == 0 {
+		return
+	}
+
+	var peakL, peakR, sumLR, sumLL, sumRR float64
+	for _, s := range samples {
+		l, r := s[0], s[1]
+		if a := math.Abs(l); a > peakL {
+			peakL = a
+		}
+		if a := math.Abs(r); a > peakR {
+			peakR = a
+		}
+		sumLR += l * r
+		sumLL += l * l
+		sumRR += r * r
+	}
+
+	// Silence says nothing about phase, so leave the correlation where it was
+	correlation := math.NaN()
+	if sumLL > 1e-9 && sumRR > 1e-9 {
+		correlation = sumLR / math.Sqrt(sumLL*sumRR)
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cm.levels.PeakL = peakL
+	cm.levels.PeakR = peakR
+	if !math.IsNaN(correlation) {
+		cm.levels.Correlation = cm.levels.Correlation*correlationSmoothing + correlation*(1-correlationSmoothing)
+	}
+}
+
+// Levels returns the latest measured levels
+func (cm *ChannelMeter) Levels() ChannelLevels {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.levels
+}
+
+// Reset clears the peak levels
+func (cm *ChannelMeter) Reset() {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.levels = ChannelLevels{Correlation: 1}
+}
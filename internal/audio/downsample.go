@@ -4,6 +4,9 @@ import "math"
 
 type SampleGetter func(i int) float64
 
+// downsampleLevelFactor is the resolution step between downsample levels
+const downsampleLevelFactor = 4
+
 type Downsample struct {
 	Mins, Maxs []float32
 }
@@ -48,6 +51,18 @@ func downsampleMinMaxCore(lenY, bins int, get SampleGetter) (mins, maxs []float6
 	return
 }
 
+// DownsampleLevels builds min/max downsamples at increasing resolutions, starting at baseBins.
+// Levels stop once a bin would cover fewer than two samples.
+func DownsampleLevels(y []float32, baseBins int) []Downsample {
+	mins, maxs := DownsampleMinMax(y, baseBins)
+	levels := []Downsample{{Mins: mins, Maxs: maxs}}
+	for bins := baseBins * downsampleLevelFactor; bins < len(y)/2; bins *= downsampleLevelFactor {
+		levelMins, levelMaxs := DownsampleMinMax(y, bins)
+		levels = append(levels, Downsample{Mins: levelMins, Maxs: levelMaxs})
+	}
+	return levels
+}
+
 // DownsampleMinMax downsamples float32 samples into min/max bins
 func DownsampleMinMax(y []float32, bins int) (mins, maxs []float32) {
 	fmins, fmaxs := downsampleMinMaxCore(len(y), bins, func(i int) float64 {
@@ -0,0 +1,367 @@
+// Package features describes what a sound is like with a handful of numbers, so samples
+// can be compared by how they sound rather than by name.
+//
+// A sound is measured in short frames: the spectral centroid tells how bright it is, a
+// summary of mel cepstral coefficients (MFCC) describes its timbre, and the loudness of
+// each frame gives the shape of its envelope. Along with the duration these are
+// reduced to a few short vectors that are cheap to store and compare.
+package features
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"os"
+	"sync"
+
+	"github.com/gopxl/beep/v2/wav"
+	"github.com/mjibson/go-dsp/fft"
+	"github.com/mjibson/go-dsp/window"
+)
+
+const (
+	// frameSize is the number of samples measured at once
+	frameSize = 1024
+	// maxSpectralFrames is how many frames of a long sound get a spectrum, the rest are
+	// only measured for loudness
+	maxSpectralFrames = 1500
+	// melBands is the number of mel filters the spectrum is reduced to
+	melBands = 26
+	// NumMFCC is the number of cepstral coefficients kept. The first one, the overall
+	// loudness, is left out so sounds compare the same at any gain.
+	NumMFCC = 12
+	// EnvelopeBins is how many parts the envelope of a sound is split into
+	EnvelopeBins = 16
+	// silenceLevel is the frame loudness below which a frame is left out of the
+	// spectral measurements, about -60 dBFS
+	silenceLevel = 0.001
+)
+
+// Names the features are stored under in the library index
+const (
+	DurationKey = "duration"
+	CentroidKey = "centroid"
+	MFCCKey     = "mfcc"
+	EnvelopeKey = "envelope"
+)
+
+// Features describes a sound
+type Features struct {
+	// Duration is the length in seconds
+	Duration float64
+	// Centroid is the average spectral centroid in Hz, 0 for silence
+	Centroid float32
+	// MFCC is the average of each cepstral coefficient over the sound
+	MFCC []float32
+	// Envelope is the loudness of each part of the sound, the loudest part being 1
+	Envelope []float32
+}
+
+// Extractor measures a sound one sample at a time, e.g. while it is read for something
+// else
+type Extractor struct {
+	sampleRate int
+	// stride is how many frames pass between frames that get a spectrum
+	stride int
+
+	frame   []float64
+	frames  int
+	levels  []float32
+	samples int
+
+	centroidSum float64
+	mfccSum     []float64
+	spectral    int
+}
+
+// NewExtractor prepares to measure a sound of numSamples samples at sampleRate
+func NewExtractor(sampleRate, numSamples int) *Extractor {
+	totalFrames := numSamples/frameSize + 1
+	return &Extractor{
+		sampleRate: sampleRate,
+		stride:     max(1, (totalFrames+maxSpectralFrames-1)/maxSpectralFrames),
+		frame:      make([]float64, 0, frameSize),
+		mfccSum:    make([]float64, NumMFCC),
+	}
+}
+
+// Add measures the next sample, mixed to mono
+func (e *Extractor) Add(sample float64) {
+	e.samples++
+	e.frame = append(e.frame, sample)
+	if len(e.frame) == frameSize {
+		e.measureFrame()
+	}
+}
+
+// measureFrame measures the samples collected and starts a new frame
+func (e *Extractor) measureFrame() {
+	var sumSquares float64
+	for _, v := range e.frame {
+		sumSquares += v * v
+	}
+	level := math.Sqrt(sumSquares / float64(len(e.frame)))
+	e.levels = append(e.levels, float32(level))
+
+	if e.frames%e.stride == 0 && level >= silenceLevel && e.sampleRate > 0 {
+		e.measureSpectrum()
+	}
+	e.frames++
+	e.frame = e.frame[:0]
+}
+
+// measureSpectrum adds the centroid and cepstrum of the current frame
+func (e *Extractor) measureSpectrum() {
+	samples := make([]float64, frameSize)
+	copy(samples, e.frame)
+	window.Apply(samples, window.Hann)
+
+	spectrum := fft.FFTReal(samples)
+	bins := frameSize/2 + 1
+	magnitudes := make([]float64, bins)
+	binHz := float64(e.sampleRate) / frameSize
+
+	var weighted, total float64
+	for i := range bins {
+		magnitudes[i] = cmplx.Abs(spectrum[i])
+		weighted += float64(i) * binHz * magnitudes[i]
+		total += magnitudes[i]
+	}
+	if total > 0 {
+		e.centroidSum += weighted / total
+	}
+
+	filters := melFilters(e.sampleRate)
+	energies := make([]float64, melBands)
+	for band, filter := range filters {
+		var energy float64
+		for i, weight := range filter.weights {
+			m := magnitudes[filter.start+i]
+			energy += weight * m * m
+		}
+		energies[band] = math.Log(energy + 1e-10)
+	}
+
+	// DCT-II of the log energies, skipping the first coefficient
+	scale := math.Sqrt(2.0 / melBands)
+	for k := 1; k <= NumMFCC; k++ {
+		var sum float64
+		for n, energy := range energies {
+			sum += energy * math.Cos(math.Pi*float64(k)*(float64(n)+0.5)/melBands)
+		}
+		e.mfccSum[k-1] += sum * scale
+	}
+
+	e.spectral++
+}
+
+// Features returns what was measured
+func (e *Extractor) Features() *Features {
+	if len(e.frame) > 0 {
+		// Pad the last frame with silence so it is measured too
+		for len(e.frame) < frameSize {
+			e.frame = append(e.frame, 0)
+		}
+		e.measureFrame()
+	}
+
+	f := &Features{
+		MFCC:     make([]float32, NumMFCC),
+		Envelope: make([]float32, EnvelopeBins),
+	}
+	if e.sampleRate > 0 {
+		f.Duration = float64(e.samples) / float64(e.sampleRate)
+	}
+
+	if e.spectral > 0 {
+		f.Centroid = float32(e.centroidSum / float64(e.spectral))
+		for i, sum := range e.mfccSum {
+			f.MFCC[i] = float32(sum / float64(e.spectral))
+		}
+	}
+
+	if len(e.levels) > 0 {
+		var loudest float32
+		for bin := range EnvelopeBins {
+			from := bin * len(e.levels) / EnvelopeBins
+			to := max(from+1, (bin+1)*len(e.levels)/EnvelopeBins)
+			var sum float32
+			for _, level := range e.levels[from:min(to, len(e.levels))] {
+				sum += level
+			}
+			f.Envelope[bin] = sum / float32(min(to, len(e.levels))-from)
+			loudest = max(loudest, f.Envelope[bin])
+		}
+		if loudest > 0 {
+			for bin := range f.Envelope {
+				f.Envelope[bin] /= loudest
+			}
+		}
+	}
+
+	return f
+}
+
+// Analyze reads a WAV file and measures it
+func Analyze(path string) (*Features, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open '%s': %w", path, err)
+	}
+	defer file.Close()
+
+	streamer, format, err := wav.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode '%s': %w", path, err)
+	}
+	defer streamer.Close()
+
+	e := NewExtractor(int(format.SampleRate), streamer.Len())
+	buf := make([][2]float64, 4096)
+	for {
+		n, ok := streamer.Stream(buf)
+		for i := range n {
+			if format.NumChannels > 1 {
+				e.Add((buf[i][0] + buf[i][1]) / 2)
+			} else {
+				e.Add(buf[i][0])
+			}
+		}
+		if !ok {
+			break
+		}
+	}
+	if err := streamer.Err(); err != nil {
+		return nil, fmt.Errorf("failed to decode '%s': %w", path, err)
+	}
+
+	return e.Features(), nil
+}
+
+// Values returns the features by name, the way the library index stores them
+func (f *Features) Values() map[string][]float32 {
+	return map[string][]float32{
+		DurationKey: {float32(f.Duration)},
+		CentroidKey: {f.Centroid},
+		MFCCKey:     f.MFCC,
+		EnvelopeKey: f.Envelope,
+	}
+}
+
+// FromValues restores features stored by Values, false if any are missing
+func FromValues(values map[string][]float32) (*Features, bool) {
+	duration, centroid := values[DurationKey], values[CentroidKey]
+	mfcc, envelope := values[MFCCKey], values[EnvelopeKey]
+	if len(duration) != 1 || len(centroid) != 1 || len(mfcc) != NumMFCC || len(envelope) != EnvelopeBins {
+		return nil, false
+	}
+	return &Features{
+		Duration: float64(duration[0]),
+		Centroid: centroid[0],
+		MFCC:     mfcc,
+		Envelope: envelope,
+	}, true
+}
+
+const (
+	// Weights of each feature in the distance between two sounds, timbre counts most
+	mfccWeight     = 1.0
+	centroidWeight = 0.5
+	envelopeWeight = 0.5
+	durationWeight = 0.25
+	// mfccScale brings the cepstral distance to about 1 for clearly different timbres
+	mfccScale = 8.0
+)
+
+// Distance returns how different two sounds are, 0 for sounds that measure the same
+func (f *Features) Distance(other *Features) float64 {
+	var mfcc float64
+	for i := range f.MFCC {
+		d := float64(f.MFCC[i] - other.MFCC[i])
+		mfcc += d * d
+	}
+	mfcc = math.Sqrt(mfcc) / mfccScale
+
+	// Brightness and length compare by ratio, in octaves
+	var centroid float64
+	if f.Centroid > 0 && other.Centroid > 0 {
+		centroid = math.Abs(math.Log2(float64(f.Centroid) / float64(other.Centroid)))
+	} else if f.Centroid != other.Centroid {
+		centroid = 1
+	}
+
+	var envelope float64
+	for i := range f.Envelope {
+		envelope += math.Abs(float64(f.Envelope[i] - other.Envelope[i]))
+	}
+	envelope /= EnvelopeBins
+
+	var duration float64
+	if f.Duration > 0 && other.Duration > 0 {
+		duration = math.Abs(math.Log2(f.Duration / other.Duration))
+	}
+
+	return mfccWeight*mfcc + centroidWeight*centroid + envelopeWeight*envelope + durationWeight*duration
+}
+
+// Similarity returns how alike two sounds are, from 0 to 1
+func (f *Features) Similarity(other *Features) float64 {
+	return 1 / (1 + f.Distance(other))
+}
+
+// melFilter is a triangular filter over a range of spectrum bins
+type melFilter struct {
+	start   int
+	weights []float64
+}
+
+// melFilterBanks holds the filters by sample rate
+var melFilterBanks sync.Map
+
+// melFilters returns the mel filter bank for a sample rate
+func melFilters(sampleRate int) []melFilter {
+	if filters, ok := melFilterBanks.Load(sampleRate); ok {
+		return filters.([]melFilter)
+	}
+
+	toMel := func(hz float64) float64 { return 2595 * math.Log10(1+hz/700) }
+	toHz := func(mel float64) float64 { return 700 * (math.Pow(10, mel/2595) - 1) }
+
+	bins := frameSize/2 + 1
+	binHz := float64(sampleRate) / frameSize
+	lo, hi := toMel(20), toMel(float64(sampleRate)/2)
+
+	// Band edges in bins, each filter rises from one edge to the next and falls to the
+	// one after
+	edges := make([]float64, melBands+2)
+	for i := range edges {
+		edges[i] = toHz(lo+(hi-lo)*float64(i)/float64(melBands+1)) / binHz
+	}
+
+	filters := make([]melFilter, melBands)
+	for band := range melBands {
+		left, center, right := edges[band], edges[band+1], edges[band+2]
+		start := int(math.Ceil(left))
+		end := min(bins-1, int(math.Floor(right)))
+
+		filter := melFilter{start: start}
+		for i := start; i <= end; i++ {
+			var weight float64
+			switch {
+			case float64(i) <= center && center > left:
+				weight = (float64(i) - left) / (center - left)
+			case float64(i) > center && right > center:
+				weight = (right - float64(i)) / (right - center)
+			}
+			filter.weights = append(filter.weights, max(0, weight))
+		}
+		// Low bands can be narrower than a bin, they take the bin they fall in
+		if len(filter.weights) == 0 {
+			filter = melFilter{start: min(bins-1, int(math.Round(center))), weights: []float64{1}}
+		}
+		filters[band] = filter
+	}
+
+	actual, _ := melFilterBanks.LoadOrStore(sampleRate, filters)
+	return actual.([]melFilter)
+}
@@ -0,0 +1,536 @@
+package audio
+
+import (
+	"bitbox-editor/internal/audio/features"
+	"bitbox-editor/internal/config"
+	"bitbox-editor/internal/io"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// indexVersion is the version of the library index format, older indexes are rebuilt
+	indexVersion = 2
+
+	// indexSaveDelay is how long changes to an index are collected before it is written
+	indexSaveDelay = 5 * time.Second
+)
+
+// IndexEntry is what the library index knows about a file. It is only valid while the
+// file keeps the size and mtime it had when it was indexed.
+type IndexEntry struct {
+	Size    int64
+	ModTime int64
+
+	MetadataLoaded bool
+	SampleRate     int
+	BitDepth       int
+	NumSamples     int
+	NumChannels    int
+
+	// MiniMins and MiniMaxs are the mini downsample, quantized to 8 bits to keep the
+	// index small
+	MiniMins []int8
+	MiniMaxs []int8
+
+	// LevelsMeasured is set once Peak and RMS are known
+	LevelsMeasured bool
+	// Peak is the largest absolute amplitude seen in the mini downsample
+	Peak float32
+	// RMS is the root mean square amplitude over all samples and channels
+	RMS float32
+
+	// Features holds analysis results by name
+	Features map[string][]float32
+}
+
+// Duration returns the length of the file in seconds, 0 if unknown
+func (e *IndexEntry) Duration() float64 {
+	if !e.MetadataLoaded || e.SampleRate == 0 {
+		return 0
+	}
+	return float64(e.NumSamples) / float64(e.SampleRate)
+}
+
+// indexFile is the on-disk form of an index
+type indexFile struct {
+	Version int
+	Root    string
+	// Entries maps paths relative to the root, using forward slashes, to their entry
+	Entries map[string]*IndexEntry
+}
+
+// LibraryIndex persists the audio files of a library folder along with their metadata,
+// mini downsamples and analysis results, so a library opens without reading every file
+// again. Files are matched by path, size and mtime.
+type LibraryIndex struct {
+	Root string
+
+	mu        sync.RWMutex
+	entries   map[string]*IndexEntry
+	dirty     bool
+	saveTimer *time.Timer
+	path      string
+}
+
+// indexes holds the open indexes by root, the cache looks files up in them
+var indexes sync.Map
+
+// indexPath returns the file holding the index of a library root
+func indexPath(root string) string {
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(config.Dir(), "library", hex.EncodeToString(sum[:8])+".gob")
+}
+
+// OpenLibraryIndex returns the index of a library folder, loading it from disk the first
+// time. A missing or outdated index starts empty.
+func OpenLibraryIndex(root string) *LibraryIndex {
+	root = filepath.Clean(root)
+	if existing, ok := indexes.Load(root); ok {
+		return existing.(*LibraryIndex)
+	}
+
+	x := &LibraryIndex{
+		Root:    root,
+		entries: make(map[string]*IndexEntry),
+		path:    indexPath(root),
+	}
+
+	if f, err := os.Open(x.path); err == nil {
+		var saved indexFile
+		if err := gob.NewDecoder(f).Decode(&saved); err != nil || saved.Version != indexVersion {
+			log.Warn("Rebuilding library index", zap.String("root", root), zap.Error(err))
+		} else if saved.Entries != nil {
+			x.entries = saved.Entries
+		}
+		f.Close()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		log.Warn("Failed to read library index", zap.String("path", x.path), zap.Error(err))
+	}
+
+	actual, _ := indexes.LoadOrStore(root, x)
+	return actual.(*LibraryIndex)
+}
+
+// Len returns the number of files in the index
+func (x *LibraryIndex) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.entries)
+}
+
+// Tree builds a file tree from the index without touching the disk
+func (x *LibraryIndex) Tree() *io.FSTree {
+	tree := io.NewFSTree(x.Root)
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	for rel, entry := range x.entries {
+		tree.AddEntry(filepath.Join(x.Root, filepath.FromSlash(rel)), false, entry.Size)
+	}
+	return tree
+}
+
+// Rescan walks the library folder and brings the index up to date. Files that are new or
+// whose size or mtime changed lose what was indexed about them, removed files are dropped.
+// Returns the paths of all files added, changed or removed.
+func (x *LibraryIndex) Rescan() (*io.FSTree, []string, error) {
+	tree := io.NewFSTree(x.Root)
+	if err := tree.ScanDirectory(x.Root, ".wav"); err != nil {
+		return nil, nil, err
+	}
+
+	var changed []string
+	seen := make(map[string]bool)
+
+	x.mu.Lock()
+	for _, file := range tree.GetAllFiles() {
+		info, err := os.Stat(file.Path)
+		if err != nil {
+			continue
+		}
+
+		rel := x.rel(file.Path)
+		seen[rel] = true
+
+		entry, ok := x.entries[rel]
+		if ok && entry.Size == info.Size() && entry.ModTime == info.ModTime().UnixNano() {
+			continue
+		}
+
+		x.entries[rel] = &IndexEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+		x.dirty = true
+		changed = append(changed, file.Path)
+	}
+	for rel := range x.entries {
+		if !seen[rel] {
+			delete(x.entries, rel)
+			x.dirty = true
+			changed = append(changed, filepath.Join(x.Root, filepath.FromSlash(rel)))
+		}
+	}
+	x.mu.Unlock()
+
+	x.scheduleSave()
+
+	return tree, changed, nil
+}
+
+// Refresh updates the index for paths reported changed, without rescanning the rest of
+// the library. A folder path covers everything below it. Returns the paths of the files
+// added, changed or removed.
+func (x *LibraryIndex) Refresh(paths []string) []string {
+	var changed []string
+
+	x.mu.Lock()
+	for _, path := range paths {
+		rel := x.rel(path)
+		if rel == "." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+
+		// Take out whatever was indexed under the path, then put back what is still there
+		previous := make(map[string]*IndexEntry)
+		for key, entry := range x.entries {
+			if key == rel || strings.HasPrefix(key, rel+"/") {
+				previous[key] = entry
+				delete(x.entries, key)
+			}
+		}
+
+		var files []string
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			sub := io.NewFSTree(path)
+			if err := sub.ScanDirectory(path, ".wav"); err != nil {
+				log.Warn("Failed to scan changed folder", zap.String("path", path), zap.Error(err))
+			}
+			for _, file := range sub.GetAllFiles() {
+				files = append(files, file.Path)
+			}
+		} else if err == nil && IsAudioFile(path) && !strings.HasPrefix(filepath.Base(path), ".") {
+			files = append(files, path)
+		}
+
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if err != nil {
+				continue
+			}
+
+			key := x.rel(file)
+			entry, ok := previous[key]
+			delete(previous, key)
+			if ok && entry.Size == info.Size() && entry.ModTime == info.ModTime().UnixNano() {
+				x.entries[key] = entry
+				continue
+			}
+
+			x.entries[key] = &IndexEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+			x.dirty = true
+			changed = append(changed, file)
+		}
+
+		for key := range previous {
+			x.dirty = true
+			changed = append(changed, filepath.Join(x.Root, filepath.FromSlash(key)))
+		}
+	}
+	x.mu.Unlock()
+
+	x.scheduleSave()
+
+	return changed
+}
+
+// rel returns the index key of a path
+func (x *LibraryIndex) rel(path string) string {
+	rel, err := filepath.Rel(x.Root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Lookup returns a copy of the entry of a file if it is indexed and unchanged on disk
+func (x *LibraryIndex) Lookup(path string) (IndexEntry, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return IndexEntry{}, false
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	entry, ok := x.entries[x.rel(path)]
+	if !ok || entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		return IndexEntry{}, false
+	}
+	return *entry, true
+}
+
+// update changes the entry of a file, creating it for the file as it is on disk now
+func (x *LibraryIndex) update(path string, fn func(entry *IndexEntry)) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	x.mu.Lock()
+	rel := x.rel(path)
+	entry, ok := x.entries[rel]
+	if !ok || entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		entry = &IndexEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+		x.entries[rel] = entry
+	}
+	fn(entry)
+	x.dirty = true
+	x.mu.Unlock()
+
+	x.scheduleSave()
+}
+
+// Entries returns a copy of every entry by full path. Unlike Lookup the files aren't
+// checked on disk, the rescan and file watching keep the index current.
+func (x *LibraryIndex) Entries() map[string]IndexEntry {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	entries := make(map[string]IndexEntry, len(x.entries))
+	for rel, entry := range x.entries {
+		entries[filepath.Join(x.Root, filepath.FromSlash(rel))] = *entry
+	}
+	return entries
+}
+
+// SetFeatures stores an analysis result for a file
+func (x *LibraryIndex) SetFeatures(path, name string, values []float32) {
+	x.update(path, func(entry *IndexEntry) {
+		if entry.Features == nil {
+			entry.Features = make(map[string][]float32)
+		}
+		entry.Features[name] = values
+	})
+}
+
+// scheduleSave writes the index once changes stop coming in
+func (x *LibraryIndex) scheduleSave() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if !x.dirty {
+		return
+	}
+	if x.saveTimer != nil {
+		x.saveTimer.Stop()
+	}
+	x.saveTimer = time.AfterFunc(indexSaveDelay, func() {
+		if err := x.Save(); err != nil {
+			log.Error("Failed to save library index", zap.String("root", x.Root), zap.Error(err))
+		}
+	})
+}
+
+// Save writes the index to the config folder if it changed
+func (x *LibraryIndex) Save() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if !x.dirty {
+		return nil
+	}
+	if x.saveTimer != nil {
+		x.saveTimer.Stop()
+		x.saveTimer = nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(x.path), 0750); err != nil {
+		return fmt.Errorf("failed to create library index folder: %w", err)
+	}
+
+	tmp := x.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to write library index: %w", err)
+	}
+	err = gob.NewEncoder(f).Encode(indexFile{Version: indexVersion, Root: x.Root, Entries: x.entries})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write library index: %w", err)
+	}
+	if err := os.Rename(tmp, x.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to replace library index: %w", err)
+	}
+
+	x.dirty = false
+	log.Debug("Saved library index", zap.String("root", x.Root), zap.Int("files", len(x.entries)))
+	return nil
+}
+
+// SaveLibraryIndexes writes every open index that has unsaved changes
+func SaveLibraryIndexes() {
+	indexes.Range(func(_, value any) bool {
+		x := value.(*LibraryIndex)
+		if err := x.Save(); err != nil {
+			log.Error("Failed to save library index", zap.String("root", x.Root), zap.Error(err))
+		}
+		return true
+	})
+}
+
+// LookupIndex returns the open index holding a file, if any
+func LookupIndex(path string) *LibraryIndex {
+	var found *LibraryIndex
+	indexes.Range(func(key, value any) bool {
+		root := key.(string)
+		if strings.HasPrefix(path, root+string(filepath.Separator)) {
+			found = value.(*LibraryIndex)
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// indexMetadata records the metadata of a loaded file in its index
+func indexMetadata(snapshot *WaveFileSnapshot) {
+	x := LookupIndex(snapshot.Path)
+	if x == nil {
+		return
+	}
+	x.update(snapshot.Path, func(entry *IndexEntry) {
+		entry.MetadataLoaded = true
+		entry.SampleRate = snapshot.SampleRate
+		entry.BitDepth = snapshot.BitDepth
+		entry.NumSamples = snapshot.NumSamples
+		entry.NumChannels = snapshot.NumChannels
+	})
+}
+
+// indexMiniDownsample records the mini downsample and levels of a loaded file in its index
+func indexMiniDownsample(path string, mins, maxs []float32, rms float32) {
+	x := LookupIndex(path)
+	if x == nil {
+		return
+	}
+	x.update(path, func(entry *IndexEntry) {
+		entry.MiniMins = quantize(mins)
+		entry.MiniMaxs = quantize(maxs)
+
+		var peak float32
+		for i := range mins {
+			peak = max(peak, float32(math.Abs(float64(mins[i]))), float32(math.Abs(float64(maxs[i]))))
+		}
+		entry.Peak = peak
+		entry.RMS = rms
+		entry.LevelsMeasured = true
+	})
+}
+
+// indexFeatures records the features of a loaded file in its index
+func indexFeatures(path string, f *features.Features) {
+	x := LookupIndex(path)
+	if x == nil {
+		return
+	}
+	x.update(path, func(entry *IndexEntry) {
+		if entry.Features == nil {
+			entry.Features = make(map[string][]float32)
+		}
+		maps.Copy(entry.Features, f.Values())
+	})
+}
+
+// hasFeatures returns true if the index of a file has its features, or if the file
+// isn't in a library and there is nowhere to keep them. The file isn't checked on disk
+// so this is cheap enough to call while drawing.
+func hasFeatures(path string) bool {
+	x := LookupIndex(path)
+	if x == nil {
+		return true
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	entry, ok := x.entries[x.rel(path)]
+	if !ok {
+		return false
+	}
+	_, ok = features.FromValues(entry.Features)
+	return ok
+}
+
+// applyIndex fills in what the index knows about a file that the snapshot is missing,
+// returns nil if the index has nothing to add
+func applyIndex(snapshot *WaveFileSnapshot) *WaveFileSnapshot {
+	x := LookupIndex(snapshot.Path)
+	if x == nil {
+		return nil
+	}
+	entry, ok := x.Lookup(snapshot.Path)
+	if !ok {
+		return nil
+	}
+
+	updated := *snapshot
+	changed := false
+	if !updated.MetadataLoaded && entry.MetadataLoaded {
+		updated.SampleRate = entry.SampleRate
+		updated.BitDepth = entry.BitDepth
+		updated.NumSamples = entry.NumSamples
+		updated.NumChannels = entry.NumChannels
+		updated.MetadataLoaded = true
+		changed = true
+	}
+	if len(updated.MiniDownsamples) == 0 && len(entry.MiniMins) > 0 && updated.MetadataLoaded {
+		updated.MiniDownsamples = []Downsample{{Mins: dequantize(entry.MiniMins), Maxs: dequantize(entry.MiniMaxs)}}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return &updated
+}
+
+// rms returns the root mean square of samples from their sum of squares
+func rms(sumSquares float64, count int) float32 {
+	if count == 0 {
+		return 0
+	}
+	return float32(math.Sqrt(sumSquares / float64(count)))
+}
+
+// quantize stores amplitudes in [-1, 1] as 8 bit values
+func quantize(values []float32) []int8 {
+	out := make([]int8, len(values))
+	for i, v := range values {
+		out[i] = int8(math.Round(float64(max(-1, min(1, v))) * 127))
+	}
+	return out
+}
+
+// dequantize restores amplitudes stored by quantize
+func dequantize(values []int8) []float32 {
+	out := make([]float32, len(values))
+	for i, v := range values {
+		out[i] = float32(v) / 127
+	}
+	return out
+}
@@ -0,0 +1,197 @@
+package audio
+
+import (
+	"sync/atomic"
+)
+
+// Loop modes, matching the loopmode attribute of sample cells
+const (
+	LoopModeOff = iota
+	LoopModeForward
+	LoopModeBidirectional
+)
+
+// LoopFadeMax is the largest LoopFadeAmt value. The fade amount is stored in thousandths
+// of the loop length.
+const LoopFadeMax = 1000
+
+// LoopSettings describes a sustain loop within a wave, in samples
+type LoopSettings struct {
+	Start   int
+	End     int
+	Mode    int
+	FadeAmt int
+}
+
+// Valid returns true if the loop covers at least one sample and looping is enabled
+func (l LoopSettings) Valid() bool {
+	return l.Mode != LoopModeOff && l.End > l.Start && l.Start >= 0
+}
+
+// FadeSamples returns the crossfade length in samples. The fade is taken from the audio
+// before the loop start, so it is limited by both the loop length and the loop start.
+func (l LoopSettings) FadeSamples() int {
+	if l.Mode != LoopModeForward || l.FadeAmt <= 0 {
+		return 0
+	}
+
+	fadeAmt := l.FadeAmt
+	if fadeAmt > LoopFadeMax {
+		fadeAmt = LoopFadeMax
+	}
+
+	fade := (l.End - l.Start) * fadeAmt / LoopFadeMax
+	if fade > l.Start {
+		fade = l.Start
+	}
+
+	return fade
+}
+
+// LoopStreamer plays in-memory samples from a start position into a sustain loop.
+// Forward loops crossfade the end of the loop into the audio leading up to the loop start
+// so the jump back is seamless. Bidirectional loops play back and forth between the points.
+// Without a valid loop the samples play once up to the end position.
+type LoopStreamer struct {
+	channels [][]float32
+	loop     LoopSettings
+	fade     int
+	length   int
+	end      int
+
+	position atomic.Int64
+	reverse  bool
+	// retrigger restarts playback from the loop start on the next Stream call
+	retrigger atomic.Bool
+}
+
+// NewLoopStreamer creates a loop streamer over mono (one channel) or stereo (two channels) samples
+func NewLoopStreamer(channels [][]float32, startSample int, loop LoopSettings) *LoopStreamer {
+	return NewSampleStreamer(channels, startSample, 0, loop)
+}
+
+// NewSampleStreamer creates a streamer that plays from startSample to endSample, entering
+// the loop if it is valid. An endSample of 0 plays to the end of the samples.
+func NewSampleStreamer(channels [][]float32, startSample, endSample int, loop LoopSettings) *LoopStreamer {
+	length := 0
+	if len(channels) > 0 {
+		length = len(channels[0])
+	}
+
+	if endSample <= 0 || endSample > length {
+		endSample = length
+	}
+	if loop.End > length {
+		loop.End = length
+	}
+
+	stop := endSample
+	if loop.Valid() {
+		stop = loop.End
+	}
+	if startSample < 0 || startSample >= stop {
+		startSample = 0
+	}
+
+	ls := &LoopStreamer{
+		channels: channels,
+		loop:     loop,
+		fade:     loop.FadeSamples(),
+		length:   length,
+		end:      endSample,
+	}
+	ls.position.Store(int64(startSample))
+
+	return ls
+}
+
+// sample returns the stereo frame at position i
+func (ls *LoopStreamer) sample(i int) (float64, float64) {
+	if i < 0 || i >= ls.length {
+		return 0, 0
+	}
+
+	left := float64(ls.channels[0][i])
+	if len(ls.channels) < 2 {
+		return left, left
+	}
+	return left, float64(ls.channels[1][i])
+}
+
+// Stream fills samples from the current position, wrapping at the loop end
+func (ls *LoopStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	if ls.length == 0 {
+		return 0, false
+	}
+
+	pos := int(ls.position.Load())
+
+	if ls.retrigger.Swap(false) && ls.loop.Valid() {
+		pos = ls.loop.Start
+		ls.reverse = false
+	}
+
+	if !ls.loop.Valid() {
+		for n < len(samples) && pos < ls.end {
+			samples[n][0], samples[n][1] = ls.sample(pos)
+			n++
+			pos++
+		}
+		ls.position.Store(int64(pos))
+		return n, n > 0
+	}
+
+	for n < len(samples) {
+		l, r := ls.sample(pos)
+
+		// Blend in the pre-loop audio over the last fade samples of the loop
+		if !ls.reverse && ls.fade > 0 && pos >= ls.loop.End-ls.fade {
+			t := float64(pos-(ls.loop.End-ls.fade)) / float64(ls.fade)
+			fl, fr := ls.sample(ls.loop.Start - ls.fade + (pos - (ls.loop.End - ls.fade)))
+			l = l*(1-t) + fl*t
+			r = r*(1-t) + fr*t
+		}
+
+		samples[n][0] = l
+		samples[n][1] = r
+		n++
+
+		if ls.reverse {
+			pos--
+			if pos < ls.loop.Start {
+				pos = min(ls.loop.Start+1, ls.loop.End-1)
+				ls.reverse = false
+			}
+			continue
+		}
+
+		pos++
+		if pos >= ls.loop.End {
+			if ls.loop.Mode == LoopModeBidirectional {
+				pos = max(ls.loop.End-2, ls.loop.Start)
+				ls.reverse = true
+			} else {
+				pos = ls.loop.Start
+			}
+		}
+	}
+
+	ls.position.Store(int64(pos))
+
+	return n, true
+}
+
+// Err returns nil, loop streamers never fail
+func (ls *LoopStreamer) Err() error {
+	return nil
+}
+
+// Retrigger restarts playback from the loop start, used to keep a loop in time with a clock
+func (ls *LoopStreamer) Retrigger() {
+	ls.retrigger.Store(true)
+}
+
+// Position returns the current playback position in samples
+func (ls *LoopStreamer) Position() int {
+	return int(ls.position.Load())
+}
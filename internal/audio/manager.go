@@ -38,8 +38,17 @@ type AudioManager struct {
 
 	analyzerBuffer *AudioBuffer
 	AnalyzerData   chan []float64
+	channelMeter   *ChannelMeter
 	stopChan       chan struct{}
 
+	// loopPreview is the loop streamer while a loop preview is playing
+	loopPreview atomic.Pointer[LoopStreamer]
+	// sync keeps loop previews in time with an external MIDI clock
+	sync syncState
+
+	// voices holds the samples triggered with PlayVoice (map[string]*voice)
+	voices sync.Map
+
 	// cursorPositions for tracking cursor positions for stopped wavs (map[string]int)
 	cursorPositions sync.Map
 
@@ -102,6 +111,9 @@ func (am *AudioManager) PlayWave(wave *WaveFile, loop bool, startMarker, endMark
 		return fmt.Errorf("audio file not yet loaded, loading in background...")
 	}
 
+	am.loopPreview.Store(nil)
+	am.sync.preview.Store(nil)
+
 	waveStartMarker := startMarker
 	waveEndMarker := endMarker
 	seekPosition := -1
@@ -138,7 +150,7 @@ func (am *AudioManager) PlayWave(wave *WaveFile, loop bool, startMarker, endMark
 		return err
 	}
 
-	monitorStreamer := NewAudioMonitor(rawStreamer, am.analyzerBuffer)
+	monitorStreamer := NewAudioMonitor(rawStreamer, am.analyzerBuffer, am.channelMeter)
 	volumeStreamer := NewVolumeStreamer(monitorStreamer, am)
 
 	var progressStreamer *ProgressStreamer
@@ -352,6 +364,8 @@ func (am *AudioManager) StopCurrent() {
 	am.cachedIsPlaying.Store(false)
 	am.cachedCurrentWavePath.Store("")
 	am.cachedProgressStreamPtr.Store(0)
+	am.loopPreview.Store(nil)
+	am.sync.preview.Store(nil)
 
 	// Clear the wave and speaker
 	am.setCurrentWave(nil)
@@ -422,6 +436,8 @@ func (am *AudioManager) PauseCurrent() {
 
 	// Clear progress stream pointer so monitor exits immediately
 	am.cachedProgressStreamPtr.Store(0)
+	am.loopPreview.Store(nil)
+	am.sync.preview.Store(nil)
 
 	// Clear the wave and speaker
 	am.setCurrentWave(nil)
@@ -507,6 +523,75 @@ func (am *AudioManager) GetAdjustedProgress() float64 {
 	return 0.0
 }
 
+// GetChannelLevels returns the per-channel peak levels of the current playback
+func (am *AudioManager) GetChannelLevels() ChannelLevels {
+	if am.channelMeter == nil || !am.IsPlaying() {
+		return ChannelLevels{Correlation: 1}
+	}
+	return am.channelMeter.Levels()
+}
+
+// PlayLoopPreview plays a wave from startSample into its sustain loop, repeating the loop
+// with the configured crossfade until playback is stopped. ownerID is the window that
+// receives the playback events.
+func (am *AudioManager) PlayLoopPreview(path, ownerID string, startSample int, loop LoopSettings) error {
+	if !loop.Valid() {
+		return fmt.Errorf("invalid loop %d-%d", loop.Start, loop.End)
+	}
+
+	snapshot := GetGlobalAsyncCache().GetSnapshot(path)
+	if snapshot == nil || !snapshot.SamplesLoaded || len(snapshot.Samples) == 0 {
+		return fmt.Errorf("audio samples not loaded for %s", filepath.Base(path))
+	}
+
+	channels := snapshot.Channels
+	if len(channels) < 2 {
+		channels = [][]float32{snapshot.Samples}
+	}
+
+	if startSample >= loop.End {
+		startSample = loop.Start
+	}
+
+	am.setProgressStream(nil)
+	am.setOriginalBounds(loop.Start, loop.End)
+	am.setCurrentWave(&WaveFile{Path: path})
+	am.clearSpeaker()
+
+	loopStreamer := NewLoopStreamer(channels, startSample, loop)
+	syncedStreamer := am.wrapLoopPreview(loopStreamer, loop, snapshot.SampleRate)
+	monitorStreamer := NewAudioMonitor(syncedStreamer, am.analyzerBuffer, am.channelMeter)
+	volumeStreamer := NewVolumeStreamer(monitorStreamer, am)
+
+	am.cachedOwnerID.Store(ownerID)
+	am.loopPreview.Store(loopStreamer)
+	am.playStreamer(volumeStreamer)
+
+	eventbus.Bus.Publish(events.AudioPlaybackEventRecord{
+		EventType:       events.AudioPlaybackStartedEvent,
+		Path:            path,
+		PositionSamples: startSample,
+		DurationSamples: loop.End - loop.Start,
+		IsPlaying:       true,
+		LoopEnabled:     true,
+		OwnerID:         ownerID,
+	})
+
+	return nil
+}
+
+// GetLoopPreviewPosition returns the playback position in samples if a loop preview of path is playing
+func (am *AudioManager) GetLoopPreviewPosition(path string) (int, bool) {
+	ls := am.loopPreview.Load()
+	if ls == nil || !am.cachedIsPlaying.Load() {
+		return 0, false
+	}
+	if currentPath, _ := am.cachedCurrentWavePath.Load().(string); currentPath != path {
+		return 0, false
+	}
+	return ls.Position(), true
+}
+
 func (am *AudioManager) IsPlaying() bool {
 	return am.cachedIsPlaying.Load()
 }
@@ -816,6 +901,10 @@ func (am *AudioManager) buildDisplayDataFromSnapshot(snapshot *WaveFileSnapshot,
 		IsPlaying:           isPlaying,
 		Progress:            snapshot.Progress,
 		Downsamples:         snapshot.Downsamples,
+		Samples:             snapshot.Samples,
+		Channels:            snapshot.Channels,
+		ChannelDownsamples:  snapshot.ChannelDownsamples,
+		SideDownsamples:     snapshot.SideDownsamples,
 		MinY:                snapshot.MinY,
 		MaxY:                snapshot.MaxY,
 		SampleRate:          snapshot.SampleRate,
@@ -1126,6 +1215,8 @@ func (am *AudioManager) setSeekingFlag(isSeeking bool) {
 
 // clearSpeaker stops all playback by clearing the speaker
 func (am *AudioManager) clearSpeaker() {
+	am.voices.Clear()
+
 	select {
 	case am.commands <- audioCommand{Type: cmdClearSpeaker}:
 	default:
@@ -5,6 +5,7 @@ import "github.com/gopxl/beep/v2"
 type AudioMonitor struct {
 	streamer   beep.Streamer
 	buffer     *AudioBuffer
+	meter      *ChannelMeter
 	monoBuffer []float64
 }
 
@@ -20,6 +21,10 @@ func (am *AudioMonitor) Stream(samples [][2]float64) (n int, ok bool) {
 
 	am.buffer.Write(am.monoBuffer)
 
+	if am.meter != nil {
+		am.meter.Update(samples[:n])
+	}
+
 	return n, ok
 }
 
@@ -27,10 +32,11 @@ func (am *AudioMonitor) Err() error {
 	return am.streamer.Err()
 }
 
-func NewAudioMonitor(source beep.Streamer, buffer *AudioBuffer) *AudioMonitor {
+func NewAudioMonitor(source beep.Streamer, buffer *AudioBuffer, meter *ChannelMeter) *AudioMonitor {
 	return &AudioMonitor{
 		streamer:   source,
 		buffer:     buffer,
+		meter:      meter,
 		monoBuffer: make([]float64, len(buffer.buffer)),
 	}
 }
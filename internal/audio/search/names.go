@@ -0,0 +1,141 @@
+package search
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// bpmPattern finds a tempo in a file name, such as "120bpm", "120 BPM" or "bpm128"
+var bpmPattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9.])(\d{2,3}(?:\.\d+)?)\s?bpm|bpm[\s_-]?(\d{2,3}(?:\.\d+)?)(?:$|[^0-9])`)
+
+// keyPattern matches a musical key written as a word of its own, such as "Am", "C#m",
+// "Bbmaj" or "F#"
+var keyPattern = regexp.MustCompile(`^([A-Ga-g])(#|b|s|sharp|flat)?(m|min|minor|maj|major)?$`)
+
+// scaleWords name the scale of a key written as a word of its own, as in "A min"
+var scaleWords = map[string]bool{"min": true, "minor": true, "maj": true, "major": true}
+
+// flats maps flat notes to the sharp spelling keys are normalized to
+var flats = map[string]string{
+	"Cb": "B", "Db": "C#", "Eb": "D#", "Fb": "E", "Gb": "F#", "Ab": "G#", "Bb": "A#",
+}
+
+// ParseName finds the tempo and key in a file name, 0 and "" if it has none
+func ParseName(name string) (float64, string) {
+	name = strings.TrimSuffix(name, path.Ext(name))
+
+	var bpm float64
+	if m := bpmPattern.FindStringSubmatch(name); m != nil {
+		value := m[1]
+		if value == "" {
+			value = m[2]
+		}
+		if v, err := strconv.ParseFloat(value, 64); err == nil && v >= 40 && v <= 300 {
+			bpm = v
+		}
+	}
+
+	var key string
+	parts := words(name)
+	for i, word := range parts {
+		// A single lowercase letter is more likely a word than a key
+		if !unicode.IsUpper(rune(word[0])) {
+			continue
+		}
+
+		// The scale may follow the note as a word of its own, as in "A min" or "F#_major"
+		if i+1 < len(parts) {
+			if scale := strings.ToLower(parts[i+1]); scaleWords[scale] {
+				if k, ok := NormalizeKey(word + scale); ok {
+					key = k
+					break
+				}
+			}
+		}
+
+		// A bare capital letter is more likely an initial or the word "A" than a key, so
+		// it is only taken as one right after the tempo or the word "key"
+		if len(word) == 1 && (i == 0 || !isKeyPosition(parts[i-1])) {
+			continue
+		}
+
+		if k, ok := NormalizeKey(word); ok {
+			key = k
+			break
+		}
+	}
+
+	return bpm, key
+}
+
+// NormalizeKey writes a key the same way whatever its spelling: the note in upper case
+// with sharps rather than flats, followed by "m" for minor keys
+func NormalizeKey(s string) (string, bool) {
+	m := keyPattern.FindStringSubmatch(s)
+	if m == nil {
+		return "", false
+	}
+
+	note := strings.ToUpper(m[1])
+	switch m[2] {
+	case "#", "s", "sharp":
+		note += "#"
+	case "b", "flat":
+		note += "b"
+	}
+	if sharp, ok := flats[note]; ok {
+		note = sharp
+	}
+	switch note {
+	case "E#":
+		note = "F"
+	case "B#":
+		note = "C"
+	}
+
+	switch m[3] {
+	case "m", "min", "minor":
+		return note + "m", true
+	default:
+		return note, true
+	}
+}
+
+// Tags returns the words of a path relative to the library root as tags, so files can
+// be found by the folders they are sorted into as well as their names
+func Tags(relPath string) []string {
+	relPath = strings.TrimSuffix(relPath, path.Ext(relPath))
+
+	seen := make(map[string]bool)
+	var tags []string
+	for _, word := range words(relPath) {
+		word = strings.ToLower(word)
+		if len(word) < 2 || seen[word] || isNumber(word) {
+			continue
+		}
+		seen[word] = true
+		tags = append(tags, word)
+	}
+	return tags
+}
+
+// words splits text on anything that isn't a letter, digit or #
+func words(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '#'
+	})
+}
+
+// isKeyPosition returns true if a key is expected after word, e.g. in "120bpm A" or "key_C"
+func isKeyPosition(word string) bool {
+	word = strings.ToLower(word)
+	return word == "key" || word == "bpm" || bpmPattern.MatchString(word)
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
@@ -0,0 +1,491 @@
+// Package search implements the query language of the library search.
+//
+// A query is a list of terms that must all match. Plain words match the file name, or
+// failing that its path. Other terms filter on metadata:
+//
+//	dur<2s  dur:1-3s  rate:44.1k  bits:24  ch:stereo  bpm:120-128  key:Am
+//	loud>-18  peak<=-1  tag:kick  rating>=4  fav:yes  name:loop  path:drums
+//
+// Numbers are compared with <, <=, >, >=, = or :, where : also takes a range written
+// a-b. Any term prefixed with - excludes the files it matches. Quote a term to search
+// for text containing spaces.
+package search
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Range is a part of a file name matched by the query, as byte offsets
+type Range struct {
+	Start, End int
+}
+
+// Record is what the search knows about a file
+type Record struct {
+	Path string
+	Name string
+	// RelPath is the path relative to the library root, plain words that don't match
+	// the name are looked for here
+	RelPath string
+
+	// MetadataLoaded is set once Duration, SampleRate, BitDepth and Channels are known
+	MetadataLoaded bool
+	Duration       float64
+	SampleRate     int
+	BitDepth       int
+	Channels       int
+
+	// LevelsMeasured is set once Peak and RMS are known
+	LevelsMeasured bool
+	Peak           float32
+	RMS            float32
+
+	// BPM and Key come from the file name, 0 and "" if it has none
+	BPM float64
+	Key string
+
+	// Tags holds the tags the user gave the file along with the words of its path
+	Tags     []string
+	Rating   int
+	Favorite bool
+}
+
+// op is the comparison of a term
+type op int
+
+const (
+	opEqual op = iota
+	opLess
+	opLessEqual
+	opGreater
+	opGreaterEqual
+	opRange
+)
+
+// field is a property a term can filter on
+type field int
+
+const (
+	fieldText field = iota
+	fieldName
+	fieldPath
+	fieldDuration
+	fieldRate
+	fieldBits
+	fieldChannels
+	fieldBPM
+	fieldKey
+	fieldLoudness
+	fieldPeak
+	fieldTag
+	fieldRating
+	fieldFavorite
+)
+
+// fields maps the names accepted in queries to their field
+var fields = map[string]field{
+	"name":       fieldName,
+	"path":       fieldPath,
+	"dur":        fieldDuration,
+	"duration":   fieldDuration,
+	"len":        fieldDuration,
+	"length":     fieldDuration,
+	"rate":       fieldRate,
+	"sr":         fieldRate,
+	"samplerate": fieldRate,
+	"bits":       fieldBits,
+	"depth":      fieldBits,
+	"bitdepth":   fieldBits,
+	"ch":         fieldChannels,
+	"channels":   fieldChannels,
+	"bpm":        fieldBPM,
+	"tempo":      fieldBPM,
+	"key":        fieldKey,
+	"loud":       fieldLoudness,
+	"loudness":   fieldLoudness,
+	"rms":        fieldLoudness,
+	"peak":       fieldPeak,
+	"tag":        fieldTag,
+	"tags":       fieldTag,
+	"rating":     fieldRating,
+	"stars":      fieldRating,
+	"fav":        fieldFavorite,
+	"favorite":   fieldFavorite,
+}
+
+// term is one condition of a query
+type term struct {
+	field  field
+	op     op
+	text   string
+	lo, hi float64
+	negate bool
+}
+
+// Query is a parsed search query
+type Query struct {
+	terms []term
+}
+
+// Parse reads a query, an empty query matches everything
+func Parse(s string) (*Query, error) {
+	q := &Query{}
+	for _, token := range tokenize(s) {
+		t, err := parseTerm(token)
+		if err != nil {
+			return nil, err
+		}
+		q.terms = append(q.terms, t)
+	}
+	return q, nil
+}
+
+// tokenize splits a query on spaces, keeping quoted parts together
+func tokenize(s string) []string {
+	var tokens []string
+	var current strings.Builder
+	quoted := false
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// parseTerm reads a single term
+func parseTerm(token string) (term, error) {
+	var t term
+	if len(token) > 1 && token[0] == '-' {
+		t.negate = true
+		token = token[1:]
+	}
+
+	// The field name ends at the first operator
+	i := strings.IndexAny(token, ":<>=")
+	if i <= 0 {
+		t.field = fieldText
+		t.text = strings.ToLower(token)
+		return t, nil
+	}
+
+	name := strings.ToLower(token[:i])
+	f, ok := fields[name]
+	if !ok {
+		return t, fmt.Errorf("unknown filter '%s'", name)
+	}
+	t.field = f
+
+	rest := token[i:]
+	switch {
+	case strings.HasPrefix(rest, "<="):
+		t.op, rest = opLessEqual, rest[2:]
+	case strings.HasPrefix(rest, ">="):
+		t.op, rest = opGreaterEqual, rest[2:]
+	case strings.HasPrefix(rest, "<"):
+		t.op, rest = opLess, rest[1:]
+	case strings.HasPrefix(rest, ">"):
+		t.op, rest = opGreater, rest[1:]
+	default:
+		t.op, rest = opEqual, rest[1:]
+	}
+	if rest == "" {
+		return t, fmt.Errorf("missing value for '%s'", name)
+	}
+
+	switch f {
+	case fieldName, fieldPath, fieldTag:
+		if t.op != opEqual {
+			return t, fmt.Errorf("'%s' only takes ':'", name)
+		}
+		t.text = strings.ToLower(rest)
+		return t, nil
+
+	case fieldKey:
+		if t.op != opEqual {
+			return t, fmt.Errorf("'%s' only takes ':'", name)
+		}
+		key, ok := NormalizeKey(rest)
+		if !ok {
+			return t, fmt.Errorf("invalid key '%s'", rest)
+		}
+		t.text = key
+		return t, nil
+
+	case fieldFavorite:
+		if t.op != opEqual {
+			return t, fmt.Errorf("'%s' only takes ':'", name)
+		}
+		switch strings.ToLower(rest) {
+		case "yes", "true", "1":
+			t.lo = 1
+		case "no", "false", "0":
+			t.lo = 0
+		default:
+			return t, fmt.Errorf("invalid value '%s' for '%s', use yes or no", rest, name)
+		}
+		return t, nil
+
+	case fieldChannels:
+		switch strings.ToLower(rest) {
+		case "mono":
+			rest = "1"
+		case "stereo":
+			rest = "2"
+		}
+	}
+
+	if t.op == opEqual {
+		if lo, hi, ok := splitRange(rest); ok {
+			var err error
+			if t.lo, err = parseValue(f, lo); err != nil {
+				return t, fmt.Errorf("invalid value '%s' for '%s'", lo, name)
+			}
+			if t.hi, err = parseValue(f, hi); err != nil {
+				return t, fmt.Errorf("invalid value '%s' for '%s'", hi, name)
+			}
+			if t.lo > t.hi {
+				t.lo, t.hi = t.hi, t.lo
+			}
+			t.op = opRange
+			return t, nil
+		}
+	}
+
+	value, err := parseValue(f, rest)
+	if err != nil {
+		return t, fmt.Errorf("invalid value '%s' for '%s'", rest, name)
+	}
+	t.lo = value
+	return t, nil
+}
+
+// splitRange splits a range written a-b or a..b. A leading minus belongs to the number,
+// so -20--10 is the range from -20 to -10.
+func splitRange(s string) (string, string, bool) {
+	if lo, hi, ok := strings.Cut(s, ".."); ok {
+		return lo, hi, true
+	}
+	for i := 1; i < len(s); i++ {
+		if s[i] == '-' && s[i-1] != '-' {
+			return s[:i], s[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// parseValue reads a number with the units its field accepts. Durations are in seconds
+// unless given in ms or m, sample rates in Hz unless given in k or khz, levels in dB.
+func parseValue(f field, s string) (float64, error) {
+	s = strings.ToLower(s)
+	scale := 1.0
+
+	switch f {
+	case fieldDuration:
+		switch {
+		case strings.HasSuffix(s, "ms"):
+			s, scale = strings.TrimSuffix(s, "ms"), 0.001
+		case strings.HasSuffix(s, "min"):
+			s, scale = strings.TrimSuffix(s, "min"), 60
+		case strings.HasSuffix(s, "m"):
+			s, scale = strings.TrimSuffix(s, "m"), 60
+		default:
+			s = strings.TrimSuffix(s, "s")
+		}
+	case fieldRate:
+		switch {
+		case strings.HasSuffix(s, "khz"):
+			s, scale = strings.TrimSuffix(s, "khz"), 1000
+		case strings.HasSuffix(s, "k"):
+			s, scale = strings.TrimSuffix(s, "k"), 1000
+		default:
+			s = strings.TrimSuffix(s, "hz")
+		}
+	case fieldBits:
+		s = strings.TrimSuffix(s, "bit")
+	case fieldLoudness, fieldPeak:
+		s = strings.TrimSuffix(strings.TrimSuffix(s, "dbfs"), "db")
+	case fieldBPM:
+		s = strings.TrimSuffix(s, "bpm")
+	case fieldRating:
+		s = strings.TrimSuffix(s, "stars")
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return v * scale, nil
+}
+
+// Empty returns true if the query has no terms
+func (q *Query) Empty() bool {
+	return len(q.terms) == 0
+}
+
+// NeedsMetadata returns true if the query filters on file metadata
+func (q *Query) NeedsMetadata() bool {
+	for _, t := range q.terms {
+		switch t.field {
+		case fieldDuration, fieldRate, fieldBits, fieldChannels:
+			return true
+		}
+	}
+	return false
+}
+
+// NeedsLevels returns true if the query filters on peak or loudness
+func (q *Query) NeedsLevels() bool {
+	for _, t := range q.terms {
+		if t.field == fieldLoudness || t.field == fieldPeak {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns true if the record matches every term of the query, along with the
+// parts of its name that matched
+func (q *Query) Match(r *Record) (bool, []Range) {
+	var ranges []Range
+	name := strings.ToLower(r.Name)
+
+	for _, t := range q.terms {
+		ok := false
+
+		switch t.field {
+		case fieldText:
+			if i := strings.Index(name, t.text); i >= 0 {
+				ok = true
+				if !t.negate {
+					ranges = append(ranges, Range{Start: i, End: i + len(t.text)})
+				}
+			} else {
+				ok = strings.Contains(strings.ToLower(r.RelPath), t.text)
+			}
+
+		case fieldName:
+			if i := strings.Index(name, t.text); i >= 0 {
+				ok = true
+				if !t.negate {
+					ranges = append(ranges, Range{Start: i, End: i + len(t.text)})
+				}
+			}
+
+		case fieldPath:
+			ok = strings.Contains(strings.ToLower(r.RelPath), t.text)
+
+		case fieldDuration:
+			ok = r.MetadataLoaded && t.compare(r.Duration)
+
+		case fieldRate:
+			ok = r.MetadataLoaded && t.compare(float64(r.SampleRate))
+
+		case fieldBits:
+			ok = r.MetadataLoaded && t.compare(float64(r.BitDepth))
+
+		case fieldChannels:
+			ok = r.MetadataLoaded && t.compare(float64(r.Channels))
+
+		case fieldBPM:
+			ok = r.BPM > 0 && t.compare(r.BPM)
+
+		case fieldKey:
+			ok = r.Key != "" && r.Key == t.text
+
+		case fieldLoudness:
+			ok = r.LevelsMeasured && t.compare(Decibels(r.RMS))
+
+		case fieldPeak:
+			ok = r.LevelsMeasured && t.compare(Decibels(r.Peak))
+
+		case fieldTag:
+			// tag:kick finds kick, kicks and kickdrum
+			for _, tag := range r.Tags {
+				if strings.HasPrefix(strings.ToLower(tag), t.text) {
+					ok = true
+					break
+				}
+			}
+
+		case fieldRating:
+			ok = t.compare(float64(r.Rating))
+
+		case fieldFavorite:
+			ok = r.Favorite == (t.lo == 1)
+		}
+
+		if ok == t.negate {
+			return false, nil
+		}
+	}
+
+	return true, mergeRanges(ranges)
+}
+
+// compare checks a number against a numeric term. Equality allows for rounding, so
+// rate:44.1k matches 44100 and dur:1.5 matches 1.5004.
+func (t *term) compare(v float64) bool {
+	const epsilon = 0.005
+	switch t.op {
+	case opLess:
+		return v < t.lo
+	case opLessEqual:
+		return v <= t.lo+epsilon
+	case opGreater:
+		return v > t.lo
+	case opGreaterEqual:
+		return v >= t.lo-epsilon
+	case opRange:
+		return v >= t.lo-epsilon && v <= t.hi+epsilon
+	default:
+		return math.Abs(v-t.lo) <= epsilon*max(1, math.Abs(t.lo))
+	}
+}
+
+// Decibels converts a linear amplitude to dBFS
+func Decibels(amplitude float32) float64 {
+	if amplitude <= 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(float64(amplitude))
+}
+
+// mergeRanges sorts ranges and joins the ones that overlap
+func mergeRanges(ranges []Range) []Range {
+	if len(ranges) < 2 {
+		return ranges
+	}
+
+	slices.SortFunc(ranges, func(a, b Range) int {
+		return a.Start - b.Start
+	})
+
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End {
+			last.End = max(last.End, r.End)
+		} else {
+			merged = append(merged, r)
+		}
+	}
+	return merged
+}
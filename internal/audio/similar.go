@@ -0,0 +1,67 @@
+package audio
+
+import (
+	"bitbox-editor/internal/audio/features"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SimilarMatch is a library file found to sound like another
+type SimilarMatch struct {
+	Path string
+	// Similarity is how alike the files sound, from 0 to 1
+	Similarity float64
+}
+
+// FindSimilar ranks the files of the library at root by how much they sound like the
+// file at path, returning the best limit matches. The file doesn't have to be in the
+// library. Also returns the library files that can't be compared yet because their
+// features haven't been measured, they are measured along with their mini downsamples.
+func FindSimilar(root, path string, limit int) ([]SimilarMatch, []string, error) {
+	index := OpenLibraryIndex(root)
+	path = filepath.Clean(path)
+
+	var reference *features.Features
+	if entry, ok := index.Lookup(path); ok {
+		reference, _ = features.FromValues(entry.Features)
+	}
+	if reference == nil {
+		f, err := features.Analyze(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to analyze '%s': %w", filepath.Base(path), err)
+		}
+		reference = f
+	}
+
+	var matches []SimilarMatch
+	var missing []string
+	for candidate, entry := range index.Entries() {
+		if candidate == path {
+			continue
+		}
+
+		f, ok := features.FromValues(entry.Features)
+		if !ok {
+			missing = append(missing, candidate)
+			continue
+		}
+		matches = append(matches, SimilarMatch{Path: candidate, Similarity: reference.Similarity(f)})
+	}
+
+	slices.SortFunc(matches, func(a, b SimilarMatch) int {
+		switch {
+		case a.Similarity > b.Similarity:
+			return -1
+		case a.Similarity < b.Similarity:
+			return 1
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	return matches, missing, nil
+}
@@ -0,0 +1,79 @@
+package audio
+
+import (
+	"math"
+)
+
+// FindNearestZeroCrossing searches samples within +/- window of position and returns the
+// index of the closest zero crossing. If no crossing is found the original position is returned.
+func FindNearestZeroCrossing(samples []float32, position, window int) int {
+	if len(samples) == 0 || window <= 0 {
+		return position
+	}
+
+	if position < 0 {
+		position = 0
+	}
+	if position >= len(samples) {
+		position = len(samples) - 1
+	}
+
+	isCrossing := func(i int) bool {
+		if i <= 0 || i >= len(samples) {
+			return false
+		}
+		prev, cur := samples[i-1], samples[i]
+		return cur == 0 || (prev < 0 && cur > 0) || (prev > 0 && cur < 0)
+	}
+
+	if samples[position] == 0 {
+		return position
+	}
+
+	// Walk outwards from the position so the first hit is the nearest
+	for offset := 0; offset <= window; offset++ {
+		left := position - offset
+		right := position + offset + 1
+
+		if isCrossing(right) {
+			// Pick whichever side of the crossing is quieter
+			if math.Abs(float64(samples[right-1])) < math.Abs(float64(samples[right])) {
+				return right - 1
+			}
+			return right
+		}
+
+		if isCrossing(left) {
+			if math.Abs(float64(samples[left-1])) < math.Abs(float64(samples[left])) {
+				return left - 1
+			}
+			return left
+		}
+	}
+
+	return position
+}
+
+// SnapToBeatGrid rounds position to the nearest grid line for the given tempo. Division is
+// the number of grid lines per beat, e.g. 4 for sixteenth notes.
+func SnapToBeatGrid(position, sampleRate int, bpm float64, division int) int {
+	step := BeatGridStep(sampleRate, bpm, division)
+	if step <= 0 {
+		return position
+	}
+
+	return int(math.Round(math.Round(float64(position)/step) * step))
+}
+
+// BeatGridStep returns the distance between grid lines in samples, or 0 if the tempo is unknown
+func BeatGridStep(sampleRate int, bpm float64, division int) float64 {
+	if sampleRate <= 0 || bpm <= 0 {
+		return 0
+	}
+
+	if division <= 0 {
+		division = 1
+	}
+
+	return (60.0 / bpm) * float64(sampleRate) / float64(division)
+}
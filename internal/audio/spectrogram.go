@@ -0,0 +1,170 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/mjibson/go-dsp/fft"
+	"github.com/mjibson/go-dsp/window"
+	"go.uber.org/zap"
+)
+
+const (
+	// SpectrogramFFTSize is the STFT window length in samples
+	SpectrogramFFTSize = 1024
+
+	// SpectrogramRows is the number of log spaced frequency rows
+	SpectrogramRows = 128
+
+	// SpectrogramMinDB is the floor of the spectrogram relative to its loudest point
+	SpectrogramMinDB = -90.0
+
+	// maxSpectrogramFrames limits the number of STFT frames for long files
+	maxSpectrogramFrames = 4096
+
+	// spectrogramMinFreq is the lowest frequency shown
+	spectrogramMinFreq = 20.0
+)
+
+// Spectrogram is an offline STFT of a wave. Values are stored column major (one column per
+// frame) with row 0 holding the highest frequency, in dB relative to the loudest point.
+type Spectrogram struct {
+	Path       string
+	SampleRate int
+	NumSamples int
+	HopSize    int
+	Frames     int
+	Rows       int
+	Values     []float32
+}
+
+// Column returns the values for a single frame
+func (s *Spectrogram) Column(frame int) []float32 {
+	if frame < 0 || frame >= s.Frames {
+		return nil
+	}
+	return s.Values[frame*s.Rows : (frame+1)*s.Rows]
+}
+
+// ComputeSpectrogram runs a short time fourier transform over mono samples
+func ComputeSpectrogram(samples []float32, sampleRate int) *Spectrogram {
+	numSamples := len(samples)
+	if numSamples == 0 || sampleRate <= 0 {
+		return nil
+	}
+
+	hopSize := SpectrogramFFTSize / 4
+	if numSamples/hopSize > maxSpectrogramFrames {
+		hopSize = numSamples / maxSpectrogramFrames
+	}
+
+	frames := numSamples/hopSize + 1
+	rows := SpectrogramRows
+
+	// Map each row to a range of FFT bins on a log frequency scale
+	nyquist := float64(sampleRate) / 2
+	binHz := float64(sampleRate) / SpectrogramFFTSize
+	rowStart := make([]int, rows)
+	rowEnd := make([]int, rows)
+	for r := 0; r < rows; r++ {
+		// Row 0 is the top of the plot so it gets the highest frequency
+		lo := spectrogramMinFreq * math.Pow(nyquist/spectrogramMinFreq, float64(rows-1-r)/float64(rows))
+		hi := spectrogramMinFreq * math.Pow(nyquist/spectrogramMinFreq, float64(rows-r)/float64(rows))
+		rowStart[r] = int(math.Floor(lo / binHz))
+		rowEnd[r] = int(math.Ceil(hi / binHz))
+		if rowEnd[r] <= rowStart[r] {
+			rowEnd[r] = rowStart[r] + 1
+		}
+		if rowEnd[r] > SpectrogramFFTSize/2 {
+			rowEnd[r] = SpectrogramFFTSize / 2
+		}
+	}
+
+	hann := window.Hann(SpectrogramFFTSize)
+	chunk := make([]float64, SpectrogramFFTSize)
+	values := make([]float32, frames*rows)
+	maxMag := 0.0
+
+	for f := 0; f < frames; f++ {
+		// Center the window on the frame position
+		start := f*hopSize - SpectrogramFFTSize/2
+		for i := 0; i < SpectrogramFFTSize; i++ {
+			idx := start + i
+			if idx < 0 || idx >= numSamples {
+				chunk[i] = 0
+				continue
+			}
+			chunk[i] = float64(samples[idx]) * hann[i]
+		}
+
+		spectrum := fft.FFTReal(chunk)
+		for r := 0; r < rows; r++ {
+			mag := 0.0
+			for b := rowStart[r]; b < rowEnd[r]; b++ {
+				if m := cmplx.Abs(spectrum[b]); m > mag {
+					mag = m
+				}
+			}
+			values[f*rows+r] = float32(mag)
+			if mag > maxMag {
+				maxMag = mag
+			}
+		}
+	}
+
+	// Convert to dB relative to the loudest point
+	for i, mag := range values {
+		db := SpectrogramMinDB
+		if maxMag > 0 && mag > 0 {
+			db = 20 * math.Log10(float64(mag)/maxMag)
+		}
+		if db < SpectrogramMinDB {
+			db = SpectrogramMinDB
+		}
+		values[i] = float32(db)
+	}
+
+	return &Spectrogram{
+		SampleRate: sampleRate,
+		NumSamples: numSamples,
+		HopSize:    hopSize,
+		Frames:     frames,
+		Rows:       rows,
+		Values:     values,
+	}
+}
+
+// GetSpectrogram returns the spectrogram for a path, or nil if it is not ready yet.
+// The first call for a loaded wave starts computing it in the background.
+func (c *AsyncWaveCache) GetSpectrogram(path string) *Spectrogram {
+	snapshot := c.GetSnapshot(path)
+	if snapshot == nil || !snapshot.SamplesLoaded || len(snapshot.Samples) == 0 {
+		return nil
+	}
+
+	if entry, ok := c.spectrograms.Load(path); ok {
+		spec := entry.(*Spectrogram)
+		if spec.NumSamples == len(snapshot.Samples) {
+			return spec
+		}
+	}
+
+	key := path + ":spectrogram"
+	if _, loading := c.inProgress.LoadOrStore(key, true); loading {
+		return nil
+	}
+
+	go func(samples []float32, sampleRate int) {
+		defer c.inProgress.Delete(key)
+
+		spec := ComputeSpectrogram(samples, sampleRate)
+		if spec == nil {
+			log.Warn("Failed to compute spectrogram", zap.String("path", path))
+			return
+		}
+		spec.Path = path
+		c.spectrograms.Store(path, spec)
+	}(snapshot.Samples, snapshot.SampleRate)
+
+	return nil
+}
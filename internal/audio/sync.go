@@ -0,0 +1,163 @@
+package audio
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/speaker"
+)
+
+// Loop sync modes, how a loop preview follows the tempo of an external MIDI clock
+const (
+	SyncModeOff = iota
+	// SyncModeVarispeed resamples the loop so its speed matches the clock tempo. Like a
+	// varispeed on a tape machine this shifts the pitch along with the tempo.
+	SyncModeVarispeed
+	// SyncModeRetrigger restarts the loop on the clock's start and on every loop length
+	// in beats, keeping the loop in phase without changing its speed
+	SyncModeRetrigger
+)
+
+// SyncModeNames are the config names of the sync modes, indexed by mode
+var SyncModeNames = []string{"off", "varispeed", "retrigger"}
+
+// ParseSyncMode returns the sync mode for a config name, unknown names turn sync off
+func ParseSyncMode(name string) int {
+	for mode, n := range SyncModeNames {
+		if n == name {
+			return mode
+		}
+	}
+	return SyncModeOff
+}
+
+// beatsPerBar is used to retrigger loops that have no beat count
+const beatsPerBar = 4
+
+// LoopSync describes how a loop preview follows the tempo of an external clock
+type LoopSync struct {
+	Mode int
+	// Beats is the length of the loop in beats, the beatcount of the cell. Without it the
+	// sample is taken to play at Tempo.
+	Beats int
+	// Tempo is the tempo of the preset the sample belongs to
+	Tempo float64
+}
+
+// loopPreviewSync is the state needed to keep a playing loop preview in sync
+type loopPreviewSync struct {
+	resampler  *beep.Resampler
+	streamer   *LoopStreamer
+	loopLen    int
+	sampleRate int
+}
+
+// syncState holds the loop sync settings and the external tempo, stored in the AudioManager
+type syncState struct {
+	settings atomic.Pointer[LoopSync]
+	// tempo is the external tempo as float64 bits, 0 when no clock is running
+	tempo   atomic.Uint64
+	preview atomic.Pointer[loopPreviewSync]
+}
+
+// SetLoopSync sets how loop previews follow the external tempo. A playing preview is
+// updated straight away.
+func (am *AudioManager) SetLoopSync(sync LoopSync) {
+	am.sync.settings.Store(&sync)
+	am.updateLoopPreviewRatio()
+}
+
+// LoopSyncSettings returns the current loop sync settings
+func (am *AudioManager) LoopSyncSettings() LoopSync {
+	if s := am.sync.settings.Load(); s != nil {
+		return *s
+	}
+	return LoopSync{}
+}
+
+// SetExternalTempo sets the tempo of the external clock, 0 means no clock is running
+func (am *AudioManager) SetExternalTempo(bpm float64) {
+	am.sync.tempo.Store(math.Float64bits(max(0, bpm)))
+	am.updateLoopPreviewRatio()
+}
+
+// ExternalTempo returns the tempo of the external clock, or 0 if no clock is running
+func (am *AudioManager) ExternalTempo() float64 {
+	return math.Float64frombits(am.sync.tempo.Load())
+}
+
+// ClockStarted restarts a synced loop preview from its loop start when the clock starts
+func (am *AudioManager) ClockStarted() {
+	preview := am.sync.preview.Load()
+	if preview == nil || am.LoopSyncSettings().Mode == SyncModeOff {
+		return
+	}
+	preview.streamer.Retrigger()
+}
+
+// ClockBeat is called on every beat of the external clock, beat counts from the song
+// start. In retrigger mode the loop preview restarts at every loop length.
+func (am *AudioManager) ClockBeat(beat int64) {
+	preview := am.sync.preview.Load()
+	settings := am.LoopSyncSettings()
+	if preview == nil || settings.Mode != SyncModeRetrigger {
+		return
+	}
+
+	beats := int64(settings.Beats)
+	if beats <= 0 {
+		beats = beatsPerBar
+	}
+	if beat%beats == 0 {
+		preview.streamer.Retrigger()
+	}
+}
+
+// wrapLoopPreview adds the resampler used to play a loop preview at the clock tempo
+func (am *AudioManager) wrapLoopPreview(ls *LoopStreamer, loop LoopSettings, sampleRate int) beep.Streamer {
+	preview := &loopPreviewSync{
+		streamer:   ls,
+		loopLen:    loop.End - loop.Start,
+		sampleRate: sampleRate,
+	}
+	preview.resampler = beep.ResampleRatio(3, am.loopPreviewRatio(preview), ls)
+	am.sync.preview.Store(preview)
+
+	return preview.resampler
+}
+
+// loopPreviewRatio returns the playback speed that matches a loop preview to the clock tempo
+func (am *AudioManager) loopPreviewRatio(preview *loopPreviewSync) float64 {
+	settings := am.LoopSyncSettings()
+	external := am.ExternalTempo()
+	if settings.Mode != SyncModeVarispeed || external <= 0 {
+		return 1
+	}
+
+	// The tempo the loop plays at its own speed
+	natural := settings.Tempo
+	if settings.Beats > 0 && preview.loopLen > 0 && preview.sampleRate > 0 {
+		seconds := float64(preview.loopLen) / float64(preview.sampleRate)
+		natural = float64(settings.Beats) * 60 / seconds
+	}
+	if natural <= 0 {
+		return 1
+	}
+
+	// Keep the speed within the range the resampler handles cleanly
+	return max(0.25, min(4, external/natural))
+}
+
+// updateLoopPreviewRatio applies the current tempo to a playing loop preview
+func (am *AudioManager) updateLoopPreviewRatio() {
+	preview := am.sync.preview.Load()
+	if preview == nil {
+		return
+	}
+
+	ratio := am.loopPreviewRatio(preview)
+	speaker.Lock()
+	preview.resampler.SetRatio(ratio)
+	speaker.Unlock()
+}
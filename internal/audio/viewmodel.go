@@ -9,23 +9,27 @@ type PlaybackRegion struct {
 
 // WaveDisplayData view model
 type WaveDisplayData struct {
-	Name             string
-	Path             string
-	IsLoading        bool
-	LoadFailed       bool
-	IsReady          bool
-	IsPlaying        bool
-	Progress         float64
-	Downsamples      []Downsample
-	MiniDownsamples  []Downsample
-	MinY, MaxY       float32
-	SampleRate       int
-	NumSamples       int
-	XLimitMax        float64
-	PositionSeconds  float64
-	DurationSeconds  float64
-	AbsolutePosition int
-	SlicePositions   []float64
+	Name               string
+	Path               string
+	IsLoading          bool
+	LoadFailed         bool
+	IsReady            bool
+	IsPlaying          bool
+	Progress           float64
+	Downsamples        []Downsample
+	MiniDownsamples    []Downsample
+	Samples            []float32
+	Channels           [][]float32
+	ChannelDownsamples [][]Downsample
+	SideDownsamples    []Downsample
+	MinY, MaxY         float32
+	SampleRate         int
+	NumSamples         int
+	XLimitMax          float64
+	PositionSeconds    float64
+	DurationSeconds    float64
+	AbsolutePosition   int
+	SlicePositions     []float64
 
 	PlaybackStartMarker int
 	PlaybackEndMarker   int
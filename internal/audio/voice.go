@@ -0,0 +1,111 @@
+package audio
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/effects"
+	"github.com/gopxl/beep/v2/speaker"
+)
+
+// VoiceOptions controls how a voice plays a sample
+type VoiceOptions struct {
+	// Gain is a linear gain applied to the voice, 1.0 leaves the level unchanged
+	Gain float64
+	// Ratio is the playback speed, 2.0 plays an octave up
+	Ratio float64
+	// StartSample and EndSample limit playback to part of the wave, an EndSample of 0
+	// plays to the end
+	StartSample int
+	EndSample   int
+	// Loop is the sustain loop, the voice repeats it until stopped when it is valid
+	Loop LoopSettings
+}
+
+// voice is a single sample playing alongside the main playback
+type voice struct {
+	ctrl *beep.Ctrl
+	done atomic.Bool
+}
+
+// PlayVoice starts playing a sample as a separate voice mixed with everything else on the
+// speaker. Voices are identified by key, starting a voice with a key that is already
+// playing replaces it. Samples must already be loaded into the cache.
+func (am *AudioManager) PlayVoice(key, path string, opts VoiceOptions) error {
+	cache := GetGlobalAsyncCache()
+	snapshot := cache.GetSnapshot(path)
+	if snapshot == nil || !snapshot.SamplesLoaded || len(snapshot.Samples) == 0 {
+		cache.RequestLoad(path, LoadFullSamples)
+		return fmt.Errorf("audio samples not loaded for %s", filepath.Base(path))
+	}
+
+	channels := snapshot.Channels
+	if len(channels) < 2 {
+		channels = [][]float32{snapshot.Samples}
+	}
+
+	var s beep.Streamer = NewSampleStreamer(channels, opts.StartSample, opts.EndSample, opts.Loop)
+
+	ratio := opts.Ratio
+	if ratio <= 0 {
+		ratio = 1
+	}
+	if snapshot.SampleRate > 0 {
+		ratio *= float64(snapshot.SampleRate) / float64(DefaultSampleRate)
+	}
+	if ratio != 1 {
+		s = beep.ResampleRatio(3, ratio, s)
+	}
+
+	if opts.Gain != 1 {
+		s = &effects.Gain{Streamer: s, Gain: opts.Gain - 1}
+	}
+
+	v := &voice{}
+	v.ctrl = &beep.Ctrl{Streamer: NewVolumeStreamer(s, am)}
+
+	if previous, ok := am.voices.Swap(key, v); ok {
+		previous.(*voice).stop()
+	}
+
+	am.playStreamer(beep.Seq(v.ctrl, beep.Callback(func() {
+		v.done.Store(true)
+		am.voices.CompareAndDelete(key, v)
+	})))
+
+	return nil
+}
+
+// StopVoice stops the voice with the given key if it is playing
+func (am *AudioManager) StopVoice(key string) {
+	if v, ok := am.voices.LoadAndDelete(key); ok {
+		v.(*voice).stop()
+	}
+}
+
+// StopAllVoices stops every playing voice
+func (am *AudioManager) StopAllVoices() {
+	am.voices.Range(func(key, v any) bool {
+		am.voices.Delete(key)
+		v.(*voice).stop()
+		return true
+	})
+}
+
+// IsVoicePlaying returns true while the voice with the given key is playing
+func (am *AudioManager) IsVoicePlaying(key string) bool {
+	v, ok := am.voices.Load(key)
+	return ok && !v.(*voice).done.Load()
+}
+
+// stop silences the voice, the speaker drops it on the next buffer
+func (v *voice) stop() {
+	if v.done.Swap(true) {
+		return
+	}
+	speaker.Lock()
+	v.ctrl.Streamer = nil
+	speaker.Unlock()
+}
@@ -759,16 +759,30 @@ func (w *WaveFile) Snapshot() WaveFileSnapshot {
 
 // WaveFileSnapshot is an immutable view of WaveFile state
 type WaveFileSnapshot struct {
-	Path       string
-	Name       string
-	SampleRate int
-	BitDepth   int
-	NumSamples int
-
+	Path        string
+	Name        string
+	SampleRate  int
+	BitDepth    int
+	NumSamples  int
+	NumChannels int
+
+	// Downsamples holds the waveform at increasing resolutions, index 0 is the overview
 	Downsamples     []Downsample
 	MiniDownsamples []Downsample
 	MinY, MaxY      float32
 
+	// Samples is the full resolution mono mix, used for sample accurate editing
+	Samples []float32
+
+	// Channels holds the full resolution left and right channels of stereo files
+	Channels [][]float32
+
+	// ChannelDownsamples holds downsample levels for each channel of stereo files
+	ChannelDownsamples [][]Downsample
+
+	// SideDownsamples holds downsample levels of the side (L-R) signal of stereo files
+	SideDownsamples []Downsample
+
 	MetadataLoaded bool
 	SamplesLoaded  bool
 	LoadErr        error
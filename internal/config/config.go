@@ -46,15 +46,35 @@ peak_fall_speed = 0.020
 noise_gate = 0.05
 color_mode = "height"
 static_color_idx = 128
+
+[midi]
+input_port = ""
+output_port = ""
+learn_profile = "default"
+loop_sync = "off"
+send_clock = false
+driver = "system"
+
+[storage]
+# Folders used as storage locations, e.g. a local mirror of the card:
+# [[storage.locations]]
+# name = "Card mirror"
+# path = "/home/user/bitbox"
+locations = []
 `)
 
 var log *zap.Logger
 
+// Dir returns the directory holding the config file and other per-user data
+func Dir() string {
+	configdir, _ := os.UserConfigDir()
+	return filepath.Join(configdir, APP_NAME)
+}
+
 func init() {
 	log = logging.NewLogger("config")
 
-	configdir, _ := os.UserConfigDir()
-	appConfigDir := filepath.Join(configdir, APP_NAME)
+	appConfigDir := Dir()
 
 	viper.AutomaticEnv()
 	viper.SetEnvPrefix(APP_NAME)
@@ -147,6 +167,19 @@ type Config struct {
 		ColorMode      string
 		StaticColorIdx int
 	}
+
+	Midi struct {
+		InputPort    string
+		OutputPort   string
+		LearnProfile string
+		LoopSync     string
+		SendClock    bool
+		Driver       string
+	}
+
+	Storage struct {
+		Locations []StorageLocation
+	}
 }
 
 // setDefaults sets all default values in viper
@@ -176,6 +209,17 @@ func setDefaults() {
 	viper.SetDefault("spectrum.noise_gate", 0.05)
 	viper.SetDefault("spectrum.color_mode", "height")
 	viper.SetDefault("spectrum.static_color_idx", 128)
+
+	// MIDI defaults
+	viper.SetDefault("midi.input_port", "")
+	viper.SetDefault("midi.output_port", "")
+	viper.SetDefault("midi.learn_profile", "default")
+	viper.SetDefault("midi.loop_sync", "off")
+	viper.SetDefault("midi.send_clock", false)
+	viper.SetDefault("midi.driver", "system")
+
+	// Storage defaults
+	viper.SetDefault("storage.locations", []map[string]any{})
 }
 
 /*
@@ -476,3 +520,116 @@ func GetSpectrumStaticColorIdx() int {
 	}
 	return staticColorIdx
 }
+
+/*
+╭─────────────╮
+│ MIDI Config │
+╰─────────────╯
+*/
+
+// SetMidiInputPort updates the MIDI input port in config, an empty name disables MIDI input
+func SetMidiInputPort(portName string) error {
+	viper.Set("midi.input_port", portName)
+	return viper.WriteConfig()
+}
+
+// GetMidiInputPort retrieves the MIDI input port from config
+func GetMidiInputPort() string {
+	return viper.GetString("midi.input_port")
+}
+
+// SetMidiOutputPort updates the MIDI output port in config, an empty name disables MIDI output
+func SetMidiOutputPort(portName string) error {
+	viper.Set("midi.output_port", portName)
+	return viper.WriteConfig()
+}
+
+// GetMidiOutputPort retrieves the MIDI output port from config
+func GetMidiOutputPort() string {
+	return viper.GetString("midi.output_port")
+}
+
+// SetMidiLearnProfile updates the active MIDI learn profile in config
+func SetMidiLearnProfile(name string) error {
+	viper.Set("midi.learn_profile", name)
+	return viper.WriteConfig()
+}
+
+// GetMidiLearnProfile retrieves the active MIDI learn profile from config
+func GetMidiLearnProfile() string {
+	name := viper.GetString("midi.learn_profile")
+	if name == "" {
+		return "default"
+	}
+	return name
+}
+
+// SetMidiLoopSync updates how loop previews follow an external MIDI clock ("off",
+// "varispeed" or "retrigger")
+func SetMidiLoopSync(mode string) error {
+	viper.Set("midi.loop_sync", mode)
+	return viper.WriteConfig()
+}
+
+// GetMidiLoopSync retrieves how loop previews follow an external MIDI clock
+func GetMidiLoopSync() string {
+	return viper.GetString("midi.loop_sync")
+}
+
+// SetMidiSendClock updates whether MIDI clock is sent to the output port
+func SetMidiSendClock(enabled bool) error {
+	viper.Set("midi.send_clock", enabled)
+	return viper.WriteConfig()
+}
+
+// GetMidiSendClock retrieves whether MIDI clock is sent to the output port
+func GetMidiSendClock() bool {
+	return viper.GetBool("midi.send_clock")
+}
+
+// SetMidiDriver updates the MIDI driver in config ("system" or "loopback")
+func SetMidiDriver(name string) error {
+	viper.Set("midi.driver", name)
+	return viper.WriteConfig()
+}
+
+// GetMidiDriver retrieves the MIDI driver from config
+func GetMidiDriver() string {
+	return viper.GetString("midi.driver")
+}
+
+/*
+╭────────────────╮
+│ Storage Config │
+╰────────────────╯
+*/
+
+// StorageLocation is a folder added as a storage location, e.g. a local mirror of the
+// card or a backup directory
+type StorageLocation struct {
+	Name string `mapstructure:"name"`
+	Path string `mapstructure:"path"`
+}
+
+// SetStorageLocations updates the custom storage locations in config
+func SetStorageLocations(locations []StorageLocation) error {
+	entries := make([]map[string]any, 0, len(locations))
+	for _, loc := range locations {
+		entries = append(entries, map[string]any{
+			"name": loc.Name,
+			"path": loc.Path,
+		})
+	}
+	viper.Set("storage.locations", entries)
+	return viper.WriteConfig()
+}
+
+// GetStorageLocations retrieves the custom storage locations from config
+func GetStorageLocations() []StorageLocation {
+	var locations []StorageLocation
+	if err := viper.UnmarshalKey("storage.locations", &locations); err != nil {
+		log.Warn("Invalid storage locations in config", zap.Error(err))
+		return nil
+	}
+	return locations
+}
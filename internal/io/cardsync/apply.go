@@ -0,0 +1,307 @@
+package cardsync
+
+import (
+	"bitbox-editor/internal/io/drive/space"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// tmpSuffix marks files being copied, they are renamed into place once complete
+const tmpSuffix = ".bbsync.tmp"
+
+// Operation is an action applied to a file
+type Operation struct {
+	Path   string
+	Action Action
+}
+
+// Result is the outcome of applying a plan
+type Result struct {
+	DryRun     bool
+	Operations []Operation
+	// Applied is the number of operations done before an error
+	Applied int
+	// Problems are the preset references the sync would break and the sides without
+	// enough free space
+	Problems []string
+}
+
+// root returns the folder of a side
+func (p *Plan) root(side Side) string {
+	if side == SideA {
+		return p.RootA
+	}
+	return p.RootB
+}
+
+// Operations returns the operations of a sync in a direction. Samples are copied before
+// the presets referencing them and deletions come last, so an interrupted sync never
+// leaves a preset pointing at a sample that isn't there yet.
+func (p *Plan) Operations(dir Direction) []Operation {
+	var ops []Operation
+	for _, e := range p.Entries {
+		if dir.allows(e.Action) {
+			ops = append(ops, Operation{Path: e.Path, Action: e.Action})
+		}
+	}
+
+	rank := func(op Operation) int {
+		switch {
+		case op.Action == ActionDeleteA || op.Action == ActionDeleteB:
+			return 2
+		case isPresetFile(op.Path):
+			return 1
+		}
+		return 0
+	}
+	slices.SortStableFunc(ops, func(a, b Operation) int {
+		return rank(a) - rank(b)
+	})
+
+	return ops
+}
+
+// Check returns the preset references a sync in a direction would break. Every preset
+// on a side written by the sync must still find each sample it finds now.
+func (p *Plan) Check(dir Direction) []string {
+	entries := make(map[string]*Entry, len(p.Entries))
+	for _, e := range p.Entries {
+		entries[e.Path] = e
+	}
+
+	// exists reports whether a file is on a side now, or after the sync when after is set
+	exists := func(side Side, after bool) func(string) bool {
+		return func(path string) bool {
+			e, ok := entries[path]
+			if !ok {
+				info, err := os.Stat(filepath.Join(p.root(side), filepath.FromSlash(path)))
+				return err == nil && info.Mode().IsRegular()
+			}
+			if after && dir.allows(e.Action) {
+				switch {
+				case (e.Action == ActionCopyToA && side == SideA) || (e.Action == ActionCopyToB && side == SideB):
+					return true
+				case (e.Action == ActionDeleteA && side == SideA) || (e.Action == ActionDeleteB && side == SideB):
+					return false
+				}
+			}
+			if side == SideA {
+				return e.A != nil
+			}
+			return e.B != nil
+		}
+	}
+
+	var problems []string
+	for _, side := range []Side{SideA, SideB} {
+		written := false
+		for _, e := range p.Entries {
+			if s, ok := e.Action.Writes(); ok && s == side && dir.allows(e.Action) {
+				written = true
+				break
+			}
+		}
+		if !written {
+			continue
+		}
+
+		other := SideB
+		if side == SideB {
+			other = SideA
+		}
+
+		for _, e := range p.Entries {
+			if !isPresetFile(e.Path) || !exists(side, true)(e.Path) {
+				continue
+			}
+
+			// A preset copied onto this side brings its references from the other side
+			source := side
+			if (e.Action == ActionCopyToA || e.Action == ActionCopyToB) && dir.allows(e.Action) {
+				source = other
+			}
+
+			refs, err := presetReferences(p.root(source), e.Path)
+			if err != nil {
+				continue
+			}
+			for _, ref := range refs {
+				if _, ok := resolveReference(e.Path, ref, exists(source, false)); !ok {
+					// Already missing, the sync doesn't break it
+					continue
+				}
+				if _, ok := resolveReference(e.Path, ref, exists(side, true)); !ok {
+					problems = append(problems, fmt.Sprintf("%s: '%s' would be missing in %s", e.Path, ref, p.root(side)))
+				}
+			}
+		}
+	}
+
+	return problems
+}
+
+// checkSpace returns the sides of a sync in a direction that don't have room for the
+// files copied to them. Replaced files only need the growth in size, plus room for the
+// largest file since it is written next to the file it replaces.
+func (p *Plan) checkSpace(dir Direction) []string {
+	var problems []string
+	for _, side := range []Side{SideA, SideB} {
+		var need, largest int64
+		for _, e := range p.Entries {
+			if !dir.allows(e.Action) {
+				continue
+			}
+
+			src, dst := e.A, e.B
+			switch {
+			case e.Action == ActionCopyToA && side == SideA:
+				src, dst = e.B, e.A
+			case e.Action == ActionCopyToB && side == SideB:
+			default:
+				continue
+			}
+
+			grow := src.Size
+			if dst != nil {
+				grow -= dst.Size
+			}
+			need += max(grow, 0)
+			largest = max(largest, src.Size)
+		}
+
+		if err := space.Check(p.root(side), uint64(need+largest)); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
+
+// Apply syncs the folders in a direction. A dry run only returns the operations and
+// problems. A sync that would break preset references or doesn't fit is refused.
+func (p *Plan) Apply(dir Direction, dryRun bool) (*Result, error) {
+	result := &Result{
+		DryRun:     dryRun,
+		Operations: p.Operations(dir),
+		Problems:   append(p.Check(dir), p.checkSpace(dir)...),
+	}
+	if dryRun {
+		return result, nil
+	}
+	if len(result.Problems) > 0 {
+		return result, fmt.Errorf("sync refused, %d problems found", len(result.Problems))
+	}
+
+	entries := make(map[string]*Entry, len(p.Entries))
+	for _, e := range p.Entries {
+		entries[e.Path] = e
+		if e.Change == Unchanged {
+			p.state.Synced[e.Path] = e.A.Hash
+		}
+	}
+
+	var applyErr error
+	for _, op := range result.Operations {
+		if err := p.apply(op, entries[op.Path]); err != nil {
+			applyErr = err
+			break
+		}
+		result.Applied++
+	}
+
+	if err := p.state.save(); err != nil {
+		log.Error("Failed to save sync state", zap.Error(err))
+	}
+
+	log.Info("Synced folders",
+		zap.String("a", p.RootA),
+		zap.String("b", p.RootB),
+		zap.Int("applied", result.Applied),
+		zap.Int("operations", len(result.Operations)))
+
+	return result, applyErr
+}
+
+// apply does a single operation and records the result in the sync state
+func (p *Plan) apply(op Operation, e *Entry) error {
+	switch op.Action {
+	case ActionCopyToA, ActionCopyToB:
+		from, to, src := SideB, SideA, e.B
+		if op.Action == ActionCopyToB {
+			from, to, src = SideA, SideB, e.A
+		}
+
+		dst := filepath.Join(p.root(to), filepath.FromSlash(op.Path))
+		if err := copyFile(filepath.Join(p.root(from), filepath.FromSlash(op.Path)), dst, src.ModTime); err != nil {
+			return err
+		}
+
+		p.state.Synced[op.Path] = src.Hash
+		if info, err := os.Stat(dst); err == nil {
+			p.state.Cache[cacheKey(to, op.Path)] = cachedHash{Size: info.Size(), ModTime: info.ModTime(), Hash: src.Hash}
+		}
+
+	case ActionDeleteA, ActionDeleteB:
+		side := SideA
+		if op.Action == ActionDeleteB {
+			side = SideB
+		}
+
+		if err := os.Remove(filepath.Join(p.root(side), filepath.FromSlash(op.Path))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete '%s': %w", op.Path, err)
+		}
+
+		delete(p.state.Synced, op.Path)
+		delete(p.state.Cache, cacheKey(side, op.Path))
+	}
+
+	return nil
+}
+
+// copyFile copies a file through a temporary file so the target is never left half
+// written, keeping the source's mtime
+func copyFile(src, dst string, modTime time.Time) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %w", src, err)
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create folder for '%s': %w", dst, err)
+	}
+
+	tmp := dst + tmpSuffix
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to write '%s': %w", dst, err)
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write '%s': %w", dst, err)
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write '%s': %w", dst, err)
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to replace '%s': %w", dst, err)
+	}
+
+	if err := os.Chtimes(dst, modTime, modTime); err != nil {
+		log.Warn("Failed to keep modification time", zap.String("path", dst), zap.Error(err))
+	}
+
+	return nil
+}
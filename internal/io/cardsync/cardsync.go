@@ -0,0 +1,384 @@
+// Package cardsync keeps two folders laid out like a Bitbox card in sync, typically a
+// local preset workspace and the SD card.
+//
+// Presets live in Presets/<name>/ and reference their samples from preset.xml, either
+// next to the preset or anywhere else on the card. Everything under Presets is synced,
+// along with the files referenced from outside it. Files are compared by content hash,
+// with the hash cached by size and mtime, against the state of the last sync so changes
+// on one side can be told apart from conflicting changes on both.
+package cardsync
+
+import (
+	"bitbox-editor/internal/logging"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var log = logging.NewLogger("cardsync")
+
+// PresetsDir is the folder holding the presets in the root of a card
+const PresetsDir = "Presets"
+
+// Side is one of the two folders being synced
+type Side int
+
+const (
+	SideA Side = iota
+	SideB
+)
+
+// Change is how a file differs between the two sides
+type Change int
+
+const (
+	Unchanged Change = iota
+	AddedA
+	AddedB
+	ChangedA
+	ChangedB
+	RemovedA
+	RemovedB
+	Conflict
+)
+
+var changeNames = map[Change]string{
+	Unchanged: "Unchanged",
+	AddedA:    "Added",
+	AddedB:    "Added",
+	ChangedA:  "Changed",
+	ChangedB:  "Changed",
+	RemovedA:  "Removed",
+	RemovedB:  "Removed",
+	Conflict:  "Conflict",
+}
+
+func (c Change) String() string {
+	return changeNames[c]
+}
+
+// Side returns the side a change was made on, conflicts and unchanged files have none
+func (c Change) Side() (Side, bool) {
+	switch c {
+	case AddedA, ChangedA, RemovedA:
+		return SideA, true
+	case AddedB, ChangedB, RemovedB:
+		return SideB, true
+	}
+	return 0, false
+}
+
+// Action is what a sync does to a file
+type Action int
+
+const (
+	ActionNone Action = iota
+	ActionCopyToA
+	ActionCopyToB
+	ActionDeleteA
+	ActionDeleteB
+)
+
+var actionNames = map[Action]string{
+	ActionNone:    "",
+	ActionCopyToA: "Copy to A",
+	ActionCopyToB: "Copy to B",
+	ActionDeleteA: "Delete from A",
+	ActionDeleteB: "Delete from B",
+}
+
+func (a Action) String() string {
+	return actionNames[a]
+}
+
+// Writes returns the side an action modifies
+func (a Action) Writes() (Side, bool) {
+	switch a {
+	case ActionCopyToA, ActionDeleteA:
+		return SideA, true
+	case ActionCopyToB, ActionDeleteB:
+		return SideB, true
+	}
+	return 0, false
+}
+
+// Direction limits a sync to the changes copied one way
+type Direction int
+
+const (
+	DirectionBoth Direction = iota
+	DirectionToB
+	DirectionToA
+)
+
+// DirectionNames are the names of the directions for display
+var DirectionNames = []string{"Both ways", "A → B", "B → A"}
+
+// allows returns true if an action is part of a sync in this direction
+func (d Direction) allows(action Action) bool {
+	side, ok := action.Writes()
+	if !ok {
+		return false
+	}
+	switch d {
+	case DirectionToB:
+		return side == SideB
+	case DirectionToA:
+		return side == SideA
+	}
+	return true
+}
+
+// Resolution decides which side of a conflict wins
+type Resolution int
+
+const (
+	ResolveSkip Resolution = iota
+	ResolveKeepA
+	ResolveKeepB
+)
+
+// ResolutionNames are the names of the resolutions for display
+var ResolutionNames = []string{"Skip", "Keep A", "Keep B"}
+
+// FileState is a file on one side
+type FileState struct {
+	Size    int64
+	ModTime time.Time
+	Hash    string
+}
+
+// Entry is a file present on either side
+type Entry struct {
+	// Path is relative to the roots, using forward slashes
+	Path   string
+	A      *FileState
+	B      *FileState
+	Change Change
+	Action Action
+
+	resolution Resolution
+}
+
+// Resolution returns how a conflict is resolved
+func (e *Entry) Resolution() Resolution {
+	return e.resolution
+}
+
+// Resolve decides which side of a conflict wins, a file deleted on the winning side is
+// deleted on the other
+func (e *Entry) Resolve(r Resolution) {
+	if e.Change != Conflict {
+		return
+	}
+	e.resolution = r
+
+	switch {
+	case r == ResolveKeepA && e.A != nil:
+		e.Action = ActionCopyToB
+	case r == ResolveKeepA:
+		e.Action = ActionDeleteB
+	case r == ResolveKeepB && e.B != nil:
+		e.Action = ActionCopyToA
+	case r == ResolveKeepB:
+		e.Action = ActionDeleteA
+	default:
+		e.Action = ActionNone
+	}
+}
+
+// Plan is the difference between two folders and the actions that bring them in sync
+type Plan struct {
+	RootA   string
+	RootB   string
+	Entries []*Entry
+
+	state *syncState
+}
+
+// Count returns the number of entries with a change
+func (p *Plan) Count(change Change) int {
+	n := 0
+	for _, e := range p.Entries {
+		if e.Change == change {
+			n++
+		}
+	}
+	return n
+}
+
+// Compare builds the plan that syncs the folders at rootA and rootB
+func Compare(rootA, rootB string) (*Plan, error) {
+	for _, root := range []string{rootA, rootB} {
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("'%s' is not a folder", root)
+		}
+	}
+
+	state := loadState(rootA, rootB)
+	plan := &Plan{RootA: rootA, RootB: rootB, state: state}
+
+	paths := make(map[string]bool)
+	for _, root := range []string{rootA, rootB} {
+		files, err := Files(root)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range files {
+			paths[p] = true
+		}
+	}
+
+	// Files synced before but now gone from both sides are forgotten
+	for p := range state.Synced {
+		if strings.HasPrefix(p, PresetsDir+"/") {
+			paths[p] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	slices.Sort(sorted)
+
+	for _, p := range sorted {
+		a, err := state.fileState(SideA, rootA, p)
+		if err != nil {
+			return nil, err
+		}
+		b, err := state.fileState(SideB, rootB, p)
+		if err != nil {
+			return nil, err
+		}
+		if a == nil && b == nil {
+			delete(state.Synced, p)
+			continue
+		}
+
+		entry := &Entry{Path: p, A: a, B: b}
+		entry.Change, entry.Action = diff(a, b, state.Synced[p])
+		plan.Entries = append(plan.Entries, entry)
+	}
+
+	log.Debug("Compared folders",
+		zap.String("a", rootA),
+		zap.String("b", rootB),
+		zap.Int("files", len(plan.Entries)),
+		zap.Int("conflicts", plan.Count(Conflict)))
+
+	return plan, nil
+}
+
+// diff compares both sides of a file with its hash at the last sync, an empty base
+// means the file was never synced
+func diff(a, b *FileState, base string) (Change, Action) {
+	switch {
+	case a != nil && b != nil:
+		switch {
+		case a.Hash == b.Hash:
+			return Unchanged, ActionNone
+		case base == a.Hash:
+			return ChangedB, ActionCopyToA
+		case base == b.Hash:
+			return ChangedA, ActionCopyToB
+		}
+		return Conflict, ActionNone
+
+	case a != nil:
+		switch {
+		case base == "":
+			return AddedA, ActionCopyToB
+		case base == a.Hash:
+			return RemovedB, ActionDeleteA
+		}
+		// Changed on A but deleted on B
+		return Conflict, ActionNone
+
+	default:
+		switch {
+		case base == "":
+			return AddedB, ActionCopyToA
+		case base == b.Hash:
+			return RemovedA, ActionDeleteB
+		}
+		return Conflict, ActionNone
+	}
+}
+
+// Files returns the files of a root kept on the card: everything under the presets folder
+// and the files its presets reference from outside it, sorted
+func Files(root string) ([]string, error) {
+	files, err := listPresetFiles(root)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(files))
+	for _, p := range files {
+		seen[p] = true
+	}
+	for _, p := range referencedFiles(root, files) {
+		if !seen[p] {
+			seen[p] = true
+			files = append(files, p)
+		}
+	}
+	slices.Sort(files)
+
+	return files, nil
+}
+
+// IsPresetFile returns true if a path is the preset.xml of a preset
+func IsPresetFile(p string) bool {
+	return isPresetFile(p)
+}
+
+// listPresetFiles returns the files under the presets folder of a root. Hidden files,
+// e.g. macOS resource forks, and unfinished writes are skipped.
+func listPresetFiles(root string) ([]string, error) {
+	presetsDir := filepath.Join(root, PresetsDir)
+	if _, err := os.Stat(presetsDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	var files []string
+	err := filepath.WalkDir(presetsDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() || strings.HasSuffix(d.Name(), tmpSuffix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list presets in '%s': %w", root, err)
+	}
+
+	return files, nil
+}
+
+// isPresetFile returns true if a path is the preset.xml of a preset
+func isPresetFile(p string) bool {
+	return strings.HasPrefix(p, PresetsDir+"/") && strings.EqualFold(path.Base(p), "preset.xml")
+}
@@ -0,0 +1,91 @@
+package cardsync
+
+import (
+	"bitbox-editor/internal/parsing/bitbox"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// presetReferences returns the file references of a preset.xml, normalized to forward
+// slashes without a leading slash
+func presetReferences(root, presetPath string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(presetPath)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", presetPath, err)
+	}
+
+	var doc bitbox.Document
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %w", presetPath, err)
+	}
+	if doc.Session == nil {
+		return nil, nil
+	}
+
+	var refs []string
+	for _, cell := range doc.Session.Cells {
+		if ref := bitbox.NormalizeReference(cell.Filename); ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	return refs, nil
+}
+
+// resolveReference finds the file a reference of a preset points at, the same way the
+// preset loader does. Paths are relative to the root with forward slashes.
+func resolveReference(presetPath, ref string, exists func(p string) bool) (string, bool) {
+	resolved, ok := bitbox.ResolveReference(".", filepath.FromSlash(path.Dir(presetPath)), ref, func(p string) bool {
+		return exists(filepath.ToSlash(p))
+	})
+	if !ok {
+		return "", false
+	}
+	return filepath.ToSlash(resolved.Path), true
+}
+
+// References returns the files outside the presets folder that a preset of a root
+// references
+func References(root, presetPath string) ([]string, error) {
+	exists := func(p string) bool {
+		info, err := os.Stat(filepath.Join(root, filepath.FromSlash(p)))
+		return err == nil && info.Mode().IsRegular()
+	}
+
+	refs, err := presetReferences(root, presetPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, ref := range refs {
+		if resolved, ok := resolveReference(presetPath, ref, exists); ok && !strings.HasPrefix(resolved, PresetsDir+"/") {
+			out = append(out, resolved)
+		}
+	}
+	return out, nil
+}
+
+// referencedFiles returns the files referenced by the presets of a root that live
+// outside the presets folder
+func referencedFiles(root string, files []string) []string {
+	var out []string
+	for _, p := range files {
+		if !isPresetFile(p) {
+			continue
+		}
+
+		refs, err := References(root, p)
+		if err != nil {
+			log.Warn("Skipping references of unreadable preset", zap.String("preset", p), zap.Error(err))
+			continue
+		}
+		out = append(out, refs...)
+	}
+	return out
+}
@@ -0,0 +1,152 @@
+package cardsync
+
+import (
+	"bitbox-editor/internal/config"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// stateVersion is the version of the sync state format
+const stateVersion = 1
+
+// syncState remembers the hash of every file at the last sync of two folders, and
+// caches file hashes by size and mtime so unchanged files aren't read again
+type syncState struct {
+	Version int    `json:"version"`
+	RootA   string `json:"root_a"`
+	RootB   string `json:"root_b"`
+	// Synced maps paths to their hash when both sides were last equal
+	Synced map[string]string `json:"synced"`
+	// Cache maps "a:" and "b:" prefixed paths to their last hash
+	Cache map[string]cachedHash `json:"cache"`
+
+	path string
+}
+
+type cachedHash struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Hash    string    `json:"hash"`
+}
+
+// statePath returns the file holding the sync state of two folders
+func statePath(rootA, rootB string) string {
+	sum := sha256.Sum256([]byte(rootA + "\x00" + rootB))
+	return filepath.Join(config.Dir(), "sync", hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadState reads the sync state of two folders, a missing or unreadable state starts
+// fresh so every difference shows as an addition or conflict
+func loadState(rootA, rootB string) *syncState {
+	state := &syncState{
+		Version: stateVersion,
+		RootA:   rootA,
+		RootB:   rootB,
+		Synced:  make(map[string]string),
+		Cache:   make(map[string]cachedHash),
+		path:    statePath(rootA, rootB),
+	}
+
+	data, err := os.ReadFile(state.path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Warn("Failed to read sync state", zap.String("path", state.path), zap.Error(err))
+		}
+		return state
+	}
+
+	var saved syncState
+	if err := json.Unmarshal(data, &saved); err != nil || saved.Version > stateVersion {
+		log.Warn("Ignoring invalid sync state", zap.String("path", state.path), zap.Error(err))
+		return state
+	}
+	if saved.Synced != nil {
+		state.Synced = saved.Synced
+	}
+	if saved.Cache != nil {
+		state.Cache = saved.Cache
+	}
+
+	return state
+}
+
+// save writes the sync state
+func (s *syncState) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0750); err != nil {
+		return fmt.Errorf("failed to create sync state folder: %w", err)
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode sync state: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write sync state '%s': %w", s.path, err)
+	}
+	return nil
+}
+
+// cacheKey returns the hash cache key of a path on a side
+func cacheKey(side Side, p string) string {
+	if side == SideA {
+		return "a:" + p
+	}
+	return "b:" + p
+}
+
+// fileState returns the state of a file on a side, or nil if it doesn't exist there
+func (s *syncState) fileState(side Side, root, p string) (*FileState, error) {
+	full := filepath.Join(root, filepath.FromSlash(p))
+	info, err := os.Stat(full)
+	if errors.Is(err, fs.ErrNotExist) {
+		delete(s.Cache, cacheKey(side, p))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", full, err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	state := &FileState{Size: info.Size(), ModTime: info.ModTime()}
+
+	key := cacheKey(side, p)
+	if cached, ok := s.Cache[key]; ok && cached.Size == state.Size && cached.ModTime.Equal(state.ModTime) {
+		state.Hash = cached.Hash
+		return state, nil
+	}
+
+	state.Hash, err = hashFile(full)
+	if err != nil {
+		return nil, err
+	}
+	s.Cache[key] = cachedHash{Size: state.Size, ModTime: state.ModTime, Hash: state.Hash}
+
+	return state, nil
+}
+
+// hashFile returns the SHA-256 of a file's contents
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
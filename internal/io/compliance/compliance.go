@@ -0,0 +1,318 @@
+// Package compliance checks that the files of a card can be stored on FAT32 and loaded
+// by the Bitbox firmware, and renames the ones that can't.
+//
+// FAT is case-insensitive, forbids a handful of characters and reserved device names,
+// and caps file sizes at 4 GiB. Names are also kept to plain ASCII, which is all the
+// Bitbox screen can show. Renames update the filenames in every preset.xml that
+// references the renamed files, so presets keep loading their samples.
+package compliance
+
+import (
+	"bitbox-editor/internal/io"
+	"bitbox-editor/internal/logging"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+var log = logging.NewLogger("compliance")
+
+const (
+	// MaxNameLength is the longest file or folder name FAT long names allow
+	MaxNameLength = 255
+	// MaxPathLength is the longest path from the root of the card that is accepted
+	MaxPathLength = 255
+	// MaxFileSize is the largest file FAT32 can store
+	MaxFileSize int64 = 1<<32 - 1
+	// MaxSampleSize is the largest WAV file, sizes are stored in 32 bits that many
+	// readers treat as signed
+	MaxSampleSize int64 = 1<<31 - 1
+)
+
+// illegalChars can't be used in FAT names
+const illegalChars = `"*/:<>?\|`
+
+// reservedNames are DOS device names that can't be used as a name, with any extension
+var reservedNames = []string{
+	"CON", "PRN", "AUX", "NUL",
+	"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+	"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+}
+
+// Kind is the kind of problem found
+type Kind int
+
+const (
+	IllegalName Kind = iota
+	NameTooLong
+	PathTooLong
+	CaseCollision
+	FileTooLarge
+	NonASCII
+	BadReference
+)
+
+var kindNames = map[Kind]string{
+	IllegalName:   "Illegal name",
+	NameTooLong:   "Name too long",
+	PathTooLong:   "Path too long",
+	CaseCollision: "Case collision",
+	FileTooLarge:  "File too large",
+	NonASCII:      "Non-ASCII name",
+	BadReference:  "Bad reference",
+}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// Warning returns true if the problem doesn't stop the file from being stored or loaded
+func (k Kind) Warning() bool {
+	return k == NonASCII
+}
+
+// Issue is a problem with a file or folder
+type Issue struct {
+	Kind Kind
+	// Path is the absolute path of the file or folder, or of the preset.xml for a bad
+	// reference
+	Path    string
+	Message string
+	// Suggested is a safe name for the file or folder, empty if renaming can't fix it
+	Suggested string
+}
+
+// Report is the result of checking a card
+type Report struct {
+	Root   string
+	Issues []Issue
+}
+
+// Errors returns the number of issues that aren't warnings
+func (r *Report) Errors() int {
+	n := 0
+	for _, issue := range r.Issues {
+		if !issue.Kind.Warning() {
+			n++
+		}
+	}
+	return n
+}
+
+// Check validates the names and sizes of the files in a tree and the filenames
+// referenced by the presets in it. The tree should include every file of the card, not
+// only the samples.
+func Check(tree *io.FSTree) *Report {
+	report := &Report{Root: tree.Root.Path}
+
+	// Safe names are picked per folder so renames don't collide with each other, an entry
+	// with several issues gets a single name
+	taken := make(map[string]map[string]bool)
+	suggested := make(map[string]string)
+	suggest := func(entry *io.FSEntry) string {
+		if name, ok := suggested[entry.Path]; ok {
+			return name
+		}
+
+		dir := filepath.Dir(entry.Path)
+		if taken[dir] == nil {
+			taken[dir] = make(map[string]bool)
+			if parent, ok := tree.FindEntry(dir); ok {
+				for _, sibling := range parent.Children {
+					taken[dir][strings.ToLower(sibling.Name)] = true
+				}
+			} else if dir == tree.Root.Path {
+				for _, sibling := range tree.Root.Children {
+					taken[dir][strings.ToLower(sibling.Name)] = true
+				}
+			}
+		}
+		suggested[entry.Path] = uniqueName(SafeName(entry.Name), taken[dir])
+		return suggested[entry.Path]
+	}
+
+	var walk func(entry *io.FSEntry)
+	walk = func(entry *io.FSEntry) {
+		report.checkCollisions(entry, suggest)
+
+		for _, child := range entry.Children {
+			report.checkEntry(tree.Root.Path, child, suggest)
+			if child.IsDir {
+				walk(child)
+			}
+		}
+	}
+	walk(tree.Root)
+
+	for _, file := range tree.GetAllFiles() {
+		if strings.EqualFold(file.Name, "preset.xml") {
+			report.checkReferences(tree.Root.Path, file.Path)
+		}
+	}
+
+	log.Debug("Checked card",
+		zap.String("root", report.Root),
+		zap.Int("issues", len(report.Issues)),
+		zap.Int("errors", report.Errors()))
+
+	return report
+}
+
+// checkEntry validates the name, path length and size of a file or folder
+func (r *Report) checkEntry(root string, entry *io.FSEntry, suggest func(*io.FSEntry) string) {
+	add := func(kind Kind, message string, fixable bool) {
+		issue := Issue{Kind: kind, Path: entry.Path, Message: message}
+		if fixable {
+			issue.Suggested = suggest(entry)
+		}
+		r.Issues = append(r.Issues, issue)
+	}
+
+	name := entry.Name
+	if problem := nameProblem(name); problem != "" {
+		add(IllegalName, problem, true)
+	}
+	if n := utf8.RuneCountInString(name); n > MaxNameLength {
+		add(NameTooLong, fmt.Sprintf("name is %d characters, the limit is %d", n, MaxNameLength), true)
+	}
+	if !isASCII(name) {
+		add(NonASCII, "name has characters the Bitbox can't display", true)
+	}
+
+	if rel, err := filepath.Rel(root, entry.Path); err == nil {
+		if n := utf8.RuneCountInString(rel) + 1; n > MaxPathLength {
+			add(PathTooLong, fmt.Sprintf("path is %d characters, the limit is %d", n, MaxPathLength), false)
+		}
+	}
+
+	if entry.IsDir {
+		return
+	}
+	switch {
+	case entry.Size > MaxFileSize:
+		add(FileTooLarge, fmt.Sprintf("%d bytes, FAT32 files are limited to 4 GiB", entry.Size), false)
+	case entry.Size > MaxSampleSize && strings.EqualFold(filepath.Ext(name), ".wav"):
+		add(FileTooLarge, fmt.Sprintf("%d bytes, WAV files are limited to 2 GiB", entry.Size), false)
+	}
+}
+
+// checkCollisions flags children of a folder whose names only differ by case, FAT can't
+// store both. The first one keeps its name.
+func (r *Report) checkCollisions(dir *io.FSEntry, suggest func(*io.FSEntry) string) {
+	seen := make(map[string]*io.FSEntry, len(dir.Children))
+	for _, child := range dir.Children {
+		key := strings.ToLower(child.Name)
+		first, ok := seen[key]
+		if !ok {
+			seen[key] = child
+			continue
+		}
+		r.Issues = append(r.Issues, Issue{
+			Kind:      CaseCollision,
+			Path:      child.Path,
+			Message:   fmt.Sprintf("only differs by case from '%s'", first.Name),
+			Suggested: suggest(child),
+		})
+	}
+}
+
+// nameProblem returns why a name can't be used on FAT, or an empty string
+func nameProblem(name string) string {
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f {
+			return "name has control characters"
+		}
+		if strings.ContainsRune(illegalChars, c) {
+			return fmt.Sprintf("name has the illegal character '%c'", c)
+		}
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return "name ends with a dot or space"
+	}
+	if strings.HasPrefix(name, " ") {
+		return "name starts with a space"
+	}
+
+	base := strings.ToUpper(strings.TrimSuffix(name, filepath.Ext(name)))
+	if slices.Contains(reservedNames, base) {
+		return fmt.Sprintf("'%s' is a reserved device name", base)
+	}
+
+	return ""
+}
+
+// isASCII returns true if a name only has printable ASCII characters
+func isASCII(name string) bool {
+	for _, c := range name {
+		if c > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
+
+// SafeName returns a name that can be used on the card: accents are dropped, other
+// non-ASCII and illegal characters become underscores, reserved names are prefixed and
+// long names are shortened keeping their extension
+func SafeName(name string) string {
+	stripped, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), name)
+	if err == nil {
+		name = stripped
+	}
+
+	var b strings.Builder
+	for _, c := range name {
+		switch {
+		case c < 0x20 || c == 0x7f || c > unicode.MaxASCII || strings.ContainsRune(illegalChars, c):
+			b.WriteByte('_')
+		default:
+			b.WriteRune(c)
+		}
+	}
+	name = strings.TrimLeft(strings.TrimRight(b.String(), ". "), " ")
+	if name == "" {
+		name = "_"
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if slices.Contains(reservedNames, strings.ToUpper(base)) {
+		base = "_" + base
+	}
+
+	if len(base)+len(ext) > MaxNameLength {
+		if len(ext) > MaxNameLength/2 {
+			ext = ""
+		}
+		base = strings.TrimRight(base[:MaxNameLength-len(ext)], ". ")
+	}
+
+	return base + ext
+}
+
+// uniqueName returns name, or name with a number added, that isn't taken in a folder
+// ignoring case, and marks it taken
+func uniqueName(name string, taken map[string]bool) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	candidate := name
+	for i := 2; taken[strings.ToLower(candidate)]; i++ {
+		suffix := fmt.Sprintf("_%d", i)
+		if len(base)+len(suffix)+len(ext) > MaxNameLength {
+			base = base[:MaxNameLength-len(suffix)-len(ext)]
+		}
+		candidate = base + suffix + ext
+	}
+
+	taken[strings.ToLower(candidate)] = true
+	return candidate
+}
@@ -0,0 +1,418 @@
+package compliance
+
+import (
+	"bitbox-editor/internal/parsing/bitbox"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// Rename gives a file or folder a new name
+type Rename struct {
+	// Path is the absolute path of the file or folder
+	Path string
+	// Name is the new name, without a folder
+	Name string
+}
+
+// Renames returns the suggested renames of a report, one per file or folder
+func (r *Report) Renames() []Rename {
+	var renames []Rename
+	seen := make(map[string]bool)
+	for _, issue := range r.Issues {
+		if issue.Suggested == "" || seen[issue.Path] {
+			continue
+		}
+		seen[issue.Path] = true
+		renames = append(renames, Rename{Path: issue.Path, Name: issue.Suggested})
+	}
+	return renames
+}
+
+// checkReferences flags filenames in a preset.xml that the card can't hold
+func (r *Report) checkReferences(root, presetPath string) {
+	doc, err := readPreset(presetPath)
+	if err != nil {
+		log.Warn("Skipping unreadable preset", zap.String("path", presetPath), zap.Error(err))
+		return
+	}
+
+	for _, cell := range doc.Session.Cells {
+		ref := bitbox.NormalizeReference(cell.Filename)
+		if ref == "" {
+			continue
+		}
+
+		add := func(message string) {
+			r.Issues = append(r.Issues, Issue{Kind: BadReference, Path: presetPath, Message: message})
+		}
+
+		if problem := referenceProblem(ref); problem != "" {
+			add(fmt.Sprintf("'%s' %s", cell.Filename, problem))
+		}
+		if n := utf8.RuneCountInString(ref) + 1; n > MaxPathLength {
+			add(fmt.Sprintf("'%s' is %d characters, the limit is %d", cell.Filename, n, MaxPathLength))
+		}
+	}
+}
+
+// referenceProblem returns why a normalized filename can't point at a file on the card,
+// or an empty string
+func referenceProblem(ref string) string {
+	for _, part := range strings.Split(ref, "/") {
+		if part == ".." {
+			continue
+		}
+		if problem := nameProblem(part); problem != "" {
+			return fmt.Sprintf("has an invalid part '%s', %s", part, problem)
+		}
+	}
+	if !isASCII(ref) {
+		return "has characters the Bitbox can't display"
+	}
+	return ""
+}
+
+// Apply renames files and folders under root and updates the filename of every preset
+// cell that references them. Nothing is renamed if a preset under root can't be read,
+// and if a rename or a preset update fails the files and presets changed so far are put
+// back. Returns the number of presets updated.
+func Apply(root string, renames []Rename) (int, error) {
+	root = filepath.Clean(root)
+
+	newNames := make(map[string]string, len(renames))
+	for _, rename := range renames {
+		path := filepath.Clean(rename.Path)
+		rel, err := filepath.Rel(root, path)
+		if err != nil || !filepath.IsLocal(rel) {
+			return 0, fmt.Errorf("'%s' is not on the card", rename.Path)
+		}
+		if problem := nameProblem(rename.Name); problem != "" || strings.ContainsAny(rename.Name, `/\`) {
+			return 0, fmt.Errorf("can't rename '%s' to '%s'", filepath.Base(path), rename.Name)
+		}
+		newNames[path] = rename.Name
+	}
+
+	// renamed returns where a path ends up once every rename is done
+	renamed := func(path string) string {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || !filepath.IsLocal(rel) {
+			return path
+		}
+		oldPath, newPath := root, root
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			oldPath = filepath.Join(oldPath, part)
+			if name, ok := newNames[oldPath]; ok {
+				part = name
+			}
+			newPath = filepath.Join(newPath, part)
+		}
+		return newPath
+	}
+
+	// Work out the new filenames before renaming anything, references are resolved
+	// against the files as they are now
+	presets, err := findPresets(root)
+	if err != nil {
+		return 0, err
+	}
+
+	updates, err := relinkPresets(root, presets, renamed)
+	if err != nil {
+		return 0, err
+	}
+
+	// Deepest first so a folder's contents are renamed before the folder
+	paths := make([]string, 0, len(newNames))
+	for path := range newNames {
+		paths = append(paths, path)
+	}
+	slices.SortFunc(paths, func(a, b string) int {
+		return strings.Count(b, string(filepath.Separator)) - strings.Count(a, string(filepath.Separator))
+	})
+
+	// Renames done so far, undone in reverse order if a later step fails so presets never
+	// point at files that moved without them
+	type move struct{ from, to string }
+	var done []move
+	undo := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			if err := renameFile(done[i].to, done[i].from); err != nil {
+				log.Error("Failed to undo rename", zap.String("path", done[i].to), zap.Error(err))
+			}
+		}
+	}
+
+	for _, path := range paths {
+		to := filepath.Join(filepath.Dir(path), newNames[path])
+		if err := renameFile(path, to); err != nil {
+			undo()
+			return 0, err
+		}
+		done = append(done, move{from: path, to: to})
+	}
+
+	updated, err := patchPresets(updates, renamed)
+	if err != nil {
+		undo()
+		return 0, err
+	}
+
+	log.Info("Renamed files",
+		zap.String("root", root),
+		zap.Int("renamed", len(paths)),
+		zap.Int("presets", updated))
+
+	return updated, nil
+}
+
+// relinkPresets works out the new cell filenames of presets once files have moved to
+// where moved says, relative to where their folders end up. Returns a patch for each
+// preset that changes. Fails if any preset can't be read, since a file it uses could be
+// moved without the preset following it.
+func relinkPresets(root string, presets []string, moved func(path string) string) (map[string]*bitbox.Patch, error) {
+	updates := make(map[string]*bitbox.Patch)
+	var errs []error
+	for _, presetPath := range presets {
+		doc, err := readPreset(presetPath)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		patch := bitbox.NewPatch()
+		for i, cell := range doc.Session.Cells {
+			ref, ok := resolveReference(root, filepath.Dir(presetPath), cell.Filename)
+			if !ok {
+				continue
+			}
+
+			target := moved(ref.Path)
+			if target == ref.Path {
+				continue
+			}
+
+			rel, err := filepath.Rel(moved(ref.Dir), target)
+			if err != nil {
+				continue
+			}
+			patch.SetCellAttr(i, "filename", formatReference(cell.Filename, rel))
+		}
+		if !patch.Empty() {
+			updates[presetPath] = patch
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("can't update presets that fail to read: %w", errors.Join(errs...))
+	}
+	return updates, nil
+}
+
+// Relink points the preset cells under root that reference a file in targets at the
+// file it maps to instead, e.g. when copies of a sample are merged into one. The files
+// themselves are left alone. Nothing is changed if a preset under root can't be read or
+// updated. Returns the number of presets updated.
+func Relink(root string, targets map[string]string) (int, error) {
+	root = filepath.Clean(root)
+
+	presets, err := findPresets(root)
+	if err != nil {
+		return 0, err
+	}
+
+	updates, err := relinkPresets(root, presets, func(path string) string {
+		if target, ok := targets[path]; ok {
+			return target
+		}
+		return path
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	updated, err := patchPresets(updates, func(path string) string { return path })
+	if err != nil {
+		return 0, err
+	}
+
+	log.Info("Relinked presets", zap.String("root", root), zap.Int("presets", updated))
+
+	return updated, nil
+}
+
+// patchPresets applies patches to presets, each found where path says. Either every
+// preset is patched or, if one fails, the ones already patched are put back as they were.
+// Returns the number of presets patched.
+func patchPresets(updates map[string]*bitbox.Patch, path func(presetPath string) string) (int, error) {
+	type original struct {
+		path string
+		data []byte
+	}
+	var patched []original
+	restore := func() {
+		for _, o := range patched {
+			if err := writeFile(o.path, o.data); err != nil {
+				log.Error("Failed to restore preset", zap.String("path", o.path), zap.Error(err))
+			}
+		}
+	}
+
+	for presetPath, patch := range updates {
+		p := path(presetPath)
+		data, err := os.ReadFile(p)
+		if err != nil {
+			restore()
+			return 0, fmt.Errorf("failed to read '%s': %w", p, err)
+		}
+		if err := bitbox.PatchFile(p, patch); err != nil {
+			restore()
+			return 0, err
+		}
+		patched = append(patched, original{path: p, data: data})
+	}
+	return len(patched), nil
+}
+
+// References returns the presets under root that reference each file, by the file's
+// absolute path. If some presets can't be read, the references of the others are
+// returned along with an error naming them.
+func References(root string) (map[string][]string, error) {
+	root = filepath.Clean(root)
+
+	presets, err := findPresets(root)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make(map[string][]string)
+	var errs []error
+	for _, presetPath := range presets {
+		doc, err := readPreset(presetPath)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, cell := range doc.Session.Cells {
+			ref, ok := resolveReference(root, filepath.Dir(presetPath), cell.Filename)
+			if ok && !slices.Contains(refs[ref.Path], presetPath) {
+				refs[ref.Path] = append(refs[ref.Path], presetPath)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return refs, fmt.Errorf("%d presets couldn't be read: %w", len(errs), errors.Join(errs...))
+	}
+	return refs, nil
+}
+
+// renameFile renames a file or folder, refusing to replace another one. Case-only
+// renames go through a temporary name since a case-insensitive file system treats both
+// names as the same file.
+func renameFile(from, to string) error {
+	if from == to {
+		return nil
+	}
+
+	if strings.EqualFold(from, to) {
+		tmp := from + ".rename"
+		if err := os.Rename(from, tmp); err != nil {
+			return fmt.Errorf("failed to rename '%s': %w", from, err)
+		}
+		from = tmp
+	} else if _, err := os.Lstat(to); err == nil {
+		return fmt.Errorf("can't rename '%s', '%s' already exists", from, filepath.Base(to))
+	}
+
+	if err := os.Rename(from, to); err != nil {
+		return fmt.Errorf("failed to rename '%s': %w", from, err)
+	}
+	return nil
+}
+
+// findPresets returns the preset.xml files under root
+func findPresets(root string) ([]string, error) {
+	var presets []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != root {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && strings.EqualFold(d.Name(), "preset.xml") {
+			presets = append(presets, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find presets in '%s': %w", root, err)
+	}
+	return presets, nil
+}
+
+// readPreset parses a preset.xml
+func readPreset(path string) (*bitbox.Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+
+	var doc bitbox.Document
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %w", path, err)
+	}
+	if doc.Session == nil {
+		return nil, errors.New("preset has no session")
+	}
+	return &doc, nil
+}
+
+// writeFile writes a file through a temporary file, like saving from the editor
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write '%s': %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to replace '%s': %w", path, err)
+	}
+	return nil
+}
+
+// resolveReference finds the file under root a cell filename points at, the same way the
+// preset loader and card sync do
+func resolveReference(root, presetDir, filename string) (bitbox.Reference, bool) {
+	return bitbox.ResolveReference(root, presetDir, filename, func(path string) bool {
+		info, err := os.Stat(path)
+		return err == nil && !info.IsDir()
+	})
+}
+
+// formatReference writes a relative path in the style of the filename it replaces,
+// keeping its separators and leading separator
+func formatReference(original, rel string) string {
+	trimmed := strings.TrimSpace(original)
+	sep := "/"
+	if strings.Contains(trimmed, `\`) {
+		sep = `\`
+	}
+
+	ref := strings.ReplaceAll(filepath.ToSlash(rel), "/", sep)
+	if strings.HasPrefix(trimmed, "/") || strings.HasPrefix(trimmed, `\`) {
+		ref = sep + ref
+	}
+	return ref
+}
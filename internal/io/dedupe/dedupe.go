@@ -0,0 +1,337 @@
+// Package dedupe finds copies of the same sample on a card and merges them into one.
+//
+// Files are compared by their decoded audio rather than their bytes, so copies that
+// only differ in name or metadata chunks are exact duplicates. A fingerprint of the
+// shape of the sound also groups near duplicates, such as a sample converted to another
+// bit depth or sample rate, trimmed or normalized. Merging keeps one file, points every
+// preset that used another copy at it and deletes the other copies.
+package dedupe
+
+import (
+	"bitbox-editor/internal/io"
+	"bitbox-editor/internal/io/compliance"
+	"bitbox-editor/internal/logging"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+var log = logging.NewLogger("dedupe")
+
+// File is a copy of a sample
+type File struct {
+	// Path is the absolute path of the file
+	Path string
+	Size int64
+	// Presets are the preset.xml files that reference the file
+	Presets []string
+}
+
+// Group is a set of files holding the same sound
+type Group struct {
+	// Exact is true if every file has the same samples
+	Exact bool
+	Files []File
+}
+
+// Keep returns the index of the file to keep when merging the group: the one most
+// presets use, then the one with the shortest path
+func (g *Group) Keep() int {
+	keep := 0
+	for i, file := range g.Files[1:] {
+		best := g.Files[keep]
+		if len(file.Presets) > len(best.Presets) ||
+			len(file.Presets) == len(best.Presets) && len(file.Path) < len(best.Path) {
+			keep = i + 1
+		}
+	}
+	return keep
+}
+
+// Wasted returns the space the group takes beyond keeping one file
+func (g *Group) Wasted() int64 {
+	var total int64
+	for _, file := range g.Files {
+		total += file.Size
+	}
+	return total - g.Files[g.Keep()].Size
+}
+
+// Report lists the duplicates found on a card
+type Report struct {
+	Root   string
+	Groups []Group
+	// Scanned is the number of files compared, Failed the number that couldn't be read
+	Scanned int
+	Failed  int
+	// PresetsErr is set if some presets couldn't be read. The presets of each file are
+	// then incomplete and nothing can be merged until they are fixed.
+	PresetsErr error
+}
+
+// Wasted returns the space all groups take beyond keeping one file of each
+func (r *Report) Wasted() int64 {
+	var total int64
+	for i := range r.Groups {
+		total += r.Groups[i].Wasted()
+	}
+	return total
+}
+
+// ProgressFunc is told how many of the files were fingerprinted so far
+type ProgressFunc func(done, total int)
+
+// Scan finds duplicate samples among the WAV files of a tree along with the presets of
+// the tree's root that use each copy. progress may be nil.
+func Scan(tree *io.FSTree, progress ProgressFunc) (*Report, error) {
+	root := filepath.Clean(tree.Root.Path)
+
+	var paths []string
+	for _, file := range tree.GetAllFiles() {
+		if strings.EqualFold(filepath.Ext(file.Name), ".wav") && !strings.HasPrefix(file.Name, ".") {
+			paths = append(paths, file.Path)
+		}
+	}
+
+	fingerprints := fingerprintAll(paths, progress)
+
+	report := &Report{Root: root, Scanned: len(paths)}
+
+	// Exact duplicates share a hash, each set of them is then compared as one
+	byHash := make(map[[32]byte][]string)
+	var hashes [][32]byte
+	for _, path := range paths {
+		fp, ok := fingerprints[path]
+		if !ok {
+			report.Failed++
+			continue
+		}
+		if _, seen := byHash[fp.Hash]; !seen {
+			hashes = append(hashes, fp.Hash)
+		}
+		byHash[fp.Hash] = append(byHash[fp.Hash], path)
+	}
+
+	// Sorted by duration, only sounds of about the same length need comparing
+	slices.SortFunc(hashes, func(a, b [32]byte) int {
+		da, db := fingerprints[byHash[a][0]].Duration, fingerprints[byHash[b][0]].Duration
+		switch {
+		case da < db:
+			return -1
+		case da > db:
+			return 1
+		}
+		return 0
+	})
+
+	sets := newUnion(len(hashes))
+	for i, a := range hashes {
+		fa := fingerprints[byHash[a][0]]
+		if fa.Silent() {
+			continue
+		}
+		for j := i + 1; j < len(hashes); j++ {
+			fb := fingerprints[byHash[hashes[j]][0]]
+			if !closeDuration(fa.Duration, fb.Duration) {
+				break
+			}
+			if fa.Similar(fb) {
+				sets.join(i, j)
+			}
+		}
+	}
+
+	members := make(map[int][]int)
+	var order []int
+	for i := range hashes {
+		set := sets.find(i)
+		if _, ok := members[set]; !ok {
+			order = append(order, set)
+		}
+		members[set] = append(members[set], i)
+	}
+
+	refs, err := compliance.References(root)
+	if err != nil {
+		log.Warn("Failed to find preset references", zap.String("root", root), zap.Error(err))
+		report.PresetsErr = err
+	}
+
+	for _, set := range order {
+		var files []File
+		for _, i := range members[set] {
+			for _, path := range byHash[hashes[i]] {
+				file := File{Path: path, Presets: refs[path]}
+				if info, err := os.Stat(path); err == nil {
+					file.Size = info.Size()
+				}
+				files = append(files, file)
+			}
+		}
+		if len(files) < 2 {
+			continue
+		}
+
+		slices.SortFunc(files, func(a, b File) int {
+			return strings.Compare(a.Path, b.Path)
+		})
+		report.Groups = append(report.Groups, Group{Exact: len(members[set]) == 1, Files: files})
+	}
+
+	// Exact groups first, then the ones wasting the most space
+	slices.SortStableFunc(report.Groups, func(a, b Group) int {
+		if a.Exact != b.Exact {
+			if a.Exact {
+				return -1
+			}
+			return 1
+		}
+		wa, wb := a.Wasted(), b.Wasted()
+		switch {
+		case wa > wb:
+			return -1
+		case wa < wb:
+			return 1
+		}
+		return 0
+	})
+
+	log.Info("Found duplicate samples",
+		zap.String("root", root),
+		zap.Int("files", report.Scanned),
+		zap.Int("groups", len(report.Groups)),
+		zap.Int("failed", report.Failed))
+
+	return report, nil
+}
+
+// fingerprintAll fingerprints files in parallel, leaving out the ones that can't be read
+func fingerprintAll(paths []string, progress ProgressFunc) map[string]*Fingerprint {
+	var (
+		mu           sync.Mutex
+		wg           sync.WaitGroup
+		fingerprints = make(map[string]*Fingerprint, len(paths))
+		done         int
+		jobs         = make(chan string)
+	)
+
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				fp, err := FingerprintFile(path)
+				if err != nil {
+					log.Debug("Skipping unreadable sample", zap.String("path", path), zap.Error(err))
+				}
+
+				mu.Lock()
+				if err == nil {
+					fingerprints[path] = fp
+				}
+				done++
+				if progress != nil {
+					progress(done, len(paths))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, path := range paths {
+		jobs <- path
+	}
+	close(jobs)
+	wg.Wait()
+
+	return fingerprints
+}
+
+// Consolidate merges copies of a sample into keep: presets under root that use one of
+// the other copies are pointed at keep, then the copies are deleted. Nothing is deleted
+// if a preset under root can't be read, it could still use one of the copies. Returns
+// the number of presets updated.
+//
+// Only exact copies are safe to merge without asking: loop points, sample starts and
+// slices are positions in the file, and they land elsewhere in a near duplicate that
+// was trimmed or resampled.
+func Consolidate(root, keep string, remove []string) (int, error) {
+	root = filepath.Clean(root)
+	keep = filepath.Clean(keep)
+
+	onCard := func(path string) bool {
+		rel, err := filepath.Rel(root, path)
+		return err == nil && filepath.IsLocal(rel)
+	}
+	if !onCard(keep) {
+		return 0, fmt.Errorf("'%s' is not on the card", keep)
+	}
+	if _, err := os.Stat(keep); err != nil {
+		return 0, fmt.Errorf("can't keep '%s': %w", filepath.Base(keep), err)
+	}
+
+	targets := make(map[string]string, len(remove))
+	for _, path := range remove {
+		path = filepath.Clean(path)
+		if path == keep {
+			continue
+		}
+		if !onCard(path) {
+			return 0, fmt.Errorf("'%s' is not on the card", path)
+		}
+		targets[path] = keep
+	}
+	if len(targets) == 0 {
+		return 0, nil
+	}
+
+	// Presets are updated first, a copy is only deleted once nothing uses it
+	updated, err := compliance.Relink(root, targets)
+	if err != nil {
+		return updated, fmt.Errorf("nothing was deleted: %w", err)
+	}
+
+	var errs []error
+	for path := range targets {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("failed to delete '%s': %w", path, err))
+		}
+	}
+
+	log.Info("Consolidated duplicates",
+		zap.String("keep", keep),
+		zap.Int("removed", len(targets)-len(errs)),
+		zap.Int("presets", updated))
+
+	return updated, errors.Join(errs...)
+}
+
+// union groups indexes into sets
+type union []int
+
+func newUnion(n int) union {
+	u := make(union, n)
+	for i := range u {
+		u[i] = i
+	}
+	return u
+}
+
+func (u union) find(i int) int {
+	for u[i] != i {
+		u[i] = u[u[i]]
+		i = u[i]
+	}
+	return i
+}
+
+func (u union) join(a, b int) {
+	u[u.find(a)] = u.find(b)
+}
@@ -0,0 +1,215 @@
+package dedupe
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/gopxl/beep/v2/wav"
+)
+
+const (
+	// envelopeBins is how many parts a sound is split into to compare its shape
+	envelopeBins = 64
+	// silenceLevel is the level below which the start and end of a sound are trimmed
+	// before comparing, about -60 dBFS
+	silenceLevel = 0.001
+)
+
+// Fingerprint describes the audio of a file. Hash only matches files with the same
+// samples, the rest matches files that sound the same but were converted, trimmed or
+// gained differently.
+type Fingerprint struct {
+	// Hash is the hash of the decoded samples and their format, ignoring the rest of
+	// the file such as metadata chunks
+	Hash [sha256.Size]byte
+	// Duration is the length in seconds without leading and trailing silence
+	Duration float64
+	// Envelope is the loudness of each part of the sound, the loudest part being 1
+	Envelope []float32
+	// Crossings is the number of zero crossings per second in each part, a rough
+	// measure of pitch and brightness
+	Crossings []float32
+}
+
+// Silent returns true if the file has no sound to compare
+func (f *Fingerprint) Silent() bool {
+	return f.Duration == 0
+}
+
+// fingerprintCache holds fingerprints by path so unchanged files aren't decoded again
+var fingerprintCache sync.Map
+
+type cachedFingerprint struct {
+	size    int64
+	modTime int64
+	fp      *Fingerprint
+}
+
+// FingerprintFile returns the fingerprint of a WAV file
+func FingerprintFile(path string) (*Fingerprint, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+	if cached, ok := fingerprintCache.Load(path); ok {
+		c := cached.(cachedFingerprint)
+		if c.size == info.Size() && c.modTime == info.ModTime().UnixNano() {
+			return c.fp, nil
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open '%s': %w", path, err)
+	}
+	defer f.Close()
+
+	streamer, format, err := wav.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode '%s': %w", path, err)
+	}
+	defer streamer.Close()
+
+	numChannels := max(1, format.NumChannels)
+
+	hash := sha256.New()
+	var header [8]byte
+	binary.LittleEndian.PutUint32(header[0:], uint32(format.SampleRate))
+	binary.LittleEndian.PutUint32(header[4:], uint32(numChannels))
+	hash.Write(header[:])
+
+	// The sound mixed to mono, for the fingerprint
+	var mono []float32
+	buf := make([][2]float64, 4096)
+	raw := make([]byte, 0, len(buf)*2*4)
+	for {
+		n, ok := streamer.Stream(buf)
+		raw = raw[:0]
+		for i := 0; i < n; i++ {
+			raw = binary.LittleEndian.AppendUint32(raw, uint32(quantizeSample(buf[i][0])))
+			if numChannels > 1 {
+				raw = binary.LittleEndian.AppendUint32(raw, uint32(quantizeSample(buf[i][1])))
+				mono = append(mono, float32((buf[i][0]+buf[i][1])/2))
+			} else {
+				mono = append(mono, float32(buf[i][0]))
+			}
+		}
+		hash.Write(raw)
+		if !ok || n == 0 {
+			break
+		}
+	}
+	if err := streamer.Err(); err != nil {
+		return nil, fmt.Errorf("failed to decode '%s': %w", path, err)
+	}
+
+	fp := fingerprint(mono, int(format.SampleRate))
+	hash.Sum(fp.Hash[:0])
+
+	fingerprintCache.Store(path, cachedFingerprint{size: info.Size(), modTime: info.ModTime().UnixNano(), fp: fp})
+	return fp, nil
+}
+
+// quantizeSample turns a decoded sample back into an integer, 24 bits hold every bit
+// depth the Bitbox plays exactly
+func quantizeSample(v float64) int32 {
+	return int32(math.Round(max(-1, min(1, v)) * (1 << 23)))
+}
+
+// fingerprint measures the shape of a mono sound, leaving out the hash
+func fingerprint(mono []float32, sampleRate int) *Fingerprint {
+	fp := &Fingerprint{}
+
+	start, end := 0, len(mono)
+	for start < end && math.Abs(float64(mono[start])) < silenceLevel {
+		start++
+	}
+	for end > start && math.Abs(float64(mono[end-1])) < silenceLevel {
+		end--
+	}
+	if end-start < envelopeBins || sampleRate <= 0 {
+		return fp
+	}
+
+	sound := mono[start:end]
+	fp.Duration = float64(len(sound)) / float64(sampleRate)
+	fp.Envelope = make([]float32, envelopeBins)
+	fp.Crossings = make([]float32, envelopeBins)
+
+	var loudest float32
+	for bin := range envelopeBins {
+		from := bin * len(sound) / envelopeBins
+		to := (bin + 1) * len(sound) / envelopeBins
+
+		var sumSquares float64
+		crossings := 0
+		for i := from; i < to; i++ {
+			sumSquares += float64(sound[i]) * float64(sound[i])
+			if i > from && (sound[i-1] < 0) != (sound[i] < 0) {
+				crossings++
+			}
+		}
+
+		fp.Envelope[bin] = float32(math.Sqrt(sumSquares / float64(to-from)))
+		fp.Crossings[bin] = float32(float64(crossings) * float64(sampleRate) / float64(to-from))
+		loudest = max(loudest, fp.Envelope[bin])
+	}
+
+	if loudest > 0 {
+		for bin := range fp.Envelope {
+			fp.Envelope[bin] /= loudest
+		}
+	}
+	return fp
+}
+
+const (
+	// durationTolerance is how much longer one near duplicate may be than another, as
+	// a fraction and in seconds
+	durationTolerance        = 0.02
+	durationToleranceSeconds = 0.02
+	// envelopeTolerance is the average difference in loudness allowed between parts
+	envelopeTolerance = 0.05
+	// crossingsTolerance is the average relative difference in zero crossings allowed
+	// between parts
+	crossingsTolerance = 0.15
+)
+
+// closeDuration returns true if b is short enough to be a near duplicate of a, given a
+// is the shorter one
+func closeDuration(a, b float64) bool {
+	return b-a <= a*durationTolerance+durationToleranceSeconds
+}
+
+// Similar returns true if two fingerprints are likely the same sound
+func (f *Fingerprint) Similar(other *Fingerprint) bool {
+	if f.Hash == other.Hash {
+		return true
+	}
+	if f.Silent() || other.Silent() {
+		return false
+	}
+
+	short, long := f.Duration, other.Duration
+	if short > long {
+		short, long = long, short
+	}
+	if !closeDuration(short, long) {
+		return false
+	}
+
+	var envelope, crossings float64
+	for bin := range envelopeBins {
+		envelope += math.Abs(float64(f.Envelope[bin] - other.Envelope[bin]))
+
+		a, b := float64(f.Crossings[bin]), float64(other.Crossings[bin])
+		if a+b > 0 {
+			crossings += math.Abs(a-b) / max(a, b)
+		}
+	}
+	return envelope/envelopeBins <= envelopeTolerance && crossings/envelopeBins <= crossingsTolerance
+}
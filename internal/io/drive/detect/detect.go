@@ -2,12 +2,23 @@ package detect
 
 import (
 	"bitbox-editor/internal/logging"
+	"os"
+	"path/filepath"
 
 	"go.uber.org/zap"
 )
 
+// BitboxPresetsDir is the folder in the root of a Bitbox card holding the presets
+const BitboxPresetsDir = "Presets"
+
 var log *zap.Logger
 
 func init() {
 	log = logging.NewLogger("detect")
 }
+
+// IsBitboxCard returns true if the drive mounted at root looks like a Bitbox card
+func IsBitboxCard(root string) bool {
+	info, err := os.Stat(filepath.Join(root, BitboxPresetsDir))
+	return err == nil && info.IsDir()
+}
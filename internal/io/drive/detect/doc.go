@@ -1,5 +1,6 @@
 // Package detect (usbdrivedetector) detects all USB storage devices connected to a computer.
-// It currently works on OS X and Linux.
+// It currently works on OS X and Linux. On Linux mounts are read from /proc and sysfs,
+// so it also works in containers and finds cards in built-in SD readers.
 //
 // Source code and other details for the project are available at Github:
 //
@@ -0,0 +1,56 @@
+package detect
+
+import (
+	"fmt"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// volumesDir holds a mount point for every mounted volume
+const volumesDir = "/Volumes"
+
+// Watch returns a channel signalled whenever drives may have been mounted or unmounted,
+// until stop is closed. The first signal is sent immediately so the caller does its
+// initial scan.
+//
+// Volumes are mounted in their own folder under /Volumes, so watching it is enough.
+func Watch(stop <-chan struct{}) (<-chan struct{}, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch mounts: %w", err)
+	}
+	if err := watcher.Add(volumesDir); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch mounts: %w", err)
+	}
+
+	changes := make(chan struct{}, 1)
+	notify(changes)
+
+	go func() {
+		defer watcher.Close()
+		defer close(changes)
+
+		for {
+			select {
+			case <-stop:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Has(fsnotify.Create) || event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+					notify(changes)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Debug("Mount watcher error", zap.Error(err))
+			}
+		}
+	}()
+
+	return changes, nil
+}
@@ -0,0 +1,65 @@
+package detect
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// watchPollTimeout is how long a poll waits before checking whether the watch was
+// stopped, in milliseconds
+const watchPollTimeout = 500
+
+// Watch returns a channel signalled whenever drives may have been mounted or unmounted,
+// until stop is closed. The first signal is sent immediately so the caller does its
+// initial scan.
+//
+// The kernel flags the mount table with POLLPRI when it changes, so this needs neither
+// polling Detect nor a udev connection, and it works in containers.
+func Watch(stop <-chan struct{}) (<-chan struct{}, error) {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch mounts: %w", err)
+	}
+
+	changes := make(chan struct{}, 1)
+	notify(changes)
+
+	go func() {
+		defer f.Close()
+		defer close(changes)
+
+		fds := []unix.PollFd{{Fd: int32(f.Fd()), Events: unix.POLLPRI}}
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			n, err := unix.Poll(fds, watchPollTimeout)
+			if errors.Is(err, unix.EINTR) {
+				continue
+			}
+			if err != nil {
+				log.Error("Failed to watch mounts", zap.Error(err))
+				return
+			}
+			if n == 0 || fds[0].Revents&(unix.POLLPRI|unix.POLLERR) == 0 {
+				continue
+			}
+
+			// Read the table to the end so the next change is reported again
+			if _, err := f.Seek(0, io.SeekStart); err == nil {
+				_, _ = io.Copy(io.Discard, f)
+			}
+			notify(changes)
+		}
+	}()
+
+	return changes, nil
+}
@@ -0,0 +1,147 @@
+package detect
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// volumeSettleDelay is how long after a volume notification drives are checked again.
+// A volume is announced before the mount manager gives it a drive letter, so the first
+// scan can miss it.
+const volumeSettleDelay = time.Second
+
+const (
+	// cmNotifyFilterTypeDeviceInterface is CM_NOTIFY_FILTER_TYPE_DEVICEINTERFACE
+	cmNotifyFilterTypeDeviceInterface = 0
+	// crSuccess is the CONFIGRET of a successful call
+	crSuccess = 0
+)
+
+// guidDevInterfaceVolume is GUID_DEVINTERFACE_VOLUME, the device interface of volumes
+var guidDevInterfaceVolume = windows.GUID{
+	Data1: 0x53f5630d,
+	Data2: 0xb6bf,
+	Data3: 0x11d0,
+	Data4: [8]byte{0x94, 0xf2, 0x00, 0xa0, 0xc9, 0x1e, 0xfb, 0x8b},
+}
+
+var (
+	cfgmgr32                     = windows.NewLazySystemDLL("cfgmgr32.dll")
+	procCMRegisterNotification   = cfgmgr32.NewProc("CM_Register_Notification")
+	procCMUnregisterNotification = cfgmgr32.NewProc("CM_Unregister_Notification")
+)
+
+// cmNotifyFilter is CM_NOTIFY_FILTER for device interface notifications. The padding
+// covers the rest of the union, whose largest member is a 200 character instance ID.
+type cmNotifyFilter struct {
+	size       uint32
+	flags      uint32
+	filterType uint32
+	reserved   uint32
+	classGUID  windows.GUID
+	_          [400 - unsafe.Sizeof(windows.GUID{})]byte
+}
+
+var (
+	// volumeWatchers are the event channels of the running watches, by the context
+	// passed to CM_Register_Notification
+	volumeWatchers   = make(map[uintptr]chan struct{})
+	volumeWatchersMu sync.Mutex
+	nextVolumeWatch  uintptr
+
+	// volumeCallback is created once, Windows only has room for a limited number of
+	// callbacks per process
+	volumeCallback     uintptr
+	volumeCallbackOnce sync.Once
+)
+
+// onVolumeNotification is called by the configuration manager on one of its own threads
+// whenever a volume arrives or is removed
+func onVolumeNotification(_, context, _, _, _ uintptr) uintptr {
+	volumeWatchersMu.Lock()
+	events, ok := volumeWatchers[context]
+	volumeWatchersMu.Unlock()
+
+	if ok {
+		notify(events)
+	}
+	return uintptr(windows.ERROR_SUCCESS)
+}
+
+// Watch returns a channel signalled whenever drives may have been mounted or unmounted,
+// until stop is closed. The first signal is sent immediately so the caller does its
+// initial scan.
+//
+// The configuration manager notifies registered callbacks of volume arrivals and
+// removals, so this needs neither a window with a message loop nor polling Detect.
+// CM_Register_Notification needs Windows 8, on older versions an error is returned.
+func Watch(stop <-chan struct{}) (<-chan struct{}, error) {
+	if err := procCMRegisterNotification.Find(); err != nil {
+		return nil, fmt.Errorf("failed to watch mounts: %w", err)
+	}
+	volumeCallbackOnce.Do(func() {
+		volumeCallback = windows.NewCallback(onVolumeNotification)
+	})
+
+	events := make(chan struct{}, 1)
+
+	volumeWatchersMu.Lock()
+	nextVolumeWatch++
+	id := nextVolumeWatch
+	volumeWatchers[id] = events
+	volumeWatchersMu.Unlock()
+
+	removeWatcher := func() {
+		volumeWatchersMu.Lock()
+		delete(volumeWatchers, id)
+		volumeWatchersMu.Unlock()
+	}
+
+	filter := cmNotifyFilter{
+		filterType: cmNotifyFilterTypeDeviceInterface,
+		classGUID:  guidDevInterfaceVolume,
+	}
+	filter.size = uint32(unsafe.Sizeof(filter))
+
+	var notification uintptr
+	r, _, _ := procCMRegisterNotification.Call(
+		uintptr(unsafe.Pointer(&filter)),
+		id,
+		volumeCallback,
+		uintptr(unsafe.Pointer(&notification)),
+	)
+	if r != crSuccess {
+		removeWatcher()
+		return nil, fmt.Errorf("failed to watch mounts: CM_Register_Notification returned %d", r)
+	}
+
+	changes := make(chan struct{}, 1)
+	notify(changes)
+
+	go func() {
+		defer close(changes)
+		defer removeWatcher()
+		// Unregistering waits for callbacks that are running, so none arrive after it
+		defer procCMUnregisterNotification.Call(notification)
+
+		var settle <-chan time.Time
+		for {
+			select {
+			case <-stop:
+				return
+			case <-events:
+				notify(changes)
+				settle = time.After(volumeSettleDelay)
+			case <-settle:
+				settle = nil
+				notify(changes)
+			}
+		}
+	}()
+
+	return changes, nil
+}
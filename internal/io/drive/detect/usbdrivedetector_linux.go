@@ -2,65 +2,171 @@ package detect
 
 import (
 	"bufio"
-	"bytes"
 	"fmt"
 	"os"
-	"os/exec"
-	"regexp"
+	"path/filepath"
+	"strconv"
 	"strings"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// mountInfoPath lists the mounts seen by this process, including mounts in containers
+	mountInfoPath = "/proc/self/mountinfo"
+	// sysDevBlock links device numbers to their sysfs devices
+	sysDevBlock = "/sys/dev/block"
+	// sysBlock holds the attributes of whole disks
+	sysBlock = "/sys/block"
 )
 
+// mount is a mounted block device read from mountinfo
+type mount struct {
+	device     string
+	mountPoint string
+}
+
 // Detect returns a list of file paths pointing to the root folder of
 // USB storage devices connected to the system.
+//
+// Mounts are read from /proc/self/mountinfo and their disks are looked up in sysfs, so
+// no external tools are needed. A disk counts as removable when the kernel flags it as
+// removable, or when it sits on the USB bus or is an SD card, which covers built-in card
+// readers that report themselves as fixed.
 func Detect() ([]string, error) {
+	mounts, err := readMountInfo(mountInfoPath)
+	if err != nil {
+		return nil, err
+	}
+
 	var drives []string
-	driveMap := make(map[string]bool)
-	dfPattern := regexp.MustCompile("^(\\/[^ ]+)[^%]+%[ ]+(.+)$")
+	seen := make(map[string]bool)
+	for _, m := range mounts {
+		if seen[m.mountPoint] {
+			continue
+		}
+		if !isRemovable(m.device) {
+			continue
+		}
+		seen[m.mountPoint] = true
 
-	cmd := "df"
-	out, err := exec.Command(cmd).Output()
+		if _, err := os.Stat(m.mountPoint); err != nil {
+			log.Debug("Skipping unreadable mount", zap.String("path", m.mountPoint), zap.Error(err))
+			continue
+		}
+		drives = append(drives, m.mountPoint)
+	}
 
+	return drives, nil
+}
+
+// readMountInfo reads the block device mounts of a mountinfo file. Each line looks like
+//
+//	36 35 8:17 / /media/user/BITBOX rw,nosuid - vfat /dev/sdb1 rw,uid=1000
+//
+// with optional fields before the "-" separator.
+func readMountInfo(path string) ([]mount, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		log.Error(fmt.Sprintf("Error calling df: %s", err))
+		return nil, fmt.Errorf("failed to read mounts: %w", err)
 	}
+	defer f.Close()
 
-	s := bufio.NewScanner(bytes.NewReader(out))
+	var mounts []mount
+	s := bufio.NewScanner(f)
 	for s.Scan() {
-		line := s.Text()
-		if dfPattern.MatchString(line) {
-			device := dfPattern.FindStringSubmatch(line)[1]
-			rootPath := dfPattern.FindStringSubmatch(line)[2]
-
-			if ok := isUSBStorage(device); ok {
-				driveMap[rootPath] = true
+		fields := strings.Fields(s.Text())
+		sep := -1
+		for i, field := range fields {
+			if field == "-" {
+				sep = i
+				break
 			}
 		}
-	}
+		if sep < 6 || len(fields) < sep+3 {
+			continue
+		}
 
-	for k := range driveMap {
-		file, err := os.Open(k)
-		if err == nil {
-			drives = append(drives, k)
+		// Only whole filesystems, bind mounts of subdirectories are skipped
+		if fields[3] != "/" {
+			continue
 		}
-		file.Close()
+
+		mounts = append(mounts, mount{
+			device:     fields[2],
+			mountPoint: unescapeMountPath(fields[4]),
+		})
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read mounts: %w", err)
 	}
 
-	return drives, nil
+	return mounts, nil
 }
 
-func isUSBStorage(device string) bool {
-	deviceVerifier := "ID_USB_DRIVER=usb-storage"
-	cmd := "udevadm"
-	args := []string{"info", "-q", "property", "-n", device}
-	out, err := exec.Command(cmd, args...).Output()
+// unescapeMountPath decodes the octal escapes mountinfo uses for spaces, tabs,
+// newlines and backslashes in paths
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+4 <= len(path) {
+			if v, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
 
+// isRemovable returns true if the device number belongs to a removable disk or a
+// partition of one
+func isRemovable(device string) bool {
+	devPath, err := filepath.EvalSymlinks(filepath.Join(sysDevBlock, device))
 	if err != nil {
+		// Not a block device, e.g. tmpfs or a network share
 		return false
 	}
 
-	if strings.Contains(string(out), deviceVerifier) {
+	// Partitions live in the directory of their disk
+	disk := filepath.Base(devPath)
+	if _, err := os.Stat(filepath.Join(devPath, "partition")); err == nil {
+		disk = filepath.Base(filepath.Dir(devPath))
+	}
+
+	if readSysAttr(filepath.Join(sysBlock, disk, "removable")) == "1" {
 		return true
 	}
 
+	diskPath, err := filepath.EvalSymlinks(filepath.Join(sysBlock, disk))
+	if err != nil {
+		return false
+	}
+
+	if strings.Contains(diskPath, "/usb") {
+		return true
+	}
+
+	// SD cards in built-in readers report as fixed, eMMC boot storage is on the same bus
+	// so it is told apart by its type
+	if strings.HasPrefix(disk, "mmcblk") {
+		return readSysAttr(filepath.Join(sysBlock, disk, "device", "type")) == "SD"
+	}
+
 	return false
 }
+
+// readSysAttr returns the trimmed contents of a sysfs attribute, or "" if it can't be read
+func readSysAttr(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
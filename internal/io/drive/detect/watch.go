@@ -0,0 +1,37 @@
+package detect
+
+import "time"
+
+// notify signals a change without blocking, changes that arrive before the last one was
+// handled are coalesced
+func notify(changes chan<- struct{}) {
+	select {
+	case changes <- struct{}{}:
+	default:
+	}
+}
+
+// Poll returns a channel signalled every interval until stop is closed. It stands in
+// for Watch where the OS gives no mount notifications. The first signal is sent
+// immediately so the caller does its initial scan.
+func Poll(stop <-chan struct{}, interval time.Duration) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	notify(changes)
+
+	go func() {
+		defer close(changes)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				notify(changes)
+			}
+		}
+	}()
+
+	return changes
+}
@@ -0,0 +1,91 @@
+// Package space reports the capacity and free space of the drive holding a path, and
+// checks there is room before files are written to it.
+package space
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Reserve is kept free on top of what an operation needs, for file system metadata and
+// the temporary files written before they are renamed into place
+const Reserve uint64 = 1 << 20
+
+// Usage is the capacity of a drive
+type Usage struct {
+	Total uint64
+	// Free is the space available to the user, which may be less than the space unused
+	Free uint64
+}
+
+// Used returns the space in use
+func (u Usage) Used() uint64 {
+	if u.Free > u.Total {
+		return 0
+	}
+	return u.Total - u.Free
+}
+
+// InsufficientSpaceError is returned when an operation needs more space than is free
+type InsufficientSpaceError struct {
+	Path string
+	Need uint64
+	Free uint64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("not enough space on '%s': %s needed, %s free",
+		e.Path, FormatBytes(e.Need), FormatBytes(e.Free))
+}
+
+// Get returns the capacity of the drive holding path. A path that doesn't exist yet is
+// looked up through its closest existing parent.
+func Get(path string) (Usage, error) {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		path = parent
+	}
+
+	u, err := usage(path)
+	if err != nil {
+		return Usage{}, fmt.Errorf("failed to read free space of '%s': %w", path, err)
+	}
+	return u, nil
+}
+
+// Check returns an *InsufficientSpaceError if the drive holding path doesn't have need
+// bytes free, plus the reserve
+func Check(path string, need uint64) error {
+	if need == 0 {
+		return nil
+	}
+
+	u, err := Get(path)
+	if err != nil {
+		return err
+	}
+	if u.Free < need+Reserve {
+		return &InsufficientSpaceError{Path: path, Need: need, Free: u.Free}
+	}
+	return nil
+}
+
+// FormatBytes returns a byte count in a readable unit
+func FormatBytes(n uint64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
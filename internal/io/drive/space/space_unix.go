@@ -0,0 +1,18 @@
+//go:build !windows
+
+package space
+
+import "golang.org/x/sys/unix"
+
+func usage(path string) (Usage, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return Usage{}, err
+	}
+
+	bsize := uint64(st.Bsize)
+	return Usage{
+		Total: uint64(st.Blocks) * bsize,
+		Free:  uint64(st.Bavail) * bsize,
+	}, nil
+}
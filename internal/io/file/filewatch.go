@@ -3,49 +3,139 @@ package file
 import (
 	"bitbox-editor/internal/logging"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"go.uber.org/zap"
 )
 
-var FileWatch *fsnotify.Watcher
 var log *zap.Logger
 
-type FileWatchEventFunc func(event fsnotify.Event)
+// FileWatchEventFunc receives a batch of changes, one event per path with the operations
+// seen for it combined
+type FileWatchEventFunc func(events []fsnotify.Event)
 
 func init() {
 	log = logging.NewLogger("filewatch")
 }
 
-func WatchDir(dir string, function FileWatchEventFunc) {
-	FileWatch, _ = fsnotify.NewWatcher()
-	defer FileWatch.Close()
+// Watcher watches a folder and everything below it
+type Watcher struct {
+	watcher *fsnotify.Watcher
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// WatchDir watches dir and its subfolders, including ones created later, and calls
+// function with the changes once none arrived for the debounce delay. Hidden folders are
+// skipped. The watcher runs until Close is called.
+func WatchDir(dir string, debounce time.Duration, function FileWatchEventFunc) (*Watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch '%s': %w", dir, err)
+	}
+
+	w := &Watcher{watcher: fw, stop: make(chan struct{})}
+	if err := w.addTree(dir); err != nil {
+		fw.Close()
+		return nil, fmt.Errorf("failed to watch '%s': %w", dir, err)
+	}
+
+	log.Debug("Watching folder", zap.String("dir", dir))
+
+	go w.run(debounce, function)
+
+	return w, nil
+}
+
+// Close stops the watcher, pending changes are dropped
+func (w *Watcher) Close() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+}
+
+// run collects events until they settle and passes them on
+func (w *Watcher) run(debounce time.Duration, function FileWatchEventFunc) {
+	defer w.watcher.Close()
+
+	var (
+		pending = make(map[string]fsnotify.Op)
+		order   []string
+		timer   = time.NewTimer(debounce)
+	)
+	timer.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			timer.Stop()
+			return
 
-	log.Debug(fmt.Sprintf("Adding file watcher to: %s", dir))
-	err := filepath.Walk(dir, watchDir)
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+
+			// New folders need watching themselves, along with anything already moved
+			// into them
+			if event.Has(fsnotify.Create) && isDir(event.Name) {
+				if err := w.addTree(event.Name); err != nil {
+					log.Debug("Failed to watch new folder", zap.String("dir", event.Name), zap.Error(err))
+				}
+			}
 
-	done := make(chan bool)
+			if _, ok := pending[event.Name]; !ok {
+				order = append(order, event.Name)
+			}
+			pending[event.Name] |= event.Op
+			timer.Reset(debounce)
 
-	go func() {
-		for {
-			select {
-			case event := <-FileWatch.Events:
-				function(event)
-			case err = <-FileWatch.Errors:
-				log.Debug(fmt.Sprintf("[channel err]-> %s", err.Error()))
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
 			}
+			log.Debug("File watcher error", zap.Error(err))
+
+		case <-timer.C:
+			batch := make([]fsnotify.Event, 0, len(order))
+			for _, name := range order {
+				batch = append(batch, fsnotify.Event{Name: name, Op: pending[name]})
+			}
+			pending = make(map[string]fsnotify.Op)
+			order = nil
+
+			function(batch)
 		}
-	}()
+	}
+}
 
-	<-done
+// addTree adds a folder and its subfolders to the watcher
+func (w *Watcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// The folder may be gone again already
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return w.watcher.Add(path)
+	})
 }
 
-// watchDir gets run as a walk func, searching for directories to add watchers to
-func watchDir(path string, fi os.FileInfo, _ error) error {
-	if fi.Mode().IsDir() {
-		return FileWatch.Add(path)
-	}
-	return nil
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
 }
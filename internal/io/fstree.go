@@ -73,6 +73,8 @@ func (t *FSTree) findOrCreateParent(path string) *FSEntry {
 	return t.AddEntry(path, true, 0)
 }
 
+// ScanDirectory adds the files under rootPath with one of the extensions, ".wav" if none
+// are given. The extension "*" adds every file.
 func (t *FSTree) ScanDirectory(rootPath string, extensions ...string) error {
 	if len(extensions) == 0 {
 		extensions = []string{".wav"}
@@ -107,7 +109,7 @@ func (t *FSTree) ScanDirectory(rootPath string, extensions ...string) error {
 		}
 
 		ext := strings.ToLower(filepath.Ext(path))
-		if extMap[ext] {
+		if extMap[ext] || extMap["*"] {
 			t.AddEntry(path, false, info.Size())
 		}
 		return nil
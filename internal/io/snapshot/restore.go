@@ -0,0 +1,206 @@
+package snapshot
+
+import (
+	"bitbox-editor/internal/io/cardsync"
+	"bitbox-editor/internal/io/drive/space"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Restore writes presets of the snapshot back to the card at root, along with the
+// samples they reference. Files added to a preset since the snapshot are removed. With
+// no presets given the whole card is rolled back, including removing presets added
+// since. Returns the number of files written or removed.
+func (s *Snapshot) Restore(root string, presets []string) (int, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	var files, scopes []string
+	if len(presets) == 0 {
+		files = make([]string, 0, len(s.Files))
+		for p := range s.Files {
+			files = append(files, p)
+		}
+		scopes = []string{cardsync.PresetsDir}
+	} else {
+		for _, preset := range presets {
+			if _, ok := s.Files[preset+"/preset.xml"]; !ok {
+				return 0, fmt.Errorf("snapshot '%s' has no preset '%s'", s.ID, preset)
+			}
+			files = append(files, s.presetFiles(preset)...)
+			scopes = append(scopes, preset)
+		}
+	}
+	slices.Sort(files)
+	files = slices.Compact(files)
+
+	// Check the whole snapshot is readable before touching the card
+	for _, p := range files {
+		if !filepath.IsLocal(filepath.FromSlash(p)) {
+			return 0, fmt.Errorf("snapshot '%s' has an invalid path '%s'", s.ID, p)
+		}
+		if !hasObject(s.Files[p].Hash) {
+			return 0, fmt.Errorf("snapshot store is missing the contents of '%s'", p)
+		}
+	}
+
+	if err := s.checkSpace(root, files); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, p := range files {
+		written, err := restoreFile(root, p, s.Files[p])
+		if err != nil {
+			return count, err
+		}
+		if written {
+			count++
+		}
+	}
+
+	for _, scope := range scopes {
+		removed, err := s.removeExtra(root, scope)
+		count += removed
+		if err != nil {
+			return count, err
+		}
+	}
+
+	log.Info("Restored snapshot",
+		zap.String("id", s.ID),
+		zap.String("root", root),
+		zap.Strings("presets", presets),
+		zap.Int("files", count))
+
+	return count, nil
+}
+
+// checkSpace returns an error if the card doesn't have room for the files of a restore.
+// Replaced files only need the growth in size, plus room for the largest file since it is
+// written next to the file it replaces.
+func (s *Snapshot) checkSpace(root string, files []string) error {
+	var need, largest int64
+	for _, p := range files {
+		file := s.Files[p]
+		grow := file.Size
+		if info, err := os.Stat(filepath.Join(root, filepath.FromSlash(p))); err == nil {
+			grow -= info.Size()
+		}
+		need += max(grow, 0)
+		largest = max(largest, file.Size)
+	}
+	return space.Check(root, uint64(need+largest))
+}
+
+// restoreFile writes a file from the store unless the card already has it, returns true
+// if it was written
+func restoreFile(root, p string, file File) (bool, error) {
+	dst := filepath.Join(root, filepath.FromSlash(p))
+	if info, err := os.Stat(dst); err == nil && info.Size() == file.Size && info.ModTime().Equal(file.ModTime) {
+		return false, nil
+	}
+
+	in, err := openObject(file.Hash)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return false, fmt.Errorf("failed to create folder for '%s': %w", dst, err)
+	}
+
+	tmp := dst + tmpSuffix
+	out, err := os.Create(tmp)
+	if err != nil {
+		return false, fmt.Errorf("failed to write '%s': %w", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		_ = os.Remove(tmp)
+		return false, fmt.Errorf("failed to write '%s': %w", dst, err)
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return false, fmt.Errorf("failed to write '%s': %w", dst, err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return false, fmt.Errorf("failed to replace '%s': %w", dst, err)
+	}
+
+	if err := os.Chtimes(dst, file.ModTime, file.ModTime); err != nil {
+		log.Warn("Failed to restore modification time", zap.String("path", dst), zap.Error(err))
+	}
+
+	return true, nil
+}
+
+// removeExtra removes the files under a folder of the card that aren't in the snapshot,
+// then the folders left empty. Hidden files are left alone.
+func (s *Snapshot) removeExtra(root, scope string) (int, error) {
+	base := filepath.Join(root, filepath.FromSlash(scope))
+
+	var extra, dirs []string
+	err := filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			dirs = append(dirs, p)
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if _, ok := s.Files[filepath.ToSlash(rel)]; !ok {
+			extra = append(extra, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list '%s': %w", base, err)
+	}
+
+	removed := 0
+	for _, p := range extra {
+		if err := os.Remove(p); err != nil {
+			return removed, fmt.Errorf("failed to remove '%s': %w", p, err)
+		}
+		removed++
+	}
+
+	// Deepest first so parents are empty by the time they're reached, the presets
+	// folder itself always stays
+	slices.Reverse(dirs)
+	for _, dir := range dirs {
+		if dir == filepath.Join(root, cardsync.PresetsDir) {
+			continue
+		}
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) == 0 {
+			_ = os.Remove(dir)
+		}
+	}
+
+	return removed, nil
+}
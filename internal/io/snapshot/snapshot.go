@@ -0,0 +1,388 @@
+// Package snapshot takes point-in-time backups of a Bitbox card and restores them.
+//
+// A snapshot records every file under Presets/ along with the samples its presets
+// reference from elsewhere on the card. File contents are kept in a content-addressed
+// store in the config folder, so a file shared by several snapshots is stored once and
+// taking a snapshot of a mostly unchanged card only copies what changed.
+package snapshot
+
+import (
+	"bitbox-editor/internal/config"
+	"bitbox-editor/internal/io/cardsync"
+	"bitbox-editor/internal/io/drive/space"
+	"bitbox-editor/internal/logging"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var log = logging.NewLogger("snapshot")
+
+// manifestVersion is the version of the snapshot manifest format
+const manifestVersion = 1
+
+// File is a file recorded in a snapshot
+type File struct {
+	Hash    string    `json:"hash"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// Snapshot is the state of a card at a point in time
+type Snapshot struct {
+	Version int       `json:"version"`
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Label   string    `json:"label"`
+	// Root is the folder the snapshot was taken of
+	Root string `json:"root"`
+	// Files maps paths relative to the root, using forward slashes, to their contents
+	Files map[string]File `json:"files"`
+	// References maps each preset.xml to the files outside Presets/ it references
+	References map[string][]string `json:"references"`
+	// Size is the total size of the files
+	Size int64 `json:"size"`
+	// ChangedPresets is the number of presets added, changed or removed since the
+	// previous snapshot of the same root
+	ChangedPresets int `json:"changed_presets"`
+}
+
+// Dir returns the folder holding the snapshots
+func Dir() string {
+	return filepath.Join(config.Dir(), "snapshots")
+}
+
+func manifestDir() string {
+	return filepath.Join(Dir(), "manifests")
+}
+
+func manifestPath(id string) string {
+	return filepath.Join(manifestDir(), id+".json")
+}
+
+// Presets returns the folders of the presets in the snapshot, sorted
+func (s *Snapshot) Presets() []string {
+	var presets []string
+	for p := range s.Files {
+		if cardsync.IsPresetFile(p) {
+			presets = append(presets, path.Dir(p))
+		}
+	}
+	slices.Sort(presets)
+	return presets
+}
+
+// presetFiles returns the files of a preset folder and the files it references
+func (s *Snapshot) presetFiles(preset string) []string {
+	var files []string
+	for p := range s.Files {
+		if strings.HasPrefix(p, preset+"/") {
+			files = append(files, p)
+		}
+	}
+	for _, ref := range s.References[preset+"/preset.xml"] {
+		if _, ok := s.Files[ref]; ok {
+			files = append(files, ref)
+		}
+	}
+	slices.Sort(files)
+	return slices.Compact(files)
+}
+
+// presetDigest returns a hash of the contents of a preset and its references, equal
+// digests mean the preset didn't change
+func (s *Snapshot) presetDigest(preset string) string {
+	h := sha256.New()
+	for _, p := range s.presetFiles(preset) {
+		fmt.Fprintf(h, "%s\x00%s\n", p, s.Files[p].Hash)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// countChangedPresets returns the number of presets that differ between two snapshots
+func countChangedPresets(prev, cur *Snapshot) int {
+	if prev == nil {
+		return len(cur.Presets())
+	}
+
+	changed := 0
+	seen := make(map[string]bool)
+	for _, preset := range cur.Presets() {
+		seen[preset] = true
+		if _, ok := prev.Files[preset+"/preset.xml"]; !ok || prev.presetDigest(preset) != cur.presetDigest(preset) {
+			changed++
+		}
+	}
+	for _, preset := range prev.Presets() {
+		if !seen[preset] {
+			changed++
+		}
+	}
+	return changed
+}
+
+// Create takes a snapshot of the card at root
+func Create(root, label string) (*Snapshot, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	root = filepath.Clean(root)
+
+	files, err := cardsync.Files(root)
+	if err != nil {
+		return nil, err
+	}
+
+	prev, err := latest(root)
+	if err != nil {
+		log.Warn("Failed to read previous snapshot", zap.String("root", root), zap.Error(err))
+	}
+
+	created := time.Now()
+	snap := &Snapshot{
+		Version:    manifestVersion,
+		ID:         newID(created),
+		Created:    created,
+		Label:      label,
+		Root:       root,
+		Files:      make(map[string]File, len(files)),
+		References: make(map[string][]string),
+	}
+
+	// Files unchanged since the previous snapshot are already stored, the rest may need
+	// room in the store
+	var need uint64
+	for _, p := range files {
+		full := filepath.Join(root, filepath.FromSlash(p))
+		info, err := os.Stat(full)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", full, err)
+		}
+
+		file := File{Size: info.Size(), ModTime: info.ModTime()}
+		if old, ok := prev.file(p); ok && old.Size == file.Size && old.ModTime.Equal(file.ModTime) && hasObject(old.Hash) {
+			file.Hash = old.Hash
+		} else {
+			need += uint64(file.Size)
+		}
+		snap.Files[p] = file
+	}
+
+	if err := space.Check(Dir(), need); err != nil {
+		return nil, err
+	}
+
+	for _, p := range files {
+		file := snap.Files[p]
+		if file.Hash == "" {
+			var err error
+			if file.Hash, err = putObject(filepath.Join(root, filepath.FromSlash(p))); err != nil {
+				return nil, err
+			}
+			snap.Files[p] = file
+		}
+
+		snap.Size += file.Size
+
+		if cardsync.IsPresetFile(p) {
+			refs, err := cardsync.References(root, p)
+			if err != nil {
+				log.Warn("Skipping references of unreadable preset", zap.String("preset", p), zap.Error(err))
+			} else if len(refs) > 0 {
+				snap.References[p] = refs
+			}
+		}
+	}
+
+	snap.ChangedPresets = countChangedPresets(prev, snap)
+
+	if err := snap.save(); err != nil {
+		return nil, err
+	}
+
+	log.Info("Took snapshot",
+		zap.String("id", snap.ID),
+		zap.String("root", root),
+		zap.Int("files", len(snap.Files)),
+		zap.Int("changed_presets", snap.ChangedPresets))
+
+	return snap, nil
+}
+
+// file returns a file of the snapshot, a nil snapshot has none
+func (s *Snapshot) file(p string) (File, bool) {
+	if s == nil {
+		return File{}, false
+	}
+	f, ok := s.Files[p]
+	return f, ok
+}
+
+// newID returns an id sortable by creation time that isn't taken yet
+func newID(created time.Time) string {
+	base := created.Format("20060102-150405")
+	id := base
+	for i := 2; ; i++ {
+		if _, err := os.Stat(manifestPath(id)); errors.Is(err, fs.ErrNotExist) {
+			return id
+		}
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// save writes the manifest of a snapshot
+func (s *Snapshot) save() error {
+	if err := os.MkdirAll(manifestDir(), 0750); err != nil {
+		return fmt.Errorf("failed to create snapshot folder: %w", err)
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	p := manifestPath(s.ID)
+	if err := os.WriteFile(p+tmpSuffix, data, 0644); err != nil {
+		return fmt.Errorf("failed to write snapshot '%s': %w", p, err)
+	}
+	if err := os.Rename(p+tmpSuffix, p); err != nil {
+		_ = os.Remove(p + tmpSuffix)
+		return fmt.Errorf("failed to write snapshot '%s': %w", p, err)
+	}
+	return nil
+}
+
+// Load reads a snapshot by id
+func Load(id string) (*Snapshot, error) {
+	data, err := os.ReadFile(manifestPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot '%s': %w", id, err)
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot '%s': %w", id, err)
+	}
+	if snap.Version > manifestVersion {
+		return nil, fmt.Errorf("snapshot '%s' was written by a newer version", id)
+	}
+	return &snap, nil
+}
+
+// List returns all snapshots, newest first. Unreadable snapshots are skipped.
+func List() ([]*Snapshot, error) {
+	entries, err := os.ReadDir(manifestDir())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	var snaps []*Snapshot
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		snap, err := Load(id)
+		if err != nil {
+			log.Warn("Skipping snapshot", zap.String("id", id), zap.Error(err))
+			continue
+		}
+		snaps = append(snaps, snap)
+	}
+
+	slices.SortFunc(snaps, func(a, b *Snapshot) int {
+		return b.Created.Compare(a.Created)
+	})
+
+	return snaps, nil
+}
+
+// latest returns the newest snapshot of a root, or nil if there is none
+func latest(root string) (*Snapshot, error) {
+	snaps, err := List()
+	if err != nil {
+		return nil, err
+	}
+	for _, snap := range snaps {
+		if snap.Root == root {
+			return snap, nil
+		}
+	}
+	return nil, nil
+}
+
+// Delete removes a snapshot and the stored files no other snapshot uses
+func Delete(id string) error {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	if err := os.Remove(manifestPath(id)); err != nil {
+		return fmt.Errorf("failed to delete snapshot '%s': %w", id, err)
+	}
+
+	used, err := usedObjects()
+	if err != nil {
+		return fmt.Errorf("deleted snapshot '%s' but kept its stored files: %w", id, err)
+	}
+
+	removed, err := pruneObjects(used)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Deleted snapshot", zap.String("id", id), zap.Int("pruned", removed))
+	return nil
+}
+
+// usedObjects returns the hashes of the contents every manifest uses. Unlike List it
+// fails on a manifest it can't read, the contents it uses are unknown and must be kept.
+func usedObjects() (map[string]bool, error) {
+	used := make(map[string]bool)
+
+	entries, err := os.ReadDir(manifestDir())
+	if errors.Is(err, fs.ErrNotExist) {
+		return used, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		p := filepath.Join(manifestDir(), entry.Name())
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot '%s': %w", p, err)
+		}
+
+		// Only the files are needed, a manifest of a newer version still uses its contents
+		var snap struct {
+			Files map[string]File `json:"files"`
+		}
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return nil, fmt.Errorf("failed to parse snapshot '%s': %w", p, err)
+		}
+		for _, f := range snap.Files {
+			used[f.Hash] = true
+		}
+	}
+	return used, nil
+}
@@ -0,0 +1,147 @@
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// tmpSuffix marks files being written, they are renamed into place once complete
+const tmpSuffix = ".tmp"
+
+// storeMu is held while snapshots are taken, restored or deleted, so a prune never
+// removes contents that a snapshot being taken has just stored or one being restored
+// still reads
+var storeMu sync.Mutex
+
+func objectDir() string {
+	return filepath.Join(Dir(), "objects")
+}
+
+// objectPath returns where the contents with a hash are stored
+func objectPath(hash string) string {
+	return filepath.Join(objectDir(), hash[:2], hash)
+}
+
+// hasObject returns true if contents with a hash are stored
+func hasObject(hash string) bool {
+	if len(hash) < 2 {
+		return false
+	}
+	_, err := os.Stat(objectPath(hash))
+	return err == nil
+}
+
+// putObject stores the contents of a file and returns their hash. Contents already
+// stored aren't written twice.
+func putObject(src string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to read '%s': %w", src, err)
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(objectDir(), 0750); err != nil {
+		return "", fmt.Errorf("failed to create snapshot store: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(objectDir(), "object-*"+tmpSuffix)
+	if err != nil {
+		return "", fmt.Errorf("failed to write to snapshot store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), in); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to store '%s': %w", src, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to store '%s': %w", src, err)
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	if hasObject(hash) {
+		return hash, nil
+	}
+
+	dst := objectPath(hash)
+	if err := os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return "", fmt.Errorf("failed to create snapshot store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return "", fmt.Errorf("failed to store '%s': %w", src, err)
+	}
+
+	return hash, nil
+}
+
+// openObject opens stored contents by hash
+func openObject(hash string) (*os.File, error) {
+	if len(hash) < 2 {
+		return nil, fmt.Errorf("invalid hash '%s'", hash)
+	}
+	f, err := os.Open(objectPath(hash))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot store is missing '%s': %w", hash, err)
+	}
+	return f, nil
+}
+
+// pruneObjects removes stored contents that aren't used and returns how many were removed
+func pruneObjects(used map[string]bool) (int, error) {
+	removed := 0
+	err := filepath.WalkDir(objectDir(), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(d.Name(), tmpSuffix) || used[d.Name()] {
+			return nil
+		}
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("failed to prune snapshot store: %w", err)
+	}
+	return removed, nil
+}
+
+// Usage returns the disk space taken by the stored contents of all snapshots
+func Usage() (int64, error) {
+	var total int64
+	err := filepath.WalkDir(objectDir(), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read snapshot store: %w", err)
+	}
+	return total, nil
+}
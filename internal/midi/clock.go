@@ -0,0 +1,226 @@
+package midi
+
+import (
+	"bitbox-editor/internal/app/eventbus"
+	"bitbox-editor/internal/app/events"
+	"bitbox-editor/internal/audio"
+	"math"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// ClockPPQN is the number of MIDI clock ticks per quarter note
+	ClockPPQN = 24
+	// ticksPerSongPosition is the number of clock ticks in one song position pointer unit (a 16th note)
+	ticksPerSongPosition = ClockPPQN / 4
+	// clockTimeout is how long the clock may be silent before the tempo is dropped
+	clockTimeout = time.Second
+	// tempoChangeThreshold is the smallest tempo change published, filtering clock jitter
+	tempoChangeThreshold = 0.1
+)
+
+// ClockSync follows the MIDI clock, start/stop and song position pointer of the input
+// port. It measures the tempo from the clock ticks and keeps loop previews in time with it.
+type ClockSync struct {
+	appBus       *eventbus.EventBus
+	audioManager *audio.AudioManager
+
+	mu       sync.Mutex
+	running  bool
+	ticks    int64
+	haveTick bool
+	// lastSeen is when the last tick arrived
+	lastSeen  time.Time
+	intervals []float64
+	tempo     float64
+}
+
+var globalClockSync *ClockSync
+
+func init() {
+	globalClockSync = NewClockSync(GetMidiManager(), eventbus.Bus, audio.GetAudioManager())
+}
+
+// GetClockSync returns the clock sync listening to the MIDI input
+func GetClockSync() *ClockSync {
+	return globalClockSync
+}
+
+// NewClockSync creates a clock sync following the clock messages received by m. It is
+// the manager's clock listener rather than a bus subscriber, so no tick is dropped when
+// the bus is busy. Changes in tempo and transport are published to appBus and applied to
+// the audio manager's loop previews.
+func NewClockSync(m *MidiManager, appBus *eventbus.EventBus, am *audio.AudioManager) *ClockSync {
+	cs := &ClockSync{
+		appBus:       appBus,
+		audioManager: am,
+		intervals:    make([]float64, 0, ClockPPQN),
+	}
+
+	m.SetClockListener(cs.handle)
+	go cs.run()
+
+	return cs
+}
+
+// Tempo returns the measured clock tempo in BPM, or 0 if no clock is being received
+func (cs *ClockSync) Tempo() float64 {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if time.Since(cs.lastSeen) > clockTimeout {
+		return 0
+	}
+	return cs.tempo
+}
+
+// IsRunning returns true between a start or continue and a stop
+func (cs *ClockSync) IsRunning() bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.running
+}
+
+// Position returns the song position in beats
+func (cs *ClockSync) Position() float64 {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return float64(cs.ticks) / ClockPPQN
+}
+
+func (cs *ClockSync) run() {
+	timeout := time.NewTicker(clockTimeout / 2)
+	defer timeout.Stop()
+
+	for range timeout.C {
+		cs.checkTimeout()
+	}
+}
+
+func (cs *ClockSync) handle(msg events.MidiEventRecord) {
+	switch msg.EventType {
+	case events.MidiClockEvent:
+		// Driver timestamps are rounded to the millisecond, which skews a tempo measured
+		// from them, so ticks are timed by when the driver callback received them
+		cs.tick(msg.Received)
+
+	case events.MidiStartEvent:
+		cs.mu.Lock()
+		cs.running = true
+		cs.ticks = 0
+		cs.mu.Unlock()
+
+		cs.audioManager.ClockStarted()
+		cs.publish(events.MidiClockStartedEvent)
+
+	case events.MidiContinueEvent:
+		cs.mu.Lock()
+		cs.running = true
+		cs.mu.Unlock()
+
+		cs.publish(events.MidiClockStartedEvent)
+
+	case events.MidiStopEvent:
+		cs.mu.Lock()
+		cs.running = false
+		cs.mu.Unlock()
+
+		cs.publish(events.MidiClockStoppedEvent)
+
+	case events.MidiSongPositionEvent:
+		cs.mu.Lock()
+		cs.ticks = int64(msg.Value14) * ticksPerSongPosition
+		cs.mu.Unlock()
+
+		cs.publish(events.MidiClockPositionEvent)
+	}
+}
+
+// tick measures the tempo from the time between clock ticks and counts beats while running
+func (cs *ClockSync) tick(now time.Time) {
+	cs.mu.Lock()
+
+	if cs.haveTick {
+		interval := float64(now.Sub(cs.lastSeen)) / float64(time.Millisecond)
+		if interval > 0 {
+			if len(cs.intervals) == ClockPPQN {
+				cs.intervals = cs.intervals[1:]
+			}
+			cs.intervals = append(cs.intervals, interval)
+		}
+	}
+	cs.haveTick = true
+	cs.lastSeen = now
+
+	tempoChanged := false
+	if len(cs.intervals) == ClockPPQN {
+		// Average over a full beat to smooth out the jitter of single ticks
+		var total float64
+		for _, interval := range cs.intervals {
+			total += interval
+		}
+		tempo := 60000 / total
+		if math.Abs(tempo-cs.tempo) >= tempoChangeThreshold {
+			cs.tempo = tempo
+			tempoChanged = true
+		}
+	}
+	tempo := cs.tempo
+
+	beat := int64(-1)
+	if cs.running {
+		if cs.ticks%ClockPPQN == 0 {
+			beat = cs.ticks / ClockPPQN
+		}
+		cs.ticks++
+	}
+
+	cs.mu.Unlock()
+
+	if tempoChanged {
+		cs.audioManager.SetExternalTempo(tempo)
+		cs.publish(events.MidiClockTempoEvent)
+	}
+	if beat >= 0 {
+		cs.audioManager.ClockBeat(beat)
+	}
+}
+
+// checkTimeout drops the tempo when the clock stops arriving, e.g. the port was closed
+func (cs *ClockSync) checkTimeout() {
+	cs.mu.Lock()
+	timedOut := cs.haveTick && time.Since(cs.lastSeen) > clockTimeout
+	if timedOut {
+		cs.haveTick = false
+		cs.running = false
+		cs.tempo = 0
+		cs.intervals = cs.intervals[:0]
+	}
+	cs.mu.Unlock()
+
+	if timedOut {
+		log.Info("MIDI clock lost")
+		cs.audioManager.SetExternalTempo(0)
+		cs.publish(events.MidiClockTempoEvent)
+	}
+}
+
+func (cs *ClockSync) publish(eventType events.MidiClockEventType) {
+	cs.mu.Lock()
+	record := events.MidiClockEventRecord{
+		EventType: eventType,
+		Tempo:     cs.tempo,
+		Beat:      float64(cs.ticks) / ClockPPQN,
+		Running:   cs.running,
+	}
+	cs.mu.Unlock()
+
+	if eventType == events.MidiClockTempoEvent {
+		log.Debug("MIDI clock tempo", zap.Float64("bpm", record.Tempo))
+	}
+
+	cs.appBus.Publish(record)
+}
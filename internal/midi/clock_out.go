@@ -0,0 +1,126 @@
+package midi
+
+import (
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// defaultClockTempo is the tempo the clock is sent at until a preset sets one
+const defaultClockTempo = 120.0
+
+// clockSender sends MIDI clock to the output port at a tempo
+type clockSender struct {
+	bpm   float64
+	tempo chan float64
+	stop  chan struct{}
+}
+
+// StartClock starts sending MIDI clock to the output port at bpm. The clock keeps running
+// while ports are changed, ticks are dropped while no output port is open.
+func (m *MidiManager) StartClock(bpm float64) {
+	m.clockMu.Lock()
+	defer m.clockMu.Unlock()
+
+	if m.clock != nil {
+		m.setClockTempo(bpm)
+		return
+	}
+
+	m.clock = &clockSender{
+		bpm:   bpm,
+		tempo: make(chan float64, 1),
+		stop:  make(chan struct{}),
+	}
+	go m.sendClock(m.clock, bpm)
+}
+
+// StopClock stops sending MIDI clock
+func (m *MidiManager) StopClock() {
+	m.clockMu.Lock()
+	defer m.clockMu.Unlock()
+
+	if m.clock != nil {
+		close(m.clock.stop)
+		m.clock = nil
+	}
+}
+
+// SetClockTempo changes the tempo of the clock sent to the output port
+func (m *MidiManager) SetClockTempo(bpm float64) {
+	m.clockMu.Lock()
+	defer m.clockMu.Unlock()
+
+	if m.clock != nil {
+		m.setClockTempo(bpm)
+	}
+}
+
+// setClockTempo hands a new tempo to the clock goroutine, the caller must hold clockMu
+func (m *MidiManager) setClockTempo(bpm float64) {
+	if bpm == m.clock.bpm {
+		return
+	}
+	m.clock.bpm = bpm
+
+	// Only the latest tempo matters
+	select {
+	case <-m.clock.tempo:
+	default:
+	}
+	m.clock.tempo <- bpm
+}
+
+// IsSendingClock returns true while clock is sent to the output port
+func (m *MidiManager) IsSendingClock() bool {
+	m.clockMu.Lock()
+	defer m.clockMu.Unlock()
+	return m.clock != nil
+}
+
+// SendStart sends a start message so followers play from the beginning
+func (m *MidiManager) SendStart() error {
+	return m.Send(midi.Start())
+}
+
+// SendStop sends a stop message
+func (m *MidiManager) SendStop() error {
+	return m.Send(midi.Stop())
+}
+
+// sendClock sends clock ticks until the sender is stopped
+func (m *MidiManager) sendClock(clock *clockSender, bpm float64) {
+	interval := clockInterval(bpm)
+	next := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-clock.stop:
+			return
+
+		case bpm := <-clock.tempo:
+			interval = clockInterval(bpm)
+
+		case <-timer.C:
+			// Errors are expected while no output port is open
+			_ = m.Send(midi.TimingClock())
+
+			// Schedule from the ideal time rather than now so the tempo does not drift
+			next = next.Add(interval)
+			if behind := time.Since(next); behind > interval {
+				next = time.Now()
+			}
+			timer.Reset(time.Until(next))
+		}
+	}
+}
+
+// clockInterval returns the time between clock ticks at a tempo
+func clockInterval(bpm float64) time.Duration {
+	if bpm <= 0 {
+		bpm = defaultClockTempo
+	}
+	return time.Duration(float64(time.Minute) / (bpm * ClockPPQN))
+}
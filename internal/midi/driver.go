@@ -0,0 +1,43 @@
+package midi
+
+import (
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// Driver provides the MIDI ports used by the MidiManager. The system driver talks to the
+// real MIDI devices, the loopback driver keeps everything in memory for development.
+type Driver interface {
+	// Name identifies the driver in the config, e.g. "system"
+	Name() string
+	// InPorts returns the names of the input ports
+	InPorts() []string
+	// OutPorts returns the names of the output ports
+	OutPorts() []string
+	// Listen delivers the messages of an input port to recv until stop is called
+	Listen(port string, recv func(msg midi.Message, timestampms int32)) (stop func(), err error)
+	// OpenOut opens an output port
+	OpenOut(port string) (OutPort, error)
+	// Close closes every port of the driver
+	Close() error
+}
+
+// OutPort is an open output port of a driver
+type OutPort interface {
+	Send(msg midi.Message) error
+	Close() error
+	String() string
+}
+
+// Driver names
+const (
+	DriverSystem   = "system"
+	DriverLoopback = "loopback"
+)
+
+// NewDriver creates a driver by name, unknown names get the system driver
+func NewDriver(name string) Driver {
+	if name == DriverLoopback {
+		return NewLoopbackDriver()
+	}
+	return NewSystemDriver()
+}
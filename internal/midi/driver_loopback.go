@@ -0,0 +1,139 @@
+package midi
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// DefaultLoopbackPort is the port of a loopback driver created without port names
+const DefaultLoopbackPort = "Loopback"
+
+// LoopbackDriver is an in-memory driver for development and for exercising the MIDI
+// routing without hardware. Every output port is looped back to the input port of the
+// same name, and messages can be injected into input ports directly.
+type LoopbackDriver struct {
+	mu        sync.Mutex
+	ports     []string
+	listeners map[string][]*loopbackListener
+	start     time.Time
+	nextID    int
+}
+
+// loopbackListener is a listener registered on a loopback input port
+type loopbackListener struct {
+	id   int
+	recv func(msg midi.Message, timestampms int32)
+}
+
+// NewLoopbackDriver creates a loopback driver with the given ports
+func NewLoopbackDriver(ports ...string) *LoopbackDriver {
+	if len(ports) == 0 {
+		ports = []string{DefaultLoopbackPort}
+	}
+
+	return &LoopbackDriver{
+		ports:     ports,
+		listeners: make(map[string][]*loopbackListener),
+		start:     time.Now(),
+	}
+}
+
+func (d *LoopbackDriver) Name() string {
+	return DriverLoopback
+}
+
+func (d *LoopbackDriver) InPorts() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.ports)
+}
+
+func (d *LoopbackDriver) OutPorts() []string {
+	return d.InPorts()
+}
+
+// Listen registers recv to receive the messages sent or injected into a port
+func (d *LoopbackDriver) Listen(port string, recv func(msg midi.Message, timestampms int32)) (func(), error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !slices.Contains(d.ports, port) {
+		return nil, fmt.Errorf("could not find MIDI port '%s'", port)
+	}
+
+	d.nextID++
+	listener := &loopbackListener{id: d.nextID, recv: recv}
+	d.listeners[port] = append(d.listeners[port], listener)
+
+	stop := func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		d.listeners[port] = slices.DeleteFunc(d.listeners[port], func(l *loopbackListener) bool {
+			return l.id == listener.id
+		})
+	}
+
+	return stop, nil
+}
+
+func (d *LoopbackDriver) OpenOut(port string) (OutPort, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !slices.Contains(d.ports, port) {
+		return nil, fmt.Errorf("could not find MIDI output port '%s'", port)
+	}
+
+	return &loopbackOutPort{driver: d, port: port}, nil
+}
+
+func (d *LoopbackDriver) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	clear(d.listeners)
+	return nil
+}
+
+// Inject delivers a message to the listeners of an input port as if a device had sent
+// it. Listeners are called synchronously and in order, so injected sequences are
+// deterministic.
+func (d *LoopbackDriver) Inject(port string, msg midi.Message, timestampms int32) error {
+	d.mu.Lock()
+	if !slices.Contains(d.ports, port) {
+		d.mu.Unlock()
+		return fmt.Errorf("could not find MIDI port '%s'", port)
+	}
+	listeners := slices.Clone(d.listeners[port])
+	d.mu.Unlock()
+
+	for _, l := range listeners {
+		l.recv(msg, timestampms)
+	}
+
+	return nil
+}
+
+// loopbackOutPort sends messages back to the loopback input port of the same name
+type loopbackOutPort struct {
+	driver *LoopbackDriver
+	port   string
+}
+
+func (p *loopbackOutPort) Send(msg midi.Message) error {
+	timestampms := int32(time.Since(p.driver.start).Milliseconds())
+	return p.driver.Inject(p.port, msg, timestampms)
+}
+
+func (p *loopbackOutPort) Close() error {
+	return nil
+}
+
+func (p *loopbackOutPort) String() string {
+	return p.port
+}
@@ -0,0 +1,91 @@
+package midi
+
+import (
+	"fmt"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+	_ "gitlab.com/gomidi/midi/v2/drivers/rtmididrv"
+)
+
+// SystemDriver uses the MIDI devices of the system through gomidi
+type SystemDriver struct{}
+
+// NewSystemDriver creates the driver for the system MIDI devices
+func NewSystemDriver() *SystemDriver {
+	return &SystemDriver{}
+}
+
+func (d *SystemDriver) Name() string {
+	return DriverSystem
+}
+
+func (d *SystemDriver) InPorts() []string {
+	inPorts := midi.GetInPorts()
+	portNames := make([]string, len(inPorts))
+	for i, port := range inPorts {
+		portNames[i] = port.String()
+	}
+	return portNames
+}
+
+func (d *SystemDriver) OutPorts() []string {
+	outPorts := midi.GetOutPorts()
+	portNames := make([]string, len(outPorts))
+	for i, port := range outPorts {
+		portNames[i] = port.String()
+	}
+	return portNames
+}
+
+// Listen listens to an input port, letting clock and transport messages through for clock sync
+func (d *SystemDriver) Listen(port string, recv func(msg midi.Message, timestampms int32)) (func(), error) {
+	inPort, err := midi.FindInPort(port)
+	if err != nil {
+		return nil, fmt.Errorf("could not find MIDI port '%s': %w", port, err)
+	}
+
+	stop, err := midi.ListenTo(inPort, recv, midi.UseTimeCode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen to MIDI port: %w", err)
+	}
+
+	return stop, nil
+}
+
+func (d *SystemDriver) OpenOut(port string) (OutPort, error) {
+	outPort, err := midi.FindOutPort(port)
+	if err != nil {
+		return nil, fmt.Errorf("could not find MIDI output port '%s': %w", port, err)
+	}
+
+	send, err := midi.SendTo(outPort)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MIDI output port: %w", err)
+	}
+
+	return &systemOutPort{port: outPort, send: send}, nil
+}
+
+func (d *SystemDriver) Close() error {
+	midi.CloseDriver()
+	return nil
+}
+
+// systemOutPort is an open output port of the system driver
+type systemOutPort struct {
+	port drivers.Out
+	send func(msg midi.Message) error
+}
+
+func (p *systemOutPort) Send(msg midi.Message) error {
+	return p.send(msg)
+}
+
+func (p *systemOutPort) Close() error {
+	return p.port.Close()
+}
+
+func (p *systemOutPort) String() string {
+	return p.port.String()
+}
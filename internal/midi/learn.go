@@ -0,0 +1,364 @@
+package midi
+
+import (
+	"bitbox-editor/internal/app/eventbus"
+	"bitbox-editor/internal/app/events"
+	"bitbox-editor/internal/config"
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ControlKind is how a learn target responds to its control
+type ControlKind int
+
+const (
+	// ControlContinuous targets take a value from 0.0 to 1.0, e.g. a volume slider
+	ControlContinuous ControlKind = iota
+	// ControlTrigger targets fire once when their control is pressed, e.g. a transport button
+	ControlTrigger
+)
+
+// triggerThreshold is the control change value that counts as pressing a trigger
+const triggerThreshold = 64
+
+// Target is a control in the editor that can be bound to a MIDI control
+type Target struct {
+	// ID identifies the target in profiles, e.g. "transport.play_pause"
+	ID string
+	// Name is shown in the mapping list
+	Name string
+	// OwnerID is the window the target belongs to, targets without an owner are always active
+	OwnerID string
+	Kind    ControlKind
+	// Get returns the current value from 0.0 to 1.0, used by relative encoders
+	Get func() float64
+	// Set applies a value from 0.0 to 1.0. It is called from the MIDI goroutine, so it
+	// should hand the value to the UI with a command rather than touching state directly.
+	Set func(value float64)
+}
+
+// LearnManager binds incoming control changes and notes to editor controls. In learn
+// mode the user arms a target by clicking it, and the next control that moves is bound to it.
+type LearnManager struct {
+	bus *eventbus.EventBus
+	id  string
+
+	mu         sync.Mutex
+	targets    map[string][]Target
+	profile    *Profile
+	learning   bool
+	armed      string
+	focusOwner string
+	// values holds the last value sent to each target, relative encoders step from it
+	values map[string]float64
+	// lastCC holds the last value of each control, used to detect trigger presses
+	lastCC map[Binding]uint8
+}
+
+var globalLearnManager *LearnManager
+
+func init() {
+	globalLearnManager = NewLearnManager(Bus)
+}
+
+// GetLearnManager returns the learn manager listening to the MIDI input
+func GetLearnManager() *LearnManager {
+	return globalLearnManager
+}
+
+// NewLearnManager creates a learn manager listening to control changes and notes on bus
+func NewLearnManager(bus *eventbus.EventBus) *LearnManager {
+	lm := &LearnManager{
+		bus:     bus,
+		id:      uuid.NewString(),
+		targets: make(map[string][]Target),
+		profile: &Profile{Name: "default"},
+		values:  make(map[string]float64),
+		lastCC:  make(map[Binding]uint8),
+	}
+
+	ch := make(eventbus.EventChannel, 256)
+	bus.Subscribe(events.MidiControlChangeKey, lm.id, ch)
+	bus.Subscribe(events.MidiNoteOnKey, lm.id, ch)
+	go lm.run(ch)
+
+	return lm
+}
+
+// LoadActiveProfile loads the profile selected in the config
+func (lm *LearnManager) LoadActiveProfile() {
+	if err := lm.UseProfile(config.GetMidiLearnProfile()); err != nil {
+		log.Warn("Could not load MIDI learn profile", zap.Error(err))
+	}
+}
+
+// UseProfile switches to a saved profile and makes it the active profile in the config
+func (lm *LearnManager) UseProfile(name string) error {
+	profile, err := LoadProfile(name)
+	if err != nil {
+		return err
+	}
+
+	lm.mu.Lock()
+	lm.profile = profile
+	lm.armed = ""
+	clear(lm.lastCC)
+	lm.mu.Unlock()
+
+	return config.SetMidiLearnProfile(name)
+}
+
+// Profile returns a copy of the active profile
+func (lm *LearnManager) Profile() Profile {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	return Profile{Name: lm.profile.Name, Bindings: slices.Clone(lm.profile.Bindings)}
+}
+
+// RegisterTarget adds a control that can be learned. Targets with the same ID and owner
+// replace each other.
+func (lm *LearnManager) RegisterTarget(target Target) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	targets := slices.DeleteFunc(lm.targets[target.ID], func(t Target) bool {
+		return t.OwnerID == target.OwnerID
+	})
+	lm.targets[target.ID] = append(targets, target)
+}
+
+// UnregisterOwner removes every target owned by a window
+func (lm *LearnManager) UnregisterOwner(ownerID string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for id, targets := range lm.targets {
+		targets = slices.DeleteFunc(targets, func(t Target) bool {
+			return t.OwnerID == ownerID
+		})
+		if len(targets) == 0 {
+			delete(lm.targets, id)
+		} else {
+			lm.targets[id] = targets
+		}
+	}
+
+	if lm.focusOwner == ownerID {
+		lm.focusOwner = ""
+	}
+}
+
+// HasTarget returns true if a target with the given ID is registered
+func (lm *LearnManager) HasTarget(id string) bool {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return len(lm.targets[id]) > 0
+}
+
+// TargetName returns the display name of a target, or its ID if it is not registered
+func (lm *LearnManager) TargetName(id string) string {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if targets := lm.targets[id]; len(targets) > 0 {
+		return targets[0].Name
+	}
+	return id
+}
+
+// SetFocusOwner sets the window whose targets receive bound controls
+func (lm *LearnManager) SetFocusOwner(ownerID string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.focusOwner = ownerID
+}
+
+// SetLearning turns learn mode on or off. Turning it off disarms any armed target.
+func (lm *LearnManager) SetLearning(learning bool) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	lm.learning = learning
+	if !learning {
+		lm.armed = ""
+	}
+}
+
+// IsLearning returns true while learn mode is on
+func (lm *LearnManager) IsLearning() bool {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.learning
+}
+
+// Arm waits for the next control to move and binds it to the target
+func (lm *LearnManager) Arm(targetID string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if lm.learning {
+		lm.armed = targetID
+	}
+}
+
+// Armed returns the target waiting for a control, or an empty string
+func (lm *LearnManager) Armed() string {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.armed
+}
+
+// BindingFor returns the binding of a target
+func (lm *LearnManager) BindingFor(targetID string) (Binding, bool) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for _, b := range lm.profile.Bindings {
+		if b.Target == targetID {
+			return b, true
+		}
+	}
+	return Binding{}, false
+}
+
+// UpdateBinding replaces the binding of a target, e.g. after changing its range or
+// encoder mode, and saves the profile
+func (lm *LearnManager) UpdateBinding(binding Binding) error {
+	lm.mu.Lock()
+	for i, b := range lm.profile.Bindings {
+		if b.Target == binding.Target {
+			lm.profile.Bindings[i] = binding
+		}
+	}
+	lm.mu.Unlock()
+
+	return lm.saveProfile()
+}
+
+// RemoveBinding unbinds a target and saves the profile
+func (lm *LearnManager) RemoveBinding(targetID string) error {
+	lm.mu.Lock()
+	lm.profile.Bindings = slices.DeleteFunc(lm.profile.Bindings, func(b Binding) bool {
+		return b.Target == targetID
+	})
+	lm.mu.Unlock()
+
+	return lm.saveProfile()
+}
+
+func (lm *LearnManager) saveProfile() error {
+	profile := lm.Profile()
+	return SaveProfile(&profile)
+}
+
+func (lm *LearnManager) run(ch eventbus.EventChannel) {
+	for event := range ch {
+		msg, ok := event.(events.MidiEventRecord)
+		if !ok {
+			continue
+		}
+
+		switch msg.EventType {
+		case events.MidiControlChangeEvent:
+			lm.handle(SourceCC, msg.Channel, msg.Controller, msg.Value)
+		case events.MidiNoteOnEvent:
+			lm.handle(SourceNote, msg.Channel, msg.Key, msg.Velocity)
+		}
+	}
+}
+
+// handle binds the control if a target is armed, otherwise applies it to the bound targets
+func (lm *LearnManager) handle(source string, channel, number, value uint8) {
+	lm.mu.Lock()
+
+	if lm.armed != "" {
+		lm.learn(source, int(channel), int(number))
+		lm.mu.Unlock()
+
+		if err := lm.saveProfile(); err != nil {
+			log.Error("Failed to save MIDI learn profile", zap.Error(err))
+		}
+		return
+	}
+
+	type update struct {
+		target Target
+		value  float64
+	}
+	var updates []update
+
+	for _, b := range lm.profile.Bindings {
+		if !b.matches(source, int(channel), int(number)) {
+			continue
+		}
+
+		for _, target := range lm.targets[b.Target] {
+			if target.OwnerID != "" && target.OwnerID != lm.focusOwner {
+				continue
+			}
+
+			v, ok := lm.resolve(b, target, source, value)
+			if ok {
+				updates = append(updates, update{target: target, value: v})
+			}
+		}
+
+		if source == SourceCC {
+			lm.lastCC[b] = value
+		}
+	}
+
+	lm.mu.Unlock()
+
+	for _, u := range updates {
+		u.target.Set(u.value)
+	}
+}
+
+// learn binds a control to the armed target. The control is taken from any other target
+// it was bound to, so one knob never drives two things by accident.
+func (lm *LearnManager) learn(source string, channel, number int) {
+	target := lm.armed
+	lm.armed = ""
+
+	lm.profile.Bindings = slices.DeleteFunc(lm.profile.Bindings, func(b Binding) bool {
+		return b.Target == target || b.matches(source, channel, number)
+	})
+	lm.profile.Bindings = append(lm.profile.Bindings, NewBinding(target, source, channel, number))
+
+	log.Info("MIDI control learned",
+		zap.String("target", target),
+		zap.String("source", source),
+		zap.Int("channel", channel),
+		zap.Int("number", number))
+}
+
+// resolve works out the value a control sends to a target. ok is false when the
+// target should not be updated, e.g. a trigger whose control was released.
+func (lm *LearnManager) resolve(b Binding, target Target, source string, value uint8) (v float64, ok bool) {
+	if target.Kind == ControlTrigger {
+		if source == SourceNote {
+			return 1, true
+		}
+		// Fire on the press only, not while the control is held or released
+		last, seen := lm.lastCC[b]
+		return 1, value >= triggerThreshold && (!seen || last < triggerThreshold)
+	}
+
+	if source == SourceCC && b.Encoder != EncoderAbsolute && b.Encoder != "" {
+		current, known := lm.values[target.ID]
+		if !known && target.Get != nil {
+			current = target.Get()
+		}
+		v = b.clamp(current + float64(b.Encoder.delta(value))*b.Step)
+	} else {
+		v = b.scale(float64(value) / 127)
+	}
+
+	lm.values[target.ID] = v
+	return v, true
+}
@@ -0,0 +1,229 @@
+package midi
+
+import (
+	"bitbox-editor/internal/config"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// profileDirName is the directory in the config dir that holds MIDI learn profiles
+const profileDirName = "midi_profiles"
+
+// Binding sources
+const (
+	SourceCC   = "cc"
+	SourceNote = "note"
+)
+
+// EncoderMode is how control change values are read
+type EncoderMode string
+
+const (
+	// EncoderAbsolute maps the 0-127 value onto the target range
+	EncoderAbsolute EncoderMode = "absolute"
+	// EncoderTwosComplement reads 1-63 as increments and 65-127 as decrements
+	EncoderTwosComplement EncoderMode = "relative_twos"
+	// EncoderSignBit reads bit 6 as the direction and the low bits as the amount
+	EncoderSignBit EncoderMode = "relative_signed"
+	// EncoderBinaryOffset reads values above 64 as increments and below as decrements
+	EncoderBinaryOffset EncoderMode = "relative_offset"
+)
+
+// EncoderModes lists the encoder modes in display order
+var EncoderModes = []EncoderMode{
+	EncoderAbsolute,
+	EncoderTwosComplement,
+	EncoderSignBit,
+	EncoderBinaryOffset,
+}
+
+func (m EncoderMode) String() string {
+	switch m {
+	case EncoderTwosComplement:
+		return "Relative (2's complement)"
+	case EncoderSignBit:
+		return "Relative (sign bit)"
+	case EncoderBinaryOffset:
+		return "Relative (binary offset)"
+	default:
+		return "Absolute"
+	}
+}
+
+// delta returns the number of steps a relative encoder value moves
+func (m EncoderMode) delta(value uint8) int {
+	v := int(value)
+	switch m {
+	case EncoderTwosComplement:
+		if v >= 64 {
+			return v - 128
+		}
+		return v
+	case EncoderSignBit:
+		if v&0x40 != 0 {
+			return -(v & 0x3f)
+		}
+		return v & 0x3f
+	case EncoderBinaryOffset:
+		return v - 64
+	default:
+		return 0
+	}
+}
+
+// Binding maps a control change or note to a learn target
+type Binding struct {
+	Target  string      `toml:"target"`
+	Source  string      `toml:"source"`
+	Channel int         `toml:"channel"`
+	Number  int         `toml:"number"`
+	Encoder EncoderMode `toml:"encoder"`
+
+	// Min and Max scale the control onto part of the target range, from 0.0 to 1.0
+	Min float64 `toml:"min"`
+	Max float64 `toml:"max"`
+	// Step is how far one relative encoder tick moves the target
+	Step float64 `toml:"step"`
+}
+
+// NewBinding creates a binding covering the full target range
+func NewBinding(target, source string, channel, number int) Binding {
+	return Binding{
+		Target:  target,
+		Source:  source,
+		Channel: channel,
+		Number:  number,
+		Encoder: EncoderAbsolute,
+		Min:     0,
+		Max:     1,
+		Step:    1.0 / 127,
+	}
+}
+
+// String describes the control the binding listens to, e.g. "CC 74 ch 1"
+func (b Binding) String() string {
+	kind := "CC"
+	if b.Source == SourceNote {
+		kind = "Note"
+	}
+	return fmt.Sprintf("%s %d ch %d", kind, b.Number, b.Channel+1)
+}
+
+// matches returns true if the binding listens to the given control
+func (b Binding) matches(source string, channel, number int) bool {
+	return b.Source == source && b.Channel == channel && b.Number == number
+}
+
+// scale maps a 0.0-1.0 control position onto the binding range
+func (b Binding) scale(t float64) float64 {
+	return b.Min + t*(b.Max-b.Min)
+}
+
+// clamp limits a value to the binding range
+func (b Binding) clamp(v float64) float64 {
+	lo, hi := min(b.Min, b.Max), max(b.Min, b.Max)
+	return max(lo, min(hi, v))
+}
+
+// Profile is a named set of bindings
+type Profile struct {
+	Name     string    `toml:"name"`
+	Bindings []Binding `toml:"binding"`
+}
+
+// profileDir returns the directory holding the learn profiles
+func profileDir() string {
+	return filepath.Join(config.Dir(), profileDirName)
+}
+
+// profilePath returns the file of a named profile
+func profilePath(name string) string {
+	return filepath.Join(profileDir(), name+".toml")
+}
+
+// ValidProfileName returns true if name can be used as a profile file name
+func ValidProfileName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/\:*?"<>|`) && name != "." && name != ".."
+}
+
+// ListProfiles returns the names of the saved learn profiles
+func ListProfiles() ([]string, error) {
+	entries, err := os.ReadDir(profileDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read MIDI profiles: %w", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".toml" {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(entry.Name(), ".toml"))
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// LoadProfile reads a learn profile. A profile that has not been saved yet is returned empty.
+func LoadProfile(name string) (*Profile, error) {
+	if !ValidProfileName(name) {
+		return nil, fmt.Errorf("invalid MIDI profile name '%s'", name)
+	}
+
+	profile := &Profile{Name: name}
+
+	if _, err := toml.DecodeFile(profilePath(name), profile); err != nil {
+		if os.IsNotExist(err) {
+			return profile, nil
+		}
+		return nil, fmt.Errorf("failed to read MIDI profile '%s': %w", name, err)
+	}
+	profile.Name = name
+
+	return profile, nil
+}
+
+// SaveProfile writes a learn profile to the config dir
+func SaveProfile(profile *Profile) error {
+	if !ValidProfileName(profile.Name) {
+		return fmt.Errorf("invalid MIDI profile name '%s'", profile.Name)
+	}
+
+	if err := os.MkdirAll(profileDir(), 0750); err != nil {
+		return fmt.Errorf("failed to create MIDI profile dir: %w", err)
+	}
+
+	f, err := os.Create(profilePath(profile.Name))
+	if err != nil {
+		return fmt.Errorf("failed to write MIDI profile '%s': %w", profile.Name, err)
+	}
+	defer f.Close()
+
+	if err := toml.NewEncoder(f).Encode(profile); err != nil {
+		return fmt.Errorf("failed to encode MIDI profile '%s': %w", profile.Name, err)
+	}
+
+	return nil
+}
+
+// DeleteProfile removes a saved learn profile
+func DeleteProfile(name string) error {
+	if !ValidProfileName(name) {
+		return fmt.Errorf("invalid MIDI profile name '%s'", name)
+	}
+
+	if err := os.Remove(profilePath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete MIDI profile '%s': %w", name, err)
+	}
+
+	return nil
+}
@@ -3,19 +3,18 @@ package midi
 import (
 	"bitbox-editor/internal/app/eventbus"
 	"bitbox-editor/internal/app/events"
-	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"gitlab.com/gomidi/midi/v2"
-	_ "gitlab.com/gomidi/midi/v2/drivers/rtmididrv"
+	"go.uber.org/zap"
 )
 
-var globalMidiManager *MidiManager
 var Bus = eventbus.NewEventBus()
 
-func init() {
-	globalMidiManager = NewMidiManager(Bus)
-}
+// globalMidiManager is set up before the init functions run, so they can register with it
+var globalMidiManager = NewMidiManager(Bus)
 
 func GetMidiManager() *MidiManager {
 	return globalMidiManager
@@ -23,36 +22,77 @@ func GetMidiManager() *MidiManager {
 
 // MidiManager handles listening to MIDI ports and publishing events
 type MidiManager struct {
-	bus  *eventbus.EventBus
-	stop func()
-	mu   sync.Mutex
+	bus    *eventbus.EventBus
+	driver Driver
+	stop   func()
+	inPort string
+	mu     sync.Mutex
+
+	// recorder captures the incoming messages while a session is recorded
+	recorder atomic.Pointer[sessionRecorder]
+
+	// clockListener gets the clock, transport and song position messages before they are
+	// published, see SetClockListener
+	clockListener atomic.Pointer[func(events.MidiEventRecord)]
+
+	// playbackBus carries the playback events that are sent to the output port
+	playbackBus *eventbus.EventBus
+	output      midiOutput
+	outMu       sync.Mutex
+
+	// clock sends MIDI clock to the output port while it is not nil
+	clock   *clockSender
+	clockMu sync.Mutex
 }
 
-// NewMidiManager creates a new MIDI manager
+// NewMidiManager creates a new MIDI manager using the system driver
 func NewMidiManager(bus *eventbus.EventBus) *MidiManager {
 	return &MidiManager{
-		bus:  bus,
-		stop: nil,
+		bus:         bus,
+		driver:      NewSystemDriver(),
+		stop:        nil,
+		playbackBus: eventbus.Bus,
 	}
 }
 
 // Close ensures the MIDI driver is closed (on app shutdown)
 func (m *MidiManager) Close() {
 	m.StopMonitoring()
-	midi.CloseDriver()
+	m.StopClock()
+	m.CloseOutput()
+
+	if err := m.Driver().Close(); err != nil {
+		log.Warn("Failed to close MIDI driver", zap.Error(err))
+	}
 }
 
-// ListPorts returns a list of available MIDI input port names
-func (m *MidiManager) ListPorts() []string {
+// SetDriver switches to another driver. Open ports are closed, and the old driver with them.
+func (m *MidiManager) SetDriver(driver Driver) {
+	m.StopMonitoring()
+	m.CloseOutput()
+
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	previous := m.driver
+	m.driver = driver
+	m.mu.Unlock()
 
-	inPorts := midi.GetInPorts()
-	portNames := make([]string, len(inPorts))
-	for i, port := range inPorts {
-		portNames[i] = port.String()
+	if previous != nil && previous != driver {
+		if err := previous.Close(); err != nil {
+			log.Warn("Failed to close MIDI driver", zap.String("driver", previous.Name()), zap.Error(err))
+		}
 	}
-	return portNames
+}
+
+// Driver returns the driver providing the MIDI ports
+func (m *MidiManager) Driver() Driver {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.driver
+}
+
+// ListPorts returns a list of available MIDI input port names
+func (m *MidiManager) ListPorts() []string {
+	return m.Driver().InPorts()
 }
 
 // StartMonitoring finds a port by name and starts listening to it
@@ -65,30 +105,29 @@ func (m *MidiManager) StartMonitoring(portName string) error {
 		m.stop()
 		m.stop = nil
 	}
-
-	inPort, err := midi.FindInPort(portName)
-	if err != nil {
-		return fmt.Errorf("could not find MIDI port '%s': %w", portName, err)
-	}
+	m.inPort = ""
 
 	// Start the new listener
-	stop, err := midi.ListenTo(inPort, func(msg midi.Message, timestampms int32) {
-		// Parse the message and publish it
-		event := m.parseMessage(msg, timestampms, inPort.String())
-		if event != nil {
-			m.bus.Publish(event)
-		}
+	stop, err := m.driver.Listen(portName, func(msg midi.Message, timestampms int32) {
+		m.receive(msg, timestampms, portName)
 	})
-
 	if err != nil {
-		return fmt.Errorf("failed to listen to MIDI port: %w", err)
+		return err
 	}
 
 	// Store the stop function
 	m.stop = stop
+	m.inPort = portName
 	return nil
 }
 
+// InputPort returns the name of the port being listened to, or an empty string if there is none
+func (m *MidiManager) InputPort() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.inPort
+}
+
 // StopMonitoring stops the active MIDI listener.
 func (m *MidiManager) StopMonitoring() {
 	m.mu.Lock()
@@ -98,15 +137,76 @@ func (m *MidiManager) StopMonitoring() {
 		m.stop()
 		m.stop = nil
 	}
+	m.inPort = ""
+}
+
+// SetClockListener sets the function called with every clock, start, continue, stop and
+// song position message. It is called on the driver's goroutine before the message is
+// published, so unlike a bus subscriber it never misses a tick, and it has to return
+// quickly. A nil listener removes it.
+func (m *MidiManager) SetClockListener(listener func(events.MidiEventRecord)) {
+	if listener == nil {
+		m.clockListener.Store(nil)
+		return
+	}
+	m.clockListener.Store(&listener)
+}
+
+// receive records a message if a session is being recorded, then parses and publishes it
+func (m *MidiManager) receive(msg midi.Message, timestampms int32, portID string) {
+	received := time.Now()
+	m.recordMessage(msg)
+
+	record, ok := m.parseMessage(msg, timestampms, portID).(events.MidiEventRecord)
+	if !ok {
+		return
+	}
+	record.Received = received
+
+	m.notifyClock(record)
+	m.bus.Publish(record)
+}
+
+// notifyClock hands clock, transport and song position messages to the clock listener
+func (m *MidiManager) notifyClock(record events.MidiEventRecord) {
+	switch record.EventType {
+	case events.MidiClockEvent, events.MidiStartEvent, events.MidiContinueEvent,
+		events.MidiStopEvent, events.MidiSongPositionEvent:
+	default:
+		return
+	}
+
+	if listener := m.clockListener.Load(); listener != nil {
+		(*listener)(record)
+	}
 }
 
 // parseMessage converts a raw midi.Message into a MidiEventRecord.
 func (m *MidiManager) parseMessage(msg midi.Message, timestampms int32, portID string) events.Event {
 	var ch, key, vel, controller, value, program, pressure uint8
-	var pitch uint16
+	var pitch, spp uint16
 	var rel int16
 
+	switch msg.Type() {
+	case midi.TimingClockMsg:
+		return events.MidiEventRecord{EventType: events.MidiClockEvent, Timestamp: timestampms, PortID: portID}
+	case midi.StartMsg:
+		return events.MidiEventRecord{EventType: events.MidiStartEvent, Timestamp: timestampms, PortID: portID}
+	case midi.ContinueMsg:
+		return events.MidiEventRecord{EventType: events.MidiContinueEvent, Timestamp: timestampms, PortID: portID}
+	case midi.StopMsg:
+		return events.MidiEventRecord{EventType: events.MidiStopEvent, Timestamp: timestampms, PortID: portID}
+	}
+
 	switch {
+	case msg.GetSPP(&spp):
+		return events.MidiEventRecord{
+			EventType: events.MidiSongPositionEvent,
+			Timestamp: timestampms,
+			PortID:    portID,
+			Value14:   spp,
+		}
+
 	case msg.GetNoteOn(&ch, &key, &vel):
 		// A NoteOn with 0 velocity is often a NoteOff
 		if vel == 0 {
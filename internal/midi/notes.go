@@ -0,0 +1,11 @@
+package midi
+
+import "fmt"
+
+// noteNames are the names of the notes of an octave, using sharps
+var noteNames = [12]string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// NoteName returns the name of a MIDI note with its octave, key 60 is middle C (C4)
+func NoteName(key uint8) string {
+	return fmt.Sprintf("%s%d", noteNames[key%12], int(key)/12-1)
+}
@@ -0,0 +1,192 @@
+package midi
+
+import (
+	"bitbox-editor/internal/app/eventbus"
+	"bitbox-editor/internal/app/events"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gitlab.com/gomidi/midi/v2"
+	"go.uber.org/zap"
+)
+
+// midiOutput is the open output port and the forwarding of playback events to it
+type midiOutput struct {
+	port OutPort
+
+	subscriberID string
+	events       eventbus.EventChannel
+	stop         chan struct{}
+}
+
+// playbackKeys are the playback events forwarded to the output port
+var playbackKeys = []string{
+	events.MidiPlaybackStoppedKey,
+	events.MidiPlaybackNoteOnKey,
+	events.MidiPlaybackNoteOffKey,
+	events.MidiPlaybackCCKey,
+	events.MidiPlaybackProgramKey,
+}
+
+// ListOutPorts returns a list of available MIDI output port names
+func (m *MidiManager) ListOutPorts() []string {
+	return m.Driver().OutPorts()
+}
+
+// OpenOutput finds an output port by name and starts sending playback events to it
+func (m *MidiManager) OpenOutput(portName string) error {
+	m.outMu.Lock()
+	defer m.outMu.Unlock()
+
+	m.closeOutput()
+
+	outPort, err := m.Driver().OpenOut(portName)
+	if err != nil {
+		return err
+	}
+
+	m.output = midiOutput{
+		port:         outPort,
+		subscriberID: uuid.NewString(),
+		events:       make(eventbus.EventChannel, 256),
+		stop:         make(chan struct{}),
+	}
+
+	for _, key := range playbackKeys {
+		m.playbackBus.Subscribe(key, m.output.subscriberID, m.output.events)
+	}
+
+	go m.forwardPlayback(m.output.events, m.output.stop)
+
+	return nil
+}
+
+// CloseOutput silences and closes the output port
+func (m *MidiManager) CloseOutput() {
+	m.outMu.Lock()
+	defer m.outMu.Unlock()
+
+	m.closeOutput()
+}
+
+// closeOutput closes the output port, the caller must hold outMu
+func (m *MidiManager) closeOutput() {
+	if m.output.port == nil {
+		return
+	}
+
+	for _, key := range playbackKeys {
+		m.playbackBus.Unsubscribe(key, m.output.subscriberID)
+	}
+	close(m.output.stop)
+
+	for _, msg := range midi.SilenceChannel(-1) {
+		_ = m.output.port.Send(msg)
+	}
+
+	if err := m.output.port.Close(); err != nil {
+		log.Warn("Failed to close MIDI output port", zap.String("port", m.output.port.String()), zap.Error(err))
+	}
+
+	m.output = midiOutput{}
+}
+
+// OutputPort returns the name of the open output port, or an empty string if there is none
+func (m *MidiManager) OutputPort() string {
+	m.outMu.Lock()
+	defer m.outMu.Unlock()
+
+	if m.output.port == nil {
+		return ""
+	}
+	return m.output.port.String()
+}
+
+// Send sends a raw message to the output port
+func (m *MidiManager) Send(msg midi.Message) error {
+	m.outMu.Lock()
+	defer m.outMu.Unlock()
+
+	if m.output.port == nil {
+		return fmt.Errorf("no MIDI output port open")
+	}
+	return m.output.port.Send(msg)
+}
+
+// SendNoteOn sends a note on to the output port. channel is 0-15.
+func (m *MidiManager) SendNoteOn(channel, key, velocity uint8) error {
+	return m.Send(midi.NoteOn(channel, key, velocity))
+}
+
+// SendNoteOff sends a note off to the output port. channel is 0-15.
+func (m *MidiManager) SendNoteOff(channel, key uint8) error {
+	return m.Send(midi.NoteOff(channel, key))
+}
+
+// SendControlChange sends a control change to the output port. channel is 0-15.
+func (m *MidiManager) SendControlChange(channel, controller, value uint8) error {
+	return m.Send(midi.ControlChange(channel, controller, value))
+}
+
+// SendProgramChange sends a program change to the output port. channel is 0-15.
+func (m *MidiManager) SendProgramChange(channel, program uint8) error {
+	return m.Send(midi.ProgramChange(channel, program))
+}
+
+// SendAllNotesOff silences every channel of the output port
+func (m *MidiManager) SendAllNotesOff() error {
+	var lastErr error
+	for _, msg := range midi.SilenceChannel(-1) {
+		if err := m.Send(msg); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// forwardPlayback sends playback events to the output port until stop is closed
+func (m *MidiManager) forwardPlayback(ch eventbus.EventChannel, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case event := <-ch:
+			e, ok := event.(events.MidiPlaybackEventRecord)
+			if !ok {
+				continue
+			}
+
+			if e.Channel < 0 || e.Channel > 15 {
+				log.Warn("Dropped MIDI playback event with an invalid channel",
+					zap.String("event", e.Type()),
+					zap.Int("channel", e.Channel))
+				continue
+			}
+
+			var err error
+			channel := uint8(e.Channel)
+
+			switch e.EventType {
+			case events.MidiPlaybackNoteOnEvent:
+				err = m.SendNoteOn(channel, clamp7(e.Note), clamp7(e.Velocity))
+			case events.MidiPlaybackNoteOffEvent:
+				err = m.SendNoteOff(channel, clamp7(e.Note))
+			case events.MidiPlaybackCCEvent:
+				err = m.SendControlChange(channel, clamp7(e.CC), clamp7(e.CCValue))
+			case events.MidiPlaybackProgramChangeEvent:
+				err = m.SendProgramChange(channel, clamp7(e.Program))
+			case events.MidiPlaybackStoppedEvent:
+				err = m.SendAllNotesOff()
+			}
+
+			if err != nil {
+				log.Warn("Failed to send MIDI playback event", zap.String("event", e.Type()), zap.Error(err))
+			}
+		}
+	}
+}
+
+// clamp7 limits a value to the 7 bit range of MIDI data bytes
+func clamp7(v int) uint8 {
+	return uint8(max(0, min(127, v)))
+}
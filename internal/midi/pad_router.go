@@ -0,0 +1,429 @@
+package midi
+
+import (
+	"bitbox-editor/internal/app/eventbus"
+	"bitbox-editor/internal/app/events"
+	"bitbox-editor/internal/audio"
+	"bitbox-editor/internal/logging"
+	"bitbox-editor/internal/parsing/bitbox"
+	"bitbox-editor/internal/preset"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var log = logging.NewLogger("midi")
+
+// Sample cell MIDI modes
+const (
+	// midiModePad plays the cell when its pad note is received
+	midiModePad = iota
+	// midiModeChromatic plays the cell pitched across the keyboard relative to its root note
+	midiModeChromatic
+)
+
+// Sample cell trigger types
+const (
+	trigTypeTrigger = iota
+	trigTypeGate
+	trigTypeToggle
+)
+
+const (
+	// defaultPadNoteBase is the note of the top left pad when a cell has no pad note,
+	// following the usual drum pad layout starting at C1
+	defaultPadNoteBase = 36
+	// defaultPadCols is the number of pad columns used to number the default pad notes
+	defaultPadCols = 4
+	// rootNoteBase is the note a cell plays at its original pitch when its root note is 0
+	rootNoteBase = 60
+)
+
+var globalPadRouter *PadRouter
+
+func init() {
+	globalPadRouter = NewPadRouter(Bus, eventbus.Bus, audio.GetAudioManager())
+}
+
+// GetPadRouter returns the router that plays incoming MIDI notes on the focused preset
+func GetPadRouter() *PadRouter {
+	return globalPadRouter
+}
+
+// heldNote is a note that started one or more voices
+type heldNote struct {
+	channel uint8
+	key     uint8
+}
+
+// routedVoice is a voice started for a cell by a note
+type routedVoice struct {
+	key      string
+	row, col int
+	// sustain is true when the voice stops on note off
+	sustain bool
+}
+
+// PadRouter plays sample cells of a preset from incoming MIDI notes, the same way the
+// hardware responds to a connected controller. Notes are matched to cells with the cell's
+// pad note, MIDI mode and MIDI channel, and velocity scales the cell gain.
+//
+// A chromatic cell with a MIDI channel plays every note on that channel. A chromatic cell
+// listening on all channels only plays the notes no pad is mapped to, so a single such
+// cell doesn't take the whole keyboard away from the pads.
+type PadRouter struct {
+	midiBus  *eventbus.EventBus
+	appBus   *eventbus.EventBus
+	audioMgr *audio.AudioManager
+
+	id     string
+	events eventbus.EventChannel
+	stop   chan struct{}
+
+	mu      sync.Mutex
+	preset  *preset.Preset
+	ownerID string
+	held    map[heldNote][]routedVoice
+	toggled map[string]bool
+}
+
+// NewPadRouter creates a router listening to midiBus and publishing pad events to appBus
+func NewPadRouter(midiBus, appBus *eventbus.EventBus, audioMgr *audio.AudioManager) *PadRouter {
+	return &PadRouter{
+		midiBus:  midiBus,
+		appBus:   appBus,
+		audioMgr: audioMgr,
+		id:       uuid.NewString(),
+		held:     make(map[heldNote][]routedVoice),
+		toggled:  make(map[string]bool),
+	}
+}
+
+// Start subscribes to note events and starts routing them
+func (r *PadRouter) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stop != nil {
+		return
+	}
+
+	r.events = make(eventbus.EventChannel, 256)
+	r.stop = make(chan struct{})
+	r.midiBus.Subscribe(events.MidiNoteOnKey, r.id, r.events)
+	r.midiBus.Subscribe(events.MidiNoteOffKey, r.id, r.events)
+
+	go r.run(r.events, r.stop)
+}
+
+// Stop unsubscribes from note events and silences any routed voices
+func (r *PadRouter) Stop() {
+	r.mu.Lock()
+	if r.stop == nil {
+		r.mu.Unlock()
+		return
+	}
+
+	r.midiBus.Unsubscribe(events.MidiNoteOnKey, r.id)
+	r.midiBus.Unsubscribe(events.MidiNoteOffKey, r.id)
+	close(r.stop)
+	r.stop = nil
+
+	release := r.takeAll()
+	r.mu.Unlock()
+
+	r.release(release)
+}
+
+// SetPreset sets the preset notes are routed to. ownerID is the window showing the preset,
+// it receives the pad trigger events.
+func (r *PadRouter) SetPreset(p *preset.Preset, ownerID string) {
+	r.mu.Lock()
+	if r.preset == p && r.ownerID == ownerID {
+		r.mu.Unlock()
+		return
+	}
+
+	release := r.takeAll()
+	r.preset = p
+	r.ownerID = ownerID
+	r.mu.Unlock()
+
+	r.release(release)
+}
+
+// ClearPreset stops routing to the preset of ownerID, if it is the current target
+func (r *PadRouter) ClearPreset(ownerID string) {
+	r.mu.Lock()
+	if r.ownerID != ownerID {
+		r.mu.Unlock()
+		return
+	}
+
+	release := r.takeAll()
+	r.preset = nil
+	r.ownerID = ""
+	r.mu.Unlock()
+
+	r.release(release)
+}
+
+// OwnerID returns the window notes are currently routed to
+func (r *PadRouter) OwnerID() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ownerID
+}
+
+func (r *PadRouter) run(ch eventbus.EventChannel, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case event := <-ch:
+			msg, ok := event.(events.MidiEventRecord)
+			if !ok {
+				continue
+			}
+
+			switch msg.EventType {
+			case events.MidiNoteOnEvent:
+				r.noteOn(msg.Channel, msg.Key, msg.Velocity)
+			case events.MidiNoteOffEvent:
+				r.noteOff(msg.Channel, msg.Key)
+			}
+		}
+	}
+}
+
+// cellVoice is a voice a note starts for a cell, worked out under the lock so the audio
+// manager can be called without holding it
+type cellVoice struct {
+	routedVoice
+	path string
+	opts audio.VoiceOptions
+	// toggle is true for toggle cells, toggled if the cell was left playing by a
+	// previous hit
+	toggle, toggled bool
+}
+
+// releasedVoices are the voices to stop and release events to publish once the lock is
+// released
+type releasedVoices struct {
+	ownerID string
+	voices  []routedVoice
+	toggled []string
+}
+
+// noteOn starts a voice for every cell that responds to the note
+func (r *PadRouter) noteOn(channel, key, velocity uint8) {
+	r.mu.Lock()
+	p, ownerID := r.preset, r.ownerID
+	voices := r.cellVoices(channel, key, velocity)
+	r.mu.Unlock()
+
+	note := heldNote{channel: channel, key: key}
+	vel := float32(velocity) / 127
+
+	for _, v := range voices {
+		// A second hit on a toggled cell stops it
+		if v.toggled && r.audioMgr.IsVoicePlaying(v.key) {
+			r.audioMgr.StopVoice(v.key)
+			r.mu.Lock()
+			delete(r.toggled, v.key)
+			r.mu.Unlock()
+			r.publishPad(ownerID, events.PadGridReleaseEvent, v.row, v.col, 0)
+			continue
+		}
+
+		if err := r.audioMgr.PlayVoice(v.key, v.path, v.opts); err != nil {
+			log.Debug("MIDI note could not play cell", zap.String("path", v.path), zap.Error(err))
+			continue
+		}
+
+		r.mu.Lock()
+		current := r.preset == p && r.ownerID == ownerID
+		if current {
+			if v.toggle {
+				r.toggled[v.key] = true
+			}
+			r.held[note] = append(r.held[note], v.routedVoice)
+		}
+		r.mu.Unlock()
+
+		// The preset changed while the voice started, it was already released
+		if !current {
+			r.audioMgr.StopVoice(v.key)
+			continue
+		}
+		r.publishPad(ownerID, events.PadGridTriggerEvent, v.row, v.col, vel)
+	}
+}
+
+// cellVoices returns the voices a note starts, one for every cell that responds to it.
+// Chromatic cells on all channels only respond if no pad cell does. Must be called with
+// r.mu held.
+func (r *PadRouter) cellVoices(channel, key, velocity uint8) []cellVoice {
+	if r.preset == nil || r.preset.BitboxConfig() == nil || r.preset.BitboxConfig().Session == nil {
+		return nil
+	}
+
+	vel := float32(velocity) / 127
+
+	// fallback holds the voices of chromatic cells on all channels, played if no pad
+	// matches the note
+	var voices, fallback []cellVoice
+	padMatched := false
+	for _, cell := range r.preset.BitboxConfig().Session.Cells {
+		params, ok := cell.Params.(*bitbox.SampleParams)
+		if !ok || cell.Row == nil || cell.Column == nil || cell.Filename == "" {
+			continue
+		}
+		if params.MidiOutChan > 0 && params.MidiOutChan-1 != int(channel) {
+			continue
+		}
+
+		row, col := *cell.Row, *cell.Column
+		ratio := 1.0
+		voiceKey := fmt.Sprintf("midi:%d_%d", row, col)
+		anyChannel := false
+
+		switch params.MidiMode {
+		case midiModeChromatic:
+			ratio = math.Pow(2, float64(int(key)-rootNoteBase-params.RootNote)/12)
+			voiceKey = fmt.Sprintf("%s:%d", voiceKey, key)
+			anyChannel = params.MidiOutChan == 0
+		default:
+			if padNote(params, row, col) != int(key) {
+				continue
+			}
+			padMatched = true
+		}
+
+		path, err := r.preset.ResolveFile(cell.Filename)
+		if err != nil {
+			log.Warn("Could not resolve file for MIDI note", zap.String("file", cell.Filename), zap.Error(err))
+			continue
+		}
+
+		loop := audio.LoopSettings{
+			Start:   params.LoopStart,
+			End:     params.LoopEnd,
+			Mode:    params.LoopMode,
+			FadeAmt: params.LoopFadeAmt,
+		}
+
+		endSample := 0
+		if params.SamLen > 0 {
+			endSample = params.SamStart + params.SamLen
+		}
+
+		toggle := params.SamTrigType == trigTypeToggle
+		voice := cellVoice{
+			routedVoice: routedVoice{
+				key: voiceKey,
+				row: row,
+				col: col,
+				// Toggled voices play until hit again
+				sustain: !toggle && (params.SamTrigType == trigTypeGate || params.MidiMode == midiModeChromatic || loop.Valid()),
+			},
+			path: path,
+			opts: audio.VoiceOptions{
+				Gain:        velocityGain(vel) * math.Pow(10, float64(params.GainDB)/1000/20),
+				Ratio:       ratio,
+				StartSample: params.SamStart,
+				EndSample:   endSample,
+				Loop:        loop,
+			},
+			toggle:  toggle,
+			toggled: toggle && r.toggled[voiceKey],
+		}
+		if anyChannel {
+			fallback = append(fallback, voice)
+		} else {
+			voices = append(voices, voice)
+		}
+	}
+
+	if !padMatched {
+		voices = append(voices, fallback...)
+	}
+	return voices
+}
+
+// noteOff releases the voices started by a note. Sustained voices stop, one shots keep
+// playing to the end of the sample.
+func (r *PadRouter) noteOff(channel, key uint8) {
+	note := heldNote{channel: channel, key: key}
+
+	r.mu.Lock()
+	voices, ownerID := r.held[note], r.ownerID
+	delete(r.held, note)
+	r.mu.Unlock()
+
+	for _, v := range voices {
+		if v.sustain {
+			r.audioMgr.StopVoice(v.key)
+		}
+		r.publishPad(ownerID, events.PadGridReleaseEvent, v.row, v.col, 0)
+	}
+}
+
+// takeAll removes every routed voice so it can be released once the lock is released.
+// Must be called with r.mu held.
+func (r *PadRouter) takeAll() releasedVoices {
+	released := releasedVoices{ownerID: r.ownerID}
+	for note, voices := range r.held {
+		released.voices = append(released.voices, voices...)
+		delete(r.held, note)
+	}
+	for key := range r.toggled {
+		released.toggled = append(released.toggled, key)
+		delete(r.toggled, key)
+	}
+	return released
+}
+
+// release stops the voices taken by takeAll
+func (r *PadRouter) release(released releasedVoices) {
+	for _, v := range released.voices {
+		r.audioMgr.StopVoice(v.key)
+		r.publishPad(released.ownerID, events.PadGridReleaseEvent, v.row, v.col, 0)
+	}
+	for _, key := range released.toggled {
+		r.audioMgr.StopVoice(key)
+	}
+}
+
+func (r *PadRouter) publishPad(ownerID string, eventType events.PadGridEvent, row, col int, velocity float32) {
+	if ownerID == "" {
+		return
+	}
+
+	r.appBus.Publish(events.PadGridEventRecord{
+		EventType: eventType,
+		Row:       row,
+		Col:       col,
+		Velocity:  velocity,
+		OwnerID:   ownerID,
+	})
+}
+
+// padNote returns the note that plays a cell in pad mode. Cells without a pad note use
+// the default layout, counting up from the top left pad.
+func padNote(params *bitbox.SampleParams, row, col int) int {
+	if params.PadNote != bitbox.NoPadNote {
+		return params.PadNote
+	}
+	return defaultPadNoteBase + row*defaultPadCols + col
+}
+
+// velocityGain maps a velocity from 0.0 to 1.0 to a linear gain. The square gives soft
+// hits a usable range without making full velocity louder than the sample.
+func velocityGain(velocity float32) float64 {
+	v := float64(velocity)
+	return v * v
+}
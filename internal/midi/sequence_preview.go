@@ -0,0 +1,131 @@
+package midi
+
+import (
+	"bitbox-editor/internal/app/eventbus"
+	"bitbox-editor/internal/app/events"
+	"bitbox-editor/internal/parsing/bitbox"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SequencePreview plays a note sequence by publishing playback events, which the open
+// output port sends on to the Bitbox or another synth
+type SequencePreview struct {
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// sequenceEvent is a playback event at a sequencer tick
+type sequenceEvent struct {
+	tick   int
+	off    bool
+	record events.MidiPlaybackEventRecord
+}
+
+// SequenceChannel returns the channel (0-15) a sequence plays on. The output channel of
+// params counts from 1, and 0 means the sequence plays on any channel, for which
+// channel 1 is used.
+func SequenceChannel(params *bitbox.NoteseqParams) int {
+	if params.MidiOutChan < 1 || params.MidiOutChan > 16 {
+		return 0
+	}
+	return params.MidiOutChan - 1
+}
+
+// PlaySequence starts publishing the notes of seq to bus at bpm, on the channel of params.
+// The preview stops by itself at the end of the last step.
+func PlaySequence(bus *eventbus.EventBus, seq *bitbox.NoteSequence, params *bitbox.NoteseqParams, bpm float64, ownerID string) *SequencePreview {
+	if bpm <= 0 {
+		bpm = defaultExportTempo
+	}
+	channel := SequenceChannel(params)
+
+	var timeline []sequenceEvent
+	if seq != nil {
+		for _, n := range seq.Notes() {
+			timeline = append(timeline,
+				sequenceEvent{tick: n.Pos, record: events.MidiPlaybackEventRecord{
+					EventType: events.MidiPlaybackNoteOnEvent,
+					Note:      n.Value,
+					Velocity:  n.Velocity,
+					Channel:   channel,
+					OwnerID:   ownerID,
+				}},
+				sequenceEvent{tick: n.Pos + max(1, n.Length), off: true, record: events.MidiPlaybackEventRecord{
+					EventType: events.MidiPlaybackNoteOffEvent,
+					Note:      n.Value,
+					Channel:   channel,
+					OwnerID:   ownerID,
+				}},
+			)
+		}
+	}
+
+	// Note offs go first so back to back notes on the same key retrigger
+	sort.SliceStable(timeline, func(i, j int) bool {
+		if timeline[i].tick != timeline[j].tick {
+			return timeline[i].tick < timeline[j].tick
+		}
+		return timeline[i].off && !timeline[j].off
+	})
+
+	end := params.Steps() * params.StepTicks()
+	if len(timeline) > 0 {
+		end = max(end, timeline[len(timeline)-1].tick)
+	}
+
+	p := &SequencePreview{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	tick := time.Duration(float64(time.Minute) / bpm / bitbox.SeqTicksPerQuarter)
+	go p.run(bus, timeline, end, tick, ownerID)
+
+	return p
+}
+
+// Stop ends the preview, silencing the notes it left playing
+func (p *SequencePreview) Stop() {
+	p.stopOnce.Do(func() { close(p.stop) })
+	<-p.done
+}
+
+// IsPlaying returns true until the preview has ended or was stopped
+func (p *SequencePreview) IsPlaying() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (p *SequencePreview) run(bus *eventbus.EventBus, timeline []sequenceEvent, end int, tick time.Duration, ownerID string) {
+	defer close(p.done)
+	defer bus.Publish(events.MidiPlaybackEventRecord{EventType: events.MidiPlaybackStoppedEvent, OwnerID: ownerID})
+
+	bus.Publish(events.MidiPlaybackEventRecord{EventType: events.MidiPlaybackStartedEvent, OwnerID: ownerID})
+
+	start := time.Now()
+	wait := func(at int) bool {
+		timer := time.NewTimer(time.Until(start.Add(time.Duration(at) * tick)))
+		defer timer.Stop()
+
+		select {
+		case <-p.stop:
+			return false
+		case <-timer.C:
+			return true
+		}
+	}
+
+	for _, ev := range timeline {
+		if !wait(ev.tick) {
+			return
+		}
+		bus.Publish(ev.record)
+	}
+	wait(end)
+}
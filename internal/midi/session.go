@@ -0,0 +1,192 @@
+package midi
+
+import (
+	"bitbox-editor/internal/app/events"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// sessionVersion is the version of the recorded session format
+const sessionVersion = 1
+
+// SessionExt is the file extension of recorded sessions
+const SessionExt = ".bbmidi"
+
+// Session is a recording of the messages received on an input port. Sessions are stored
+// as JSON with the raw bytes of each message in hex, e.g.
+//
+//	{"version": 1, "port": "Bitbox", "events": [{"t": 0, "data": "903c64"}]}
+type Session struct {
+	Version int            `json:"version"`
+	Port    string         `json:"port"`
+	Events  []SessionEvent `json:"events"`
+}
+
+// SessionEvent is a single message of a session. Time is in milliseconds from the start
+// of the recording.
+type SessionEvent struct {
+	Time int32  `json:"t"`
+	Data string `json:"data"`
+}
+
+// Message returns the MIDI message of the event
+func (e SessionEvent) Message() (midi.Message, error) {
+	data, err := hex.DecodeString(e.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session event data '%s': %w", e.Data, err)
+	}
+	return midi.Message(data), nil
+}
+
+// sessionRecorder captures incoming messages into a session
+type sessionRecorder struct {
+	mu      sync.Mutex
+	session *Session
+	start   time.Time
+}
+
+// StartRecording starts capturing the messages received on the input port
+func (m *MidiManager) StartRecording() {
+	m.recorder.Store(&sessionRecorder{
+		session: &Session{Version: sessionVersion, Port: m.InputPort()},
+		start:   time.Now(),
+	})
+}
+
+// StopRecording stops capturing and returns the recorded session, or nil if no session
+// was being recorded
+func (m *MidiManager) StopRecording() *Session {
+	recorder := m.recorder.Swap(nil)
+	if recorder == nil {
+		return nil
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	return recorder.session
+}
+
+// IsRecording returns true while a session is being recorded
+func (m *MidiManager) IsRecording() bool {
+	return m.recorder.Load() != nil
+}
+
+// recordMessage adds a message to the session being recorded. Times are taken from the
+// wall clock rather than the driver timestamp so sessions from different drivers line up.
+func (m *MidiManager) recordMessage(msg midi.Message) {
+	recorder := m.recorder.Load()
+	if recorder == nil {
+		return
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	recorder.session.Events = append(recorder.session.Events, SessionEvent{
+		Time: int32(time.Since(recorder.start).Milliseconds()),
+		Data: hex.EncodeToString(msg.Bytes()),
+	})
+}
+
+// ReplaySession feeds a recorded session into the event bus as if it was received on the
+// session's port. Messages are parsed and published in order with their recorded
+// timestamps. Without realtime the replay runs as fast as listeners take the events:
+// each event waits until every listener has room for it, so nothing is dropped and a
+// replay always produces the same events. With realtime the replay waits between
+// messages as long as they were apart when recorded and, like live input, a listener
+// that falls behind misses events. Closing stop ends a replay early.
+func (m *MidiManager) ReplaySession(session *Session, realtime bool, stop <-chan struct{}) error {
+	port := session.Port
+	if port == "" {
+		port = "Session"
+	}
+
+	start := time.Now()
+	for i, event := range session.Events {
+		msg, err := event.Message()
+		if err != nil {
+			return fmt.Errorf("event %d: %w", i, err)
+		}
+
+		record, ok := m.parseMessage(msg, event.Time, port).(events.MidiEventRecord)
+
+		if !realtime {
+			if !ok {
+				continue
+			}
+			// Stamp the recorded time so the clock is measured as it was played
+			record.Received = start.Add(time.Duration(event.Time) * time.Millisecond)
+			m.notifyClock(record)
+			if !m.bus.PublishWait(record, stop) {
+				return nil
+			}
+			continue
+		}
+
+		wait := time.Until(start.Add(time.Duration(event.Time) * time.Millisecond))
+		if wait > 0 {
+			select {
+			case <-stop:
+				return nil
+			case <-time.After(wait):
+			}
+		}
+
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		if ok {
+			record.Received = time.Now()
+			m.notifyClock(record)
+			m.bus.Publish(record)
+		}
+	}
+
+	return nil
+}
+
+// SaveSession writes a session to a file
+func SaveSession(path string, session *Session) error {
+	if !strings.HasSuffix(path, SessionExt) {
+		path += SessionExt
+	}
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode MIDI session: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write MIDI session '%s': %w", path, err)
+	}
+
+	return nil
+}
+
+// LoadSession reads a session from a file
+func LoadSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MIDI session '%s': %w", path, err)
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to decode MIDI session '%s': %w", path, err)
+	}
+	if session.Version > sessionVersion {
+		return nil, fmt.Errorf("MIDI session '%s' has unsupported version %d", path, session.Version)
+	}
+
+	return &session, nil
+}
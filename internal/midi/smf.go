@@ -0,0 +1,275 @@
+package midi
+
+import (
+	"bitbox-editor/internal/parsing/bitbox"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/smf"
+	"go.uber.org/zap"
+)
+
+// defaultExportTempo is written to exported files when the preset has no tempo
+const defaultExportTempo = 120.0
+
+// SMFTrack describes a track of a standard MIDI file, used to pick what to import
+type SMFTrack struct {
+	Index    int
+	Name     string
+	Channels []int
+	Notes    int
+}
+
+// SMFImportOptions selects the notes taken from a standard MIDI file
+type SMFImportOptions struct {
+	// Track is the track index to import, or -1 for every track
+	Track int
+	// Channel is the channel to import from 0-15, or -1 for every channel
+	Channel int
+}
+
+// smfNote is a note read from a standard MIDI file, times are in file ticks
+type smfNote struct {
+	track    int
+	channel  int
+	key      int
+	velocity int
+	start    int64
+	end      int64
+}
+
+// ReadSMFTracks lists the tracks of a type 0 or type 1 standard MIDI file
+func ReadSMFTracks(path string) ([]SMFTrack, error) {
+	file, err := readSMF(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks := make([]SMFTrack, len(file.Tracks))
+	for i, track := range file.Tracks {
+		tracks[i] = SMFTrack{Index: i, Name: fmt.Sprintf("Track %d", i+1)}
+
+		for _, ev := range track {
+			var name string
+			var channel, key, velocity uint8
+
+			switch {
+			case ev.Message.GetMetaTrackName(&name):
+				if name != "" {
+					tracks[i].Name = name
+				}
+			case ev.Message.GetNoteStart(&channel, &key, &velocity):
+				tracks[i].Notes++
+				if !slices.Contains(tracks[i].Channels, int(channel)) {
+					tracks[i].Channels = append(tracks[i].Channels, int(channel))
+				}
+			}
+		}
+		sort.Ints(tracks[i].Channels)
+	}
+
+	return tracks, nil
+}
+
+// ImportSMF reads the notes of a standard MIDI file into a note sequence. Notes are
+// quantized to the step length of params, and notes starting after the last step are dropped.
+func ImportSMF(path string, params *bitbox.NoteseqParams, opts SMFImportOptions) (*bitbox.NoteSequence, error) {
+	file, err := readSMF(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ppq, ok := file.TimeFormat.(smf.MetricTicks)
+	if !ok {
+		return nil, fmt.Errorf("MIDI file '%s' uses SMPTE timing, only metric timing is supported", path)
+	}
+
+	notes := collectNotes(file, opts)
+
+	fileStepTicks := float64(ppq.Resolution()) * params.StepQuarters()
+	stepTicks := params.StepTicks()
+	steps := params.Steps()
+
+	// One event per step and key, the loudest note wins
+	type slot struct{ step, key int }
+	events := make(map[slot]bitbox.SeqEvent)
+	dropped := 0
+
+	for _, n := range notes {
+		step := int(math.Round(float64(n.start) / fileStepTicks))
+		if step >= steps {
+			dropped++
+			continue
+		}
+
+		length := int(math.Round(float64(n.end-n.start) / fileStepTicks))
+		length = max(1, min(length, steps-step))
+
+		s := slot{step: step, key: n.key}
+		if existing, exists := events[s]; exists && existing.Velocity >= n.velocity {
+			continue
+		}
+
+		events[s] = bitbox.SeqEvent{
+			Pos:      step * stepTicks,
+			Type:     bitbox.SeqEventNote,
+			Value:    n.key,
+			Length:   length * stepTicks,
+			Velocity: n.velocity,
+		}
+	}
+
+	seq := &bitbox.NoteSequence{Events: make([]bitbox.SeqEvent, 0, len(events))}
+	for _, e := range events {
+		seq.Events = append(seq.Events, e)
+	}
+	sort.Slice(seq.Events, func(i, j int) bool {
+		a, b := seq.Events[i], seq.Events[j]
+		if a.Pos != b.Pos {
+			return a.Pos < b.Pos
+		}
+		return a.Value < b.Value
+	})
+
+	if dropped > 0 {
+		log.Info("Dropped MIDI notes past the end of the sequence",
+			zap.String("path", path),
+			zap.Int("dropped", dropped),
+			zap.Int("steps", steps))
+	}
+
+	return seq, nil
+}
+
+// ExportSMF writes a note sequence to a type 0 standard MIDI file. Notes are sent on the
+// output channel of params, or channel 1 if the sequence plays on any channel.
+func ExportSMF(path string, seq *bitbox.NoteSequence, params *bitbox.NoteseqParams, name string, bpm float64) error {
+	if bpm <= 0 {
+		bpm = defaultExportTempo
+	}
+
+	channel := uint8(SequenceChannel(params))
+
+	type timedMessage struct {
+		tick int64
+		off  bool
+		msg  []byte
+	}
+	var messages []timedMessage
+
+	if seq != nil {
+		for _, n := range seq.Notes() {
+			key := clamp7(n.Value)
+			messages = append(messages,
+				timedMessage{tick: int64(n.Pos), msg: midi.NoteOn(channel, key, clamp7(n.Velocity))},
+				timedMessage{tick: int64(n.Pos + max(1, n.Length)), off: true, msg: midi.NoteOff(channel, key)},
+			)
+		}
+	}
+
+	// Note offs go first so back to back notes on the same key retrigger
+	sort.SliceStable(messages, func(i, j int) bool {
+		if messages[i].tick != messages[j].tick {
+			return messages[i].tick < messages[j].tick
+		}
+		return messages[i].off && !messages[j].off
+	})
+
+	var track smf.Track
+	if name != "" {
+		track.Add(0, smf.MetaTrackSequenceName(name))
+	}
+	track.Add(0, smf.MetaMeter(4, 4))
+	track.Add(0, smf.MetaTempo(bpm))
+
+	var last int64
+	for _, m := range messages {
+		track.Add(uint32(m.tick-last), m.msg)
+		last = m.tick
+	}
+
+	// End the track on the last step so the pattern loops at the right length in a DAW
+	end := int64(params.Steps() * params.StepTicks())
+	track.Close(uint32(max(0, end-last)))
+
+	file := smf.New()
+	file.TimeFormat = smf.MetricTicks(bitbox.SeqTicksPerQuarter)
+	if err := file.Add(track); err != nil {
+		return fmt.Errorf("failed to build MIDI file: %w", err)
+	}
+
+	if err := file.WriteFile(path); err != nil {
+		return fmt.Errorf("failed to write MIDI file '%s': %w", path, err)
+	}
+
+	return nil
+}
+
+func readSMF(path string) (*smf.SMF, error) {
+	file, err := smf.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MIDI file '%s': %w", path, err)
+	}
+	if file.Format() > 1 {
+		return nil, fmt.Errorf("MIDI file '%s' is type %d, only type 0 and 1 are supported", path, file.Format())
+	}
+	return file, nil
+}
+
+// collectNotes pairs note starts and ends of the selected tracks and channels. Notes that
+// are never released end with their track.
+func collectNotes(file *smf.SMF, opts SMFImportOptions) []smfNote {
+	var notes []smfNote
+
+	for ti, track := range file.Tracks {
+		if opts.Track >= 0 && opts.Track != ti {
+			continue
+		}
+
+		type held struct{ channel, key int }
+		open := make(map[held][]smfNote)
+		var tick int64
+
+		for _, ev := range track {
+			tick += int64(ev.Delta)
+
+			var channel, key, velocity uint8
+			switch {
+			case ev.Message.GetNoteStart(&channel, &key, &velocity):
+				if opts.Channel >= 0 && int(channel) != opts.Channel {
+					continue
+				}
+				h := held{int(channel), int(key)}
+				open[h] = append(open[h], smfNote{
+					track:    ti,
+					channel:  int(channel),
+					key:      int(key),
+					velocity: int(velocity),
+					start:    tick,
+				})
+
+			case ev.Message.GetNoteEnd(&channel, &key):
+				h := held{int(channel), int(key)}
+				if len(open[h]) == 0 {
+					continue
+				}
+				n := open[h][0]
+				open[h] = open[h][1:]
+				n.end = tick
+				notes = append(notes, n)
+			}
+		}
+
+		for _, pending := range open {
+			for _, n := range pending {
+				n.end = tick
+				notes = append(notes, n)
+			}
+		}
+	}
+
+	return notes
+}
@@ -1,5 +1,32 @@
 package bitbox
 
+// SeqTicksPerQuarter is the resolution of event positions and lengths in a note sequence
+const SeqTicksPerQuarter = 96
+
+// SeqEventNote is the type of note events in a sequence
+const SeqEventNote = "note"
+
 type NoteSequence struct {
-	// TODO: noteseq params
+	Events []SeqEvent `xml:"seqevent"`
+}
+
+// SeqEvent is a single event of a note sequence. Pos and Length are in sequencer ticks,
+// see SeqTicksPerQuarter.
+type SeqEvent struct {
+	Pos      int    `xml:"pos,attr"`
+	Type     string `xml:"type,attr"`
+	Value    int    `xml:"value,attr"`
+	Length   int    `xml:"length,attr"`
+	Velocity int    `xml:"velocity,attr"`
+}
+
+// Notes returns the note events of the sequence
+func (s *NoteSequence) Notes() []SeqEvent {
+	var notes []SeqEvent
+	for _, e := range s.Events {
+		if e.Type == SeqEventNote {
+			notes = append(notes, e)
+		}
+	}
+	return notes
 }
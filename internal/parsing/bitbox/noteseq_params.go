@@ -1,5 +1,18 @@
 package bitbox
 
+import "math"
+
+// NoteStepLengths are the step lengths selected by NoteStepLen, in quarter notes
+// (1/64, 1/32, 1/16, 1/8, 1/4, 1/2 and a bar)
+var NoteStepLengths = []float64{1.0 / 16, 1.0 / 8, 1.0 / 4, 1.0 / 2, 1, 2, 4}
+
+const (
+	// DefaultNoteStepCount is used when a sequence has no step count set
+	DefaultNoteStepCount = 16
+	// defaultNoteStepQuarters is a 1/16 step, used when NoteStepLen is out of range
+	defaultNoteStepQuarters = 1.0 / 4
+)
+
 type NoteseqParams struct {
 	NoteStepLen   int `xml:"notesteplen,attr,omitempty"`
 	NoteStepCount int `xml:"notestepcount,attr,omitempty"`
@@ -10,3 +23,24 @@ type NoteseqParams struct {
 	DispMode      int `xml:"dispmode,attr,omitempty"`
 	SeqPlayEnable int `xml:"seqplayenable,attr,omitempty"`
 }
+
+// StepQuarters returns the length of one step in quarter notes
+func (p *NoteseqParams) StepQuarters() float64 {
+	if p.NoteStepLen < 0 || p.NoteStepLen >= len(NoteStepLengths) {
+		return defaultNoteStepQuarters
+	}
+	return NoteStepLengths[p.NoteStepLen]
+}
+
+// StepTicks returns the length of one step in sequencer ticks
+func (p *NoteseqParams) StepTicks() int {
+	return max(1, int(math.Round(p.StepQuarters()*SeqTicksPerQuarter)))
+}
+
+// Steps returns the number of steps in the sequence
+func (p *NoteseqParams) Steps() int {
+	if p.NoteStepCount <= 0 {
+		return DefaultNoteStepCount
+	}
+	return p.NoteStepCount
+}
@@ -7,7 +7,7 @@ type ParamSet map[string]string
 func newParamsForType(cellType string) (any, error) {
 	switch cellType {
 	case "sample":
-		return &SampleParams{}, nil
+		return &SampleParams{PadNote: NoPadNote}, nil
 	case "samtempl":
 		return &SamTemplateParams{}, nil
 	case "delay":
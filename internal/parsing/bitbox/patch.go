@@ -0,0 +1,266 @@
+package bitbox
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// Patch is a set of changes to the cells of a preset.xml. Applying it rewrites only the
+// tags it changes and copies the rest of the file as it is, so attributes, elements and
+// formatting the model doesn't know about survive a save.
+//
+// Cells are counted in the order they appear in the session, the same order as
+// Session.Cells.
+type Patch struct {
+	cellAttrs  map[int][]xml.Attr
+	paramAttrs map[int][]xml.Attr
+	sequences  map[int]*NoteSequence
+}
+
+func NewPatch() *Patch {
+	return &Patch{
+		cellAttrs:  make(map[int][]xml.Attr),
+		paramAttrs: make(map[int][]xml.Attr),
+		sequences:  make(map[int]*NoteSequence),
+	}
+}
+
+// SetCellAttr sets an attribute of a cell, e.g. its filename
+func (p *Patch) SetCellAttr(cell int, name, value string) *Patch {
+	p.cellAttrs[cell] = setAttr(p.cellAttrs[cell], name, value)
+	return p
+}
+
+// SetParam sets an attribute of a cell's params
+func (p *Patch) SetParam(cell int, name string, value int) *Patch {
+	p.paramAttrs[cell] = setAttr(p.paramAttrs[cell], name, strconv.Itoa(value))
+	return p
+}
+
+// SetSequence replaces the note sequence of a cell, nil removes it
+func (p *Patch) SetSequence(cell int, seq *NoteSequence) *Patch {
+	p.sequences[cell] = seq
+	return p
+}
+
+// Empty returns true if the patch changes nothing
+func (p *Patch) Empty() bool {
+	return len(p.cellAttrs) == 0 && len(p.paramAttrs) == 0 && len(p.sequences) == 0
+}
+
+// Apply returns the preset.xml data with the patch applied
+func (p *Patch) Apply(data []byte) ([]byte, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	var (
+		out   bytes.Buffer
+		last  int
+		stack []string
+		cell  = -1
+		// seqStart is where the sequence being replaced starts, -1 outside of one
+		seqStart = -1
+		// seqDone marks the cells whose sequence was written
+		seqDone = make(map[int]bool)
+		// paramsDone marks the cells whose params were written
+		paramsDone = make(map[int]bool)
+	)
+
+	// replace copies the data up to from, writes text in place of data[from:to]
+	replace := func(from, to int, text []byte) {
+		out.Write(data[last:from])
+		out.Write(text)
+		last = to
+	}
+
+	inSession := func() bool {
+		return len(stack) == 2 && stack[0] == "document" && stack[1] == "session"
+	}
+	inCell := func() bool {
+		return len(stack) == 3 && stack[0] == "document" && stack[1] == "session" && stack[2] == "cell"
+	}
+
+	for {
+		from := int(dec.InputOffset())
+		tok, err := dec.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse preset: %w", err)
+		}
+		to := int(dec.InputOffset())
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			selfClosing := bytes.HasSuffix(data[from:to], []byte("/>"))
+
+			switch {
+			case t.Name.Local == "cell" && inSession():
+				cell++
+				attrs := t.Attr
+				for _, a := range p.cellAttrs[cell] {
+					attrs = setAttr(attrs, a.Name.Local, a.Value)
+				}
+				seq, addSeq := p.sequences[cell]
+				switch {
+				case selfClosing && addSeq && seq != nil:
+					// A sequence can't go in an empty tag, it is opened and closed around it
+					text := startTag(t.Name, attrs, false)
+					seqXML, err := encodeSequence(seq)
+					if err != nil {
+						return nil, err
+					}
+					text = append(text, seqXML...)
+					text = append(text, "</"+qualifiedName(t.Name)+">"...)
+					replace(from, to, text)
+					seqDone[cell] = true
+				case len(p.cellAttrs[cell]) > 0:
+					replace(from, to, startTag(t.Name, attrs, selfClosing))
+				}
+
+			case t.Name.Local == "params" && inCell():
+				if changes := p.paramAttrs[cell]; len(changes) > 0 {
+					attrs := t.Attr
+					for _, a := range changes {
+						attrs = setAttr(attrs, a.Name.Local, a.Value)
+					}
+					replace(from, to, startTag(t.Name, attrs, selfClosing))
+					paramsDone[cell] = true
+				}
+
+			case t.Name.Local == "sequence" && inCell():
+				if _, ok := p.sequences[cell]; ok {
+					seqStart = from
+				}
+			}
+
+			// Self closing tags are followed by a matching end element with no text
+			stack = append(stack, t.Name.Local)
+
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, errors.New("failed to parse preset: unbalanced tags")
+			}
+			stack = stack[:len(stack)-1]
+
+			switch {
+			case t.Name.Local == "sequence" && inCell() && seqStart >= 0:
+				seqXML, err := encodeSequence(p.sequences[cell])
+				if err != nil {
+					return nil, err
+				}
+				replace(seqStart, to, seqXML)
+				seqStart = -1
+				seqDone[cell] = true
+
+			case t.Name.Local == "cell" && inSession():
+				if seq, ok := p.sequences[cell]; ok && seq != nil && !seqDone[cell] {
+					seqXML, err := encodeSequence(seq)
+					if err != nil {
+						return nil, err
+					}
+					replace(from, from, seqXML)
+					seqDone[cell] = true
+				}
+			}
+		}
+	}
+
+	// A change that matched nothing would otherwise look like a successful save
+	for i := range p.cellAttrs {
+		if i < 0 || i > cell {
+			return nil, fmt.Errorf("preset has no cell %d", i)
+		}
+	}
+	for i := range p.sequences {
+		if i < 0 || i > cell {
+			return nil, fmt.Errorf("preset has no cell %d", i)
+		}
+	}
+	for i := range p.paramAttrs {
+		if !paramsDone[i] {
+			return nil, fmt.Errorf("preset has no params for cell %d", i)
+		}
+	}
+
+	out.Write(data[last:])
+	return out.Bytes(), nil
+}
+
+// PatchFile applies a patch to a preset.xml. The file is written to a temporary file
+// first so a failed write never leaves a truncated preset on the card.
+func PatchFile(path string, patch *Patch) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+
+	patched, err := patch.Apply(data)
+	if err != nil {
+		return fmt.Errorf("failed to update '%s': %w", path, err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, patched, 0644); err != nil {
+		return fmt.Errorf("failed to write '%s': %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to replace '%s': %w", path, err)
+	}
+	return nil
+}
+
+// setAttr sets an attribute in place, adding it at the end if it is missing
+func setAttr(attrs []xml.Attr, name, value string) []xml.Attr {
+	for i, a := range attrs {
+		if a.Name.Space == "" && a.Name.Local == name {
+			attrs[i].Value = value
+			return attrs
+		}
+	}
+	return append(attrs, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+}
+
+// qualifiedName writes a raw name with its prefix
+func qualifiedName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+// startTag writes a start tag from raw tokens
+func startTag(name xml.Name, attrs []xml.Attr, selfClosing bool) []byte {
+	var b bytes.Buffer
+	b.WriteString("<" + qualifiedName(name))
+	for _, a := range attrs {
+		b.WriteString(" " + qualifiedName(a.Name) + `="`)
+		_ = xml.EscapeText(&b, []byte(a.Value))
+		b.WriteString(`"`)
+	}
+	if selfClosing {
+		b.WriteString("/>")
+	} else {
+		b.WriteString(">")
+	}
+	return b.Bytes()
+}
+
+// encodeSequence writes a sequence element, nothing for nil
+func encodeSequence(seq *NoteSequence) ([]byte, error) {
+	if seq == nil {
+		return nil, nil
+	}
+	var b bytes.Buffer
+	enc := xml.NewEncoder(&b)
+	if err := enc.EncodeElement(seq, xml.StartElement{Name: xml.Name{Local: "sequence"}}); err != nil {
+		return nil, fmt.Errorf("failed to encode sequence: %w", err)
+	}
+	return b.Bytes(), nil
+}
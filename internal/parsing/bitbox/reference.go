@@ -0,0 +1,52 @@
+package bitbox
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Reference is the file a cell filename points at
+type Reference struct {
+	// Dir is the folder the filename was found relative to
+	Dir string
+	// Path is the file
+	Path string
+}
+
+// NormalizeReference cleans up a cell filename the way the Bitbox reads it. The Bitbox
+// writes backslashes and paths from the root of the card, the result uses forward slashes
+// without a leading slash, or is empty if the cell has no file.
+func NormalizeReference(filename string) string {
+	ref := strings.TrimSpace(filename)
+	ref = strings.Trim(ref, `"'`)
+	ref = strings.ReplaceAll(ref, `\`, "/")
+	ref = strings.TrimLeft(ref, "/")
+	if ref == "" {
+		return ""
+	}
+	return path.Clean(ref)
+}
+
+// ResolveReference finds the file a cell filename points at. It is looked up in the
+// preset folder first and then in each parent up to root, files outside of root are never
+// found. exists tells whether a candidate path is a file the caller can use.
+func ResolveReference(root, presetDir, filename string, exists func(path string) bool) (Reference, bool) {
+	ref := NormalizeReference(filename)
+	if ref == "" {
+		return Reference{}, false
+	}
+
+	root = filepath.Clean(root)
+	dir := filepath.Clean(presetDir)
+	for {
+		candidate := filepath.Join(dir, filepath.FromSlash(ref))
+		if rel, err := filepath.Rel(root, candidate); err == nil && filepath.IsLocal(rel) && exists(candidate) {
+			return Reference{Dir: dir, Path: candidate}, true
+		}
+		if dir == root || filepath.Dir(dir) == dir {
+			return Reference{}, false
+		}
+		dir = filepath.Dir(dir)
+	}
+}
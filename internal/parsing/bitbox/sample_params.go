@@ -1,5 +1,9 @@
 package bitbox
 
+// NoPadNote is the PadNote of a cell whose preset doesn't set one, so a pad note of 0 can
+// be told apart from a missing one
+const NoPadNote = -1
+
 type SampleParams struct {
 	GainDB          int `xml:"gaindb,attr,omitempty"`
 	Pitch           int `xml:"pitch,attr,omitempty"`
@@ -70,38 +70,92 @@ func (p *Preset) resolveWavFiles() {
 	}
 }
 
-func (p *Preset) Wavs() []*audio.WaveFile {
-	return p.wavs
+// Tempo returns the global tempo from the preset's song cell, or 0 if it is not known
+func (p *Preset) Tempo() float64 {
+	if p.bitboxConfig == nil || p.bitboxConfig.Session == nil {
+		return 0
+	}
+
+	for _, cell := range p.bitboxConfig.Session.Cells {
+		if params, ok := cell.Params.(*bitbox.SongParams); ok && params.GlobTempo > 0 {
+			return float64(params.GlobTempo)
+		}
+	}
+
+	return 0
 }
 
-func (p *Preset) ResolveFile(inputPath string) (string, error) {
-	dir, err := filepath.Abs(p.Path)
-	if err != nil {
-		return "", errors.New(fmt.Sprintf("Base path %s does not exist.", p.Path))
+// CellAt returns the cell at a pad position, or nil if there is none
+func (p *Preset) CellAt(row, col int) *bitbox.Cell {
+	if p.bitboxConfig == nil || p.bitboxConfig.Session == nil {
+		return nil
 	}
 
-	fixedPath := strings.TrimSpace(inputPath)
-	fixedPath = strings.Trim(fixedPath, `"'`)
+	for i, cell := range p.bitboxConfig.Session.Cells {
+		if cell.Row != nil && *cell.Row == row && cell.Column != nil && *cell.Column == col {
+			return &p.bitboxConfig.Session.Cells[i]
+		}
+	}
 
-	fixedPath = strings.ReplaceAll(fixedPath, "\\", "/")
-	fixedPath = strings.TrimLeft(fixedPath, "/")
+	return nil
+}
 
-	rel := filepath.FromSlash(fixedPath)
+// CellIndex returns the position of a cell in the session, the way a bitbox.Patch
+// counts cells, or -1 if the cell is not part of this preset
+func (p *Preset) CellIndex(cell *bitbox.Cell) int {
+	if p.bitboxConfig == nil || p.bitboxConfig.Session == nil {
+		return -1
+	}
 
-	for {
-		candidate := filepath.Join(dir, rel)
-		if _, err := os.Stat(candidate); err == nil {
-			return candidate, nil
+	for i := range p.bitboxConfig.Session.Cells {
+		if &p.bitboxConfig.Session.Cells[i] == cell {
+			return i
 		}
+	}
 
-		parent := filepath.Dir(dir)
-		if parent == dir {
-			break
-		}
-		dir = parent
+	return -1
+}
+
+// Save applies a patch to preset.xml. Only what the patch changes is rewritten, the rest
+// of the file stays as the Bitbox wrote it.
+func (p *Preset) Save(patch *bitbox.Patch) error {
+	if p.bitboxConfig == nil {
+		return errors.New(fmt.Sprintf("no bitbox config loaded for preset %s", p.Name))
+	}
+	if patch.Empty() {
+		return nil
+	}
+
+	path := filepath.Join(p.Path, "preset.xml")
+	if err := bitbox.PatchFile(path, patch); err != nil {
+		return errors.New(fmt.Sprintf("failed to save bitbox preset %s - %s", p.Name, err))
 	}
 
-	return "", os.ErrNotExist
+	log.Info("saved preset", zap.String("path", path))
+	return nil
+}
+
+func (p *Preset) Wavs() []*audio.WaveFile {
+	return p.wavs
+}
+
+// ResolveFile finds the file a cell filename points at, looking in the preset folder
+// first and then in each of its parents
+func (p *Preset) ResolveFile(inputPath string) (string, error) {
+	dir, err := filepath.Abs(p.Path)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Base path %s does not exist.", p.Path))
+	}
+
+	root := filepath.VolumeName(dir) + string(filepath.Separator)
+	ref, ok := bitbox.ResolveReference(root, dir, inputPath, func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	})
+	if !ok {
+		return "", os.ErrNotExist
+	}
+	return ref.Path, nil
 }
 
 func (p *Preset) loadAbletonConfig(path string) error {